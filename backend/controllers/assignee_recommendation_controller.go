@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Weights used to rank candidate assignees. A higher score means a better fit.
+const (
+	recommendationBaseScore       = 100.0
+	recommendationOpenTaskPenalty = 5.0
+	recommendationOverduePenalty  = 15.0
+	recommendationUpcomingPenalty = 8.0
+	recommendationOnTimeWeight    = 0.3  // applied to the on-time rate (0-100)
+	recommendationNeutralOnTime   = 50.0 // assumed rate when the user has no history
+	recommendationAbsencePenalty  = 1000.0
+)
+
+// AssigneeRecommendation describes how suitable a user is for a task
+type AssigneeRecommendation struct {
+	User              models.User `json:"user"`
+	Score             float64     `json:"score"`
+	OpenTasks         int         `json:"open_tasks"`
+	OverdueTasks      int         `json:"overdue_tasks"`
+	UpcomingDeadlines int         `json:"upcoming_deadlines"`
+	CompletedSameType int         `json:"completed_same_type"`
+	OnTimeRate        *float64    `json:"on_time_rate"` // nil when the user has no comparable history
+	IsAbsent          bool        `json:"is_absent"`
+	AbsentUntil       *time.Time  `json:"absent_until,omitempty"`
+}
+
+// assignableRoles returns the roles a user with the given role may hand tasks to
+func assignableRoles(role string) []string {
+	switch role {
+	case models.RoleTeamLeader:
+		return []string{models.RoleDeputy, models.RoleOfficer}
+	case models.RoleDeputy:
+		return []string{models.RoleOfficer}
+	}
+	return nil
+}
+
+// rankAssignees scores the candidates by workload, punctuality on the same document
+// type and absence, best candidate first. documentTypeID is nil for independent tasks.
+func rankAssignees(candidates []models.User, documentTypeID *uint) ([]AssigneeRecommendation, error) {
+	if len(candidates) == 0 {
+		return []AssigneeRecommendation{}, nil
+	}
+
+	candidateIDs := make([]uint, len(candidates))
+	for i, candidate := range candidates {
+		candidateIDs[i] = candidate.ID
+	}
+
+	var tasks []models.Task
+	if err := database.DB.Preload("AssignedTo").Preload("IncomingDocument").
+		Where("assigned_to_id IN (?)", candidateIDs).Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var absences []models.UserAbsence
+	if err := database.DB.Where("user_id IN (?) AND start_date <= ? AND end_date >= ?", candidateIDs, now, now).
+		Find(&absences).Error; err != nil {
+		return nil, err
+	}
+	absentUntil := make(map[uint]time.Time)
+	for _, absence := range absences {
+		if until, ok := absentUntil[absence.UserID]; !ok || absence.EndDate.After(until) {
+			absentUntil[absence.UserID] = absence.EndDate
+		}
+	}
+
+	// Reuse the dashboard per-user statistics for the workload part
+	performance := collectUserPerformance(tasks)
+
+	// Punctuality on comparable tasks: same document type, or independent tasks
+	completedSameType := make(map[uint]int)
+	onTimeSameType := make(map[uint]int)
+	for _, task := range tasks {
+		if task.Status != models.StatusCompleted || task.Deadline == nil || task.CompletionDate == nil {
+			continue
+		}
+		if documentTypeID != nil {
+			if task.IncomingDocument == nil || task.IncomingDocument.DocumentTypeID != *documentTypeID {
+				continue
+			}
+		} else if task.IncomingDocumentID != nil {
+			continue
+		}
+		assigneeID := *task.AssignedToID
+		completedSameType[assigneeID]++
+		if !task.CompletionDate.After(*task.Deadline) {
+			onTimeSameType[assigneeID]++
+		}
+	}
+
+	recommendations := make([]AssigneeRecommendation, 0, len(candidates))
+	for _, candidate := range candidates {
+		rec := AssigneeRecommendation{User: candidate}
+
+		if stats, ok := performance[candidate.ID]; ok {
+			rec.OpenTasks = stats.TotalTasks - stats.CompletedTasks
+			rec.OverdueTasks = stats.OverdueTasks
+			rec.UpcomingDeadlines = stats.UpcomingTasks
+		}
+
+		onTime := recommendationNeutralOnTime
+		if completed := completedSameType[candidate.ID]; completed > 0 {
+			rate := float64(onTimeSameType[candidate.ID]) / float64(completed) * 100
+			rec.OnTimeRate = &rate
+			rec.CompletedSameType = completed
+			onTime = rate
+		}
+
+		rec.Score = recommendationBaseScore -
+			float64(rec.OpenTasks)*recommendationOpenTaskPenalty -
+			float64(rec.OverdueTasks)*recommendationOverduePenalty -
+			float64(rec.UpcomingDeadlines)*recommendationUpcomingPenalty +
+			onTime*recommendationOnTimeWeight
+
+		if until, ok := absentUntil[candidate.ID]; ok {
+			rec.IsAbsent = true
+			rec.AbsentUntil = &until
+			rec.Score -= recommendationAbsencePenalty
+		}
+
+		recommendations = append(recommendations, rec)
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		if recommendations[i].Score != recommendations[j].Score {
+			return recommendations[i].Score > recommendations[j].Score
+		}
+		return recommendations[i].OpenTasks < recommendations[j].OpenTasks
+	})
+
+	return recommendations, nil
+}
+
+// recommendAssigneesForTask ranks the users the requester may hand the task to
+func recommendAssigneesForTask(task *models.Task, requesterID uint, requesterRole string) ([]AssigneeRecommendation, error) {
+	roles := assignableRoles(requesterRole)
+	if len(roles) == 0 {
+		return []AssigneeRecommendation{}, nil
+	}
+
+	query := database.DB.Where("role IN (?) AND is_active = ? AND id <> ?", roles, true, requesterID)
+	if task.AssignedToID != nil {
+		query = query.Where("id <> ?", *task.AssignedToID)
+	}
+
+	var candidates []models.User
+	if err := query.Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	var documentTypeID *uint
+	if task.IncomingDocumentID != nil {
+		var document models.IncomingDocument
+		if err := database.DB.First(&document, *task.IncomingDocumentID).Error; err == nil {
+			documentTypeID = &document.DocumentTypeID
+		}
+	}
+
+	return rankAssignees(candidates, documentTypeID)
+}
+
+// GetAssigneeRecommendations ranks eligible users for a task by current workload
+func GetAssigneeRecommendations(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	var task models.Task
+	if !requireVisibleTask(c, &task, uint(id)) {
+		return
+	}
+
+	recommendations, err := recommendAssigneesForTask(&task, userID.(uint), userRole.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tính toán đề xuất người xử lý"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":         task.ID,
+		"recommendations": recommendations,
+	})
+}
+
+// AutoAssignTask assigns the task to the best ranked user who is not absent
+func AutoAssignTask(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	var task models.Task
+	if !requireVisibleTask(c, &task, uint(id)) {
+		return
+	}
+
+	if task.Status == models.StatusCompleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không thể gán công việc đã hoàn thành"})
+		return
+	}
+
+	recommendations, err := recommendAssigneesForTask(&task, userID.(uint), userRole.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tính toán đề xuất người xử lý"})
+		return
+	}
+
+	var selected *AssigneeRecommendation
+	for i := range recommendations {
+		if !recommendations[i].IsAbsent {
+			selected = &recommendations[i]
+			break
+		}
+	}
+	if selected == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Không có người xử lý phù hợp đang làm việc"})
+		return
+	}
+
+	notes := fmt.Sprintf("Tự động gán cho %s theo khối lượng công việc (điểm %.1f)", selected.User.Name, selected.Score)
+	if err := assignTask(&task, selected.User.ID, userID.(uint), notes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể gán công việc"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task":           task,
+		"recommendation": selected,
+		"message":        fmt.Sprintf("Đã tự động gán công việc cho %s", selected.User.Name),
+	})
+}
@@ -0,0 +1,543 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"ai-code-agent-backend/services"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// maxBulkItems limits how many items a single bulk request may touch
+const maxBulkItems = 200
+
+type BulkTaskAssignRequest struct {
+	TaskIDs      []uint `json:"task_ids" binding:"required"`
+	AssignedTo   uint   `json:"assigned_to" binding:"required"`
+	Notes        string `json:"notes"`
+	AllOrNothing bool   `json:"all_or_nothing"`
+}
+
+type BulkTaskForwardRequest struct {
+	TaskIDs      []uint `json:"task_ids" binding:"required"`
+	AssignedTo   uint   `json:"assigned_to" binding:"required"`
+	Comment      string `json:"comment"`
+	AllOrNothing bool   `json:"all_or_nothing"`
+}
+
+type BulkTaskStatusRequest struct {
+	TaskIDs      []uint `json:"task_ids" binding:"required"`
+	Status       string `json:"status" binding:"required"`
+	Notes        string `json:"notes"`
+	AllOrNothing bool   `json:"all_or_nothing"`
+}
+
+type BulkAssignProcessorRequest struct {
+	DocumentIDs  []uint `json:"document_ids" binding:"required"`
+	ProcessorID  uint   `json:"processor_id" binding:"required"`
+	AllOrNothing bool   `json:"all_or_nothing"`
+}
+
+type BulkDeleteRequest struct {
+	IDs          []uint `json:"ids" binding:"required"`
+	AllOrNothing bool   `json:"all_or_nothing"`
+}
+
+// BulkItemResult is the outcome of a bulk operation for one item
+type BulkItemResult struct {
+	ID      uint   `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BulkResponse summarises a bulk operation
+type BulkResponse struct {
+	Total      int              `json:"total"`
+	Succeeded  int              `json:"succeeded"`
+	Failed     int              `json:"failed"`
+	RolledBack bool             `json:"rolled_back"`
+	Results    []BulkItemResult `json:"results"`
+}
+
+// bulkItemOutcome carries what a successfully applied item needs after the commit
+type bulkItemOutcome struct {
+	OldValues   interface{}
+	NewValues   interface{}
+	AfterCommit func()
+}
+
+// bulkOperation describes one kind of bulk change and how to apply it to a single item
+type bulkOperation struct {
+	Action      models.AuditAction
+	EntityType  models.AuditEntityType
+	Description string
+	Apply       func(tx *gorm.DB, id uint) (*bulkItemOutcome, error)
+}
+
+// runBulk applies op to every id inside one transaction, isolating each item with a
+// savepoint so a failing item does not affect the others. With allOrNothing set, any
+// failure rolls back the whole batch. Every item gets its own audit log entry.
+// When the transaction itself fails, so that the results of the items could not be
+// trusted, the whole batch is abandoned with a 500 and runBulk returns false.
+func runBulk(c *gin.Context, ids []uint, allOrNothing bool, op bulkOperation) (BulkResponse, bool) {
+	ids = uniqueIDs(ids)
+	response := BulkResponse{Total: len(ids), Results: make([]BulkItemResult, len(ids))}
+	outcomes := make([]*bulkItemOutcome, len(ids))
+
+	tx := database.DB.Begin()
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể thực hiện thao tác hàng loạt"})
+		return response, false
+	}
+	abort := func() (BulkResponse, bool) {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể thực hiện thao tác hàng loạt"})
+		return response, false
+	}
+	for i, id := range ids {
+		response.Results[i] = BulkItemResult{ID: id}
+
+		if err := tx.Exec("SAVEPOINT bulk_item").Error; err != nil {
+			return abort()
+		}
+
+		outcome, err := op.Apply(tx, id)
+		if err != nil {
+			// Without the rollback the transaction stays aborted and every later item would fail
+			if err := tx.Exec("ROLLBACK TO SAVEPOINT bulk_item").Error; err != nil {
+				return abort()
+			}
+			if opErr, ok := err.(*operationError); ok {
+				response.Results[i].Error = opErr.Message
+			} else {
+				response.Results[i].Error = "Không thể xử lý mục này"
+			}
+			continue
+		}
+
+		if err := tx.Exec("RELEASE SAVEPOINT bulk_item").Error; err != nil {
+			return abort()
+		}
+		if outcome == nil {
+			outcome = &bulkItemOutcome{}
+		}
+		outcomes[i] = outcome
+		response.Results[i].Success = true
+	}
+
+	failed := 0
+	for _, result := range response.Results {
+		if !result.Success {
+			failed++
+		}
+	}
+
+	if allOrNothing && failed > 0 {
+		tx.Rollback()
+		response.RolledBack = true
+	} else if err := tx.Commit().Error; err != nil {
+		response.RolledBack = true
+	}
+
+	if response.RolledBack {
+		for i := range response.Results {
+			if response.Results[i].Success {
+				response.Results[i].Success = false
+				response.Results[i].Error = "Đã hoàn tác do thao tác hàng loạt không thành công"
+				outcomes[i] = nil
+			}
+		}
+	}
+
+	auditService := services.NewAuditService()
+	metadata := map[string]interface{}{
+		"bulk":           true,
+		"batch_size":     len(ids),
+		"all_or_nothing": allOrNothing,
+	}
+	for i, result := range response.Results {
+		if result.Success {
+			response.Succeeded++
+			if outcomes[i].AfterCommit != nil {
+				outcomes[i].AfterCommit()
+			}
+			auditService.LogActivity(c, op.Action, op.EntityType, result.ID, op.Description, outcomes[i].OldValues, outcomes[i].NewValues, metadata)
+		} else {
+			response.Failed++
+			auditService.LogFailedActivity(c, op.Action, op.EntityType, result.ID, op.Description, result.Error, metadata)
+		}
+	}
+
+	return response, true
+}
+
+// uniqueIDs drops duplicate and zero ids while keeping the original order
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
+}
+
+// validateBulkIDs rejects empty or oversized batches
+func validateBulkIDs(c *gin.Context, ids []uint) bool {
+	if len(uniqueIDs(ids)) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Danh sách ID không được để trống"})
+		return false
+	}
+	if len(ids) > maxBulkItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Chỉ được xử lý tối đa %d mục mỗi lần", maxBulkItems)})
+		return false
+	}
+	return true
+}
+
+// findTaskForBulk loads a task inside the bulk transaction, as requireVisibleTask would: within the
+// user's view of tasks, and with an incoming document they are cleared for
+func findTaskForBulk(tx *gorm.DB, id, userID uint, userRole string) (*models.Task, error) {
+	var task models.Task
+	if err := services.ScopeVisibleTasks(tx, userID, userRole).First(&task, id).Error; err != nil {
+		return nil, &operationError{http.StatusNotFound, "Không tìm thấy công việc"}
+	}
+	if task.IncomingDocumentID != nil {
+		var document models.IncomingDocument
+		if err := tx.First(&document, *task.IncomingDocumentID).Error; err == nil && !services.CanAccessIncomingDocument(tx, &document, userID) {
+			return nil, &operationError{http.StatusNotFound, "Không tìm thấy công việc"}
+		}
+	}
+	return &task, nil
+}
+
+// BulkAssignTasks assigns several tasks to the same user
+func BulkAssignTasks(c *gin.Context) {
+	var req BulkTaskAssignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+	if !validateBulkIDs(c, req.TaskIDs) {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	var assignee models.User
+	if err := database.DB.Where("id = ? AND is_active = ?", req.AssignedTo, true).First(&assignee).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Người được giao không tồn tại"})
+		return
+	}
+
+	response, ok := runBulk(c, req.TaskIDs, req.AllOrNothing, bulkOperation{
+		Action:      models.AuditActionTaskAssign,
+		EntityType:  models.AuditEntityTask,
+		Description: "Gán công việc hàng loạt cho " + assignee.Name,
+		Apply: func(tx *gorm.DB, id uint) (*bulkItemOutcome, error) {
+			task, err := findTaskForBulk(tx, id, userID.(uint), userRole.(string))
+			if err != nil {
+				return nil, err
+			}
+			if task.Status == models.StatusCompleted {
+				return nil, &operationError{http.StatusBadRequest, "Không thể gán công việc đã hoàn thành"}
+			}
+
+			old := gin.H{"assigned_to_id": task.AssignedToID, "status": task.Status}
+			if err := assignTaskTx(tx, task, assignee.ID, userID.(uint), req.Notes); err != nil {
+				return nil, err
+			}
+			return &bulkItemOutcome{
+				OldValues: old,
+				NewValues: gin.H{"assigned_to_id": task.AssignedToID, "status": task.Status},
+			}, nil
+		},
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// BulkForwardTasks forwards several tasks to the same user
+func BulkForwardTasks(c *gin.Context) {
+	var req BulkTaskForwardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+	if !validateBulkIDs(c, req.TaskIDs) {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	var assignee models.User
+	if err := database.DB.Where("id = ? AND is_active = ?", req.AssignedTo, true).First(&assignee).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Người được giao không tồn tại"})
+		return
+	}
+
+	response, ok := runBulk(c, req.TaskIDs, req.AllOrNothing, bulkOperation{
+		Action:      models.AuditActionTaskForward,
+		EntityType:  models.AuditEntityTask,
+		Description: "Chuyển tiếp công việc hàng loạt cho " + assignee.Name,
+		Apply: func(tx *gorm.DB, id uint) (*bulkItemOutcome, error) {
+			task, err := findTaskForBulk(tx, id, userID.(uint), userRole.(string))
+			if err != nil {
+				return nil, err
+			}
+			if task.Status == models.StatusCompleted {
+				return nil, &operationError{http.StatusBadRequest, "Không thể chuyển tiếp công việc đã hoàn thành"}
+			}
+
+			old := gin.H{"assigned_to_id": task.AssignedToID}
+			if err := forwardTaskTx(tx, task, assignee.ID, userID.(uint), req.Comment); err != nil {
+				return nil, err
+			}
+			return &bulkItemOutcome{
+				OldValues: old,
+				NewValues: gin.H{"assigned_to_id": task.AssignedToID},
+			}, nil
+		},
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// BulkUpdateTaskStatus moves several tasks to the same status using the usual transition rules
+func BulkUpdateTaskStatus(c *gin.Context) {
+	var req BulkTaskStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+	if !validateBulkIDs(c, req.TaskIDs) {
+		return
+	}
+	if !models.IsValidTaskStatus(req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Trạng thái không hợp lệ"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	action := models.AuditActionTaskUpdate
+	if req.Status == models.StatusCompleted {
+		action = models.AuditActionTaskComplete
+	}
+
+	response, ok := runBulk(c, req.TaskIDs, req.AllOrNothing, bulkOperation{
+		Action:      action,
+		EntityType:  models.AuditEntityTask,
+		Description: "Cập nhật trạng thái hàng loạt: " + req.Status,
+		Apply: func(tx *gorm.DB, id uint) (*bulkItemOutcome, error) {
+			task, err := findTaskForBulk(tx, id, userID.(uint), userRole.(string))
+			if err != nil {
+				return nil, err
+			}
+
+			// Bulk changes follow the allowed transitions, unlike the single-task endpoint
+			if !task.CanTransitionTo(req.Status) {
+				return nil, &operationError{http.StatusBadRequest, fmt.Sprintf("Không thể chuyển trạng thái từ \"%s\" sang \"%s\"", task.Status, req.Status)}
+			}
+
+			old := gin.H{"status": task.Status}
+			if err := changeTaskStatusTx(tx, task, req.Status, userID.(uint), req.Notes); err != nil {
+				return nil, err
+			}
+			return &bulkItemOutcome{
+				OldValues: old,
+				NewValues: gin.H{"status": task.Status},
+			}, nil
+		},
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// BulkDeleteTasks deletes several tasks, applying the same rules as a single deletion
+func BulkDeleteTasks(c *gin.Context) {
+	var req BulkDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+	if !validateBulkIDs(c, req.IDs) {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	response, ok := runBulk(c, req.IDs, req.AllOrNothing, bulkOperation{
+		Action:      models.AuditActionTaskDelete,
+		EntityType:  models.AuditEntityTask,
+		Description: "Xóa công việc hàng loạt",
+		Apply: func(tx *gorm.DB, id uint) (*bulkItemOutcome, error) {
+			task, err := findTaskForBulk(tx, id, userID.(uint), userRole.(string))
+			if err != nil {
+				return nil, err
+			}
+
+			if err := deleteTaskTx(tx, task, userID.(uint), userRole.(string)); err != nil {
+				return nil, err
+			}
+			return &bulkItemOutcome{
+				OldValues: gin.H{"description": task.Description, "status": task.Status},
+			}, nil
+		},
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// BulkAssignProcessor assigns the same processor to several incoming documents
+func BulkAssignProcessor(c *gin.Context) {
+	var req BulkAssignProcessorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+	if !validateBulkIDs(c, req.DocumentIDs) {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	response, ok := runBulk(c, req.DocumentIDs, req.AllOrNothing, bulkOperation{
+		Action:      models.AuditActionDocumentAssign,
+		EntityType:  models.AuditEntityIncomingDocument,
+		Description: "Gán người xử lý văn bản đến hàng loạt",
+		Apply: func(tx *gorm.DB, id uint) (*bulkItemOutcome, error) {
+			var document models.IncomingDocument
+			if err := tx.First(&document, id).Error; err != nil {
+				return nil, &operationError{http.StatusNotFound, "Không tìm thấy văn bản đến"}
+			}
+			if !services.CanAccessIncomingDocument(tx, &document, userID.(uint)) {
+				return nil, &operationError{http.StatusNotFound, "Không tìm thấy văn bản đến"}
+			}
+
+			old := gin.H{"processor_id": document.ProcessorID, "status": document.Status}
+			if err := assignProcessorTx(tx, &document, req.ProcessorID, userID.(uint)); err != nil {
+				return nil, err
+			}
+			return &bulkItemOutcome{
+				OldValues: old,
+				NewValues: gin.H{"processor_id": document.ProcessorID, "status": document.Status},
+			}, nil
+		},
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// BulkDeleteIncomingDocuments deletes several incoming documents and their files
+func BulkDeleteIncomingDocuments(c *gin.Context) {
+	var req BulkDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+	if !validateBulkIDs(c, req.IDs) {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	response, ok := runBulk(c, req.IDs, req.AllOrNothing, bulkOperation{
+		Action:      models.AuditActionDocumentDelete,
+		EntityType:  models.AuditEntityIncomingDocument,
+		Description: "Xóa văn bản đến hàng loạt",
+		Apply: func(tx *gorm.DB, id uint) (*bulkItemOutcome, error) {
+			var document models.IncomingDocument
+			if err := tx.First(&document, id).Error; err != nil {
+				return nil, &operationError{http.StatusNotFound, "Không tìm thấy văn bản đến"}
+			}
+			if !services.CanAccessIncomingDocument(tx, &document, userID.(uint)) {
+				return nil, &operationError{http.StatusNotFound, "Không tìm thấy văn bản đến"}
+			}
+
+			filePaths, err := deleteIncomingDocumentTx(tx, &document, userRole.(string))
+			if err != nil {
+				return nil, err
+			}
+			return &bulkItemOutcome{
+				OldValues:   gin.H{"arrival_number": document.ArrivalNumber, "summary": document.Summary},
+				AfterCommit: func() { removeStoredFiles(filePaths) },
+			}, nil
+		},
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// BulkDeleteOutgoingDocuments deletes several outgoing documents that are not yet approved or sent
+func BulkDeleteOutgoingDocuments(c *gin.Context) {
+	var req BulkDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+	if !validateBulkIDs(c, req.IDs) {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	response, ok := runBulk(c, req.IDs, req.AllOrNothing, bulkOperation{
+		Action:      models.AuditActionDocumentDelete,
+		EntityType:  models.AuditEntityOutgoingDocument,
+		Description: "Xóa văn bản đi hàng loạt",
+		Apply: func(tx *gorm.DB, id uint) (*bulkItemOutcome, error) {
+			var document models.OutgoingDocument
+			if err := tx.First(&document, id).Error; err != nil {
+				return nil, &operationError{http.StatusNotFound, "Không tìm thấy văn bản đi"}
+			}
+			if !services.CanAccessOutgoingDocument(tx, &document, userID.(uint)) {
+				return nil, &operationError{http.StatusNotFound, "Không tìm thấy văn bản đi"}
+			}
+
+			if err := deleteOutgoingDocumentTx(tx, &document, userRole.(string)); err != nil {
+				return nil, err
+			}
+			filePath := document.FilePath
+			return &bulkItemOutcome{
+				OldValues:   gin.H{"document_number": document.DocumentNumber, "summary": document.Summary},
+				AfterCommit: func() { removeStoredFiles([]string{filePath}) },
+			}, nil
+		},
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
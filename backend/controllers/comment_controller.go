@@ -3,16 +3,168 @@ package controllers
 import (
 	"ai-code-agent-backend/database"
 	"ai-code-agent-backend/models"
+	"ai-code-agent-backend/services"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 )
 
+// commentAttachmentType is the FileService document type of files attached to comments
+const commentAttachmentType = "comment"
+
 type CreateCommentRequest struct {
+	Content  string `json:"content" binding:"required"`
+	ParentID *uint  `json:"parent_id"` // Comment being replied to
+}
+
+type UpdateCommentRequest struct {
 	Content string `json:"content" binding:"required"`
 }
 
+// CommentWithAttachments is a comment together with the files attached to it
+type CommentWithAttachments struct {
+	models.Comment
+	Attachments []services.FileInfo `json:"attachments"`
+}
+
+// syncCommentMentionsTx makes the stored mentions match the @usernames in the comment and
+// returns the users that were not mentioned before
+func syncCommentMentionsTx(db *gorm.DB, comment *models.Comment) ([]uint, error) {
+	var mentionedIDs []uint
+	if usernames := models.ParseMentions(comment.Content); len(usernames) > 0 {
+		if err := db.Model(&models.User{}).Where("username IN (?) AND is_active = ? AND id <> ?", usernames, true, comment.UserID).
+			Pluck("id", &mentionedIDs).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var existingIDs []uint
+	if err := db.Model(&models.CommentMention{}).Where("comment_id = ?", comment.ID).Pluck("user_id", &existingIDs).Error; err != nil {
+		return nil, err
+	}
+
+	stillMentioned := make(map[uint]bool, len(mentionedIDs))
+	for _, id := range mentionedIDs {
+		stillMentioned[id] = true
+	}
+	alreadyMentioned := make(map[uint]bool, len(existingIDs))
+	for _, id := range existingIDs {
+		alreadyMentioned[id] = true
+		if !stillMentioned[id] {
+			if err := db.Where("comment_id = ? AND user_id = ?", comment.ID, id).Delete(&models.CommentMention{}).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var added []uint
+	for _, id := range mentionedIDs {
+		if alreadyMentioned[id] {
+			continue
+		}
+		mention := models.CommentMention{CommentID: comment.ID, UserID: id}
+		if err := db.Create(&mention).Error; err != nil {
+			return nil, err
+		}
+		added = append(added, id)
+	}
+	return added, nil
+}
+
+// notifyCommentMentionsTx tells newly mentioned users where they were mentioned
+func notifyCommentMentionsTx(db *gorm.DB, comment *models.Comment, task *models.Task, userIDs []uint) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	var author models.User
+	db.First(&author, comment.UserID)
+	message := fmt.Sprintf("%s đã nhắc đến bạn trong bình luận về công việc %s", author.Name, taskLabel(task))
+	return notifyUsersTx(db, userIDs, models.WatchEntityTask, task.ID, comment.UserID, models.NotificationEventMention, message)
+}
+
+// commentAttachments returns the files attached to the given comments, keyed by comment ID
+func commentAttachments(commentIDs []uint) map[uint][]services.FileInfo {
+	attachments := make(map[uint][]services.FileInfo)
+	if len(commentIDs) == 0 {
+		return attachments
+	}
+
+	var files []services.FileInfo
+	database.DB.Table("files").
+		Where("document_type = ? AND document_id IN (?) AND deleted_at IS NULL", commentAttachmentType, commentIDs).
+		Order("uploaded_at asc").Find(&files)
+	for _, file := range files {
+		attachments[file.DocumentID] = append(attachments[file.DocumentID], file)
+	}
+	return attachments
+}
+
+// withAttachments pairs the comments with their attachments; placeholders of deleted comments have none
+func withAttachments(comments []models.Comment) []CommentWithAttachments {
+	ids := make([]uint, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+	attachments := commentAttachments(ids)
+
+	result := make([]CommentWithAttachments, len(comments))
+	for i, comment := range comments {
+		files := attachments[comment.ID]
+		if files == nil || comment.IsDeleted {
+			files = []services.FileInfo{}
+		}
+		result[i] = CommentWithAttachments{Comment: comment, Attachments: files}
+	}
+	return result
+}
+
+// loadComment loads the comment from the route, on a task the user may see
+func loadComment(c *gin.Context) (*models.Comment, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return nil, false
+	}
+
+	var comment models.Comment
+	if err := database.DB.First(&comment, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy bình luận"})
+		return nil, false
+	}
+	var task models.Task
+	if !requireVisibleTask(c, &task, comment.TaskID) {
+		return nil, false
+	}
+
+	return &comment, true
+}
+
+// loadOwnComment loads the comment from the route and checks the current user wrote it
+func loadOwnComment(c *gin.Context) (*models.Comment, bool) {
+	comment, ok := loadComment(c)
+	if !ok {
+		return nil, false
+	}
+
+	userID, _ := c.Get("user_id")
+
+	if comment.Kind == models.CommentKindSystem {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không thể thay đổi bình luận hệ thống"})
+		return nil, false
+	}
+	if comment.UserID != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Chỉ người viết mới có thể thay đổi bình luận"})
+		return nil, false
+	}
+
+	return comment, true
+}
+
 func CreateComment(c *gin.Context) {
 	taskID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -21,30 +173,76 @@ func CreateComment(c *gin.Context) {
 	}
 
 	var req CreateCommentRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Content) == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
 		return
 	}
 
 	userID, _ := c.Get("user_id")
 
+	var task models.Task
+	if !requireVisibleTask(c, &task, uint(taskID)) {
+		return
+	}
+
 	comment := models.Comment{
-		TaskID:  uint(taskID),
+		TaskID:  task.ID,
 		UserID:  userID.(uint),
-		Content: req.Content,
+		Content: strings.TrimSpace(req.Content),
+		Kind:    models.CommentKindUser,
 	}
 
-	if err := database.DB.Create(&comment).Error; err != nil {
+	if req.ParentID != nil {
+		var parent models.Comment
+		if err := database.DB.Where("task_id = ?", task.ID).First(&parent, *req.ParentID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Không tìm thấy bình luận được trả lời"})
+			return
+		}
+		// Threads are one level deep: a reply to a reply joins the original thread
+		if parent.ParentID != nil {
+			comment.ParentID = parent.ParentID
+		} else {
+			comment.ParentID = &parent.ID
+		}
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Create(&comment).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo bình luận"})
+		return
+	}
+
+	mentioned, err := syncCommentMentionsTx(tx, &comment)
+	if err == nil {
+		err = notifyCommentMentionsTx(tx, &comment, &task, mentioned)
+	}
+	if err == nil {
+		err = notifyTaskWatchersTx(tx, task.ID, comment.UserID, models.NotificationEventComment, func(task *models.Task) string {
+			var author models.User
+			tx.First(&author, comment.UserID)
+			return fmt.Sprintf("%s đã bình luận về công việc %s", author.Name, taskLabel(task))
+		})
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo bình luận"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo bình luận"})
 		return
 	}
 
 	// Load user relation
-	database.DB.Preload("User").First(&comment, comment.ID)
+	database.DB.Preload("User").Preload("Mentions.User").First(&comment, comment.ID)
 
-	c.JSON(http.StatusCreated, comment)
+	c.JSON(http.StatusCreated, CommentWithAttachments{Comment: comment, Attachments: []services.FileInfo{}})
 }
 
+// GetTaskComments returns the comments of a task in posting order; replies carry parent_id.
+// Pass kind=user or kind=system to only get human comments or system events.
 func GetTaskComments(c *gin.Context) {
 	taskID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -52,11 +250,194 @@ func GetTaskComments(c *gin.Context) {
 		return
 	}
 
+	var task models.Task
+	if !requireVisibleTask(c, &task, uint(taskID)) {
+		return
+	}
+
+	query := database.DB.Unscoped().Preload("User").Preload("Mentions.User").Where("task_id = ?", taskID)
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
 	var comments []models.Comment
-	if err := database.DB.Preload("User").Where("task_id = ?", taskID).Order("created_at asc").Find(&comments).Error; err != nil {
+	if err := query.Order("created_at asc").Find(&comments).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách bình luận"})
 		return
 	}
 
-	c.JSON(http.StatusOK, comments)
+	// Deleted comments are left out, except as placeholders for threads that still have replies
+	hasReplies := make(map[uint]bool)
+	for _, comment := range comments {
+		if comment.ParentID != nil && comment.DeletedAt == nil {
+			hasReplies[*comment.ParentID] = true
+		}
+	}
+	visible := make([]models.Comment, 0, len(comments))
+	for _, comment := range comments {
+		if comment.DeletedAt != nil {
+			if !hasReplies[comment.ID] {
+				continue
+			}
+			comment.Content = ""
+			comment.Mentions = nil
+			comment.IsDeleted = true
+		}
+		visible = append(visible, comment)
+	}
+
+	c.JSON(http.StatusOK, withAttachments(visible))
+}
+
+// UpdateComment changes the content of the current user's comment, keeping the previous
+// content as a revision
+func UpdateComment(c *gin.Context) {
+	comment, ok := loadOwnComment(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Content) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+	content := strings.TrimSpace(req.Content)
+
+	if content != comment.Content {
+		var task models.Task
+		database.DB.First(&task, comment.TaskID)
+
+		tx := database.DB.Begin()
+		revision := models.CommentRevision{
+			CommentID:  comment.ID,
+			Content:    comment.Content,
+			EditedByID: comment.UserID,
+		}
+		err := tx.Create(&revision).Error
+		if err == nil {
+			err = tx.Model(comment).Updates(map[string]interface{}{
+				"content":   content,
+				"is_edited": true,
+				"edited_at": time.Now(),
+			}).Error
+		}
+		var mentioned []uint
+		if err == nil {
+			mentioned, err = syncCommentMentionsTx(tx, comment)
+		}
+		if err == nil {
+			err = notifyCommentMentionsTx(tx, comment, &task, mentioned)
+		}
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật bình luận"})
+			return
+		}
+		if err := tx.Commit().Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật bình luận"})
+			return
+		}
+	}
+
+	database.DB.Preload("User").Preload("Mentions.User").First(comment, comment.ID)
+
+	c.JSON(http.StatusOK, withAttachments([]models.Comment{*comment})[0])
+}
+
+// DeleteComment soft deletes a comment and its attachments. Authors may delete their own comments; admins may
+// delete any comment, including system ones.
+func DeleteComment(c *gin.Context) {
+	comment, ok := loadComment(c)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	if userRole.(string) != models.RoleAdmin {
+		if comment.Kind == models.CommentKindSystem || comment.UserID != userID.(uint) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền xóa bình luận này"})
+			return
+		}
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Model(comment).UpdateColumn("deleted_by_id", userID.(uint)).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa bình luận"})
+		return
+	}
+	if err := tx.Delete(comment).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa bình luận"})
+		return
+	}
+	if err := tx.Exec("UPDATE files SET deleted_at = NOW() WHERE document_type = ? AND document_id = ? AND deleted_at IS NULL",
+		commentAttachmentType, comment.ID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa bình luận"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa bình luận"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Xóa bình luận thành công"})
+}
+
+// GetCommentRevisions returns the earlier versions of an edited comment, oldest first
+func GetCommentRevisions(c *gin.Context) {
+	comment, ok := loadComment(c)
+	if !ok {
+		return
+	}
+
+	var revisions []models.CommentRevision
+	if err := database.DB.Preload("EditedBy").Where("comment_id = ?", comment.ID).Order("created_at asc").Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy lịch sử chỉnh sửa"})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// UploadCommentAttachment attaches a file to the current user's comment
+func UploadCommentAttachment(c *gin.Context) {
+	comment, ok := loadOwnComment(c)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không thể đọc file"})
+		return
+	}
+	defer file.Close()
+
+	config := services.DocumentUploadConfig
+	if strings.Contains(header.Header.Get("Content-Type"), "image/") {
+		config = services.ImageUploadConfig
+	}
+	if !contains(config.AllowedRoles, userRole.(string)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền upload file"})
+		return
+	}
+
+	fileInfo, err := services.NewFileService().UploadFile(file, header, config, userID.(uint), commentAttachmentType, comment.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Đính kèm file thành công",
+		"file":    fileInfo,
+	})
 }
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// versionETag formats a record version as an ETag value
+func versionETag(version uint) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// respondWithETag sets the ETag of a record and answers 304 when the client already has
+// this version. It returns false when the response has been written.
+func respondWithETag(c *gin.Context, version uint) bool {
+	etag := versionETag(version)
+	c.Header("ETag", etag)
+	if match := c.GetHeader("If-None-Match"); match != "" && strings.TrimPrefix(match, "W/") == etag {
+		c.Status(http.StatusNotModified)
+		return false
+	}
+	return true
+}
+
+// expectedVersion returns the version the client based its changes on, taken from the
+// If-Match header or else from the version sent in the body. It is nil when neither was
+// sent; such updates are applied without a version check.
+func expectedVersion(c *gin.Context, bodyVersion *uint) (*uint, error) {
+	if match := strings.TrimSpace(c.GetHeader("If-Match")); match != "" && match != "*" {
+		value := strings.Trim(strings.TrimPrefix(match, "W/"), "\"")
+		parsed, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		version := uint(parsed)
+		return &version, nil
+	}
+	return bodyVersion, nil
+}
+
+// respondVersionConflict rejects a stale update, returning the current record so the client can merge
+func respondVersionConflict(c *gin.Context, current interface{}, version uint) {
+	c.Header("ETag", versionETag(version))
+	c.JSON(http.StatusConflict, gin.H{
+		"error":   "Dữ liệu đã được người khác cập nhật. Vui lòng xem lại thay đổi mới nhất và thử lại",
+		"current": current,
+	})
+}
+
+// updateIfVersion applies the updates only while the record is still at the expected version
+// (any version when expected is nil). It returns false when another update got there first.
+func updateIfVersion(db *gorm.DB, model interface{}, expected *uint, updates map[string]interface{}) (bool, error) {
+	if expected == nil {
+		return true, db.Model(model).Updates(updates).Error
+	}
+
+	result := db.Model(model).Where("version = ?", *expected).Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	// No row matched: either the version moved on, or there was nothing to change
+	scope := db.NewScope(model)
+	var current struct{ Version uint }
+	if err := db.Table(scope.TableName()).Select("version").
+		Where("id = ?", scope.PrimaryKeyValue()).Scan(&current).Error; err != nil {
+		return false, err
+	}
+	return current.Version == *expected, nil
+}
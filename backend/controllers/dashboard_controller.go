@@ -26,6 +26,7 @@ type DashboardStats struct {
 	TrendData       []TrendDataPoint       `json:"trend_data"`
 	UserPerformance []UserPerformanceStats `json:"user_performance"`
 	IncomingFiles   IncomingFileStats      `json:"incoming_files"`
+	UnacceptedTasks []models.Task          `json:"unaccepted_tasks"` // assigned by the user and not accepted in time
 }
 
 // IncomingFileStats represents incoming file statistics
@@ -71,16 +72,20 @@ type UserPerformanceStats struct {
 	CompletedTasks  int     `json:"completed_tasks"`
 	InProgressTasks int     `json:"in_progress_tasks"`
 	OverdueTasks    int     `json:"overdue_tasks"`
+	UpcomingTasks   int     `json:"upcoming_tasks"`
 	CompletionRate  float64 `json:"completion_rate"`
 }
 
+// upcomingDeadlineWindow is how far ahead a deadline counts as "upcoming" in per-user workload
+const upcomingDeadlineWindow = 3 * 24 * time.Hour
+
 // GetDashboardStats returns comprehensive dashboard statistics
 func GetDashboardStats(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	userRole, _ := c.Get("user_role")
 
 	var tasks []models.Task
-	query := database.DB.Preload("AssignedTo").Preload("CreatedBy").Preload("IncomingDocument").Preload("Comments.User")
+	query := preloadVisibleIncomingDocument(database.DB, userID.(uint)).Preload("AssignedTo").Preload("CreatedBy").Preload("Comments.User")
 
 	// Filter based on role
 	switch userRole.(string) {
@@ -100,6 +105,7 @@ func GetDashboardStats(c *gin.Context) {
 	}
 
 	stats := calculateDashboardStats(tasks)
+	stats.UnacceptedTasks = getUnacceptedTasks(userID.(uint))
 	c.JSON(http.StatusOK, stats)
 }
 
@@ -119,7 +125,7 @@ func calculateDashboardStats(tasks []models.Task) DashboardStats {
 
 	// Get latest arrival number
 	var latestDoc models.IncomingDocument
-	database.DB.Order("arrival_number desc").First(&latestDoc)
+	database.DB.Order("arrival_year desc, arrival_number desc").First(&latestDoc)
 	incomingFilesStats.LatestOrder = latestDoc.ArrivalNumber
 
 	// Basic counts
@@ -134,7 +140,6 @@ func calculateDashboardStats(tasks []models.Task) DashboardStats {
 
 	// Role distribution
 	roleMap := make(map[string]*RoleStats)
-	userMap := make(map[uint]*UserPerformanceStats)
 
 	for _, task := range tasks {
 		// Count by status
@@ -172,28 +177,12 @@ func calculateDashboardStats(tasks []models.Task) DashboardStats {
 			} else if task.Status == models.StatusProcessing || task.Status == models.StatusReview {
 				roleMap[role].InProgressTasks++
 			}
-
-			// User performance statistics
-			userID := task.AssignedTo.ID
-			if userMap[userID] == nil {
-				userMap[userID] = &UserPerformanceStats{
-					UserID:   userID,
-					UserName: task.AssignedTo.Name,
-					UserRole: task.AssignedTo.Role,
-				}
-			}
-			userMap[userID].TotalTasks++
-			if task.Status == models.StatusCompleted {
-				userMap[userID].CompletedTasks++
-			} else if task.Status == models.StatusProcessing || task.Status == models.StatusReview {
-				userMap[userID].InProgressTasks++
-			}
-			if remainingTime.IsOverdue && task.Status != models.StatusCompleted {
-				userMap[userID].OverdueTasks++
-			}
 		}
 	}
 
+	// User performance statistics
+	userMap := collectUserPerformance(tasks)
+
 	// Calculate completion rates
 	var completionRate float64
 	if totalTasks > 0 {
@@ -223,12 +212,9 @@ func calculateDashboardStats(tasks []models.Task) DashboardStats {
 		tasksByRole[role] = *stats
 	}
 
-	// Convert user map to slice and calculate completion rates
+	// Convert user map to slice
 	var userPerformance []UserPerformanceStats
 	for _, stats := range userMap {
-		if stats.TotalTasks > 0 {
-			stats.CompletionRate = float64(stats.CompletedTasks) / float64(stats.TotalTasks) * 100
-		}
 		userPerformance = append(userPerformance, *stats)
 	}
 
@@ -258,6 +244,53 @@ func calculateDashboardStats(tasks []models.Task) DashboardStats {
 	}
 }
 
+// collectUserPerformance aggregates per-assignee statistics (totals, in-progress, overdue,
+// upcoming deadlines and completion rate) from the given tasks
+func collectUserPerformance(tasks []models.Task) map[uint]*UserPerformanceStats {
+	now := time.Now()
+	userMap := make(map[uint]*UserPerformanceStats)
+
+	for _, task := range tasks {
+		if task.AssignedTo == nil || task.AssignedTo.ID == 0 {
+			continue
+		}
+
+		userID := task.AssignedTo.ID
+		if userMap[userID] == nil {
+			userMap[userID] = &UserPerformanceStats{
+				UserID:   userID,
+				UserName: task.AssignedTo.Name,
+				UserRole: task.AssignedTo.Role,
+			}
+		}
+		stats := userMap[userID]
+
+		stats.TotalTasks++
+		if task.Status == models.StatusCompleted {
+			stats.CompletedTasks++
+			continue
+		}
+		if task.Status == models.StatusProcessing || task.Status == models.StatusReview {
+			stats.InProgressTasks++
+		}
+
+		remainingTime := task.GetRemainingTime()
+		if remainingTime.IsOverdue {
+			stats.OverdueTasks++
+		} else if !remainingTime.IsPaused && task.Deadline != nil && task.Deadline.Sub(now) <= upcomingDeadlineWindow {
+			stats.UpcomingTasks++
+		}
+	}
+
+	for _, stats := range userMap {
+		if stats.TotalTasks > 0 {
+			stats.CompletionRate = float64(stats.CompletedTasks) / float64(stats.TotalTasks) * 100
+		}
+	}
+
+	return userMap
+}
+
 func generateRecentActivity(tasks []models.Task) []ActivityItem {
 	var activities []ActivityItem
 
@@ -317,8 +350,8 @@ func getUpcomingTasks(tasks []models.Task, days int) []models.Task {
 
 	var upcoming []models.Task
 	for _, task := range tasks {
-		if task.Status != models.StatusCompleted &&
-			task.Deadline.After(now) &&
+		if task.Status != models.StatusCompleted && task.Status != models.StatusOnHold &&
+			task.Deadline != nil && task.Deadline.After(now) &&
 			task.Deadline.Before(futureDate) {
 			upcoming = append(upcoming, task)
 		}
@@ -381,7 +414,7 @@ func GetUserTasks(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
 	var tasks []models.Task
-	if err := database.DB.Preload("AssignedTo").Preload("CreatedBy").Preload("IncomingDocument").
+	if err := preloadVisibleIncomingDocument(database.DB, userID.(uint)).Preload("AssignedTo").Preload("CreatedBy").
 		Where("assigned_to_id = ?", userID).Find(&tasks).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy công việc của người dùng"})
 		return
@@ -423,7 +456,8 @@ func GetSystemHealth(c *gin.Context) {
 	// Calculate overdue tasks
 	now := time.Now()
 	var tasks []models.Task
-	database.DB.Where("status != ? AND deadline < ?", models.StatusCompleted, now).Find(&tasks)
+	overdueCondition, overdueArgs := models.OverdueTaskCondition(now)
+	database.DB.Where(overdueCondition, overdueArgs...).Find(&tasks)
 	overdueTaskCount = int64(len(tasks))
 
 	// Calculate active users (users with tasks in last 7 days)
@@ -579,7 +613,8 @@ func GetDetailedMetrics(c *gin.Context) {
 
 	// Count overdue tasks
 	now := time.Now()
-	database.DB.Model(&models.Task{}).Where("status != ? AND deadline < ?", models.StatusCompleted, now).Count(&taskStats.Overdue)
+	overdueCondition, overdueArgs := models.OverdueTaskCondition(now)
+	database.DB.Model(&models.Task{}).Where(overdueCondition, overdueArgs...).Count(&taskStats.Overdue)
 
 	metrics := map[string]interface{}{
 		"timestamp": time.Now(),
@@ -0,0 +1,357 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"ai-code-agent-backend/services"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type GrantDocumentAccessRequest struct {
+	UserIDs []uint `json:"user_ids" binding:"required"`
+}
+
+// validateDocumentLevels checks the urgency and secrecy level sent by the client, leaving empty values alone
+func validateDocumentLevels(urgency, secrecyLevel string) string {
+	if urgency != "" && !models.IsValidUrgency(urgency) {
+		return "Độ khẩn không hợp lệ"
+	}
+	if secrecyLevel != "" && !models.IsValidSecrecy(secrecyLevel) {
+		return "Độ mật không hợp lệ"
+	}
+	return ""
+}
+
+// auditClassifiedAccess records that someone opened, changed or was refused a classified document
+func auditClassifiedAccess(c *gin.Context, entityType models.AuditEntityType, entityID uint, secrecyLevel string, allowed bool) {
+	description := fmt.Sprintf("Truy cập tài liệu mật (%s): %s %s", secrecyLevel, c.Request.Method, c.FullPath())
+	if !allowed {
+		description = fmt.Sprintf("Từ chối truy cập tài liệu mật (%s): %s %s", secrecyLevel, c.Request.Method, c.FullPath())
+	}
+	services.NewAuditService().LogActivity(c, models.AuditActionClassifiedAccess, entityType, entityID, description, nil, nil,
+		gin.H{"secrecy_level": secrecyLevel, "allowed": allowed, "method": c.Request.Method, "path": c.Request.URL.Path})
+}
+
+// requireIncomingDocumentAccess checks that the user may see a document, auditing every access to a
+// classified one. When access is refused it writes a not found response and returns false, so the
+// document's existence is not revealed.
+func requireIncomingDocumentAccess(c *gin.Context, document *models.IncomingDocument) bool {
+	if !models.IsClassified(document.SecrecyLevel) {
+		return true
+	}
+	userID, _ := c.Get("user_id")
+	allowed := services.CanAccessIncomingDocument(database.DB, document, userID.(uint))
+	auditClassifiedAccess(c, models.AuditEntityIncomingDocument, document.ID, document.SecrecyLevel, allowed)
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đến"})
+	}
+	return allowed
+}
+
+// requireOutgoingDocumentAccess is requireIncomingDocumentAccess for outgoing documents
+func requireOutgoingDocumentAccess(c *gin.Context, document *models.OutgoingDocument) bool {
+	if !models.IsClassified(document.SecrecyLevel) {
+		return true
+	}
+	userID, _ := c.Get("user_id")
+	allowed := services.CanAccessOutgoingDocument(database.DB, document, userID.(uint))
+	auditClassifiedAccess(c, models.AuditEntityOutgoingDocument, document.ID, document.SecrecyLevel, allowed)
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đi"})
+	}
+	return allowed
+}
+
+// canChangeSecrecy reports whether the user may reclassify a document: its creator, or a leader or admin
+func canChangeSecrecy(userRole string, createdByID, userID uint) bool {
+	switch userRole {
+	case models.RoleAdmin, models.RoleTeamLeader, models.RoleDeputy:
+		return true
+	}
+	return createdByID == userID
+}
+
+// auditSecrecyChange records a document being classified, reclassified or declassified
+func auditSecrecyChange(c *gin.Context, entityType models.AuditEntityType, entityID uint, oldLevel, newLevel string) {
+	services.NewAuditService().LogActivity(c, models.AuditActionDocumentUpdate, entityType, entityID,
+		fmt.Sprintf("Thay đổi độ mật từ %s thành %s", oldLevel, newLevel),
+		gin.H{"secrecy_level": oldLevel}, gin.H{"secrecy_level": newLevel}, nil)
+}
+
+// auditClassifiedFileAccess audits a request for a stored file that belongs to a classified document
+// and reports whether the user may have it
+func auditClassifiedFileAccess(c *gin.Context, filePath string, userID uint) bool {
+	var fileRecord services.FileInfo
+	if err := database.DB.Table("files").Where("file_path = ?", filePath).First(&fileRecord).Error; err != nil {
+		return true
+	}
+	classified := services.ClassifiedDocumentOf(database.DB, fileRecord.DocumentType, fileRecord.DocumentID, userID)
+	if classified == nil {
+		return true
+	}
+	auditClassifiedAccess(c, classified.EntityType, classified.EntityID, classified.SecrecyLevel, classified.Allowed)
+	return classified.Allowed
+}
+
+// requireDocumentFilesAccess checks that the user may list the files of a document; files of a
+// classified document are hidden from users not cleared for it
+func requireDocumentFilesAccess(c *gin.Context, documentType string, documentID uint) bool {
+	userID, _ := c.Get("user_id")
+	classified := services.ClassifiedDocumentOf(database.DB, documentType, documentID, userID.(uint))
+	if classified == nil {
+		return true
+	}
+	auditClassifiedAccess(c, classified.EntityType, classified.EntityID, classified.SecrecyLevel, classified.Allowed)
+	if !classified.Allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy tài liệu"})
+	}
+	return classified.Allowed
+}
+
+// requireVisibleTask loads a task the user may see: one within their role's view of tasks, whose
+// incoming document they are cleared for when it is classified. Otherwise it writes a not found
+// response and returns false.
+func requireVisibleTask(c *gin.Context, task *models.Task, id uint) bool {
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+	if err := services.ScopeVisibleTasks(database.DB, userID.(uint), userRole.(string)).First(task, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy công việc"})
+		return false
+	}
+	if task.IncomingDocumentID == nil {
+		return true
+	}
+	var document models.IncomingDocument
+	if err := database.DB.First(&document, *task.IncomingDocumentID).Error; err != nil || !models.IsClassified(document.SecrecyLevel) {
+		return true
+	}
+	allowed := services.CanAccessIncomingDocument(database.DB, &document, userID.(uint))
+	auditClassifiedAccess(c, models.AuditEntityIncomingDocument, document.ID, document.SecrecyLevel, allowed)
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy công việc"})
+	}
+	return allowed
+}
+
+// clearTaskAssigneeTx clears the assignee of a task for its incoming document when that is
+// classified, so whoever is handed the task can open it
+func clearTaskAssigneeTx(db *gorm.DB, task *models.Task, actorID uint) error {
+	if task.IncomingDocumentID == nil || task.AssignedToID == nil {
+		return nil
+	}
+	var document models.IncomingDocument
+	if err := db.Select("id, secrecy_level").First(&document, *task.IncomingDocumentID).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+	if !models.IsClassified(document.SecrecyLevel) {
+		return nil
+	}
+	return grantDocumentAccessTx(db, models.AccessEntityIncomingDocument, document.ID, []uint{*task.AssignedToID}, actorID)
+}
+
+// preloadVisibleIncomingDocument preloads the incoming document of tasks, and its IncomingFile
+// alias, only where the user may see it; tasks of a classified document the user was not cleared for
+// list without it. It must come before any nested IncomingDocument or IncomingFile preload, which
+// would otherwise load the document unscoped.
+func preloadVisibleIncomingDocument(query *gorm.DB, userID uint) *gorm.DB {
+	visible := func(db *gorm.DB) *gorm.DB {
+		return services.ScopeVisibleIncomingDocuments(db, userID)
+	}
+	return query.Preload("IncomingDocument", visible).Preload("IncomingFile", visible)
+}
+
+// grantDocumentAccessTx clears users for a document; users already cleared are left as they are
+func grantDocumentAccessTx(db *gorm.DB, entityType string, entityID uint, userIDs []uint, grantedByID uint) error {
+	for _, userID := range userIDs {
+		if err := db.Exec(`INSERT INTO document_access_grants (entity_type, entity_id, user_id, granted_by_id, created_at)
+			VALUES (?, ?, ?, ?, NOW()) ON CONFLICT (entity_type, entity_id, user_id) DO NOTHING`,
+			entityType, entityID, userID, grantedByID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateGrantees checks that every user to be cleared exists and is active
+func validateGrantees(db *gorm.DB, userIDs []uint) bool {
+	userIDs = uniqueIDs(userIDs)
+	if len(userIDs) == 0 {
+		return true
+	}
+	var count int
+	db.Model(&models.User{}).Where("id IN (?) AND is_active = ?", userIDs, true).Count(&count)
+	return count == len(userIDs)
+}
+
+// accessTarget is the document whose clearances are being managed
+type accessTarget struct {
+	EntityType  string
+	AuditEntity models.AuditEntityType
+	ID          uint
+	Label       string
+}
+
+// loadAccessTarget loads the document of the request and checks the user may manage who is cleared
+// for it: its creator, or a leader or admin who can see it
+func loadAccessTarget(c *gin.Context, entityType string) (*accessTarget, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return nil, false
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	var createdByID uint
+	target := &accessTarget{EntityType: entityType, ID: uint(id)}
+	if entityType == models.AccessEntityIncomingDocument {
+		var document models.IncomingDocument
+		if err := database.DB.First(&document, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đến"})
+			return nil, false
+		}
+		if !requireIncomingDocumentAccess(c, &document) {
+			return nil, false
+		}
+		createdByID = document.CreatedByID
+		target.AuditEntity = models.AuditEntityIncomingDocument
+		target.Label = fmt.Sprintf("văn bản đến số %d", document.ArrivalNumber)
+	} else {
+		var document models.OutgoingDocument
+		if err := database.DB.First(&document, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đi"})
+			return nil, false
+		}
+		if !requireOutgoingDocumentAccess(c, &document) {
+			return nil, false
+		}
+		createdByID = document.CreatedByID
+		target.AuditEntity = models.AuditEntityOutgoingDocument
+		target.Label = fmt.Sprintf("văn bản đi %s", document.DocumentNumber)
+	}
+
+	switch userRole.(string) {
+	case models.RoleAdmin, models.RoleTeamLeader, models.RoleDeputy:
+	default:
+		if createdByID != userID.(uint) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền quản lý quyền truy cập văn bản này"})
+			return nil, false
+		}
+	}
+	return target, true
+}
+
+func getDocumentAccessGrants(c *gin.Context, entityType string) {
+	if target, ok := loadAccessTarget(c, entityType); ok {
+		respondAccessGrants(c, target)
+	}
+}
+
+func respondAccessGrants(c *gin.Context, target *accessTarget) {
+	var grants []models.DocumentAccessGrant
+	if err := database.DB.Preload("User").Preload("GrantedBy").
+		Where("entity_type = ? AND entity_id = ?", target.EntityType, target.ID).
+		Order("created_at asc").Find(&grants).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách người được phép truy cập"})
+		return
+	}
+
+	c.JSON(http.StatusOK, grants)
+}
+
+func grantDocumentAccess(c *gin.Context, entityType string) {
+	target, ok := loadAccessTarget(c, entityType)
+	if !ok {
+		return
+	}
+
+	var req GrantDocumentAccessRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(uniqueIDs(req.UserIDs)) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+	if !validateGrantees(database.DB, req.UserIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Người dùng không tồn tại hoặc đã ngừng hoạt động"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := grantDocumentAccessTx(database.DB, target.EntityType, target.ID, uniqueIDs(req.UserIDs), userID.(uint)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cấp quyền truy cập"})
+		return
+	}
+
+	services.NewAuditService().LogActivity(c, models.AuditActionAccessGrant, target.AuditEntity, target.ID,
+		fmt.Sprintf("Cấp quyền truy cập %s cho %d người dùng", target.Label, len(uniqueIDs(req.UserIDs))),
+		nil, gin.H{"user_ids": uniqueIDs(req.UserIDs)}, nil)
+
+	respondAccessGrants(c, target)
+}
+
+func revokeDocumentAccess(c *gin.Context, entityType string) {
+	target, ok := loadAccessTarget(c, entityType)
+	if !ok {
+		return
+	}
+
+	grantee, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID người dùng không hợp lệ"})
+		return
+	}
+
+	result := database.DB.Where("entity_type = ? AND entity_id = ? AND user_id = ?", target.EntityType, target.ID, grantee).
+		Delete(&models.DocumentAccessGrant{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể thu hồi quyền truy cập"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Người dùng chưa được cấp quyền truy cập"})
+		return
+	}
+
+	services.NewAuditService().LogActivity(c, models.AuditActionAccessRevoke, target.AuditEntity, target.ID,
+		fmt.Sprintf("Thu hồi quyền truy cập %s", target.Label), gin.H{"user_id": grantee}, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Đã thu hồi quyền truy cập"})
+}
+
+// GetIncomingDocumentAccess lists the users cleared for a classified incoming document
+func GetIncomingDocumentAccess(c *gin.Context) {
+	getDocumentAccessGrants(c, models.AccessEntityIncomingDocument)
+}
+
+// GrantIncomingDocumentAccess clears users for an incoming document
+func GrantIncomingDocumentAccess(c *gin.Context) {
+	grantDocumentAccess(c, models.AccessEntityIncomingDocument)
+}
+
+// RevokeIncomingDocumentAccess withdraws a user's clearance for an incoming document
+func RevokeIncomingDocumentAccess(c *gin.Context) {
+	revokeDocumentAccess(c, models.AccessEntityIncomingDocument)
+}
+
+// GetOutgoingDocumentAccess lists the users cleared for a classified outgoing document
+func GetOutgoingDocumentAccess(c *gin.Context) {
+	getDocumentAccessGrants(c, models.AccessEntityOutgoingDocument)
+}
+
+// GrantOutgoingDocumentAccess clears users for an outgoing document
+func GrantOutgoingDocumentAccess(c *gin.Context) {
+	grantDocumentAccess(c, models.AccessEntityOutgoingDocument)
+}
+
+// RevokeOutgoingDocumentAccess withdraws a user's clearance for an outgoing document
+func RevokeOutgoingDocumentAccess(c *gin.Context) {
+	revokeDocumentAccess(c, models.AccessEntityOutgoingDocument)
+}
@@ -0,0 +1,418 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type DirectiveAssigneeRequest struct {
+	Role            string `json:"role" binding:"required"` // "lead", "support"
+	UserID          *uint  `json:"user_id"`
+	UnitName        string `json:"unit_name"`
+	TaskDescription string `json:"task_description"`
+}
+
+type SaveDirectiveRequest struct {
+	Instruction string                     `json:"instruction" binding:"required"`
+	Deadline    string                     `json:"deadline"` // YYYY-MM-DD
+	Assignees   []DirectiveAssigneeRequest `json:"assignees" binding:"required"`
+	Note        string                     `json:"note"` // Reason for the revision
+}
+
+// loadDirectiveDocument loads the incoming document from the route
+func loadDirectiveDocument(c *gin.Context) (*models.IncomingDocument, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return nil, false
+	}
+
+	var document models.IncomingDocument
+	if err := database.DB.First(&document, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đến"})
+		return nil, false
+	}
+	if !requireIncomingDocumentAccess(c, &document) {
+		return nil, false
+	}
+
+	return &document, true
+}
+
+// findDirective returns the directive of the document with its assignees in order
+func findDirective(db *gorm.DB, documentID uint) (*models.DocumentDirective, error) {
+	var directive models.DocumentDirective
+	err := db.Preload("Director").
+		Preload("Assignees", func(db *gorm.DB) *gorm.DB { return db.Order("position asc, id asc") }).
+		Preload("Assignees.User").Preload("Assignees.Task").
+		Where("incoming_document_id = ?", documentID).First(&directive).Error
+	if err != nil {
+		return nil, err
+	}
+	return &directive, nil
+}
+
+// lockDirectiveTx locks the directive of the document for the rest of the transaction and returns
+// it as findDirective does. The lock is taken on its own, since gorm would carry FOR UPDATE into the
+// preloads and lock the people and tasks of the directive as well.
+func lockDirectiveTx(tx *gorm.DB, documentID uint) (*models.DocumentDirective, error) {
+	var locked models.DocumentDirective
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("incoming_document_id = ?", documentID).First(&locked).Error; err != nil {
+		return nil, err
+	}
+	return findDirective(tx, documentID)
+}
+
+// validateDirectiveAssignees checks the roles and people of a directive. Exactly one lead is required.
+func validateDirectiveAssignees(assignees []DirectiveAssigneeRequest) error {
+	leads := 0
+	seenUsers := make(map[uint]bool)
+	for _, assignee := range assignees {
+		switch assignee.Role {
+		case models.DirectiveRoleLead:
+			leads++
+		case models.DirectiveRoleSupport:
+		default:
+			return &operationError{http.StatusBadRequest, "Vai trò trong bút phê phải là chủ trì hoặc phối hợp"}
+		}
+
+		if assignee.UserID == nil && strings.TrimSpace(assignee.UnitName) == "" {
+			return &operationError{http.StatusBadRequest, "Mỗi đơn vị hoặc cá nhân trong bút phê phải có người nhận hoặc tên đơn vị"}
+		}
+		if assignee.UserID != nil {
+			var user models.User
+			if err := database.DB.First(&user, *assignee.UserID).Error; err != nil || !user.IsActive {
+				return &operationError{http.StatusBadRequest, "Người được giao trong bút phê không tồn tại hoặc đã ngừng hoạt động"}
+			}
+			if seenUsers[user.ID] {
+				return &operationError{http.StatusBadRequest, fmt.Sprintf("%s được nêu nhiều lần trong bút phê", user.Name)}
+			}
+			seenUsers[user.ID] = true
+		}
+	}
+	if leads != 1 {
+		return &operationError{http.StatusBadRequest, "Bút phê phải có đúng một đơn vị hoặc cá nhân chủ trì"}
+	}
+	return nil
+}
+
+// directiveAssigneeKey identifies an assignee across revisions so tasks already created stay linked
+func directiveAssigneeKey(role string, userID *uint, unitName string) string {
+	if userID != nil {
+		return fmt.Sprintf("%s:user:%d", role, *userID)
+	}
+	return fmt.Sprintf("%s:unit:%s", role, strings.ToLower(strings.TrimSpace(unitName)))
+}
+
+// GetDocumentDirective returns the current directive of an incoming document
+func GetDocumentDirective(c *gin.Context) {
+	document, ok := loadDirectiveDocument(c)
+	if !ok {
+		return
+	}
+
+	directive, err := findDirective(database.DB, document.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Văn bản chưa có bút phê"})
+		return
+	}
+
+	c.JSON(http.StatusOK, directive)
+}
+
+// SaveDocumentDirective writes the directive of an incoming document, or revises it when one
+// exists. The previous version is kept in the directive history.
+func SaveDocumentDirective(c *gin.Context) {
+	document, ok := loadDirectiveDocument(c)
+	if !ok {
+		return
+	}
+
+	var req SaveDirectiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Instruction) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vui lòng nhập nội dung bút phê và người thực hiện"})
+		return
+	}
+	if err := validateDirectiveAssignees(req.Assignees); err != nil {
+		respondOperationError(c, err, "Dữ liệu không hợp lệ")
+		return
+	}
+
+	var deadline *time.Time
+	if req.Deadline != "" {
+		date, err := time.ParseInLocation("2006-01-02", req.Deadline, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Định dạng hạn trả lời không hợp lệ"})
+			return
+		}
+		endOfDay := date.Add(24*time.Hour - time.Second)
+		deadline = &endOfDay
+	}
+
+	userID, _ := c.Get("user_id")
+
+	// The directive is locked so concurrent revisions are numbered one after the other
+	tx := database.DB.Begin()
+	directive, err := lockDirectiveTx(tx, document.ID)
+	isRevision := err == nil
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lưu bút phê"})
+		return
+	}
+
+	existingTasks := make(map[string]*uint)
+	if isRevision {
+		for i := range directive.Assignees {
+			assignee := &directive.Assignees[i]
+			existingTasks[directiveAssigneeKey(assignee.Role, assignee.UserID, assignee.UnitName)] = assignee.TaskID
+			assignee.User, assignee.Task = nil, nil
+		}
+		snapshot, _ := json.Marshal(directive.Assignees)
+		revision := models.DocumentDirectiveRevision{
+			DirectiveID: directive.ID,
+			Revision:    directive.Revision,
+			DirectorID:  directive.DirectorID,
+			Instruction: directive.Instruction,
+			Deadline:    directive.Deadline,
+			Assignees:   string(snapshot),
+			RevisedByID: userID.(uint),
+			Note:        req.Note,
+		}
+		if err := tx.Create(&revision).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lưu lịch sử bút phê"})
+			return
+		}
+		if err := tx.Where("directive_id = ?", directive.ID).Delete(&models.DirectiveAssignee{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lưu bút phê"})
+			return
+		}
+		// Updated through a bare model so the loaded assignees are not saved back
+		err = tx.Model(&models.DocumentDirective{}).Where("id = ?", directive.ID).Updates(map[string]interface{}{
+			"director_id": userID.(uint),
+			"instruction": strings.TrimSpace(req.Instruction),
+			"deadline":    deadline,
+			"revision":    directive.Revision + 1,
+		}).Error
+	} else {
+		directive = &models.DocumentDirective{
+			IncomingDocumentID: document.ID,
+			DirectorID:         userID.(uint),
+			Instruction:        strings.TrimSpace(req.Instruction),
+			Deadline:           deadline,
+			Revision:           1,
+		}
+		err = tx.Create(directive).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lưu bút phê"})
+		return
+	}
+
+	for i, assigneeReq := range req.Assignees {
+		assignee := models.DirectiveAssignee{
+			DirectiveID:     directive.ID,
+			Role:            assigneeReq.Role,
+			UserID:          assigneeReq.UserID,
+			UnitName:        strings.TrimSpace(assigneeReq.UnitName),
+			TaskDescription: strings.TrimSpace(assigneeReq.TaskDescription),
+			TaskID:          existingTasks[directiveAssigneeKey(assigneeReq.Role, assigneeReq.UserID, assigneeReq.UnitName)],
+			Position:        i + 1,
+		}
+		if err := tx.Create(&assignee).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lưu bút phê"})
+			return
+		}
+	}
+
+	// The directing leader becomes the processor of a document that has none yet
+	if document.ProcessorID == nil {
+		if err := assignProcessorTx(tx, document, userID.(uint), userID.(uint)); err != nil {
+			tx.Rollback()
+			respondOperationError(c, err, "Không thể lưu bút phê")
+			return
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lưu bút phê"})
+		return
+	}
+
+	directive, _ = findDirective(database.DB, document.ID)
+
+	status := http.StatusCreated
+	if isRevision {
+		status = http.StatusOK
+	}
+	c.JSON(status, directive)
+}
+
+// GetDocumentDirectiveHistory returns the earlier versions of a directive, newest first
+func GetDocumentDirectiveHistory(c *gin.Context) {
+	document, ok := loadDirectiveDocument(c)
+	if !ok {
+		return
+	}
+
+	var directive models.DocumentDirective
+	if err := database.DB.Where("incoming_document_id = ?", document.ID).First(&directive).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Văn bản chưa có bút phê"})
+		return
+	}
+
+	var revisions []models.DocumentDirectiveRevision
+	if err := database.DB.Preload("Director").Preload("RevisedBy").Where("directive_id = ?", directive.ID).
+		Order("revision desc").Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy lịch sử bút phê"})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// CreateTasksFromDirective creates a task for every person named in the directive who does not
+// have one yet. Units without a named person are reported back, since tasks need an assignee.
+func CreateTasksFromDirective(c *gin.Context) {
+	document, ok := loadDirectiveDocument(c)
+	if !ok {
+		return
+	}
+
+	// The directive is locked so that a second request waits and then sees the tasks this one created
+	tx := database.DB.Begin()
+	directive, err := lockDirectiveTx(tx, document.ID)
+	if err != nil {
+		tx.Rollback()
+		if gorm.IsRecordNotFoundError(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Văn bản chưa có bút phê"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo công việc từ bút phê"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	actorID := userID.(uint)
+
+	var created []models.Task
+	var skippedUnits []string
+
+	// Without a deadline in the directive, the document's urgency sets one
+	deadline := directive.Deadline
+	if deadline == nil {
+		deadline = models.UrgencyDeadline(document.Urgency, time.Now())
+	}
+
+	for _, assignee := range directive.Assignees {
+		if assignee.TaskID != nil {
+			continue
+		}
+		if assignee.UserID == nil {
+			skippedUnits = append(skippedUnits, assignee.UnitName)
+			continue
+		}
+
+		description := assignee.TaskDescription
+		if description == "" {
+			description = directive.Instruction
+		}
+		rolePrefix := "[Chủ trì] "
+		if assignee.Role == models.DirectiveRoleSupport {
+			rolePrefix = "[Phối hợp] "
+		}
+
+		task := models.Task{
+			Description:        rolePrefix + description,
+			Status:             models.StatusNotStarted,
+			AssignedToID:       assignee.UserID,
+			CreatedByID:        actorID,
+			IncomingDocumentID: &document.ID,
+			TaskType:           models.TaskTypeDocumentLinked,
+			DeadlineType:       models.DeadlineTypeSpecific,
+			Deadline:           deadline,
+		}
+		task.MarkAssigned(actorID)
+
+		err := tx.Create(&task).Error
+		if err == nil {
+			err = createTaskStatusHistoryTx(tx, task.ID, "", models.StatusNotStarted, actorID, "Tạo công việc từ bút phê của lãnh đạo")
+		}
+		if err == nil {
+			err = watchTaskChainTx(tx, &task)
+		}
+		if err == nil {
+			err = clearTaskAssigneeTx(tx, &task, actorID)
+		}
+		if err == nil {
+			err = tx.Model(&models.DirectiveAssignee{}).Where("id = ?", assignee.ID).Update("task_id", task.ID).Error
+		}
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo công việc từ bút phê"})
+			return
+		}
+		created = append(created, task)
+	}
+
+	if len(created) == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không có công việc mới nào cần tạo từ bút phê", "skipped_units": skippedUnits})
+		return
+	}
+
+	// The document status already followed the new tasks through their history entries
+	now := time.Now()
+	if err := tx.Model(directive).UpdateColumn("tasks_created_at", now).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo công việc từ bút phê"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo công việc từ bút phê"})
+		return
+	}
+
+	for i := range created {
+		database.DB.Preload("AssignedTo").First(&created[i], created[i].ID)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"tasks":         created,
+		"skipped_units": skippedUnits,
+		"message":       fmt.Sprintf("Đã tạo %d công việc từ bút phê", len(created)),
+	})
+}
+
+// deleteDocumentDirectiveTx removes the directive of a document that is being deleted, with its
+// assignees and history
+func deleteDocumentDirectiveTx(db *gorm.DB, documentID uint) error {
+	var directive models.DocumentDirective
+	if err := db.Where("incoming_document_id = ?", documentID).First(&directive).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+	if err := db.Where("directive_id = ?", directive.ID).Delete(&models.DirectiveAssignee{}).Error; err != nil {
+		return err
+	}
+	if err := db.Where("directive_id = ?", directive.ID).Delete(&models.DocumentDirectiveRevision{}).Error; err != nil {
+		return err
+	}
+	return db.Unscoped().Delete(&directive).Error
+}
@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"ai-code-agent-backend/services"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// Why a document was reported as a possible duplicate
+const (
+	DuplicateReasonSameNumber     = "same_number"     // Same original number, issuing unit and document date
+	DuplicateReasonSimilarSummary = "similar_summary" // Summary is nearly the same
+	DuplicateReasonSameFile       = "same_file"       // The attached file is byte for byte the same
+)
+
+// How far back summaries are compared, and how many candidates are reported at most
+const (
+	duplicateSummaryWindow = 90 * 24 * time.Hour
+	maxDuplicateCandidates = 10
+)
+
+type DuplicateCandidate struct {
+	Document   models.IncomingDocument `json:"document"`
+	Reasons    []string                `json:"reasons"`
+	Similarity float64                 `json:"similarity,omitempty"`
+}
+
+type CheckDuplicatesRequest struct {
+	OriginalNumber string `json:"original_number"`
+	DocumentDate   string `json:"document_date"`
+	IssuingUnitID  uint   `json:"issuing_unit_id"`
+	Summary        string `json:"summary"`
+}
+
+// duplicateSet collects candidates, merging the reasons found for the same document
+type duplicateSet struct {
+	byID map[uint]*DuplicateCandidate
+}
+
+func newDuplicateSet() *duplicateSet {
+	return &duplicateSet{byID: make(map[uint]*DuplicateCandidate)}
+}
+
+func (s *duplicateSet) add(document models.IncomingDocument, reason string, similarity float64) {
+	candidate, ok := s.byID[document.ID]
+	if !ok {
+		candidate = &DuplicateCandidate{Document: document}
+		s.byID[document.ID] = candidate
+	}
+	candidate.Reasons = append(candidate.Reasons, reason)
+	if similarity > candidate.Similarity {
+		candidate.Similarity = similarity
+	}
+}
+
+// list returns the strongest candidates first: more reasons, then higher similarity
+func (s *duplicateSet) list() []DuplicateCandidate {
+	candidates := make([]DuplicateCandidate, 0, len(s.byID))
+	for _, candidate := range s.byID {
+		candidates = append(candidates, *candidate)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if len(candidates[i].Reasons) != len(candidates[j].Reasons) {
+			return len(candidates[i].Reasons) > len(candidates[j].Reasons)
+		}
+		if candidates[i].Similarity != candidates[j].Similarity {
+			return candidates[i].Similarity > candidates[j].Similarity
+		}
+		return candidates[i].Document.ID > candidates[j].Document.ID
+	})
+	if len(candidates) > maxDuplicateCandidates {
+		candidates = candidates[:maxDuplicateCandidates]
+	}
+	return candidates
+}
+
+// findIncomingDuplicates looks for registered documents that are probably the one being entered
+func findIncomingDuplicates(db *gorm.DB, originalNumber string, issuingUnitID uint, documentDate time.Time, summary string, excludeID uint) ([]DuplicateCandidate, error) {
+	set := newDuplicateSet()
+
+	if number := services.NormalizeDocumentNumber(originalNumber); number != "" && issuingUnitID > 0 && !documentDate.IsZero() {
+		var sameDay []models.IncomingDocument
+		if err := db.Preload("IssuingUnit").
+			Where("issuing_unit_id = ? AND DATE(document_date) = DATE(?) AND id <> ?", issuingUnitID, documentDate, excludeID).
+			Find(&sameDay).Error; err != nil {
+			return nil, err
+		}
+		for _, document := range sameDay {
+			if services.NormalizeDocumentNumber(document.OriginalNumber) == number {
+				set.add(document, DuplicateReasonSameNumber, 0)
+			}
+		}
+	}
+
+	if services.FoldText(summary) != "" {
+		var recent []models.IncomingDocument
+		if err := db.Preload("IssuingUnit").
+			Where("arrival_date >= ? AND id <> ?", time.Now().Add(-duplicateSummaryWindow), excludeID).
+			Order("arrival_date desc").Limit(1000).Find(&recent).Error; err != nil {
+			return nil, err
+		}
+		for _, document := range recent {
+			if similarity := services.SummarySimilarity(summary, document.Summary); similarity >= services.SummarySimilarityThreshold {
+				set.add(document, DuplicateReasonSimilarSummary, similarity)
+			}
+		}
+	}
+
+	return set.list(), nil
+}
+
+// findIncomingDuplicatesByFile returns the documents that already have a file with the given hash
+func findIncomingDuplicatesByFile(db *gorm.DB, fileHash string, excludeIDs ...uint) ([]DuplicateCandidate, error) {
+	query := db.Preload("IssuingUnit").
+		Where("incoming_documents.id IN (SELECT document_id FROM files WHERE file_hash = ? AND document_type = ? AND deleted_at IS NULL)", fileHash, "incoming")
+	if len(excludeIDs) > 0 {
+		query = query.Where("incoming_documents.id NOT IN (?)", excludeIDs)
+	}
+
+	var documents []models.IncomingDocument
+	if err := query.Find(&documents).Error; err != nil {
+		return nil, err
+	}
+
+	set := newDuplicateSet()
+	for _, document := range documents {
+		set.add(document, DuplicateReasonSameFile, 1)
+	}
+	return set.list(), nil
+}
+
+// duplicateRoot follows duplicate links so new duplicates all point at the first registered copy;
+// the walk stops at the last copy db lets through, so a scoped db never links to a hidden document
+func duplicateRoot(db *gorm.DB, documentID uint) (*models.IncomingDocument, error) {
+	var document models.IncomingDocument
+	if err := db.First(&document, documentID).Error; err != nil {
+		return nil, err
+	}
+	for seen := 0; document.DuplicateOfID != nil && seen < 10; seen++ {
+		var original models.IncomingDocument
+		if err := db.First(&original, *document.DuplicateOfID).Error; err != nil {
+			break
+		}
+		document = original
+	}
+	return &document, nil
+}
+
+// respondDuplicates reports likely duplicates; the client resubmits with force or duplicate_of_id
+func respondDuplicates(c *gin.Context, candidates []DuplicateCandidate) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error":      "Văn bản có thể đã được đăng ký. Vui lòng kiểm tra hoặc xác nhận để tiếp tục",
+		"duplicates": candidates,
+	})
+}
+
+// CheckIncomingDocumentDuplicates lists registered documents that look like the one being entered,
+// so the form can warn before it is submitted
+func CheckIncomingDocumentDuplicates(c *gin.Context) {
+	var req CheckDuplicatesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	var documentDate time.Time
+	if req.DocumentDate != "" {
+		parsed, err := time.Parse("2006-01-02", req.DocumentDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Định dạng ngày văn bản không hợp lệ"})
+			return
+		}
+		documentDate = parsed
+	}
+
+	userID, _ := c.Get("user_id")
+	candidates, err := findIncomingDuplicates(services.ScopeVisibleIncomingDocuments(database.DB, userID.(uint)), req.OriginalNumber, req.IssuingUnitID, documentDate, req.Summary, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể kiểm tra văn bản trùng"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"duplicates": candidates})
+}
@@ -0,0 +1,875 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"ai-code-agent-backend/services"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// Rows are inserted in batches, each in its own transaction
+const (
+	defaultImportBatchSize = 100
+	maxImportBatchSize     = 1000
+)
+
+// Column headers each import field is recognised by, besides its own name. Headers are compared
+// folded, so accents and punctuation do not matter.
+var incomingImportColumns = map[string][]string{
+	"arrival_number":  {"số đến", "số thứ tự", "stt"},
+	"arrival_date":    {"ngày đến"},
+	"original_number": {"số ký hiệu", "số, ký hiệu", "số hiệu", "số văn bản"},
+	"document_date":   {"ngày văn bản", "ngày tháng văn bản", "ngày ban hành"},
+	"document_type":   {"loại văn bản"},
+	"issuing_unit":    {"cơ quan ban hành", "nơi gửi", "đơn vị ban hành", "tác giả"},
+	"summary":         {"trích yếu", "trích yếu nội dung", "tên loại và trích yếu nội dung"},
+	"processor":       {"người xử lý", "người nhận", "đơn vị, người nhận"},
+	"register_book":   {"sổ", "sổ đăng ký"},
+	"status":          {"trạng thái"},
+	"urgency":         {"độ khẩn"},
+	"secrecy_level":   {"độ mật"},
+	"internal_notes":  {"ghi chú"},
+}
+
+var outgoingImportColumns = map[string][]string{
+	"document_number": {"số ký hiệu", "số, ký hiệu", "số văn bản", "số hiệu"},
+	"issue_date":      {"ngày ban hành", "ngày văn bản", "ngày tháng văn bản"},
+	"document_type":   {"loại văn bản"},
+	"issuing_unit":    {"đơn vị ban hành", "cơ quan ban hành", "đơn vị soạn thảo"},
+	"summary":         {"trích yếu", "trích yếu nội dung", "tên loại và trích yếu nội dung"},
+	"drafter":         {"người soạn thảo"},
+	"approver":        {"người ký", "người duyệt", "người phê duyệt"},
+	"status":          {"trạng thái"},
+	"urgency":         {"độ khẩn"},
+	"secrecy_level":   {"độ mật"},
+	"internal_notes":  {"ghi chú"},
+}
+
+var (
+	incomingImportRequired = []string{"arrival_number", "arrival_date", "original_number", "document_date", "document_type", "issuing_unit", "summary"}
+	outgoingImportRequired = []string{"document_number", "issue_date", "document_type", "issuing_unit", "summary"}
+)
+
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportReport is the outcome of an import, or in a dry run what the import would do
+type ImportReport struct {
+	DryRun               bool              `json:"dry_run"`
+	TotalRows            int               `json:"total_rows"`
+	ValidRows            int               `json:"valid_rows"`
+	Imported             int               `json:"imported"`
+	Failed               int               `json:"failed"`
+	Columns              map[string]string `json:"columns"` // Field -> header it is read from
+	UnmappedColumns      []string          `json:"unmapped_columns"`
+	CreatedDocumentTypes []string          `json:"created_document_types"` // Created, or to be created in a dry run
+	CreatedIssuingUnits  []string          `json:"created_issuing_units"`
+	Errors               []ImportRowError  `json:"errors"`
+}
+
+func (r *ImportReport) addError(row int, field, message string) {
+	r.Errors = append(r.Errors, ImportRowError{Row: row, Field: field, Message: message})
+}
+
+// importLookups resolves the names used in a register to document types, issuing units and users.
+// Types and units are keyed by folded name; one not created yet is missing or maps to 0.
+type importLookups struct {
+	createMissing bool
+	documentTypes map[string]uint
+	issuingUnits  map[string]uint
+	typeNames     map[string]string // Folded name -> name as written, for the ones to be created
+	unitNames     map[string]string
+	users         map[string]uint // Folded username or name -> user; 0 when the name is shared
+}
+
+func loadImportLookups(db *gorm.DB, createMissing bool) (*importLookups, error) {
+	lookups := &importLookups{
+		createMissing: createMissing,
+		documentTypes: make(map[string]uint),
+		issuingUnits:  make(map[string]uint),
+		typeNames:     make(map[string]string),
+		unitNames:     make(map[string]string),
+		users:         make(map[string]uint),
+	}
+
+	var documentTypes []models.DocumentType
+	if err := db.Find(&documentTypes).Error; err != nil {
+		return nil, err
+	}
+	for _, documentType := range documentTypes {
+		lookups.documentTypes[services.FoldText(documentType.Name)] = documentType.ID
+		if documentType.Code != "" {
+			if _, taken := lookups.documentTypes[services.FoldText(documentType.Code)]; !taken {
+				lookups.documentTypes[services.FoldText(documentType.Code)] = documentType.ID
+			}
+		}
+	}
+
+	var issuingUnits []models.IssuingUnit
+	if err := db.Find(&issuingUnits).Error; err != nil {
+		return nil, err
+	}
+	for _, issuingUnit := range issuingUnits {
+		lookups.issuingUnits[services.FoldText(issuingUnit.Name)] = issuingUnit.ID
+	}
+
+	var users []models.User
+	if err := db.Select("id, name, username").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		lookups.users[services.FoldText(user.Username)] = user.ID
+	}
+	for _, user := range users {
+		name := services.FoldText(user.Name)
+		if id, seen := lookups.users[name]; seen && id != user.ID {
+			lookups.users[name] = 0
+		} else {
+			lookups.users[name] = user.ID
+		}
+	}
+	return lookups, nil
+}
+
+// documentType returns the key of a document type. An unknown type is accepted when missing
+// ones may be created; planMissing registers it once its row is known to be valid.
+func (l *importLookups) documentType(name string) (string, string) {
+	key := services.FoldText(name)
+	if _, ok := l.documentTypes[key]; !ok && !l.createMissing {
+		return "", fmt.Sprintf("Loại văn bản \"%s\" không tồn tại", name)
+	}
+	return key, ""
+}
+
+// issuingUnit returns the key of an issuing unit, accepting unknown ones like documentType
+func (l *importLookups) issuingUnit(name string) (string, string) {
+	key := services.FoldText(name)
+	if _, ok := l.issuingUnits[key]; !ok && !l.createMissing {
+		return "", fmt.Sprintf("Cơ quan ban hành \"%s\" không tồn tại", name)
+	}
+	return key, ""
+}
+
+// user finds a user by username or full name
+func (l *importLookups) user(name string) (uint, string) {
+	id, ok := l.users[services.FoldText(name)]
+	switch {
+	case !ok:
+		return 0, fmt.Sprintf("Người dùng \"%s\" không tồn tại", name)
+	case id == 0:
+		return 0, fmt.Sprintf("Có nhiều người dùng tên \"%s\", vui lòng dùng tên đăng nhập", name)
+	}
+	return id, ""
+}
+
+// pendingNames lists the names registered for creation, sorted. With created set, only the
+// ones that were created are listed.
+func pendingNames(names map[string]string, ids map[string]uint, created bool) []string {
+	list := make([]string, 0, len(names))
+	for key, name := range names {
+		if !created || ids[key] != 0 {
+			list = append(list, name)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// planMissing registers for creation the document types and issuing units that valid records
+// use but the system does not know yet
+func (l *importLookups) planMissing(records []importRecord) {
+	for _, record := range records {
+		if key := services.FoldText(record.documentType); l.documentTypes[key] == 0 {
+			l.typeNames[key] = strings.TrimSpace(record.documentType)
+		}
+		if key := services.FoldText(record.issuingUnit); l.issuingUnits[key] == 0 {
+			l.unitNames[key] = strings.TrimSpace(record.issuingUnit)
+		}
+	}
+}
+
+// createMissingTx creates the document type and issuing unit of a record when they do not exist
+// yet. It runs under the row's savepoint, so a row that cannot be saved leaves nothing behind;
+// the returned undo forgets what was created once the savepoint or the batch is rolled back.
+func (l *importLookups) createMissingTx(tx *gorm.DB, record importRecord) (func(), error) {
+	var createdType, createdUnit string
+	undo := func() {
+		if createdType != "" {
+			delete(l.documentTypes, createdType)
+		}
+		if createdUnit != "" {
+			delete(l.issuingUnits, createdUnit)
+		}
+	}
+
+	if key := services.FoldText(record.documentType); l.documentTypes[key] == 0 {
+		documentType := models.DocumentType{Name: l.typeNames[key], IsActive: true}
+		if err := tx.Create(&documentType).Error; err != nil {
+			return undo, err
+		}
+		l.documentTypes[key] = documentType.ID
+		createdType = key
+	}
+	if key := services.FoldText(record.issuingUnit); l.issuingUnits[key] == 0 {
+		issuingUnit := models.IssuingUnit{Name: l.unitNames[key], IsActive: true}
+		if err := tx.Create(&issuingUnit).Error; err != nil {
+			return undo, err
+		}
+		l.issuingUnits[key] = issuingUnit.ID
+		createdUnit = key
+	}
+	return undo, nil
+}
+
+// importRegister identifies a numbering register whose counter must stay ahead of imported numbers
+type importRegister struct {
+	scope          string
+	year           int
+	book           string
+	documentTypeID uint // Outgoing registers only
+}
+
+// importRecord is a validated row waiting to be inserted
+type importRecord struct {
+	line         int
+	number       int    // Number the row takes in its register, 0 when it takes none
+	documentType string // As written in the file
+	issuingUnit  string
+	// register runs before the batch is inserted, insert once missing types and units exist.
+	// Rows of types still to be created take no number, so register never needs their ID.
+	register func(*importLookups) importRegister
+	insert   func(*gorm.DB, *importLookups) error
+}
+
+// importRequest holds the options of an import upload
+type importRequest struct {
+	filename      string
+	rows          []services.ImportRow
+	overrides     map[string]string
+	dryRun        bool
+	createMissing bool
+	batchSize     int
+	registerBook  string
+}
+
+// parseImportRequest reads the uploaded file and the import options. Imports are dry runs
+// unless dry_run=false is sent.
+func parseImportRequest(c *gin.Context) (*importRequest, bool) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vui lòng chọn file cần nhập"})
+		return nil, false
+	}
+	if fileHeader.Size > services.MaxImportFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("File quá lớn, tối đa %d MB", services.MaxImportFileSize/(1024*1024))})
+		return nil, false
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không thể đọc file"})
+		return nil, false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, services.MaxImportFileSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không thể đọc file"})
+		return nil, false
+	}
+
+	rows, err := services.ReadImportRows(data, fileHeader.Filename)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if len(rows) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File không có dữ liệu, dòng đầu tiên phải là tiêu đề cột"})
+		return nil, false
+	}
+
+	req := &importRequest{
+		filename:      fileHeader.Filename,
+		rows:          rows,
+		dryRun:        c.DefaultPostForm("dry_run", "true") != "false",
+		createMissing: c.PostForm("create_missing") == "true",
+		batchSize:     defaultImportBatchSize,
+		registerBook:  strings.TrimSpace(c.PostForm("register_book")),
+	}
+	if mapping := c.PostForm("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &req.overrides); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cấu hình cột không hợp lệ"})
+			return nil, false
+		}
+	}
+	if batchSize := c.PostForm("batch_size"); batchSize != "" {
+		size, err := strconv.Atoi(batchSize)
+		if err != nil || size < 1 || size > maxImportBatchSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Số dòng mỗi lô phải từ 1 đến %d", maxImportBatchSize)})
+			return nil, false
+		}
+		req.batchSize = size
+	}
+	return req, true
+}
+
+// mapImportColumns maps the header row and checks that every required field has a column
+func mapImportColumns(c *gin.Context, req *importRequest, aliases map[string][]string, required []string, report *ImportReport) (map[string]int, bool) {
+	header := req.rows[0].Cells
+	columns, unmapped := services.MapImportColumns(header, aliases, req.overrides)
+
+	var missing []string
+	for _, field := range required {
+		if _, ok := columns[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":            "File thiếu cột bắt buộc: " + strings.Join(missing, ", "),
+			"missing_columns":  missing,
+			"unmapped_columns": unmapped,
+		})
+		return nil, false
+	}
+
+	report.Columns = make(map[string]string, len(columns))
+	for field, i := range columns {
+		report.Columns[field] = header[i]
+	}
+	report.UnmappedColumns = unmapped
+	return columns, true
+}
+
+// importCell returns the trimmed value of a field in a row, empty when the file has no such column
+func importCell(row services.ImportRow, columns map[string]int, field string) string {
+	i, ok := columns[field]
+	if !ok || i >= len(row.Cells) {
+		return ""
+	}
+	return strings.TrimSpace(row.Cells[i])
+}
+
+// insertImportBatchTx inserts a batch of records, each under a savepoint so a failing row does
+// not take the others with it, nor leave behind the types and units created for it. The
+// counters of the registers touched are locked first and moved past the imported numbers, so
+// numbers handed out later do not collide with them. undo forgets the types and units created
+// in the batch, for when it is rolled back.
+func insertImportBatchTx(tx *gorm.DB, records []importRecord, lookups *importLookups, report *ImportReport) (imported int, undo func(), err error) {
+	var undos []func()
+	undo = func() {
+		for _, u := range undos {
+			u()
+		}
+	}
+
+	highest := make(map[importRegister]int)
+	for _, record := range records {
+		if record.number == 0 {
+			continue
+		}
+		register := record.register(lookups)
+		if record.number > highest[register] {
+			highest[register] = record.number
+		}
+	}
+
+	// Lock in a fixed order so concurrent imports cannot deadlock
+	registers := make([]importRegister, 0, len(highest))
+	for register := range highest {
+		registers = append(registers, register)
+	}
+	sort.Slice(registers, func(i, j int) bool {
+		a, b := registers[i], registers[j]
+		if a.scope != b.scope {
+			return a.scope < b.scope
+		}
+		if a.year != b.year {
+			return a.year < b.year
+		}
+		return a.book < b.book
+	})
+	sequences := make([]*models.DocumentSequence, len(registers))
+	for i, register := range registers {
+		lastUsed := func() (int, error) { return highestArrivalNumber(tx, register.year, register.book) }
+		if register.scope == models.SequenceScopeOutgoing {
+			lastUsed = func() (int, error) { return highestOutgoingNumber(tx, register.year, register.documentTypeID) }
+		}
+		sequence, err := services.LockSequence(tx, register.scope, register.year, register.book, lastUsed)
+		if err != nil {
+			return 0, undo, err
+		}
+		sequences[i] = sequence
+	}
+
+	for _, record := range records {
+		if err := tx.Exec("SAVEPOINT import_row").Error; err != nil {
+			return 0, undo, err
+		}
+		undoRow, err := lookups.createMissingTx(tx, record)
+		if err == nil {
+			err = record.insert(tx, lookups)
+		}
+		if err != nil {
+			undoRow()
+			if rollbackErr := tx.Exec("ROLLBACK TO SAVEPOINT import_row").Error; rollbackErr != nil {
+				return 0, undo, rollbackErr
+			}
+			report.addError(record.line, "", "Không thể lưu dòng: "+err.Error())
+			continue
+		}
+		undos = append(undos, undoRow)
+		if err := tx.Exec("RELEASE SAVEPOINT import_row").Error; err != nil {
+			return 0, undo, err
+		}
+		imported++
+	}
+
+	for i, sequence := range sequences {
+		if sequence.LastValue < highest[registers[i]] {
+			if err := tx.Model(sequence).Update("last_value", highest[registers[i]]).Error; err != nil {
+				return 0, undo, err
+			}
+		}
+	}
+	return imported, undo, nil
+}
+
+// runImport inserts the validated records in batches, creating missing types and units with
+// the first row that uses them, and audits the import
+func runImport(c *gin.Context, req *importRequest, records []importRecord, lookups *importLookups, report *ImportReport, entityType models.AuditEntityType, label string) {
+	for start := 0; start < len(records); start += req.batchSize {
+		end := start + req.batchSize
+		if end > len(records) {
+			end = len(records)
+		}
+		batch := records[start:end]
+
+		tx := database.DB.Begin()
+		imported, undo, err := insertImportBatchTx(tx, batch, lookups, report)
+		if err == nil {
+			err = tx.Commit().Error
+		} else {
+			tx.Rollback()
+		}
+		if err != nil {
+			undo()
+			for _, record := range batch {
+				report.addError(record.line, "", "Lô dữ liệu không được lưu: "+err.Error())
+			}
+			continue
+		}
+		report.Imported += imported
+	}
+
+	sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Row < report.Errors[j].Row })
+	report.Failed = report.TotalRows - report.Imported
+	report.CreatedDocumentTypes = pendingNames(lookups.typeNames, lookups.documentTypes, true)
+	report.CreatedIssuingUnits = pendingNames(lookups.unitNames, lookups.issuingUnits, true)
+
+	services.NewAuditService().LogActivity(c, models.AuditActionDocumentImport, entityType, 0,
+		fmt.Sprintf("Nhập %d/%d %s từ file %s", report.Imported, report.TotalRows, label, req.filename),
+		nil, nil, gin.H{
+			"file":                   req.filename,
+			"total_rows":             report.TotalRows,
+			"imported":               report.Imported,
+			"failed":                 report.Failed,
+			"created_document_types": report.CreatedDocumentTypes,
+			"created_issuing_units":  report.CreatedIssuingUnits,
+		})
+}
+
+// finishImport answers a dry run with the validation report, or performs the import
+func finishImport(c *gin.Context, req *importRequest, records []importRecord, lookups *importLookups, report *ImportReport, entityType models.AuditEntityType, label string) {
+	report.ValidRows = len(records)
+	lookups.planMissing(records)
+
+	if report.DryRun {
+		report.Failed = report.TotalRows - report.ValidRows
+		report.CreatedDocumentTypes = pendingNames(lookups.typeNames, lookups.documentTypes, false)
+		report.CreatedIssuingUnits = pendingNames(lookups.unitNames, lookups.issuingUnits, false)
+		c.JSON(http.StatusOK, report)
+		return
+	}
+	runImport(c, req, records, lookups, report, entityType, label)
+	c.JSON(http.StatusOK, report)
+}
+
+// ImportIncomingDocuments imports an incoming register from CSV or XLSX. Rows keep the arrival
+// numbers of the register they come from, and the yearly counters are moved past them.
+// Without dry_run=false only the validation report is returned. Rows without a status are
+// imported as completed, since they are mostly historical.
+func ImportIncomingDocuments(c *gin.Context) {
+	req, ok := parseImportRequest(c)
+	if !ok {
+		return
+	}
+
+	report := &ImportReport{DryRun: req.dryRun, TotalRows: len(req.rows) - 1, Errors: []ImportRowError{}}
+	columns, ok := mapImportColumns(c, req, incomingImportColumns, incomingImportRequired, report)
+	if !ok {
+		return
+	}
+
+	lookups, err := loadImportLookups(database.DB, req.createMissing)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tải dữ liệu danh mục"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	type arrivalKey struct {
+		year   int
+		book   string
+		number int
+	}
+	seen := make(map[arrivalKey]int)
+	var records []importRecord
+	var keys []arrivalKey
+
+	for _, row := range req.rows[1:] {
+		cell := func(field string) string { return importCell(row, columns, field) }
+		failed := false
+		fail := func(field, message string) {
+			report.addError(row.Line, field, message)
+			failed = true
+		}
+
+		arrivalNumber, err := strconv.Atoi(cell("arrival_number"))
+		if err != nil || arrivalNumber <= 0 {
+			fail("arrival_number", "Số đến phải là số nguyên dương")
+		}
+		arrivalDate, err := services.ParseImportDate(cell("arrival_date"))
+		if err != nil {
+			fail("arrival_date", "Ngày đến không hợp lệ")
+		}
+		documentDate, err := services.ParseImportDate(cell("document_date"))
+		if err != nil {
+			fail("document_date", "Ngày văn bản không hợp lệ")
+		}
+		for _, field := range []string{"original_number", "document_type", "issuing_unit", "summary"} {
+			if cell(field) == "" {
+				fail(field, "Không được để trống")
+			}
+		}
+
+		typeKey, message := "", ""
+		if cell("document_type") != "" {
+			if typeKey, message = lookups.documentType(cell("document_type")); message != "" {
+				fail("document_type", message)
+			}
+		}
+		unitKey := ""
+		if cell("issuing_unit") != "" {
+			if unitKey, message = lookups.issuingUnit(cell("issuing_unit")); message != "" {
+				fail("issuing_unit", message)
+			}
+		}
+
+		var processorID *uint
+		if name := cell("processor"); name != "" {
+			id, message := lookups.user(name)
+			if message != "" {
+				fail("processor", message)
+			} else {
+				processorID = &id
+			}
+		}
+
+		status := cell("status")
+		switch status {
+		case "":
+			status = models.IncomingStatusCompleted
+		case models.IncomingStatusReceived, models.IncomingStatusForwarded, models.IncomingStatusAssigned,
+			models.IncomingStatusProcessing, models.IncomingStatusCompleted:
+		default:
+			fail("status", "Trạng thái không hợp lệ")
+		}
+		urgency, ok := services.ParseImportUrgency(cell("urgency"))
+		if !ok {
+			fail("urgency", "Độ khẩn không hợp lệ")
+		}
+		secrecyLevel, ok := services.ParseImportSecrecy(cell("secrecy_level"))
+		if !ok {
+			fail("secrecy_level", "Độ mật không hợp lệ")
+		}
+
+		registerBook := cell("register_book")
+		if registerBook == "" {
+			registerBook = req.registerBook
+		}
+		if failed {
+			continue
+		}
+
+		key := arrivalKey{arrivalDate.Year(), registerBook, arrivalNumber}
+		if line, duplicate := seen[key]; duplicate {
+			report.addError(row.Line, "arrival_number", fmt.Sprintf("Số đến %d năm %d trùng với dòng %d", arrivalNumber, key.year, line))
+			continue
+		}
+		seen[key] = row.Line
+
+		document := &models.IncomingDocument{
+			ArrivalDate:    arrivalDate,
+			ArrivalNumber:  arrivalNumber,
+			ArrivalYear:    arrivalDate.Year(),
+			RegisterBook:   registerBook,
+			OriginalNumber: cell("original_number"),
+			DocumentDate:   documentDate,
+			Summary:        cell("summary"),
+			Urgency:        urgency,
+			SecrecyLevel:   secrecyLevel,
+			InternalNotes:  cell("internal_notes"),
+			ProcessorID:    processorID,
+			Status:         status,
+			CreatedByID:    userID.(uint),
+		}
+		keys = append(keys, key)
+		records = append(records, importRecord{
+			line:         row.Line,
+			number:       arrivalNumber,
+			documentType: cell("document_type"),
+			issuingUnit:  cell("issuing_unit"),
+			register: func(*importLookups) importRegister {
+				return importRegister{scope: models.SequenceScopeIncoming, year: key.year, book: key.book}
+			},
+			insert: func(tx *gorm.DB, lookups *importLookups) error {
+				document.DocumentTypeID = lookups.documentTypes[typeKey]
+				document.IssuingUnitID = lookups.issuingUnits[unitKey]
+				return tx.Create(document).Error
+			},
+		})
+	}
+
+	// Numbers already taken in the registers the file writes to
+	years := make(map[int]bool)
+	for _, key := range keys {
+		years[key.year] = true
+	}
+	if len(years) > 0 {
+		yearList := make([]int, 0, len(years))
+		for year := range years {
+			yearList = append(yearList, year)
+		}
+		var existing []struct {
+			ArrivalYear   int
+			RegisterBook  string
+			ArrivalNumber int
+		}
+		if err := database.DB.Table("incoming_documents").Select("arrival_year, register_book, arrival_number").
+			Where("arrival_year IN (?) AND deleted_at IS NULL", yearList).Scan(&existing).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể kiểm tra số đến đã dùng"})
+			return
+		}
+		taken := make(map[arrivalKey]bool, len(existing))
+		for _, row := range existing {
+			taken[arrivalKey{row.ArrivalYear, row.RegisterBook, row.ArrivalNumber}] = true
+		}
+
+		kept := records[:0]
+		for i, record := range records {
+			if taken[keys[i]] {
+				report.addError(record.line, "arrival_number",
+					fmt.Sprintf("Số đến %d năm %d đã được sử dụng", keys[i].number, keys[i].year))
+				continue
+			}
+			kept = append(kept, record)
+		}
+		records = kept
+	}
+
+	finishImport(c, req, records, lookups, report, models.AuditEntityIncomingDocument, "văn bản đến")
+}
+
+// Leading number of a document number such as "12/QĐ-CAX"
+var leadingNumber = regexp.MustCompile(`^0*(\d+)`)
+
+// registerSequenceOf works out which number of the type's register an imported document number
+// is, when the number follows the type's template. It returns 0 for numbers typed by hand.
+func registerSequenceOf(number string, year int, documentType *models.DocumentType, unitCode string) int {
+	if documentType == nil || documentType.NumberTemplate == "" {
+		return 0
+	}
+	match := leadingNumber.FindStringSubmatch(number)
+	if match == nil {
+		return 0
+	}
+	seq, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+	formatted := services.FormatDocumentNumber(documentType.NumberTemplate, seq, year, documentType.Code, unitCode)
+	if services.NormalizeDocumentNumber(formatted) != services.NormalizeDocumentNumber(number) {
+		return 0
+	}
+	return seq
+}
+
+// ImportOutgoingDocuments imports an outgoing register from CSV or XLSX, keeping the document
+// numbers. Numbers that follow their type's template are entered in the type's register so
+// later numbers continue after them. Rows without a drafter or approver are attributed to the
+// importing user, and rows without a status are imported as sent.
+func ImportOutgoingDocuments(c *gin.Context) {
+	req, ok := parseImportRequest(c)
+	if !ok {
+		return
+	}
+
+	report := &ImportReport{DryRun: req.dryRun, TotalRows: len(req.rows) - 1, Errors: []ImportRowError{}}
+	columns, ok := mapImportColumns(c, req, outgoingImportColumns, outgoingImportRequired, report)
+	if !ok {
+		return
+	}
+
+	lookups, err := loadImportLookups(database.DB, req.createMissing)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tải dữ liệu danh mục"})
+		return
+	}
+
+	var documentTypes []models.DocumentType
+	database.DB.Find(&documentTypes)
+	typesByID := make(map[uint]*models.DocumentType, len(documentTypes))
+	for i := range documentTypes {
+		typesByID[documentTypes[i].ID] = &documentTypes[i]
+	}
+	var issuingUnits []models.IssuingUnit
+	database.DB.Find(&issuingUnits)
+	unitCodes := make(map[uint]string, len(issuingUnits))
+	for _, issuingUnit := range issuingUnits {
+		unitCodes[issuingUnit.ID] = issuingUnit.Code
+	}
+
+	userID, _ := c.Get("user_id")
+
+	seen := make(map[string]int)
+	var records []importRecord
+
+	for _, row := range req.rows[1:] {
+		cell := func(field string) string { return importCell(row, columns, field) }
+		failed := false
+		fail := func(field, message string) {
+			report.addError(row.Line, field, message)
+			failed = true
+		}
+
+		documentNumber := cell("document_number")
+		if documentNumber == "" {
+			fail("document_number", "Không được để trống")
+		}
+		issueDate, err := services.ParseImportDate(cell("issue_date"))
+		if err != nil {
+			fail("issue_date", "Ngày ban hành không hợp lệ")
+		}
+		for _, field := range []string{"document_type", "issuing_unit", "summary"} {
+			if cell(field) == "" {
+				fail(field, "Không được để trống")
+			}
+		}
+
+		typeKey, message := "", ""
+		if cell("document_type") != "" {
+			if typeKey, message = lookups.documentType(cell("document_type")); message != "" {
+				fail("document_type", message)
+			}
+		}
+		unitKey := ""
+		if cell("issuing_unit") != "" {
+			if unitKey, message = lookups.issuingUnit(cell("issuing_unit")); message != "" {
+				fail("issuing_unit", message)
+			}
+		}
+
+		drafterID, approverID := userID.(uint), userID.(uint)
+		if name := cell("drafter"); name != "" {
+			if drafterID, message = lookups.user(name); message != "" {
+				fail("drafter", message)
+			}
+		}
+		if name := cell("approver"); name != "" {
+			if approverID, message = lookups.user(name); message != "" {
+				fail("approver", message)
+			}
+		}
+
+		status := cell("status")
+		switch status {
+		case "":
+			status = models.OutgoingStatusSent
+		case models.OutgoingStatusDraft, models.OutgoingStatusReview, models.OutgoingStatusApproved, models.OutgoingStatusIssued,
+			models.OutgoingStatusSent, models.OutgoingStatusRejected, models.OutgoingStatusCancelled:
+		default:
+			fail("status", "Trạng thái không hợp lệ")
+		}
+		urgency, ok := services.ParseImportUrgency(cell("urgency"))
+		if !ok {
+			fail("urgency", "Độ khẩn không hợp lệ")
+		}
+		secrecyLevel, ok := services.ParseImportSecrecy(cell("secrecy_level"))
+		if !ok {
+			fail("secrecy_level", "Độ mật không hợp lệ")
+		}
+		if failed {
+			continue
+		}
+
+		year := issueDate.Year()
+		key := fmt.Sprintf("%d|%s|%s", year, typeKey, services.NormalizeDocumentNumber(documentNumber))
+		if line, duplicate := seen[key]; duplicate {
+			report.addError(row.Line, "document_number", fmt.Sprintf("Số văn bản %s trùng với dòng %d", documentNumber, line))
+			continue
+		}
+		seen[key] = row.Line
+
+		typeID, unitID := lookups.documentTypes[typeKey], lookups.issuingUnits[unitKey]
+		if typeID > 0 && outgoingNumberTaken(database.DB, documentNumber, year, typeID, 0) {
+			report.addError(row.Line, "document_number", fmt.Sprintf("Số văn bản %s đã tồn tại trong năm %d", documentNumber, year))
+			continue
+		}
+		sequenceNumber := registerSequenceOf(documentNumber, year, typesByID[typeID], unitCodes[unitID])
+
+		document := &models.OutgoingDocument{
+			DocumentNumber: documentNumber,
+			NumberYear:     year,
+			SequenceNumber: sequenceNumber,
+			IssueDate:      issueDate,
+			Summary:        cell("summary"),
+			Urgency:        urgency,
+			SecrecyLevel:   secrecyLevel,
+			DrafterID:      drafterID,
+			ApproverID:     approverID,
+			InternalNotes:  cell("internal_notes"),
+			Status:         status,
+			CreatedByID:    userID.(uint),
+		}
+		records = append(records, importRecord{
+			line:         row.Line,
+			number:       sequenceNumber,
+			documentType: cell("document_type"),
+			issuingUnit:  cell("issuing_unit"),
+			register: func(lookups *importLookups) importRegister {
+				typeID := lookups.documentTypes[typeKey]
+				return importRegister{scope: models.SequenceScopeOutgoing, year: year, book: outgoingRegisterBook(typeID), documentTypeID: typeID}
+			},
+			insert: func(tx *gorm.DB, lookups *importLookups) error {
+				document.DocumentTypeID = lookups.documentTypes[typeKey]
+				document.IssuingUnitID = lookups.issuingUnits[unitKey]
+				return tx.Create(document).Error
+			},
+		})
+	}
+
+	finishImport(c, req, records, lookups, report, models.AuditEntityOutgoingDocument, "văn bản đi")
+}
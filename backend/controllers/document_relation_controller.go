@@ -0,0 +1,347 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"ai-code-agent-backend/services"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type CreateDocumentRelationRequest struct {
+	TargetType   string `json:"target_type" binding:"required"` // "incoming_document" or "outgoing_document"
+	TargetID     uint   `json:"target_id" binding:"required"`
+	RelationType string `json:"relation_type" binding:"required"`
+	Notes        string `json:"notes"`
+}
+
+// relationDocument is a document at one end of a relation
+type relationDocument struct {
+	Type        string
+	ID          uint
+	AuditEntity models.AuditEntityType
+	Label       string
+	WrittenOn   time.Time // Date the document was written: the document date of incoming ones
+	ReceivedOn  time.Time // Date the office had it: the arrival date of incoming ones
+}
+
+// loadRelationDocument loads a document that is to be linked and checks the user may see it
+func loadRelationDocument(c *gin.Context, documentType string, id uint) (*relationDocument, bool) {
+	switch documentType {
+	case models.RelationDocumentIncoming:
+		var document models.IncomingDocument
+		if err := database.DB.First(&document, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đến"})
+			return nil, false
+		}
+		if !requireIncomingDocumentAccess(c, &document) {
+			return nil, false
+		}
+		return &relationDocument{
+			Type:        documentType,
+			ID:          document.ID,
+			AuditEntity: models.AuditEntityIncomingDocument,
+			Label:       fmt.Sprintf("văn bản đến số %d", document.ArrivalNumber),
+			WrittenOn:   document.DocumentDate,
+			ReceivedOn:  document.ArrivalDate,
+		}, true
+	case models.RelationDocumentOutgoing:
+		var document models.OutgoingDocument
+		if err := database.DB.First(&document, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đi"})
+			return nil, false
+		}
+		if !requireOutgoingDocumentAccess(c, &document) {
+			return nil, false
+		}
+		return &relationDocument{
+			Type:        documentType,
+			ID:          document.ID,
+			AuditEntity: models.AuditEntityOutgoingDocument,
+			Label:       fmt.Sprintf("văn bản đi %s", document.DocumentNumber),
+			WrittenOn:   document.IssueDate,
+			ReceivedOn:  document.IssueDate,
+		}, true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Loại văn bản không hợp lệ"})
+	return nil, false
+}
+
+// validateDocumentRelation checks that source may be linked to target with the relation type.
+// Replies run between directions and cannot predate what they answer; replacements and
+// amendments stay within one direction and may not loop back on themselves.
+func validateDocumentRelation(db *gorm.DB, source, target *relationDocument, relationType string) error {
+	if !models.IsValidDocumentRelationType(relationType) {
+		return &operationError{http.StatusBadRequest, "Loại quan hệ không hợp lệ"}
+	}
+	if source.Type == target.Type && source.ID == target.ID {
+		return &operationError{http.StatusBadRequest, "Văn bản không thể liên kết với chính nó"}
+	}
+
+	switch relationType {
+	case models.DocumentRelationRepliesTo:
+		if source.Type == target.Type {
+			return &operationError{http.StatusBadRequest, "Văn bản đi chỉ trả lời văn bản đến và ngược lại"}
+		}
+		if source.WrittenOn.Format("2006-01-02") < target.ReceivedOn.Format("2006-01-02") {
+			return &operationError{http.StatusBadRequest, "Văn bản trả lời không thể có ngày trước ngày nhận được văn bản được trả lời"}
+		}
+	case models.DocumentRelationSupersedes, models.DocumentRelationAmends:
+		if source.Type != target.Type {
+			return &operationError{http.StatusBadRequest, "Văn bản chỉ thay thế hoặc sửa đổi văn bản cùng chiều đến hoặc đi"}
+		}
+	}
+
+	var existing []models.DocumentRelation
+	if err := db.Where("(source_type = ? AND source_id = ? AND target_type = ? AND target_id = ?) OR (source_type = ? AND source_id = ? AND target_type = ? AND target_id = ?)",
+		source.Type, source.ID, target.Type, target.ID, target.Type, target.ID, source.Type, source.ID).
+		Find(&existing).Error; err != nil {
+		return err
+	}
+	for _, relation := range existing {
+		forward := relation.SourceType == source.Type && relation.SourceID == source.ID
+		switch {
+		case forward && relation.RelationType == relationType:
+			return &operationError{http.StatusBadRequest, "Hai văn bản đã có quan hệ này"}
+		case !forward && relation.RelationType == relationType && relationType != models.DocumentRelationCites:
+			return &operationError{http.StatusBadRequest, "Văn bản kia đã được ghi nhận có quan hệ này theo chiều ngược lại"}
+		case isReplacement(relation.RelationType) && isReplacement(relationType):
+			return &operationError{http.StatusBadRequest, "Hai văn bản đã có quan hệ thay thế hoặc sửa đổi"}
+		}
+	}
+
+	if isReplacement(relationType) {
+		loops, err := replacementReaches(db, target, source)
+		if err != nil {
+			return err
+		}
+		if loops {
+			return &operationError{http.StatusBadRequest, "Quan hệ này tạo thành vòng thay thế hoặc sửa đổi giữa các văn bản"}
+		}
+	}
+	return nil
+}
+
+func isReplacement(relationType string) bool {
+	return relationType == models.DocumentRelationSupersedes || relationType == models.DocumentRelationAmends
+}
+
+// replacementReaches reports whether from already replaces or amends to, directly or through
+// other documents
+func replacementReaches(db *gorm.DB, from, to *relationDocument) (bool, error) {
+	visited := map[uint]bool{from.ID: true}
+	frontier := []uint{from.ID}
+	for len(frontier) > 0 {
+		var next []uint
+		if err := db.Model(&models.DocumentRelation{}).
+			Where("source_type = ? AND target_type = ? AND source_id IN (?) AND relation_type IN (?)",
+				from.Type, from.Type, frontier, []string{models.DocumentRelationSupersedes, models.DocumentRelationAmends}).
+			Pluck("target_id", &next).Error; err != nil {
+			return false, err
+		}
+		frontier = nil
+		for _, id := range next {
+			if id == to.ID {
+				return true, nil
+			}
+			if !visited[id] {
+				visited[id] = true
+				frontier = append(frontier, id)
+			}
+		}
+	}
+	return false, nil
+}
+
+func createDocumentRelation(c *gin.Context, sourceType string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	var req CreateDocumentRelationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
+		return
+	}
+
+	source, ok := loadRelationDocument(c, sourceType, uint(id))
+	if !ok {
+		return
+	}
+	target, ok := loadRelationDocument(c, req.TargetType, req.TargetID)
+	if !ok {
+		return
+	}
+	if err := validateDocumentRelation(database.DB, source, target, req.RelationType); err != nil {
+		respondOperationError(c, err, "Không thể tạo liên kết")
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	relation := models.DocumentRelation{
+		SourceType:   source.Type,
+		SourceID:     source.ID,
+		TargetType:   target.Type,
+		TargetID:     target.ID,
+		RelationType: req.RelationType,
+		Notes:        req.Notes,
+		CreatedByID:  userID.(uint),
+	}
+	if err := database.DB.Create(&relation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo liên kết"})
+		return
+	}
+
+	services.NewAuditService().LogActivity(c, models.AuditActionRelationCreate, source.AuditEntity, source.ID,
+		fmt.Sprintf("Liên kết %s (%s) với %s", source.Label, relation.RelationType, target.Label),
+		nil, relation, nil)
+
+	database.DB.Preload("CreatedBy").First(&relation, relation.ID)
+	c.JSON(http.StatusCreated, relation)
+}
+
+func getDocumentRelations(c *gin.Context, documentType string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+	if _, ok := loadRelationDocument(c, documentType, uint(id)); !ok {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	thread, err := services.CorrespondenceThreadOf(database.DB, documentType, uint(id), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy các văn bản liên quan"})
+		return
+	}
+	response := gin.H{"thread": thread}
+	if documentType == models.RelationDocumentIncoming {
+		responseTime, err := services.ResponseTimeOf(database.DB, uint(id))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy các văn bản liên quan"})
+			return
+		}
+		response["response_time"] = responseTime
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateIncomingDocumentRelation links an incoming document to another document
+func CreateIncomingDocumentRelation(c *gin.Context) {
+	createDocumentRelation(c, models.RelationDocumentIncoming)
+}
+
+// CreateOutgoingDocumentRelation links an outgoing document to another document, typically
+// as the reply to an incoming one
+func CreateOutgoingDocumentRelation(c *gin.Context) {
+	createDocumentRelation(c, models.RelationDocumentOutgoing)
+}
+
+// GetIncomingDocumentRelations returns the correspondence thread of an incoming document and
+// how long it took to be answered
+func GetIncomingDocumentRelations(c *gin.Context) {
+	getDocumentRelations(c, models.RelationDocumentIncoming)
+}
+
+// GetOutgoingDocumentRelations returns the correspondence thread of an outgoing document
+func GetOutgoingDocumentRelations(c *gin.Context) {
+	getDocumentRelations(c, models.RelationDocumentOutgoing)
+}
+
+// DeleteDocumentRelation removes a relation. Admins, secretaries and whoever created it may do so.
+func DeleteDocumentRelation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	var relation models.DocumentRelation
+	if err := database.DB.First(&relation, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy liên kết"})
+		return
+	}
+	source, ok := loadRelationDocument(c, relation.SourceType, relation.SourceID)
+	if !ok {
+		return
+	}
+	if userRole.(string) != models.RoleAdmin && userRole.(string) != models.RoleSecretary && relation.CreatedByID != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền xóa liên kết này"})
+		return
+	}
+
+	if err := database.DB.Delete(&relation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa liên kết"})
+		return
+	}
+
+	services.NewAuditService().LogActivity(c, models.AuditActionRelationDelete, source.AuditEntity, source.ID,
+		fmt.Sprintf("Xóa liên kết %s (%s) với văn bản %d", source.Label, relation.RelationType, relation.TargetID),
+		relation, nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Xóa liên kết thành công"})
+}
+
+// GetResponseTimes reports for the incoming documents that arrived in a period how many days
+// passed between arrival and the issue of their reply. Filters: from, to (YYYY-MM-DD) and
+// issuing_unit_id; without dates the last 90 days are reported.
+func GetResponseTimes(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	to := time.Now()
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ngày kết thúc không hợp lệ"})
+			return
+		}
+		to = parsed
+	}
+	from := to.AddDate(0, 0, -90)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ngày bắt đầu không hợp lệ"})
+			return
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ngày bắt đầu phải trước ngày kết thúc"})
+		return
+	}
+
+	query := services.ScopeVisibleIncomingDocuments(database.DB.Model(&models.IncomingDocument{}), userID.(uint)).
+		Where("incoming_documents.status <> ?", models.IncomingStatusDraft).
+		Where("DATE(incoming_documents.arrival_date) BETWEEN DATE(?) AND DATE(?)", from, to)
+	if unitID, err := strconv.Atoi(c.Query("issuing_unit_id")); err == nil && unitID > 0 {
+		query = query.Where("incoming_documents.issuing_unit_id = ?", unitID)
+	}
+
+	entries, err := services.ResponseTimes(query.Order("incoming_documents.arrival_date, incoming_documents.id"))
+	if err != nil {
+		log.Printf("Response time report failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lập báo cáo thời gian trả lời"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":      from.Format("2006-01-02"),
+		"to":        to.Format("2006-01-02"),
+		"summary":   services.SummarizeResponseTimes(entries),
+		"documents": entries,
+	})
+}
@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"ai-code-agent-backend/services"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type AdjustSequenceRequest struct {
+	LastValue *int   `json:"last_value" binding:"required"` // Next number handed out is LastValue+1
+	Reason    string `json:"reason" binding:"required"`
+}
+
+type CorrectArrivalNumberRequest struct {
+	ArrivalNumber int    `json:"arrival_number" binding:"required"`
+	Reason        string `json:"reason" binding:"required"`
+}
+
+// highestArrivalNumber returns the highest arrival number used in a register
+func highestArrivalNumber(db *gorm.DB, year int, book string) (int, error) {
+	var result struct {
+		Highest int `gorm:"column:highest"`
+	}
+	err := db.Raw("SELECT COALESCE(MAX(arrival_number), 0) AS highest FROM incoming_documents WHERE arrival_year = ? AND register_book = ? AND deleted_at IS NULL",
+		year, book).Scan(&result).Error
+	return result.Highest, err
+}
+
+// outgoingRegisterBook names the register book of a document type
+func outgoingRegisterBook(documentTypeID uint) string {
+	return strconv.FormatUint(uint64(documentTypeID), 10)
+}
+
+// highestOutgoingNumber returns the highest sequence number reserved for a document type.
+// Cancelled and deleted documents count, their numbers are never handed out again.
+func highestOutgoingNumber(db *gorm.DB, year int, documentTypeID uint) (int, error) {
+	var result struct {
+		Highest int `gorm:"column:highest"`
+	}
+	err := db.Raw("SELECT COALESCE(MAX(sequence_number), 0) AS highest FROM outgoing_documents WHERE number_year = ? AND document_type_id = ?",
+		year, documentTypeID).Scan(&result).Error
+	return result.Highest, err
+}
+
+// highestUsedNumber returns the highest number of the sequence's register already given to a record
+func highestUsedNumber(db *gorm.DB, sequence *models.DocumentSequence) (int, error) {
+	switch sequence.Scope {
+	case models.SequenceScopeIncoming:
+		return highestArrivalNumber(db, sequence.Year, sequence.RegisterBook)
+	case models.SequenceScopeOutgoing:
+		documentTypeID, err := strconv.ParseUint(sequence.RegisterBook, 10, 64)
+		if err != nil {
+			return 0, nil
+		}
+		return highestOutgoingNumber(db, sequence.Year, uint(documentTypeID))
+	}
+	return 0, nil
+}
+
+// GetDocumentSequences lists the numbering registers, optionally for one year
+func GetDocumentSequences(c *gin.Context) {
+	query := database.DB.Order("year desc, scope asc, register_book asc")
+	if year := c.Query("year"); year != "" {
+		query = query.Where("year = ?", year)
+	}
+	if scope := c.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+
+	var sequences []models.DocumentSequence
+	if err := query.Find(&sequences).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách sổ đăng ký"})
+		return
+	}
+
+	type SequenceWithUsage struct {
+		models.DocumentSequence
+		HighestUsed int `json:"highest_used"`
+	}
+	result := make([]SequenceWithUsage, len(sequences))
+	for i := range sequences {
+		highest, _ := highestUsedNumber(database.DB, &sequences[i])
+		result[i] = SequenceWithUsage{DocumentSequence: sequences[i], HighestUsed: highest}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// AdjustDocumentSequence sets the last number of a register. Raising it skips numbers; lowering
+// it hands out again numbers that were reserved but never used, never one that is taken.
+func AdjustDocumentSequence(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	var req AdjustSequenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" || *req.LastValue < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vui lòng nhập số cuối hợp lệ và lý do điều chỉnh"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	var sequence models.DocumentSequence
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&sequence, id).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy sổ đăng ký"})
+		return
+	}
+
+	highest, err := highestUsedNumber(tx, &sequence)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể điều chỉnh sổ đăng ký"})
+		return
+	}
+	if *req.LastValue < highest {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Số cuối không được nhỏ hơn số lớn nhất đã sử dụng (%d)", highest)})
+		return
+	}
+
+	oldValue := sequence.LastValue
+	if err := tx.Model(&sequence).Update("last_value", *req.LastValue).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể điều chỉnh sổ đăng ký"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể điều chỉnh sổ đăng ký"})
+		return
+	}
+
+	description := fmt.Sprintf("Điều chỉnh sổ %s năm %d từ số %d thành %d", sequence.Scope, sequence.Year, oldValue, sequence.LastValue)
+	if sequence.LastValue > oldValue {
+		description = fmt.Sprintf("Bỏ qua các số %d-%d của sổ %s năm %d", oldValue+1, sequence.LastValue, sequence.Scope, sequence.Year)
+	}
+	services.NewAuditService().LogActivity(c, models.AuditActionSequenceAdjust, models.AuditEntitySystem, sequence.ID, description,
+		gin.H{"last_value": oldValue}, gin.H{"last_value": sequence.LastValue},
+		gin.H{"reason": req.Reason, "scope": sequence.Scope, "year": sequence.Year, "register_book": sequence.RegisterBook})
+
+	c.JSON(http.StatusOK, sequence)
+}
+
+// CorrectArrivalNumber changes the arrival number of a document, e.g. to fix a number registered
+// out of order. The new number must be free in the document's register.
+func CorrectArrivalNumber(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	var req CorrectArrivalNumberRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" || req.ArrivalNumber < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vui lòng nhập số đến hợp lệ và lý do điều chỉnh"})
+		return
+	}
+
+	tx := database.DB.Begin()
+
+	// The document is locked too, so two corrections of it cannot both start from the old number
+	var document models.IncomingDocument
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&document, id).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đến"})
+		return
+	}
+	if document.ArrivalNumber == req.ArrivalNumber {
+		tx.Rollback()
+		c.JSON(http.StatusOK, document)
+		return
+	}
+
+	// Lock the register so the number cannot be handed out while it is being taken here
+	sequence, err := services.LockSequence(tx, models.SequenceScopeIncoming, document.ArrivalYear, document.RegisterBook,
+		func() (int, error) { return highestArrivalNumber(tx, document.ArrivalYear, document.RegisterBook) })
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể điều chỉnh số đến"})
+		return
+	}
+
+	var taken int
+	tx.Model(&models.IncomingDocument{}).
+		Where("arrival_year = ? AND register_book = ? AND arrival_number = ? AND id <> ?", document.ArrivalYear, document.RegisterBook, req.ArrivalNumber, document.ID).
+		Count(&taken)
+	if taken > 0 {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Số đến %d đã được sử dụng trong năm %d", req.ArrivalNumber, document.ArrivalYear)})
+		return
+	}
+
+	oldNumber := document.ArrivalNumber
+	err = tx.Model(&document).Update("arrival_number", req.ArrivalNumber).Error
+	if err == nil && req.ArrivalNumber > sequence.LastValue {
+		err = tx.Model(sequence).Update("last_value", req.ArrivalNumber).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể điều chỉnh số đến"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể điều chỉnh số đến"})
+		return
+	}
+
+	services.NewAuditService().LogActivity(c, models.AuditActionNumberCorrect, models.AuditEntityIncomingDocument, document.ID,
+		fmt.Sprintf("Điều chỉnh số đến từ %d thành %d (năm %d)", oldNumber, req.ArrivalNumber, document.ArrivalYear),
+		gin.H{"arrival_number": oldNumber}, gin.H{"arrival_number": req.ArrivalNumber},
+		gin.H{"reason": req.Reason, "register_book": document.RegisterBook})
+
+	c.JSON(http.StatusOK, document)
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"ai-code-agent-backend/database"
 	"ai-code-agent-backend/models"
+	"ai-code-agent-backend/services"
 	"net/http"
 	"strconv"
 
@@ -64,6 +65,12 @@ func CreateDocumentType(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Document type name is required"})
 		return
 	}
+	if documentType.NumberTemplate != "" {
+		if err := services.ValidateNumberTemplate(documentType.NumberTemplate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	// Set default values
 	documentType.IsActive = true
@@ -105,10 +112,18 @@ func UpdateDocumentType(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Document type name is required"})
 		return
 	}
+	if updateData.NumberTemplate != "" {
+		if err := services.ValidateNumberTemplate(updateData.NumberTemplate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	// Update fields
 	documentType.Name = updateData.Name
 	documentType.Description = updateData.Description
+	documentType.Code = updateData.Code
+	documentType.NumberTemplate = updateData.NumberTemplate
 	documentType.IsActive = updateData.IsActive
 
 	if err := database.DB.Save(&documentType).Error; err != nil {
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/models"
+	"ai-code-agent-backend/services"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportIncomingEmail takes in an uploaded .eml file as a draft incoming document. The draft is
+// completed and registered through CreateIncomingDocument with its draft_id.
+func ImportIncomingEmail(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vui lòng chọn file email (.eml)"})
+		return
+	}
+	if strings.ToLower(filepath.Ext(fileHeader.Filename)) != ".eml" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Chỉ hỗ trợ file email .eml"})
+		return
+	}
+	if fileHeader.Size > services.MaxEmailSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Email quá lớn, tối đa %d MB", services.MaxEmailSize/(1024*1024))})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không thể đọc file"})
+		return
+	}
+	defer file.Close()
+	raw, err := io.ReadAll(io.LimitReader(file, services.MaxEmailSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không thể đọc file"})
+		return
+	}
+
+	email, err := services.ParseEmail(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	document, err := services.ImportEmail(email, userID.(uint))
+	if err != nil {
+		if imported, ok := err.(*services.EmailAlreadyImportedError); ok {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email này đã được tiếp nhận", "document_id": imported.DocumentID})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	services.NewAuditService().LogActivity(c, models.AuditActionDocumentCreate, models.AuditEntityIncomingDocument, document.ID,
+		fmt.Sprintf("Tạo văn bản đến nháp từ email: %s", document.Summary),
+		nil, nil, gin.H{"source": "eml", "file": fileHeader.Filename, "message_id": email.MessageID})
+
+	c.JSON(http.StatusCreated, document)
+}
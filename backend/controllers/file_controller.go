@@ -227,10 +227,13 @@ func GetIncomingFiles(c *gin.Context) {
 		FROM files f
 		LEFT JOIN incoming_documents id ON f.document_id = id.id
 		WHERE f.document_type = 'incoming' AND f.deleted_at IS NULL
+		  AND (id.secrecy_level IS NULL OR id.secrecy_level = ? OR id.created_by_id = ? OR id.processor_id = ?
+		       OR id.id IN (SELECT entity_id FROM document_access_grants WHERE entity_type = ? AND user_id = ?))
 		ORDER BY f.uploaded_at DESC
 	`
 
-	if err := database.DB.Raw(query).Scan(&files).Error; err != nil {
+	userID, _ := c.Get("user_id")
+	if err := database.DB.Raw(query, models.SecrecyNone, userID, userID, models.AccessEntityIncomingDocument, userID).Scan(&files).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách file"})
 		return
 	}
@@ -258,6 +261,7 @@ func EnhancedDownloadFile(c *gin.Context) {
 	fileService := services.NewFileService()
 
 	// Check file access
+	auditClassifiedFileAccess(c, filePath, userID.(uint))
 	if err := fileService.CheckFileAccess(filePath, userID.(uint), userRole.(string)); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền truy cập file"})
 		return
@@ -302,6 +306,7 @@ func GetFileThumbnail(c *gin.Context) {
 	fileService := services.NewFileService()
 
 	// Check file access
+	auditClassifiedFileAccess(c, filePath, userID.(uint))
 	if err := fileService.CheckFileAccess(filePath, userID.(uint), userRole.(string)); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền truy cập file"})
 		return
@@ -349,6 +354,7 @@ func GetFileInfo(c *gin.Context) {
 	fileService := services.NewFileService()
 
 	// Check file access
+	auditClassifiedFileAccess(c, filePath, userID.(uint))
 	if err := fileService.CheckFileAccess(filePath, userID.(uint), userRole.(string)); err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền truy cập file"})
 		return
@@ -361,7 +367,20 @@ func GetFileInfo(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, fileRecord)
+	// The extracted text rides along; it is pending right after upload and missing for files
+	// the extraction worker has not reached yet
+	response := struct {
+		services.FileInfo
+		TextExtraction *models.FileText       `json:"text_extraction,omitempty"`
+		Signatures     []models.FileSignature `json:"signatures,omitempty"`
+	}{FileInfo: fileRecord}
+	var fileText models.FileText
+	if err := database.DB.Where("file_id = ?", fileRecord.ID).First(&fileText).Error; err == nil {
+		response.TextExtraction = &fileText
+	}
+	database.DB.Where("file_id = ?", fileRecord.ID).Order("position").Find(&response.Signatures)
+
+	c.JSON(http.StatusOK, response)
 }
 
 // DeleteFile removes a file
@@ -416,6 +435,10 @@ func GetFilesByDocument(c *gin.Context) {
 
 	userRole, _ := c.Get("user_role")
 
+	if !requireDocumentFilesAccess(c, documentType, uint(documentID)) {
+		return
+	}
+
 	// Get files for document
 	var files []services.FileInfo
 	query := database.DB.Table("files").Where("document_type = ? AND document_id = ? AND deleted_at IS NULL", documentType, documentID)
@@ -454,6 +477,12 @@ func DownloadFile(c *gin.Context) {
 		return
 	}
 
+	userID, _ := c.Get("user_id")
+	if !auditClassifiedFileAccess(c, filePath, userID.(uint)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền truy cập file"})
+		return
+	}
+
 	// Convert to OS-specific path for file operations
 	osFilePath := filepath.FromSlash(filePath)
 
@@ -484,6 +513,10 @@ func GetFileVersions(c *gin.Context) {
 		return
 	}
 
+	if !requireDocumentFilesAccess(c, documentType, uint(documentID)) {
+		return
+	}
+
 	// Get file versions (simplified - in real implementation, you'd track versions)
 	var files []services.FileInfo
 	query := database.DB.Table("files").Where("document_type = ? AND document_id = ? AND deleted_at IS NULL", documentType, documentID)
@@ -623,6 +656,44 @@ func UpdateFileAccess(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Cập nhật mức truy cập thành công"})
 }
 
+// VerifyFileSignatures verifies the digital signatures of a PDF again (admin only)
+func VerifyFileSignatures(c *gin.Context) {
+	fileID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID file không hợp lệ"})
+		return
+	}
+
+	var fileRecord services.FileInfo
+	if err := database.DB.Table("files").Where("id = ? AND deleted_at IS NULL", fileID).First(&fileRecord).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File không tồn tại"})
+		return
+	}
+
+	signatures, err := services.VerifyFileSignatures(fileRecord.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xác minh chữ ký số: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"file_id": fileRecord.ID, "signatures": signatures})
+}
+
+// ReverifyAllFileSignatures verifies the signatures of every PDF again in the background,
+// e.g. after the trust store changed (admin only)
+func ReverifyAllFileSignatures(c *gin.Context) {
+	count, err := services.ReverifyAllFileSignatures()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xác minh lại chữ ký số"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": fmt.Sprintf("Đang xác minh lại chữ ký số của %d file PDF", count),
+		"count":   count,
+	})
+}
+
 // BulkDeleteFiles deletes multiple files (admin only)
 func BulkDeleteFiles(c *gin.Context) {
 	var request struct {
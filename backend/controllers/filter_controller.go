@@ -19,6 +19,8 @@ func GetFilterPresets(c *gin.Context) {
 
 // GetSearchSuggestions provides autocomplete suggestions for search queries
 func GetSearchSuggestions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
 	searchType := c.Query("type")
 	query := c.Query("q")
 	limitStr := c.DefaultQuery("limit", "10")
@@ -33,7 +35,7 @@ func GetSearchSuggestions(c *gin.Context) {
 		limit = 10
 	}
 
-	suggestions, err := services.GetSearchSuggestions(searchType, query, limit)
+	suggestions, err := services.GetSearchSuggestions(searchType, query, limit, userID.(uint), userRole.(string))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy gợi ý tìm kiếm"})
 		return
@@ -79,6 +81,7 @@ func GetFilterOptions(c *gin.Context) {
 				"draft",
 				"review",
 				"approved",
+				"issued",
 				"sent",
 				"rejected",
 			},
@@ -5,12 +5,15 @@ import (
 	"ai-code-agent-backend/models"
 	"ai-code-agent-backend/services"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 )
 
 type CreateIncomingDocumentRequest struct {
@@ -22,6 +25,13 @@ type CreateIncomingDocumentRequest struct {
 	Summary        string `json:"summary" binding:"required"`
 	InternalNotes  string `json:"internal_notes"`
 	ProcessorID    *uint  `json:"processor_id"`
+	RegisterBook   string `json:"register_book"` // Empty for the main register
+	Urgency        string `json:"urgency"`
+	SecrecyLevel   string `json:"secrecy_level"`
+	ClearedUserIDs []uint `json:"cleared_user_ids"` // Users who may see a classified document besides its creator and processor
+	Force          bool   `json:"force"`            // Register even though likely duplicates were found
+	DuplicateOfID  *uint  `json:"duplicate_of_id"`  // Register as a copy of an existing document
+	DraftID        *uint  `json:"draft_id"`         // Register a scanned draft, keeping its file, instead of creating a new document
 }
 
 type UpdateIncomingDocumentRequest struct {
@@ -33,6 +43,10 @@ type UpdateIncomingDocumentRequest struct {
 	InternalNotes  string `json:"internal_notes"`
 	ProcessorID    *uint  `json:"processor_id"`
 	Status         string `json:"status"`
+	Urgency        string `json:"urgency"`
+	SecrecyLevel   string `json:"secrecy_level"`
+	DuplicateOfID  *uint  `json:"duplicate_of_id"` // Mark the document as a copy of an earlier one
+	Version        *uint  `json:"version"`         // alternative to the If-Match header
 }
 
 type AssignProcessorRequest struct {
@@ -73,6 +87,21 @@ func CreateIncomingDocument(c *gin.Context) {
 		return
 	}
 
+	if message := validateDocumentLevels(req.Urgency, req.SecrecyLevel); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+	if req.Urgency == "" {
+		req.Urgency = models.UrgencyNormal
+	}
+	if req.SecrecyLevel == "" {
+		req.SecrecyLevel = models.SecrecyNone
+	}
+	if !validateGrantees(database.DB, req.ClearedUserIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Người được phép truy cập không tồn tại hoặc đã ngừng hoạt động"})
+		return
+	}
+
 	// Validate processor if provided (must be Team Leader or Deputy)
 	if req.ProcessorID != nil {
 		var processor models.User
@@ -86,6 +115,29 @@ func CreateIncomingDocument(c *gin.Context) {
 		}
 	}
 
+	// The same document often arrives twice, e.g. by post and by email
+	var duplicateOfID *uint
+	var ignoredDuplicates []DuplicateCandidate
+	if req.DuplicateOfID != nil {
+		original, err := duplicateRoot(services.ScopeVisibleIncomingDocuments(database.DB, userID.(uint)), *req.DuplicateOfID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Văn bản gốc không tồn tại"})
+			return
+		}
+		duplicateOfID = &original.ID
+	} else {
+		candidates, err := findIncomingDuplicates(services.ScopeVisibleIncomingDocuments(database.DB, userID.(uint)), req.OriginalNumber, req.IssuingUnitID, documentDate, req.Summary, 0)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể kiểm tra văn bản trùng"})
+			return
+		}
+		if len(candidates) > 0 && !req.Force {
+			respondDuplicates(c, candidates)
+			return
+		}
+		ignoredDuplicates = candidates
+	}
+
 	// Use database transaction to atomically generate arrival number
 	tx := database.DB.Begin()
 	defer func() {
@@ -94,22 +146,35 @@ func CreateIncomingDocument(c *gin.Context) {
 		}
 	}()
 
-	// Get next arrival number using raw SQL for better atomicity
-	var result struct {
-		NextNumber int `gorm:"column:next_number"`
+	// A scanned draft is registered in place, keeping its attached file
+	var draft models.IncomingDocument
+	if req.DraftID != nil {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&draft, *req.DraftID).Error; err != nil || draft.Status != models.IncomingStatusDraft {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Văn bản nháp không tồn tại hoặc đã được đăng ký"})
+			return
+		}
 	}
-	err = tx.Raw("SELECT COALESCE(MAX(arrival_number), 0) + 1 as next_number FROM incoming_documents").Scan(&result).Error
+
+	// Reserve the next number of the year's register; the counter stays locked until commit
+	registerBook := strings.TrimSpace(req.RegisterBook)
+	arrivalNumber, err := services.NextSequenceValue(tx, models.SequenceScopeIncoming, arrivalDate.Year(), registerBook,
+		func() (int, error) { return highestArrivalNumber(tx, arrivalDate.Year(), registerBook) })
 	if err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo số đến"})
 		return
 	}
-	arrivalNumber := result.NextNumber
 
 	// Create the document
 	incomingDoc := models.IncomingDocument{
 		ArrivalDate:    arrivalDate,
 		ArrivalNumber:  arrivalNumber,
+		ArrivalYear:    arrivalDate.Year(),
+		RegisterBook:   registerBook,
+		DuplicateOfID:  duplicateOfID,
+		Urgency:        req.Urgency,
+		SecrecyLevel:   req.SecrecyLevel,
 		OriginalNumber: req.OriginalNumber,
 		DocumentDate:   documentDate,
 		DocumentTypeID: req.DocumentTypeID,
@@ -127,7 +192,14 @@ func CreateIncomingDocument(c *gin.Context) {
 	}
 
 	// Create the document within the transaction
-	if err := tx.Create(&incomingDoc).Error; err != nil {
+	if draft.ID != 0 {
+		incomingDoc.ID, incomingDoc.CreatedAt = draft.ID, draft.CreatedAt
+		incomingDoc.FilePath, incomingDoc.Version = draft.FilePath, draft.Version
+		err = tx.Save(&incomingDoc).Error
+	} else {
+		err = tx.Create(&incomingDoc).Error
+	}
+	if err != nil {
 		tx.Rollback()
 		if database.IsUniqueConstraintError(err) {
 			c.JSON(http.StatusConflict, gin.H{"error": "Số đến đã tồn tại, vui lòng thử lại"})
@@ -137,12 +209,32 @@ func CreateIncomingDocument(c *gin.Context) {
 		return
 	}
 
+	err = watchIncomingDocumentTx(tx, &incomingDoc)
+	if err == nil && models.IsClassified(incomingDoc.SecrecyLevel) {
+		err = grantDocumentAccessTx(tx, models.AccessEntityIncomingDocument, incomingDoc.ID, uniqueIDs(req.ClearedUserIDs), userID.(uint))
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo văn bản đến"})
+		return
+	}
+
 	// Commit the transaction
 	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể hoàn tất tạo văn bản đến"})
 		return
 	}
 
+	if len(ignoredDuplicates) > 0 {
+		ids := make([]uint, len(ignoredDuplicates))
+		for i, candidate := range ignoredDuplicates {
+			ids[i] = candidate.Document.ID
+		}
+		services.NewAuditService().LogActivity(c, models.AuditActionDocumentCreate, models.AuditEntityIncomingDocument, incomingDoc.ID,
+			fmt.Sprintf("Đăng ký văn bản đến số %d dù có %d văn bản nghi trùng", incomingDoc.ArrivalNumber, len(ids)),
+			nil, nil, gin.H{"ignored_duplicates": ids})
+	}
+
 	// Load relations with explicit error handling
 	if err := database.DB.Preload("DocumentType").First(&incomingDoc, incomingDoc.ID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tải loại văn bản"})
@@ -191,10 +283,26 @@ func GetIncomingDocuments(c *gin.Context) {
 			Where("tasks.assigned_to_id = ?", userID)
 	}
 
+	// Classified documents are listed only for the users cleared for them
+	query = services.ScopeVisibleIncomingDocuments(query, userID.(uint))
+	if urgency := c.Query("urgency"); urgency != "" {
+		query = query.Where("incoming_documents.urgency = ?", urgency)
+	}
+	if secrecyLevel := c.Query("secrecy_level"); secrecyLevel != "" {
+		query = query.Where("incoming_documents.secrecy_level = ?", secrecyLevel)
+	}
+	// Scanned drafts wait in their own queue, listed with status=draft
+	if filterParams.Status != models.IncomingStatusDraft {
+		query = query.Where("incoming_documents.status <> ?", models.IncomingStatusDraft)
+	}
+
 	// Apply advanced filters
 	query = services.ApplyIncomingDocumentFilters(query, filterParams)
 
-	// Apply sorting
+	// Apply sorting; unless asked otherwise the most urgent documents come first
+	if filterParams.SortBy == "" || filterParams.SortBy == "urgency" {
+		query = query.Order(models.UrgencyOrderSQL("incoming_documents"))
+	}
 	allowedSortFields := []string{"arrival_date", "arrival_number", "document_date", "created_at", "updated_at"}
 	query = services.ApplySorting(query, filterParams.SortBy, filterParams.SortOrder, allowedSortFields)
 
@@ -236,11 +344,19 @@ func GetIncomingDocument(c *gin.Context) {
 		return
 	}
 
+	userID, _ := c.Get("user_id")
 	var document models.IncomingDocument
-	if err := database.DB.Preload("DocumentType").Preload("IssuingUnit").Preload("Processor").Preload("Tasks.AssignedTo").First(&document, id).Error; err != nil {
+	if err := database.DB.Preload("DocumentType").Preload("IssuingUnit").Preload("Processor").Preload("Tasks.AssignedTo").Preload("Directive.Director").Preload("Directive.Assignees.User").
+		Preload("DuplicateOf", func(db *gorm.DB) *gorm.DB {
+			// The original is left out when it is classified and the user was not cleared for it
+			return services.ScopeVisibleIncomingDocuments(db, userID.(uint))
+		}).First(&document, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đến"})
 		return
 	}
+	if !requireIncomingDocumentAccess(c, &document) {
+		return
+	}
 
 	// Load CreatedBy explicitly
 	var createdByUser models.User
@@ -248,6 +364,17 @@ func GetIncomingDocument(c *gin.Context) {
 		document.CreatedBy = createdByUser
 	}
 
+	if document.Thread, err = services.CorrespondenceThreadOf(database.DB, models.RelationDocumentIncoming, document.ID, userID.(uint)); err != nil {
+		log.Printf("Cannot load correspondence thread of incoming document %d: %v", document.ID, err)
+	}
+	if document.ResponseTime, err = services.ResponseTimeOf(database.DB, document.ID); err != nil {
+		log.Printf("Cannot load response time of incoming document %d: %v", document.ID, err)
+	}
+
+	if !respondWithETag(c, document.Version) {
+		return
+	}
+
 	c.JSON(http.StatusOK, document)
 }
 
@@ -265,6 +392,13 @@ func UpdateIncomingDocument(c *gin.Context) {
 		return
 	}
 
+	expected, err := expectedVersion(c, req.Version)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Phiên bản dữ liệu không hợp lệ"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
 	userRole, _ := c.Get("user_role")
 
 	var document models.IncomingDocument
@@ -272,6 +406,9 @@ func UpdateIncomingDocument(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đến"})
 		return
 	}
+	if !requireIncomingDocumentAccess(c, &document) {
+		return
+	}
 
 	// Check permissions
 	switch userRole.(string) {
@@ -305,9 +442,41 @@ func UpdateIncomingDocument(c *gin.Context) {
 	if req.InternalNotes != "" {
 		updates["internal_notes"] = req.InternalNotes
 	}
-	if req.Status != "" {
+	if req.Status != "" && req.Status != document.Status {
+		var taskCount int
+		database.DB.Model(&models.Task{}).Where("incoming_document_id = ?", document.ID).Count(&taskCount)
+		if taskCount > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Văn bản đã có công việc, trạng thái được cập nhật tự động theo tiến độ công việc"})
+			return
+		}
 		updates["status"] = req.Status
 	}
+	if message := validateDocumentLevels(req.Urgency, req.SecrecyLevel); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+	if req.Urgency != "" {
+		updates["urgency"] = req.Urgency
+	}
+	if req.SecrecyLevel != "" && req.SecrecyLevel != document.SecrecyLevel {
+		if !canChangeSecrecy(userRole.(string), document.CreatedByID, userID.(uint)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền thay đổi độ mật của văn bản"})
+			return
+		}
+		updates["secrecy_level"] = req.SecrecyLevel
+	}
+	if req.DuplicateOfID != nil {
+		original, err := duplicateRoot(services.ScopeVisibleIncomingDocuments(database.DB, userID.(uint)), *req.DuplicateOfID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Văn bản gốc không tồn tại"})
+			return
+		}
+		if original.ID == document.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Không thể đánh dấu văn bản trùng với chính nó"})
+			return
+		}
+		updates["duplicate_of_id"] = original.ID
+	}
 	if req.ProcessorID != nil {
 		// Validate processor (must be Team Leader or Deputy)
 		var processor models.User
@@ -326,10 +495,21 @@ func UpdateIncomingDocument(c *gin.Context) {
 		}
 	}
 
-	if err := database.DB.Model(&document).Updates(updates).Error; err != nil {
+	oldStatus, oldSecrecy := document.Status, document.SecrecyLevel
+	updated, err := updateIfVersion(database.DB, &document, expected, updates)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật văn bản đến"})
 		return
 	}
+	if updated {
+		if oldSecrecy != document.SecrecyLevel {
+			auditSecrecyChange(c, models.AuditEntityIncomingDocument, document.ID, oldSecrecy, document.SecrecyLevel)
+		}
+		if req.ProcessorID != nil {
+			watchIncomingDocumentTx(database.DB, &document)
+		}
+		notifyIncomingDocumentStatusChangedTx(database.DB, &document, oldStatus, userID.(uint))
+	}
 
 	// Load relations
 	database.DB.Preload("DocumentType").Preload("IssuingUnit").Preload("Processor").First(&document, document.ID)
@@ -340,6 +520,12 @@ func UpdateIncomingDocument(c *gin.Context) {
 		document.CreatedBy = createdByUser
 	}
 
+	if !updated {
+		respondVersionConflict(c, document, document.Version)
+		return
+	}
+
+	c.Header("ETag", versionETag(document.Version))
 	c.JSON(http.StatusOK, document)
 }
 
@@ -362,26 +548,14 @@ func AssignProcessor(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đến"})
 		return
 	}
-
-	// Validate processor (must be Team Leader or Deputy)
-	var processor models.User
-	if err := database.DB.First(&processor, req.ProcessorID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Người xử lý không tồn tại"})
-		return
-	}
-	if !processor.IsTeamLeaderOrDeputy() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Người xử lý phải là Trưởng hoặc Phó Công An Xã"})
+	if !requireIncomingDocumentAccess(c, &document) {
 		return
 	}
 
-	// Update processor and status
-	document.ProcessorID = &req.ProcessorID
-	if document.Status == models.IncomingStatusReceived {
-		document.Status = models.IncomingStatusForwarded
-	}
+	userID, _ := c.Get("user_id")
 
-	if err := database.DB.Save(&document).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể gán người xử lý"})
+	if err := assignProcessorTx(database.DB, &document, req.ProcessorID, userID.(uint)); err != nil {
+		respondOperationError(c, err, "Không thể gán người xử lý")
 		return
 	}
 
@@ -397,6 +571,33 @@ func AssignProcessor(c *gin.Context) {
 	c.JSON(http.StatusOK, document)
 }
 
+// assignProcessorTx validates the processor and assigns it to the document
+func assignProcessorTx(db *gorm.DB, document *models.IncomingDocument, processorID, actorID uint) error {
+	// Validate processor (must be Team Leader or Deputy)
+	var processor models.User
+	if err := db.First(&processor, processorID).Error; err != nil {
+		return &operationError{http.StatusBadRequest, "Người xử lý không tồn tại"}
+	}
+	if !processor.IsTeamLeaderOrDeputy() {
+		return &operationError{http.StatusBadRequest, "Người xử lý phải là Trưởng hoặc Phó Công An Xã"}
+	}
+
+	// Update processor and status
+	oldStatus := document.Status
+	document.ProcessorID = &processorID
+	if document.Status == models.IncomingStatusReceived {
+		document.Status = models.IncomingStatusForwarded
+	}
+
+	if err := db.Save(document).Error; err != nil {
+		return err
+	}
+	if err := watchIncomingDocumentTx(db, document); err != nil {
+		return err
+	}
+	return notifyIncomingDocumentStatusChangedTx(db, document, oldStatus, actorID)
+}
+
 // DeleteIncomingDocument deletes an incoming document
 func DeleteIncomingDocument(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -412,34 +613,10 @@ func DeleteIncomingDocument(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đến"})
 		return
 	}
-
-	// Check permissions
-	switch userRole.(string) {
-	case models.RoleSecretary, models.RoleAdmin, models.RoleTeamLeader, models.RoleDeputy:
-		// Can delete any document
-	default:
-		c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền xóa văn bản"})
+	if !requireIncomingDocumentAccess(c, &document) {
 		return
 	}
 
-	// Check if document has related tasks (including soft-deleted tasks)
-	var tasks []models.Task
-	database.DB.Unscoped().Where("incoming_document_id = ?", id).Find(&tasks)
-
-	if len(tasks) > 0 {
-		// Get active (non-deleted) tasks
-		var activeTasks []models.Task
-		database.DB.Where("incoming_document_id = ?", id).Find(&activeTasks)
-
-		if len(activeTasks) > 0 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":         fmt.Sprintf("Không thể xóa văn bản đã có %d công việc liên quan. Vui lòng xóa các công việc liên quan trước.", len(activeTasks)),
-				"related_tasks": len(activeTasks),
-			})
-			return
-		}
-	}
-
 	// Start transaction for safe deletion
 	tx := database.DB.Begin()
 	defer func() {
@@ -448,47 +625,84 @@ func DeleteIncomingDocument(c *gin.Context) {
 		}
 	}()
 
-	// Delete associated files from the new file system
-	var associatedFiles []struct {
-		FilePath string `json:"file_path"`
+	filePaths, err := deleteIncomingDocumentTx(tx, &document, userRole.(string))
+	if err != nil {
+		tx.Rollback()
+		respondOperationError(c, err, "Không thể xóa văn bản đến")
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể hoàn tất xóa văn bản"})
+		return
+	}
+
+	removeStoredFiles(filePaths)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Xóa văn bản đến thành công"})
+}
+
+// deleteIncomingDocumentTx checks that the document may be deleted and soft deletes it
+// together with its files. The stored file paths are returned so the caller can remove
+// them from disk once the transaction has been committed.
+func deleteIncomingDocumentTx(tx *gorm.DB, document *models.IncomingDocument, userRole string) ([]string, error) {
+	// Check permissions
+	switch userRole {
+	case models.RoleSecretary, models.RoleAdmin, models.RoleTeamLeader, models.RoleDeputy:
+		// Can delete any document
+	default:
+		return nil, &operationError{http.StatusForbidden, "Không có quyền xóa văn bản"}
+	}
+
+	// Check if document has related active tasks
+	var activeTasks int
+	tx.Model(&models.Task{}).Where("incoming_document_id = ?", document.ID).Count(&activeTasks)
+	if activeTasks > 0 {
+		return nil, &operationError{http.StatusBadRequest, fmt.Sprintf("Không thể xóa văn bản đã có %d công việc liên quan. Vui lòng xóa các công việc liên quan trước.", activeTasks)}
 	}
 
+	var filePaths []string
+
 	// Get all files associated with this document
-	if err := tx.Raw("SELECT file_path FROM files WHERE document_type = 'incoming' AND document_id = ? AND deleted_at IS NULL", id).Scan(&associatedFiles).Error; err == nil {
+	var associatedFiles []struct {
+		FilePath string `json:"file_path"`
+	}
+	if err := tx.Raw("SELECT file_path FROM files WHERE document_type = 'incoming' AND document_id = ? AND deleted_at IS NULL", document.ID).Scan(&associatedFiles).Error; err == nil {
 		// Mark files as deleted in database (soft delete)
-		if err := tx.Exec("UPDATE files SET deleted_at = NOW() WHERE document_type = 'incoming' AND document_id = ?", id).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa files liên quan"})
-			return
+		if err := tx.Exec("UPDATE files SET deleted_at = NOW() WHERE document_type = 'incoming' AND document_id = ?", document.ID).Error; err != nil {
+			return nil, &operationError{http.StatusInternalServerError, "Không thể xóa files liên quan"}
 		}
-
-		// Delete physical files
 		for _, file := range associatedFiles {
-			if file.FilePath != "" {
-				os.Remove(file.FilePath)
-			}
+			filePaths = append(filePaths, file.FilePath)
 		}
 	}
 
-	// Delete legacy file if exists
-	if document.FilePath != "" {
-		os.Remove(document.FilePath)
+	// Legacy file stored directly on the document
+	filePaths = append(filePaths, document.FilePath)
+
+	if err := removeWatchersTx(tx, models.WatchEntityIncomingDocument, document.ID); err != nil {
+		return nil, err
+	}
+	if err := deleteDocumentDirectiveTx(tx, document.ID); err != nil {
+		return nil, err
 	}
 
 	// Delete the document (soft delete)
-	if err := tx.Delete(&document).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa văn bản đến"})
-		return
+	if err := tx.Delete(document).Error; err != nil {
+		return nil, err
 	}
 
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể hoàn tất xóa văn bản"})
-		return
-	}
+	return filePaths, nil
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Xóa văn bản đến thành công"})
+// removeStoredFiles deletes files from disk, ignoring empty paths and missing files
+func removeStoredFiles(paths []string) {
+	for _, path := range paths {
+		if path != "" {
+			os.Remove(path)
+		}
+	}
 }
 
 // UploadIncomingDocumentFile uploads a file for an incoming document
@@ -504,6 +718,9 @@ func UploadIncomingDocumentFile(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đến"})
 		return
 	}
+	if !requireIncomingDocumentAccess(c, &document) {
+		return
+	}
 
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -540,6 +757,28 @@ func UploadIncomingDocumentFile(c *gin.Context) {
 		return
 	}
 
+	// A file already attached to another document usually means the document was registered twice
+	if c.PostForm("force") != "true" {
+		fileHash, err := fileService.HashFile(file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		excluded := []uint{document.ID}
+		if document.DuplicateOfID != nil {
+			excluded = append(excluded, *document.DuplicateOfID)
+		}
+		candidates, err := findIncomingDuplicatesByFile(services.ScopeVisibleIncomingDocuments(database.DB, userID.(uint)), fileHash, excluded...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể kiểm tra văn bản trùng"})
+			return
+		}
+		if len(candidates) > 0 {
+			respondDuplicates(c, candidates)
+			return
+		}
+	}
+
 	// Upload file using enhanced service
 	fileInfo, err := fileService.UploadFile(file, header, config, userID.(uint), "incoming", uint(id))
 	if err != nil {
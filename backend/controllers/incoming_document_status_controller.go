@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"ai-code-agent-backend/services"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// taskStarted reports whether work on a task has begun
+func taskStarted(status string) bool {
+	return status != models.StatusNotStarted && status != models.StatusReceived
+}
+
+// derivedIncomingStatus works out the status of a document from its linked tasks: assigned while
+// no task has started, processing once one has, completed when all are. completedAt is the
+// completion date of the last task to finish. ok is false when the document has no tasks and its
+// status is left to the secretary.
+func derivedIncomingStatus(document *models.IncomingDocument, tasks []models.Task) (status string, completedAt *time.Time, ok bool) {
+	if len(tasks) == 0 {
+		// Tasks were removed from a document that was already under way
+		if document.Status == models.IncomingStatusProcessing || document.Status == models.IncomingStatusCompleted {
+			if document.ProcessorID != nil {
+				return models.IncomingStatusAssigned, nil, true
+			}
+			return models.IncomingStatusReceived, nil, true
+		}
+		return "", nil, false
+	}
+
+	completed, started := 0, false
+	for i := range tasks {
+		if tasks[i].Status == models.StatusCompleted {
+			completed++
+			if tasks[i].CompletionDate != nil && (completedAt == nil || tasks[i].CompletionDate.After(*completedAt)) {
+				completedAt = tasks[i].CompletionDate
+			}
+		}
+		if taskStarted(tasks[i].Status) {
+			started = true
+		}
+	}
+
+	switch {
+	case completed == len(tasks):
+		if completedAt == nil {
+			now := time.Now()
+			completedAt = &now
+		}
+		return models.IncomingStatusCompleted, completedAt, true
+	case started:
+		return models.IncomingStatusProcessing, nil, true
+	default:
+		return models.IncomingStatusAssigned, nil, true
+	}
+}
+
+// syncIncomingDocumentStatusTx brings the status of a document in line with its tasks and
+// notifies the document's watchers when it changes. It reports whether anything changed.
+// The document row is locked before its tasks are read, so tasks finishing in parallel
+// transactions sync one after the other and the last one sees them all completed.
+func syncIncomingDocumentStatusTx(db *gorm.DB, documentID, actorID uint) (bool, error) {
+	var document models.IncomingDocument
+	if err := db.Set("gorm:query_option", "FOR UPDATE").First(&document, documentID).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var tasks []models.Task
+	if err := db.Select("id, status, completion_date").Where("incoming_document_id = ?", documentID).Find(&tasks).Error; err != nil {
+		return false, err
+	}
+
+	status, completedAt, ok := derivedIncomingStatus(&document, tasks)
+	if !ok || (status == document.Status && sameDeadline(completedAt, document.CompletedAt)) {
+		return false, nil
+	}
+
+	oldStatus := document.Status
+	if err := db.Model(&document).Updates(map[string]interface{}{"status": status, "completed_at": completedAt}).Error; err != nil {
+		return false, err
+	}
+	return true, notifyIncomingDocumentStatusChangedTx(db, &document, oldStatus, actorID)
+}
+
+// syncTaskDocumentStatusTx syncs the status of the document a task is linked to, if any
+func syncTaskDocumentStatusTx(db *gorm.DB, taskID, actorID uint) error {
+	var task models.Task
+	if err := db.Unscoped().Select("id, incoming_document_id").First(&task, taskID).Error; err != nil {
+		return err
+	}
+	if task.IncomingDocumentID == nil {
+		return nil
+	}
+	_, err := syncIncomingDocumentStatusTx(db, *task.IncomingDocumentID, actorID)
+	return err
+}
+
+// RecomputeIncomingDocumentStatuses re-derives the status of every document that has tasks, or
+// whose status says work has started, e.g. after importing historical data
+func RecomputeIncomingDocumentStatuses(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var documentIDs []uint
+	if err := database.DB.Model(&models.IncomingDocument{}).
+		Where("id IN (SELECT incoming_document_id FROM tasks WHERE incoming_document_id IS NOT NULL AND deleted_at IS NULL) OR status IN (?)",
+			[]string{models.IncomingStatusProcessing, models.IncomingStatusCompleted}).
+		Pluck("id", &documentIDs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách văn bản đến"})
+		return
+	}
+
+	changed, failed := 0, 0
+	for _, documentID := range documentIDs {
+		tx := database.DB.Begin()
+		updated, err := syncIncomingDocumentStatusTx(tx, documentID, userID.(uint))
+		if err != nil {
+			tx.Rollback()
+			failed++
+			continue
+		}
+		if err := tx.Commit().Error; err != nil {
+			failed++
+			continue
+		}
+		if updated {
+			changed++
+		}
+	}
+
+	services.NewAuditService().LogActivity(c, models.AuditActionSystemConfig, models.AuditEntitySystem, 0,
+		fmt.Sprintf("Tính lại trạng thái %d văn bản đến, %d văn bản thay đổi", len(documentIDs), changed),
+		nil, nil, gin.H{"checked": len(documentIDs), "changed": changed, "failed": failed})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Đã tính lại trạng thái văn bản đến",
+		"checked": len(documentIDs),
+		"changed": changed,
+		"failed":  failed,
+	})
+}
@@ -109,6 +109,8 @@ func UpdateIssuingUnit(c *gin.Context) {
 	// Update fields
 	issuingUnit.Name = updateData.Name
 	issuingUnit.Description = updateData.Description
+	issuingUnit.Code = updateData.Code
+	issuingUnit.Emails = updateData.Emails
 	issuingUnit.IsActive = updateData.IsActive
 
 	if err := database.DB.Save(&issuingUnit).Error; err != nil {
@@ -0,0 +1,542 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"ai-code-agent-backend/services"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type SetApprovalChainRequest struct {
+	ApproverIDs []uint `json:"approver_ids" binding:"required"` // In the order they approve
+}
+
+type ApprovalActionRequest struct {
+	Comment string `json:"comment"`
+	Sign    bool   `json:"sign"` // Approve only: sign the approved PDF with the organisation's certificate
+}
+
+type IssueOutgoingDocumentRequest struct {
+	IssueDate string `json:"issue_date"` // YYYY-MM-DD, defaults to the planned issue date
+	Comment   string `json:"comment"`
+}
+
+// approvalAction moves a document one step through the approval workflow inside tx
+type approvalAction func(tx *gorm.DB, document *models.OutgoingDocument, actorID uint, userRole string) error
+
+// isEditableDraft reports whether a document is back with its drafter. Documents rejected before
+// approval chains existed are treated as drafts.
+func isEditableDraft(status string) bool {
+	return status == models.OutgoingStatusDraft || status == models.OutgoingStatusRejected
+}
+
+// canSubmitForApproval reports whether the user may send a document into review or take it back:
+// its drafter, its creator or an admin
+func canSubmitForApproval(document *models.OutgoingDocument, userID uint, userRole string) bool {
+	return userRole == models.RoleAdmin || document.DrafterID == userID || document.CreatedByID == userID
+}
+
+// approvalChainOf returns the approval steps of a document in order
+func approvalChainOf(db *gorm.DB, documentID uint) ([]models.OutgoingApprovalStep, error) {
+	var steps []models.OutgoingApprovalStep
+	err := db.Where("outgoing_document_id = ?", documentID).Order("position").Find(&steps).Error
+	return steps, err
+}
+
+// recordApprovalTx sets the status of a document and appends the change to its approval history
+func recordApprovalTx(tx *gorm.DB, document *models.OutgoingDocument, action, status string, step *models.OutgoingApprovalStep, actorID uint, comment string, updates map[string]interface{}) error {
+	history := models.OutgoingApprovalHistory{
+		OutgoingDocumentID: document.ID,
+		Action:             action,
+		FromStatus:         document.Status,
+		ToStatus:           status,
+		ActorID:            actorID,
+		Comment:            comment,
+	}
+	if step != nil {
+		position := step.Position
+		history.StepPosition = &position
+	}
+
+	if updates == nil {
+		updates = make(map[string]interface{})
+	}
+	updates["status"] = status
+	if err := tx.Model(document).Updates(updates).Error; err != nil {
+		return err
+	}
+	return tx.Create(&history).Error
+}
+
+// submitForApprovalTx sends a draft to the first approver of its chain. A document without a
+// chain is approved by its approver alone.
+func submitForApprovalTx(tx *gorm.DB, document *models.OutgoingDocument, actorID uint, userRole, comment string) error {
+	if !isEditableDraft(document.Status) {
+		return &operationError{http.StatusBadRequest, "Chỉ trình duyệt được văn bản đang soạn thảo"}
+	}
+	if !canSubmitForApproval(document, actorID, userRole) {
+		return &operationError{http.StatusForbidden, "Chỉ người soạn thảo hoặc người tạo văn bản mới có thể trình duyệt"}
+	}
+
+	steps, err := approvalChainOf(tx, document.ID)
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		step := models.OutgoingApprovalStep{OutgoingDocumentID: document.ID, Position: 1, ApproverID: document.ApproverID}
+		if err := tx.Create(&step).Error; err != nil {
+			return err
+		}
+		steps = append(steps, step)
+	}
+
+	// Every submission is a new round: earlier decisions stay in the history only
+	if err := tx.Model(&models.OutgoingApprovalStep{}).Where("outgoing_document_id = ?", document.ID).
+		Updates(map[string]interface{}{"status": models.ApprovalStepWaiting, "comment": "", "decided_at": nil}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&steps[0]).Update("status", models.ApprovalStepPending).Error; err != nil {
+		return err
+	}
+	return recordApprovalTx(tx, document, models.ApprovalActionSubmit, models.OutgoingStatusReview, nil, actorID, comment, nil)
+}
+
+// withdrawFromApprovalTx takes a document in review back to draft, e.g. to change its chain
+func withdrawFromApprovalTx(tx *gorm.DB, document *models.OutgoingDocument, actorID uint, userRole, comment string) error {
+	if document.Status != models.OutgoingStatusReview {
+		return &operationError{http.StatusBadRequest, "Văn bản không ở trạng thái chờ duyệt"}
+	}
+	if !canSubmitForApproval(document, actorID, userRole) {
+		return &operationError{http.StatusForbidden, "Chỉ người soạn thảo hoặc người tạo văn bản mới có thể rút lại văn bản"}
+	}
+	if err := tx.Model(&models.OutgoingApprovalStep{}).Where("outgoing_document_id = ? AND status = ?", document.ID, models.ApprovalStepPending).
+		Update("status", models.ApprovalStepWaiting).Error; err != nil {
+		return err
+	}
+	return recordApprovalTx(tx, document, models.ApprovalActionWithdraw, models.OutgoingStatusDraft, nil, actorID, comment, nil)
+}
+
+// pendingApprovalStep returns the step waiting for a decision, checking that it is the user's
+func pendingApprovalStep(tx *gorm.DB, document *models.OutgoingDocument, actorID uint) (*models.OutgoingApprovalStep, error) {
+	if document.Status != models.OutgoingStatusReview {
+		return nil, &operationError{http.StatusBadRequest, "Văn bản không ở trạng thái chờ duyệt"}
+	}
+	var step models.OutgoingApprovalStep
+	if err := tx.Where("outgoing_document_id = ? AND status = ?", document.ID, models.ApprovalStepPending).First(&step).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, &operationError{http.StatusConflict, "Văn bản không có bước duyệt nào đang chờ"}
+		}
+		return nil, err
+	}
+	if step.ApproverID != actorID {
+		return nil, &operationError{http.StatusForbidden, "Văn bản đang chờ người khác duyệt"}
+	}
+	return &step, nil
+}
+
+// requireFinalApprovalStep checks that the user's pending step is the last of the chain, the only
+// one whose approval may be signed
+func requireFinalApprovalStep(tx *gorm.DB, document *models.OutgoingDocument, actorID uint) error {
+	step, err := pendingApprovalStep(tx, document, actorID)
+	if err != nil {
+		return err
+	}
+	var later int
+	if err := tx.Model(&models.OutgoingApprovalStep{}).Where("outgoing_document_id = ? AND position > ?", document.ID, step.Position).
+		Count(&later).Error; err != nil {
+		return err
+	}
+	if later > 0 {
+		return &operationError{http.StatusBadRequest, "Chỉ ký số khi phê duyệt bước cuối cùng"}
+	}
+	return nil
+}
+
+// approveStepTx approves the pending step and hands the document to the next approver, or
+// approves the document when the step was the last one
+func approveStepTx(tx *gorm.DB, document *models.OutgoingDocument, actorID uint, comment string) error {
+	step, err := pendingApprovalStep(tx, document, actorID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := tx.Model(step).Updates(map[string]interface{}{"status": models.ApprovalStepApproved, "comment": comment, "decided_at": &now}).Error; err != nil {
+		return err
+	}
+
+	var next models.OutgoingApprovalStep
+	err = tx.Where("outgoing_document_id = ? AND position > ?", document.ID, step.Position).Order("position").First(&next).Error
+	switch {
+	case err == nil:
+		if err := tx.Model(&next).Update("status", models.ApprovalStepPending).Error; err != nil {
+			return err
+		}
+		return recordApprovalTx(tx, document, models.ApprovalActionApprove, models.OutgoingStatusReview, step, actorID, comment, nil)
+	case gorm.IsRecordNotFoundError(err):
+		return recordApprovalTx(tx, document, models.ApprovalActionApprove, models.OutgoingStatusApproved, step, actorID, comment, nil)
+	default:
+		return err
+	}
+}
+
+// rejectStepTx sends the document back to its drafter with the approver's reasons
+func rejectStepTx(tx *gorm.DB, document *models.OutgoingDocument, actorID uint, comment string) error {
+	if strings.TrimSpace(comment) == "" {
+		return &operationError{http.StatusBadRequest, "Vui lòng nhập lý do từ chối"}
+	}
+	step, err := pendingApprovalStep(tx, document, actorID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := tx.Model(step).Updates(map[string]interface{}{"status": models.ApprovalStepRejected, "comment": comment, "decided_at": &now}).Error; err != nil {
+		return err
+	}
+	return recordApprovalTx(tx, document, models.ApprovalActionReject, models.OutgoingStatusDraft, step, actorID, comment, nil)
+}
+
+// signOutgoingDocumentTx signs the PDF of a document that has just been approved and makes the
+// signed file its current file; the unsigned one stays as the previous version. The signed file is
+// written before tx commits, so the caller removes it if the transaction fails.
+func signOutgoingDocumentTx(tx *gorm.DB, document *models.OutgoingDocument, actorID uint) (*services.FileInfo, error) {
+	if document.Status != models.OutgoingStatusApproved {
+		return nil, &operationError{http.StatusBadRequest, "Chỉ ký số khi phê duyệt bước cuối cùng"}
+	}
+	if document.FilePath == "" {
+		return nil, &operationError{http.StatusBadRequest, "Văn bản chưa có file để ký số"}
+	}
+	var file services.FileInfo
+	if err := tx.Table("files").Where("file_path = ?", document.FilePath).First(&file).Error; err != nil {
+		return nil, &operationError{http.StatusNotFound, "Không tìm thấy file của văn bản"}
+	}
+	if !strings.EqualFold(filepath.Ext(file.FilePath), ".pdf") && file.MimeType != "application/pdf" {
+		return nil, &operationError{http.StatusBadRequest, "Chỉ ký số được file PDF"}
+	}
+
+	signer, err := services.DocumentSignerFromEnv()
+	if err != nil {
+		return nil, &operationError{http.StatusInternalServerError, "Không thể tải chứng thư số của cơ quan: " + err.Error()}
+	}
+	if signer == nil {
+		return nil, &operationError{http.StatusServiceUnavailable, "Chưa cấu hình chứng thư số của cơ quan"}
+	}
+	data, err := os.ReadFile(file.FilePath)
+	if err != nil {
+		return nil, &operationError{http.StatusInternalServerError, "Không thể đọc file của văn bản"}
+	}
+	var actor models.User
+	if err := tx.First(&actor, actorID).Error; err != nil {
+		return nil, err
+	}
+	signedData, err := signer.SignPDF(data, services.PDFSignOptions{SignerName: actor.Name, Reason: "Phê duyệt văn bản", Time: time.Now()})
+	if err != nil {
+		return nil, &operationError{http.StatusBadRequest, "Không thể ký số file: " + err.Error()}
+	}
+
+	signed, err := services.NewFileService().SaveFileVersion(tx, &file, signedData, actorID)
+	if err != nil {
+		return nil, err
+	}
+	history := models.OutgoingApprovalHistory{
+		OutgoingDocumentID: document.ID,
+		Action:             models.ApprovalActionSign,
+		FromStatus:         document.Status,
+		ToStatus:           document.Status,
+		ActorID:            actorID,
+		Comment:            "Ký số bằng chứng thư " + signer.Certificate().Subject.CommonName,
+	}
+	if err := tx.Model(document).Update("file_path", signed.FilePath).Error; err != nil {
+		return signed, err
+	}
+	return signed, tx.Create(&history).Error
+}
+
+// approveAndSign approves the current step, signing the document's PDF when sign is set
+func approveAndSign(c *gin.Context, comment string, sign bool) {
+	description := "Phê duyệt"
+	if sign {
+		description = "Phê duyệt và ký số"
+	}
+	var signed *services.FileInfo
+	documentID, committed := applyApprovalAction(c, description, func(tx *gorm.DB, document *models.OutgoingDocument, actorID uint, userRole string) error {
+		// Checked before the step is approved, so asking to sign too early is refused with the
+		// approval chain left as it was
+		if sign {
+			if err := requireFinalApprovalStep(tx, document, actorID); err != nil {
+				return err
+			}
+		}
+		if err := approveStepTx(tx, document, actorID, comment); err != nil || !sign {
+			return err
+		}
+		var err error
+		signed, err = signOutgoingDocumentTx(tx, document, actorID)
+		return err
+	})
+	if signed != nil {
+		if committed {
+			services.NewFileService().AfterFileSaved(signed)
+		} else {
+			os.Remove(signed.FilePath)
+		}
+	}
+	if committed {
+		respondApproval(c, documentID)
+	}
+}
+
+// issueOutgoingDocumentTx releases an approved document, taking the next number of the register
+// when none was typed in
+func issueOutgoingDocumentTx(tx *gorm.DB, document *models.OutgoingDocument, actorID uint, userRole string, issueDate *time.Time, comment string) error {
+	if userRole != models.RoleSecretary && userRole != models.RoleAdmin {
+		return &operationError{http.StatusForbidden, "Chỉ văn thư mới có thể ban hành văn bản"}
+	}
+	if document.Status != models.OutgoingStatusApproved {
+		return &operationError{http.StatusBadRequest, "Chỉ ban hành được văn bản đã được phê duyệt"}
+	}
+
+	updates := make(map[string]interface{})
+	date := document.IssueDate
+	if issueDate != nil {
+		if document.SequenceNumber > 0 && issueDate.Year() != document.NumberYear {
+			return &operationError{http.StatusBadRequest, "Văn bản đã được cấp số, không thể đổi năm ban hành"}
+		}
+		date = *issueDate
+		updates["issue_date"] = date
+	}
+	if document.DocumentNumber == "" {
+		numberFields, err := reserveOutgoingNumberTx(tx, document.DocumentTypeID, document.IssuingUnitID, date)
+		if err != nil {
+			return err
+		}
+		for field, value := range numberFields {
+			updates[field] = value
+		}
+	} else if document.SequenceNumber == 0 && date.Year() != document.NumberYear {
+		if outgoingNumberTaken(tx, document.DocumentNumber, date.Year(), document.DocumentTypeID, document.ID) {
+			return &operationError{http.StatusConflict, fmt.Sprintf("Số văn bản %s đã tồn tại trong năm %d", document.DocumentNumber, date.Year())}
+		}
+		updates["number_year"] = date.Year()
+	}
+
+	if err := recordApprovalTx(tx, document, models.ApprovalActionIssue, models.OutgoingStatusIssued, nil, actorID, comment, updates); err != nil {
+		return err
+	}
+	return syncDispatchStatusTx(tx, document)
+}
+
+// runApprovalAction loads the document of the request, applies the action in a transaction with
+// the document locked, and answers with the document and its approval chain
+func runApprovalAction(c *gin.Context, description string, action approvalAction) {
+	if documentID, committed := applyApprovalAction(c, description, action); committed {
+		respondApproval(c, documentID)
+	}
+}
+
+// applyApprovalAction is runApprovalAction without the answer on success, for actions with work
+// to finish once the transaction has committed. It answers errors itself.
+func applyApprovalAction(c *gin.Context, description string, action approvalAction) (uint, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return 0, false
+	}
+
+	var document models.OutgoingDocument
+	if err := database.DB.First(&document, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đi"})
+		return 0, false
+	}
+	if !requireOutgoingDocumentAccess(c, &document) {
+		return 0, false
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	tx := database.DB.Begin()
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&document, id).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đi"})
+		return 0, false
+	}
+	if document.Status == models.OutgoingStatusCancelled {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Văn bản đã bị hủy, không thể thay đổi trạng thái"})
+		return 0, false
+	}
+	oldStatus := document.Status
+	err = action(tx, &document, userID.(uint), userRole.(string))
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		respondOperationError(c, err, "Không thể cập nhật trạng thái phê duyệt")
+		return 0, false
+	}
+
+	services.NewAuditService().LogActivity(c, models.AuditActionDocumentApproval, models.AuditEntityOutgoingDocument, document.ID,
+		fmt.Sprintf("%s văn bản đi %s", description, document.DocumentNumber),
+		gin.H{"status": oldStatus}, gin.H{"status": document.Status}, nil)
+	return document.ID, true
+}
+
+// respondApproval answers with the document, its approval chain and its approval history
+func respondApproval(c *gin.Context, documentID uint) {
+	var document models.OutgoingDocument
+	if err := database.DB.Preload("DocumentType").Preload("IssuingUnit").Preload("Drafter").Preload("Approver").Preload("CreatedBy").
+		First(&document, documentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đi"})
+		return
+	}
+
+	var steps []models.OutgoingApprovalStep
+	var history []models.OutgoingApprovalHistory
+	if err := database.DB.Preload("Approver").Where("outgoing_document_id = ?", documentID).Order("position").Find(&steps).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy quy trình phê duyệt"})
+		return
+	}
+	if err := database.DB.Preload("Actor").Where("outgoing_document_id = ?", documentID).Order("created_at, id").Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy lịch sử phê duyệt"})
+		return
+	}
+
+	c.Header("ETag", versionETag(document.Version))
+	c.JSON(http.StatusOK, gin.H{"document": document, "steps": steps, "history": history})
+}
+
+// GetOutgoingApproval returns the approval chain of an outgoing document and its history
+func GetOutgoingApproval(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+	var document models.OutgoingDocument
+	if err := database.DB.First(&document, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đi"})
+		return
+	}
+	if !requireOutgoingDocumentAccess(c, &document) {
+		return
+	}
+	respondApproval(c, document.ID)
+}
+
+// SetApprovalChain sets who approves a draft, one after another. The last approver becomes the
+// document's approver.
+func SetApprovalChain(c *gin.Context) {
+	var req SetApprovalChainRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.ApproverIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vui lòng chọn người phê duyệt"})
+		return
+	}
+	approverIDs := uniqueIDs(req.ApproverIDs)
+	if len(approverIDs) != len(req.ApproverIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Người phê duyệt bị trùng trong quy trình"})
+		return
+	}
+
+	var approvers []models.User
+	if err := database.DB.Where("id IN (?) AND is_active = ?", approverIDs, true).Find(&approvers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể kiểm tra người phê duyệt"})
+		return
+	}
+	if len(approvers) != len(approverIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Người phê duyệt không tồn tại hoặc đã ngừng hoạt động"})
+		return
+	}
+	for _, approver := range approvers {
+		if !approver.IsTeamLeaderOrDeputy() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Người phê duyệt phải là Trưởng hoặc Phó Công An Xã"})
+			return
+		}
+	}
+
+	runApprovalAction(c, "Cập nhật quy trình phê duyệt", func(tx *gorm.DB, document *models.OutgoingDocument, actorID uint, userRole string) error {
+		if !isEditableDraft(document.Status) {
+			return &operationError{http.StatusBadRequest, "Chỉ thay đổi được quy trình phê duyệt khi văn bản đang soạn thảo"}
+		}
+		if !canSubmitForApproval(document, actorID, userRole) && userRole != models.RoleSecretary {
+			return &operationError{http.StatusForbidden, "Không có quyền thay đổi quy trình phê duyệt của văn bản này"}
+		}
+		if err := tx.Where("outgoing_document_id = ?", document.ID).Delete(&models.OutgoingApprovalStep{}).Error; err != nil {
+			return err
+		}
+		for i, approverID := range approverIDs {
+			if err := tx.Create(&models.OutgoingApprovalStep{
+				OutgoingDocumentID: document.ID,
+				Position:           i + 1,
+				ApproverID:         approverID,
+				Status:             models.ApprovalStepWaiting,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(document).Update("approver_id", approverIDs[len(approverIDs)-1]).Error
+	})
+}
+
+// SubmitOutgoingDocument sends a draft into review
+func SubmitOutgoingDocument(c *gin.Context) {
+	var req ApprovalActionRequest
+	c.ShouldBindJSON(&req)
+	runApprovalAction(c, "Trình duyệt", func(tx *gorm.DB, document *models.OutgoingDocument, actorID uint, userRole string) error {
+		return submitForApprovalTx(tx, document, actorID, userRole, req.Comment)
+	})
+}
+
+// WithdrawOutgoingDocument takes a document in review back to draft
+func WithdrawOutgoingDocument(c *gin.Context) {
+	var req ApprovalActionRequest
+	c.ShouldBindJSON(&req)
+	runApprovalAction(c, "Rút lại", func(tx *gorm.DB, document *models.OutgoingDocument, actorID uint, userRole string) error {
+		return withdrawFromApprovalTx(tx, document, actorID, userRole, req.Comment)
+	})
+}
+
+// ApproveOutgoingDocument approves the current step of the approval chain; only its approver may.
+// With sign, the final approval also signs the document's PDF.
+func ApproveOutgoingDocument(c *gin.Context) {
+	var req ApprovalActionRequest
+	c.ShouldBindJSON(&req)
+	approveAndSign(c, req.Comment, req.Sign)
+}
+
+// RejectOutgoingDocument returns a document to draft with the approver's reasons
+func RejectOutgoingDocument(c *gin.Context) {
+	var req ApprovalActionRequest
+	c.ShouldBindJSON(&req)
+	runApprovalAction(c, "Từ chối", func(tx *gorm.DB, document *models.OutgoingDocument, actorID uint, userRole string) error {
+		return rejectStepTx(tx, document, actorID, req.Comment)
+	})
+}
+
+// IssueOutgoingDocument numbers and releases an approved document
+func IssueOutgoingDocument(c *gin.Context) {
+	var req IssueOutgoingDocumentRequest
+	c.ShouldBindJSON(&req)
+	var issueDate *time.Time
+	if req.IssueDate != "" {
+		parsed, err := time.Parse("2006-01-02", req.IssueDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Định dạng ngày ban hành không hợp lệ"})
+			return
+		}
+		issueDate = &parsed
+	}
+	runApprovalAction(c, "Ban hành", func(tx *gorm.DB, document *models.OutgoingDocument, actorID uint, userRole string) error {
+		return issueOutgoingDocumentTx(tx, document, actorID, userRole, issueDate, req.Comment)
+	})
+}
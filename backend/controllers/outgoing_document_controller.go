@@ -4,16 +4,20 @@ import (
 	"ai-code-agent-backend/database"
 	"ai-code-agent-backend/models"
 	"ai-code-agent-backend/services"
+	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 )
 
 type CreateOutgoingDocumentRequest struct {
-	DocumentNumber string `json:"document_number" binding:"required"`
+	DocumentNumber string `json:"document_number"` // Leave empty to take a number from the type's register on approval
 	IssueDate      string `json:"issue_date" binding:"required"`
 	DocumentTypeID uint   `json:"document_type_id" binding:"required"`
 	IssuingUnitID  uint   `json:"issuing_unit_id" binding:"required"`
@@ -21,6 +25,9 @@ type CreateOutgoingDocumentRequest struct {
 	DrafterID      uint   `json:"drafter_id" binding:"required"`
 	ApproverID     uint   `json:"approver_id" binding:"required"`
 	InternalNotes  string `json:"internal_notes"`
+	Urgency        string `json:"urgency"`
+	SecrecyLevel   string `json:"secrecy_level"`
+	ClearedUserIDs []uint `json:"cleared_user_ids"` // Users who may see a classified document besides its creator, drafter and approver
 }
 
 type UpdateOutgoingDocumentRequest struct {
@@ -33,11 +40,19 @@ type UpdateOutgoingDocumentRequest struct {
 	ApproverID     uint   `json:"approver_id"`
 	InternalNotes  string `json:"internal_notes"`
 	Status         string `json:"status"`
+	Urgency        string `json:"urgency"`
+	SecrecyLevel   string `json:"secrecy_level"`
+	Version        *uint  `json:"version"` // alternative to the If-Match header
 }
 
 type UpdateApprovalStatusRequest struct {
 	Status string `json:"status" binding:"required"`
 	Notes  string `json:"notes"`
+	Sign   bool   `json:"sign"` // With approved: sign the approved PDF with the organisation's certificate
+}
+
+type CancelOutgoingDocumentRequest struct {
+	Reason string `json:"reason" binding:"required"`
 }
 
 // CreateOutgoingDocument creates a new outgoing document
@@ -57,6 +72,21 @@ func CreateOutgoingDocument(c *gin.Context) {
 		return
 	}
 
+	if message := validateDocumentLevels(req.Urgency, req.SecrecyLevel); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+	if req.Urgency == "" {
+		req.Urgency = models.UrgencyNormal
+	}
+	if req.SecrecyLevel == "" {
+		req.SecrecyLevel = models.SecrecyNone
+	}
+	if !validateGrantees(database.DB, req.ClearedUserIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Người được phép truy cập không tồn tại hoặc đã ngừng hoạt động"})
+		return
+	}
+
 	// Validate drafter (must be Team Leader, Deputy, or Officer)
 	var drafter models.User
 	if err := database.DB.First(&drafter, req.DrafterID).Error; err != nil {
@@ -79,9 +109,16 @@ func CreateOutgoingDocument(c *gin.Context) {
 		return
 	}
 
+	documentNumber := strings.TrimSpace(req.DocumentNumber)
+	if documentNumber != "" && outgoingNumberTaken(database.DB, documentNumber, issueDate.Year(), req.DocumentTypeID, 0) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Số văn bản %s đã tồn tại trong năm %d", documentNumber, issueDate.Year())})
+		return
+	}
+
 	// Create outgoing document
 	outgoingDoc := models.OutgoingDocument{
-		DocumentNumber: req.DocumentNumber,
+		DocumentNumber: documentNumber,
+		NumberYear:     issueDate.Year(),
 		IssueDate:      issueDate,
 		DocumentTypeID: req.DocumentTypeID,
 		IssuingUnitID:  req.IssuingUnitID,
@@ -89,11 +126,23 @@ func CreateOutgoingDocument(c *gin.Context) {
 		DrafterID:      req.DrafterID,
 		ApproverID:     req.ApproverID,
 		InternalNotes:  req.InternalNotes,
+		Urgency:        req.Urgency,
+		SecrecyLevel:   req.SecrecyLevel,
 		Status:         models.OutgoingStatusDraft,
 		CreatedByID:    userID.(uint),
 	}
 
-	if err := database.DB.Create(&outgoingDoc).Error; err != nil {
+	tx := database.DB.Begin()
+	err = tx.Create(&outgoingDoc).Error
+	if err == nil && models.IsClassified(outgoingDoc.SecrecyLevel) {
+		err = grantDocumentAccessTx(tx, models.AccessEntityOutgoingDocument, outgoingDoc.ID, uniqueIDs(req.ClearedUserIDs), userID.(uint))
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo văn bản đi"})
 		return
 	}
@@ -124,10 +173,22 @@ func GetOutgoingDocuments(c *gin.Context) {
 		query = query.Where("drafter_id = ? OR created_by_id = ?", userID, userID)
 	}
 
+	// Classified documents are listed only for the users cleared for them
+	query = services.ScopeVisibleOutgoingDocuments(query, userID.(uint))
+	if urgency := c.Query("urgency"); urgency != "" {
+		query = query.Where("outgoing_documents.urgency = ?", urgency)
+	}
+	if secrecyLevel := c.Query("secrecy_level"); secrecyLevel != "" {
+		query = query.Where("outgoing_documents.secrecy_level = ?", secrecyLevel)
+	}
+
 	// Apply advanced filters
 	query = services.ApplyOutgoingDocumentFilters(query, filterParams)
 
-	// Apply sorting
+	// Apply sorting; unless asked otherwise the most urgent documents come first
+	if filterParams.SortBy == "" || filterParams.SortBy == "urgency" {
+		query = query.Order(models.UrgencyOrderSQL("outgoing_documents"))
+	}
 	allowedSortFields := []string{"issue_date", "document_number", "created_at", "updated_at"}
 	query = services.ApplySorting(query, filterParams.SortBy, filterParams.SortOrder, allowedSortFields)
 
@@ -162,10 +223,24 @@ func GetOutgoingDocument(c *gin.Context) {
 	}
 
 	var document models.OutgoingDocument
-	if err := database.DB.Preload("DocumentType").Preload("IssuingUnit").Preload("Drafter").Preload("Approver").Preload("CreatedBy").First(&document, id).Error; err != nil {
+	if err := database.DB.Preload("DocumentType").Preload("IssuingUnit").Preload("Drafter").Preload("Approver").Preload("CreatedBy").
+		Preload("Recipients", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).Preload("Recipients.ReceivingUnit").
+		First(&document, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đi"})
 		return
 	}
+	if !requireOutgoingDocumentAccess(c, &document) {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if document.Thread, err = services.CorrespondenceThreadOf(database.DB, models.RelationDocumentOutgoing, document.ID, userID.(uint)); err != nil {
+		log.Printf("Cannot load correspondence thread of outgoing document %d: %v", document.ID, err)
+	}
+
+	if !respondWithETag(c, document.Version) {
+		return
+	}
 
 	c.JSON(http.StatusOK, document)
 }
@@ -184,6 +259,12 @@ func UpdateOutgoingDocument(c *gin.Context) {
 		return
 	}
 
+	expected, err := expectedVersion(c, req.Version)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Phiên bản dữ liệu không hợp lệ"})
+		return
+	}
+
 	userID, _ := c.Get("user_id")
 	userRole, _ := c.Get("user_role")
 
@@ -192,6 +273,9 @@ func UpdateOutgoingDocument(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đi"})
 		return
 	}
+	if !requireOutgoingDocumentAccess(c, &document) {
+		return
+	}
 
 	// Check permissions
 	switch userRole.(string) {
@@ -208,20 +292,57 @@ func UpdateOutgoingDocument(c *gin.Context) {
 		return
 	}
 
+	if document.Status == models.OutgoingStatusCancelled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Văn bản đã bị hủy, không thể chỉnh sửa"})
+		return
+	}
+	// Once in review the content is what the approvers see and sign; it changes only back in draft
+	if !isEditableDraft(document.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Chỉ chỉnh sửa được văn bản đang soạn thảo"})
+		return
+	}
+	if req.Status == models.OutgoingStatusCancelled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vui lòng dùng chức năng hủy văn bản để hủy số"})
+		return
+	}
+	if req.Status != "" && req.Status != document.Status {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Trạng thái văn bản chỉ thay đổi qua trình duyệt, phê duyệt và ban hành"})
+		return
+	}
+
 	// Update fields if provided
 	updates := make(map[string]interface{})
 
-	if req.DocumentNumber != "" {
-		updates["document_number"] = req.DocumentNumber
-	}
+	documentNumber := strings.TrimSpace(req.DocumentNumber)
+	documentTypeID := document.DocumentTypeID
+	issueDate := document.IssueDate
 	if req.IssueDate != "" {
-		if issueDate, err := time.Parse("2006-01-02", req.IssueDate); err == nil {
+		if parsed, err := time.Parse("2006-01-02", req.IssueDate); err == nil {
+			issueDate = parsed
 			updates["issue_date"] = issueDate
 		}
 	}
 	if req.DocumentTypeID > 0 {
+		documentTypeID = req.DocumentTypeID
 		updates["document_type_id"] = req.DocumentTypeID
 	}
+	// A number from the register belongs to its type and year for good
+	if document.SequenceNumber > 0 && ((documentNumber != "" && documentNumber != document.DocumentNumber) ||
+		documentTypeID != document.DocumentTypeID || issueDate.Year() != document.NumberYear) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Văn bản đã được cấp số, không thể đổi số, loại văn bản hoặc năm ban hành"})
+		return
+	}
+	if documentNumber == "" {
+		documentNumber = document.DocumentNumber
+	}
+	if document.SequenceNumber == 0 {
+		if documentNumber != "" && outgoingNumberTaken(database.DB, documentNumber, issueDate.Year(), documentTypeID, document.ID) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Số văn bản %s đã tồn tại trong năm %d", documentNumber, issueDate.Year())})
+			return
+		}
+		updates["document_number"] = documentNumber
+		updates["number_year"] = issueDate.Year()
+	}
 	if req.IssuingUnitID > 0 {
 		updates["issuing_unit_id"] = req.IssuingUnitID
 	}
@@ -231,8 +352,19 @@ func UpdateOutgoingDocument(c *gin.Context) {
 	if req.InternalNotes != "" {
 		updates["internal_notes"] = req.InternalNotes
 	}
-	if req.Status != "" {
-		updates["status"] = req.Status
+	if message := validateDocumentLevels(req.Urgency, req.SecrecyLevel); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+	if req.Urgency != "" {
+		updates["urgency"] = req.Urgency
+	}
+	if req.SecrecyLevel != "" && req.SecrecyLevel != document.SecrecyLevel {
+		if !canChangeSecrecy(userRole.(string), document.CreatedByID, userID.(uint)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền thay đổi độ mật của văn bản"})
+			return
+		}
+		updates["secrecy_level"] = req.SecrecyLevel
 	}
 	if req.DrafterID > 0 {
 		// Validate drafter
@@ -258,82 +390,74 @@ func UpdateOutgoingDocument(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Người phê duyệt phải là Trưởng hoặc Phó Công An Xã"})
 			return
 		}
+		if req.ApproverID != document.ApproverID {
+			var steps int
+			database.DB.Model(&models.OutgoingApprovalStep{}).Where("outgoing_document_id = ?", document.ID).Count(&steps)
+			if steps > 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Văn bản đã có quy trình phê duyệt, vui lòng đổi người phê duyệt trong quy trình"})
+				return
+			}
+		}
 		updates["approver_id"] = req.ApproverID
 	}
 
-	if err := database.DB.Model(&document).Updates(updates).Error; err != nil {
+	tx := database.DB.Begin()
+	oldSecrecy := document.SecrecyLevel
+	updated, err := updateIfVersion(tx, &document, expected, updates)
+	if err == nil && updated {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật văn bản đi"})
 		return
 	}
+	if updated && oldSecrecy != document.SecrecyLevel {
+		auditSecrecyChange(c, models.AuditEntityOutgoingDocument, document.ID, oldSecrecy, document.SecrecyLevel)
+	}
 
 	// Load relations
 	database.DB.Preload("DocumentType").Preload("IssuingUnit").Preload("Drafter").Preload("Approver").Preload("CreatedBy").First(&document, document.ID)
 
+	if !updated {
+		respondVersionConflict(c, document, document.Version)
+		return
+	}
+
+	c.Header("ETag", versionETag(document.Version))
 	c.JSON(http.StatusOK, document)
 }
 
-// UpdateApprovalStatus updates the approval status of an outgoing document
+// UpdateApprovalStatus moves a document through the approval workflow by the status asked for,
+// for clients that predate the dedicated actions: review submits it, approved approves the
+// current step, draft or rejected rejects it, issued or sent issues it. Notes become the comment
+// recorded in the approval history. Sign with the final approval signs the document's PDF.
 func UpdateApprovalStatus(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
-		return
-	}
-
 	var req UpdateApprovalStatusRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
 		return
 	}
 
-	userID, _ := c.Get("user_id")
-	userRole, _ := c.Get("user_role")
-
-	var document models.OutgoingDocument
-	if err := database.DB.First(&document, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đi"})
-		return
-	}
-
-	// Check if user is the approver or has admin/secretary role
-	if userRole.(string) != models.RoleAdmin && userRole.(string) != models.RoleSecretary {
-		if document.ApproverID != userID.(uint) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Chỉ người phê duyệt mới có thể thay đổi trạng thái phê duyệt"})
-			return
-		}
-	}
-
-	// Validate status transition
-	validStatuses := []string{models.OutgoingStatusDraft, models.OutgoingStatusReview, models.OutgoingStatusApproved, models.OutgoingStatusSent, models.OutgoingStatusRejected}
-	isValidStatus := false
-	for _, status := range validStatuses {
-		if req.Status == status {
-			isValidStatus = true
-			break
-		}
-	}
-	if !isValidStatus {
+	switch req.Status {
+	case models.OutgoingStatusReview:
+		runApprovalAction(c, "Trình duyệt", func(tx *gorm.DB, document *models.OutgoingDocument, actorID uint, userRole string) error {
+			return submitForApprovalTx(tx, document, actorID, userRole, req.Notes)
+		})
+	case models.OutgoingStatusApproved:
+		approveAndSign(c, req.Notes, req.Sign)
+	case models.OutgoingStatusDraft, models.OutgoingStatusRejected:
+		runApprovalAction(c, "Từ chối", func(tx *gorm.DB, document *models.OutgoingDocument, actorID uint, userRole string) error {
+			return rejectStepTx(tx, document, actorID, req.Notes)
+		})
+	case models.OutgoingStatusIssued, models.OutgoingStatusSent:
+		runApprovalAction(c, "Ban hành", func(tx *gorm.DB, document *models.OutgoingDocument, actorID uint, userRole string) error {
+			return issueOutgoingDocumentTx(tx, document, actorID, userRole, nil, req.Notes)
+		})
+	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Trạng thái không hợp lệ"})
-		return
-	}
-
-	// Update status
-	updates := map[string]interface{}{
-		"status": req.Status,
 	}
-	if req.Notes != "" {
-		updates["internal_notes"] = req.Notes
-	}
-
-	if err := database.DB.Model(&document).Updates(updates).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật trạng thái phê duyệt"})
-		return
-	}
-
-	// Load relations
-	database.DB.Preload("DocumentType").Preload("IssuingUnit").Preload("Drafter").Preload("Approver").Preload("CreatedBy").First(&document, document.ID)
-
-	c.JSON(http.StatusOK, document)
 }
 
 // DeleteOutgoingDocument deletes an outgoing document
@@ -351,19 +475,12 @@ func DeleteOutgoingDocument(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đi"})
 		return
 	}
-
-	// Check permissions
-	switch userRole.(string) {
-	case models.RoleSecretary, models.RoleAdmin, models.RoleTeamLeader, models.RoleDeputy:
-		// Can delete any document
-	default:
-		c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền xóa văn bản"})
+	if !requireOutgoingDocumentAccess(c, &document) {
 		return
 	}
 
-	// Check if document is already approved or sent
-	if document.Status == models.OutgoingStatusApproved || document.Status == models.OutgoingStatusSent {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Không thể xóa văn bản đã được phê duyệt hoặc đã gửi"})
+	if err := deleteOutgoingDocumentTx(database.DB, &document, userRole.(string)); err != nil {
+		respondOperationError(c, err, "Không thể xóa văn bản đi")
 		return
 	}
 
@@ -372,13 +489,30 @@ func DeleteOutgoingDocument(c *gin.Context) {
 		os.Remove(document.FilePath)
 	}
 
-	// Delete the document
-	if err := database.DB.Delete(&document).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa văn bản đi"})
-		return
+	c.JSON(http.StatusOK, gin.H{"message": "Xóa văn bản đi thành công"})
+}
+
+// deleteOutgoingDocumentTx checks that the document may be deleted and soft deletes it.
+// The stored file is left on disk for the caller to remove after a successful commit.
+func deleteOutgoingDocumentTx(db *gorm.DB, document *models.OutgoingDocument, userRole string) error {
+	// Check permissions
+	switch userRole {
+	case models.RoleSecretary, models.RoleAdmin, models.RoleTeamLeader, models.RoleDeputy:
+		// Can delete any document
+	default:
+		return &operationError{http.StatusForbidden, "Không có quyền xóa văn bản"}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Xóa văn bản đi thành công"})
+	// Check if document is already approved, issued or sent
+	switch document.Status {
+	case models.OutgoingStatusApproved, models.OutgoingStatusIssued, models.OutgoingStatusSent:
+		return &operationError{http.StatusBadRequest, "Không thể xóa văn bản đã được phê duyệt, ban hành hoặc đã gửi"}
+	}
+	if document.Status == models.OutgoingStatusCancelled {
+		return &operationError{http.StatusBadRequest, "Không thể xóa văn bản đã hủy, số văn bản được giữ lại trong sổ"}
+	}
+
+	return db.Delete(document).Error
 }
 
 // UploadOutgoingDocumentFile uploads a signed document file for an outgoing document
@@ -394,6 +528,14 @@ func UploadOutgoingDocumentFile(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đi"})
 		return
 	}
+	if !requireOutgoingDocumentAccess(c, &document) {
+		return
+	}
+	// Replacing the file in review or later would swap what was approved, or drop the signed PDF
+	if !isEditableDraft(document.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Chỉ thay đổi được file của văn bản đang soạn thảo"})
+		return
+	}
 
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -442,12 +584,8 @@ func UploadOutgoingDocumentFile(c *gin.Context) {
 		fileService.DeleteFile(document.FilePath, userID.(uint), userRole.(string))
 	}
 
-	// Update document with file path and potentially change status
+	// Update document with file path; sending it for review is left to the approval workflow
 	document.FilePath = fileInfo.FilePath
-	// If document is in draft status and file is uploaded, move to review
-	if document.Status == models.OutgoingStatusDraft {
-		document.Status = models.OutgoingStatusReview
-	}
 
 	if err := database.DB.Save(&document).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật thông tin file"})
@@ -485,6 +623,124 @@ func GetApprovers(c *gin.Context) {
 	c.JSON(http.StatusOK, users)
 }
 
+// outgoingNumberTaken reports whether another document of the same type and year already uses a number
+func outgoingNumberTaken(db *gorm.DB, number string, year int, documentTypeID, excludeID uint) bool {
+	var count int
+	db.Model(&models.OutgoingDocument{}).
+		Where("document_number = ? AND number_year = ? AND document_type_id = ? AND id <> ?", number, year, documentTypeID, excludeID).
+		Count(&count)
+	return count > 0
+}
+
+// reserveOutgoingNumberTx takes the next number of the document type's register for the issue year
+// and returns the fields to store on the document. The register stays locked until tx ends, so
+// rolling back gives the number back.
+func reserveOutgoingNumberTx(tx *gorm.DB, documentTypeID, issuingUnitID uint, issueDate time.Time) (map[string]interface{}, error) {
+	var documentType models.DocumentType
+	if err := tx.First(&documentType, documentTypeID).Error; err != nil {
+		return nil, &operationError{http.StatusBadRequest, "Loại văn bản không tồn tại"}
+	}
+	if documentType.NumberTemplate == "" {
+		return nil, &operationError{http.StatusBadRequest, "Loại văn bản chưa có mẫu số, vui lòng nhập số văn bản"}
+	}
+
+	var issuingUnit models.IssuingUnit
+	if err := tx.First(&issuingUnit, issuingUnitID).Error; err != nil {
+		return nil, &operationError{http.StatusBadRequest, "Đơn vị ban hành không tồn tại"}
+	}
+
+	year := issueDate.Year()
+	seq, err := services.NextSequenceValue(tx, models.SequenceScopeOutgoing, year, outgoingRegisterBook(documentTypeID),
+		func() (int, error) { return highestOutgoingNumber(tx, year, documentTypeID) })
+	if err != nil {
+		return nil, err
+	}
+
+	number := services.FormatDocumentNumber(documentType.NumberTemplate, seq, year, documentType.Code, issuingUnit.Code)
+	if outgoingNumberTaken(tx, number, year, documentTypeID, 0) {
+		return nil, &operationError{http.StatusConflict, fmt.Sprintf("Số văn bản %s đã được nhập tay cho văn bản khác, vui lòng điều chỉnh sổ đăng ký", number)}
+	}
+
+	return map[string]interface{}{
+		"document_number": number,
+		"sequence_number": seq,
+		"number_year":     year,
+	}, nil
+}
+
+// CancelOutgoingDocument cancels a document. Its number stays in the register, marked as cancelled,
+// and is not handed out again.
+func CancelOutgoingDocument(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	var req CancelOutgoingDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vui lòng nhập lý do hủy"})
+		return
+	}
+
+	var document models.OutgoingDocument
+	if err := database.DB.First(&document, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đi"})
+		return
+	}
+	if !requireOutgoingDocumentAccess(c, &document) {
+		return
+	}
+	if document.Status == models.OutgoingStatusCancelled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Văn bản đã bị hủy"})
+		return
+	}
+
+	oldStatus := document.Status
+	if err := database.DB.Model(&document).Updates(map[string]interface{}{
+		"status":        models.OutgoingStatusCancelled,
+		"cancel_reason": strings.TrimSpace(req.Reason),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể hủy văn bản"})
+		return
+	}
+
+	services.NewAuditService().LogActivity(c, models.AuditActionNumberCancel, models.AuditEntityOutgoingDocument, document.ID,
+		fmt.Sprintf("Hủy văn bản đi số %s", document.DocumentNumber),
+		gin.H{"status": oldStatus}, gin.H{"status": document.Status},
+		gin.H{"reason": document.CancelReason, "document_number": document.DocumentNumber, "number_year": document.NumberYear})
+
+	database.DB.Preload("DocumentType").Preload("IssuingUnit").Preload("Drafter").Preload("Approver").Preload("CreatedBy").First(&document, document.ID)
+
+	c.JSON(http.StatusOK, document)
+}
+
+// GetOutgoingRegister returns the register of outgoing numbers for a year, cancelled numbers included.
+// Filter by document_type_id to see a single register book.
+func GetOutgoingRegister(c *gin.Context) {
+	year, err := strconv.Atoi(c.DefaultQuery("year", strconv.Itoa(time.Now().Year())))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Năm không hợp lệ"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	query := services.ScopeVisibleOutgoingDocuments(database.DB, userID.(uint)).
+		Preload("DocumentType").Preload("IssuingUnit").Preload("Drafter").
+		Where("number_year = ? AND document_number <> ''", year)
+	if typeID := c.Query("document_type_id"); typeID != "" {
+		query = query.Where("document_type_id = ?", typeID)
+	}
+
+	var documents []models.OutgoingDocument
+	if err := query.Order("document_type_id asc, sequence_number asc, document_number asc").Find(&documents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy sổ văn bản đi"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"year": year, "documents": documents})
+}
+
 // Helper function to check if a role can be a drafter
 func isDrafterRole(role string) bool {
 	return role == models.RoleTeamLeader || role == models.RoleDeputy || role == models.RoleOfficer
@@ -0,0 +1,458 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"ai-code-agent-backend/services"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type RecipientRequest struct {
+	ReceivingUnitID uint   `json:"receiving_unit_id" binding:"required"`
+	DeliveryMethod  string `json:"delivery_method"` // Defaults to post
+	Notes           string `json:"notes"`
+}
+
+type SetRecipientsRequest struct {
+	Recipients []RecipientRequest `json:"recipients"`
+}
+
+type DispatchOutgoingDocumentRequest struct {
+	RecipientIDs   []uint `json:"recipient_ids"` // Empty dispatches to every recipient not sent to yet
+	DispatchedAt   string `json:"dispatched_at"` // YYYY-MM-DD, defaults to today
+	TrackingNumber string `json:"tracking_number"`
+	Notes          string `json:"notes"`
+}
+
+type ConfirmReceiptRequest struct {
+	ReceivedAt string `json:"received_at"` // YYYY-MM-DD, defaults to today
+	ReceivedBy string `json:"received_by"`
+	Notes      string `json:"notes"`
+}
+
+type ReturnRecipientRequest struct {
+	Notes string `json:"notes" binding:"required"`
+}
+
+// derivedDispatchStatus works out the status of an issued document from its distribution
+// list: sent once every recipient has been dispatched, with sentAt the last dispatch date, and
+// back to issued when a recipient is added or returned later. ok is false for documents
+// without recipients and documents not yet issued, whose status is left as it is.
+func derivedDispatchStatus(document *models.OutgoingDocument, recipients []models.OutgoingDocumentRecipient) (status string, sentAt *time.Time, ok bool) {
+	if len(recipients) == 0 || (document.Status != models.OutgoingStatusIssued && document.Status != models.OutgoingStatusSent) {
+		return "", nil, false
+	}
+	for i := range recipients {
+		if !recipients[i].IsDispatched() {
+			return models.OutgoingStatusIssued, nil, true
+		}
+		if recipients[i].DispatchedAt != nil && (sentAt == nil || recipients[i].DispatchedAt.After(*sentAt)) {
+			sentAt = recipients[i].DispatchedAt
+		}
+	}
+	return models.OutgoingStatusSent, sentAt, true
+}
+
+// syncDispatchStatusTx brings the status of a document in line with its distribution list. The
+// document row is locked and reloaded first, so dispatches in parallel transactions sync one after
+// the other and the last one sees every recipient sent.
+func syncDispatchStatusTx(db *gorm.DB, document *models.OutgoingDocument) error {
+	if err := db.Set("gorm:query_option", "FOR UPDATE").First(document, document.ID).Error; err != nil {
+		return err
+	}
+	var recipients []models.OutgoingDocumentRecipient
+	if err := db.Select("id, status, dispatched_at").Where("outgoing_document_id = ?", document.ID).Find(&recipients).Error; err != nil {
+		return err
+	}
+	status, sentAt, ok := derivedDispatchStatus(document, recipients)
+	if !ok || (status == document.Status && sameDeadline(sentAt, document.SentAt)) {
+		return nil
+	}
+	return db.Model(document).Updates(map[string]interface{}{"status": status, "sent_at": sentAt}).Error
+}
+
+// loadDispatchDocument loads the outgoing document of the request, refusing cancelled ones
+func loadDispatchDocument(c *gin.Context) (*models.OutgoingDocument, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return nil, false
+	}
+	var document models.OutgoingDocument
+	if err := database.DB.First(&document, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy văn bản đi"})
+		return nil, false
+	}
+	if !requireOutgoingDocumentAccess(c, &document) {
+		return nil, false
+	}
+	if c.Request.Method != http.MethodGet && document.Status == models.OutgoingStatusCancelled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Văn bản đã bị hủy, không thể gửi"})
+		return nil, false
+	}
+	return &document, true
+}
+
+// parseDispatchDate reads an optional YYYY-MM-DD date, defaulting to now
+func parseDispatchDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now(), nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func respondRecipients(c *gin.Context, status int, documentID uint) {
+	var recipients []models.OutgoingDocumentRecipient
+	if err := database.DB.Preload("ReceivingUnit").Preload("DispatchedBy").
+		Where("outgoing_document_id = ?", documentID).Order("position, id").Find(&recipients).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách nơi nhận"})
+		return
+	}
+	c.JSON(status, recipients)
+}
+
+// GetOutgoingDocumentRecipients returns the distribution list of an outgoing document
+func GetOutgoingDocumentRecipients(c *gin.Context) {
+	if document, ok := loadDispatchDocument(c); ok {
+		respondRecipients(c, http.StatusOK, document.ID)
+	}
+}
+
+// SetOutgoingDocumentRecipients replaces the distribution list of an outgoing document. Units
+// already sent to stay on the list with their delivery method; the others may be changed freely.
+func SetOutgoingDocumentRecipients(c *gin.Context) {
+	var req SetRecipientsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
+		return
+	}
+	document, ok := loadDispatchDocument(c)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+	if userRole.(string) == models.RoleOfficer && document.DrafterID != userID.(uint) && document.CreatedByID != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền chỉnh sửa nơi nhận của văn bản này"})
+		return
+	}
+
+	// The current list is read and checked under a lock on the document, so a dispatch running
+	// alongside cannot send to a recipient this request drops or changes
+	tx := database.DB.Begin()
+	err := func() error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(document, document.ID).Error; err != nil {
+			return err
+		}
+		var existing []models.OutgoingDocumentRecipient
+		if err := tx.Preload("ReceivingUnit").Where("outgoing_document_id = ?", document.ID).Find(&existing).Error; err != nil {
+			return err
+		}
+		byUnit := make(map[uint]*models.OutgoingDocumentRecipient, len(existing))
+		for i := range existing {
+			byUnit[existing[i].ReceivingUnitID] = &existing[i]
+		}
+
+		requested := make(map[uint]bool, len(req.Recipients))
+		for i := range req.Recipients {
+			recipient := &req.Recipients[i]
+			if requested[recipient.ReceivingUnitID] {
+				return &operationError{http.StatusBadRequest, "Nơi nhận bị trùng trong danh sách"}
+			}
+			requested[recipient.ReceivingUnitID] = true
+			if recipient.DeliveryMethod == "" {
+				recipient.DeliveryMethod = models.DeliveryMethodPost
+			}
+			if !models.IsValidDeliveryMethod(recipient.DeliveryMethod) {
+				return &operationError{http.StatusBadRequest, "Hình thức gửi không hợp lệ"}
+			}
+
+			current := byUnit[recipient.ReceivingUnitID]
+			if current == nil {
+				var unit models.ReceivingUnit
+				if err := tx.Where("id = ? AND is_active = ?", recipient.ReceivingUnitID, true).First(&unit).Error; err != nil {
+					return &operationError{http.StatusBadRequest, "Đơn vị nhận không tồn tại hoặc đã ngừng hoạt động"}
+				}
+			} else if current.IsDispatched() && current.DeliveryMethod != recipient.DeliveryMethod {
+				return &operationError{http.StatusBadRequest, fmt.Sprintf("Văn bản đã được gửi đến %s, không thể đổi hình thức gửi", current.ReceivingUnit.Name)}
+			}
+		}
+		for _, current := range existing {
+			if !requested[current.ReceivingUnitID] && current.IsDispatched() {
+				return &operationError{http.StatusBadRequest, fmt.Sprintf("Văn bản đã được gửi đến %s, không thể bỏ khỏi nơi nhận", current.ReceivingUnit.Name)}
+			}
+		}
+
+		for _, current := range existing {
+			if !requested[current.ReceivingUnitID] {
+				if err := tx.Delete(&current).Error; err != nil {
+					return err
+				}
+			}
+		}
+		for position, recipient := range req.Recipients {
+			if current := byUnit[recipient.ReceivingUnitID]; current != nil {
+				if err := tx.Model(current).Updates(map[string]interface{}{
+					"delivery_method": recipient.DeliveryMethod,
+					"notes":           recipient.Notes,
+					"position":        position,
+				}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Create(&models.OutgoingDocumentRecipient{
+				OutgoingDocumentID: document.ID,
+				ReceivingUnitID:    recipient.ReceivingUnitID,
+				DeliveryMethod:     recipient.DeliveryMethod,
+				Status:             models.RecipientStatusPending,
+				Position:           position,
+				Notes:              recipient.Notes,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return syncDispatchStatusTx(tx, document)
+	}()
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		respondOperationError(c, err, "Không thể cập nhật nơi nhận")
+		return
+	}
+
+	services.NewAuditService().LogActivity(c, models.AuditActionDocumentUpdate, models.AuditEntityOutgoingDocument, document.ID,
+		fmt.Sprintf("Cập nhật nơi nhận văn bản đi %s: %d đơn vị", document.DocumentNumber, len(req.Recipients)),
+		nil, req.Recipients, nil)
+
+	respondRecipients(c, http.StatusOK, document.ID)
+}
+
+// DispatchOutgoingDocument records that an issued document was sent to some or all of its
+// recipients. The document becomes sent once every recipient has been dispatched.
+func DispatchOutgoingDocument(c *gin.Context) {
+	var req DispatchOutgoingDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
+		return
+	}
+	document, ok := loadDispatchDocument(c)
+	if !ok {
+		return
+	}
+	if document.Status != models.OutgoingStatusIssued && document.Status != models.OutgoingStatusSent {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Văn bản chưa được ban hành, chưa thể gửi"})
+		return
+	}
+
+	dispatchedAt, err := parseDispatchDate(req.DispatchedAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ngày gửi không hợp lệ"})
+		return
+	}
+	if dispatchedAt.Format("2006-01-02") < document.IssueDate.Format("2006-01-02") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ngày gửi không thể trước ngày ban hành"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	actorID := userID.(uint)
+	updates := map[string]interface{}{
+		"status":           models.RecipientStatusDispatched,
+		"dispatched_at":    dispatchedAt,
+		"dispatched_by_id": actorID,
+		"tracking_number":  req.TrackingNumber,
+		"received_at":      nil,
+		"received_by":      "",
+	}
+	if req.Notes != "" {
+		updates["notes"] = req.Notes
+	}
+
+	// The recipients are read under a lock on the document, so two dispatches cannot both send
+	// to the same recipient
+	var recipients []models.OutgoingDocumentRecipient
+	tx := database.DB.Begin()
+	err = func() error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(document, document.ID).Error; err != nil {
+			return err
+		}
+		if document.Status != models.OutgoingStatusIssued && document.Status != models.OutgoingStatusSent {
+			return &operationError{http.StatusBadRequest, "Văn bản chưa được ban hành, chưa thể gửi"}
+		}
+
+		query := tx.Preload("ReceivingUnit").Where("outgoing_document_id = ?", document.ID)
+		if ids := uniqueIDs(req.RecipientIDs); len(ids) > 0 {
+			query = query.Where("id IN (?)", ids)
+		} else {
+			query = query.Where("status IN (?)", []string{models.RecipientStatusPending, models.RecipientStatusReturned})
+		}
+		if err := query.Find(&recipients).Error; err != nil {
+			return err
+		}
+		if len(req.RecipientIDs) > 0 && len(recipients) != len(uniqueIDs(req.RecipientIDs)) {
+			return &operationError{http.StatusNotFound, "Không tìm thấy nơi nhận"}
+		}
+		if len(recipients) == 0 {
+			return &operationError{http.StatusBadRequest, "Không có nơi nhận nào cần gửi"}
+		}
+		for _, recipient := range recipients {
+			if recipient.IsDispatched() {
+				return &operationError{http.StatusBadRequest, fmt.Sprintf("Văn bản đã được gửi đến %s", recipient.ReceivingUnit.Name)}
+			}
+		}
+
+		for i := range recipients {
+			if err := tx.Model(&recipients[i]).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return syncDispatchStatusTx(tx, document)
+	}()
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		respondOperationError(c, err, "Không thể ghi nhận gửi văn bản")
+		return
+	}
+
+	names := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		names[i] = recipient.ReceivingUnit.Name
+	}
+	services.NewAuditService().LogActivity(c, models.AuditActionDocumentDispatch, models.AuditEntityOutgoingDocument, document.ID,
+		fmt.Sprintf("Gửi văn bản đi %s đến %d nơi nhận", document.DocumentNumber, len(recipients)),
+		nil, gin.H{"recipients": names, "dispatched_at": dispatchedAt, "tracking_number": req.TrackingNumber}, nil)
+
+	database.DB.Preload("DocumentType").Preload("IssuingUnit").Preload("Drafter").Preload("Approver").Preload("CreatedBy").
+		Preload("Recipients", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).Preload("Recipients.ReceivingUnit").
+		First(document, document.ID)
+	c.JSON(http.StatusOK, document)
+}
+
+// loadDispatchRecipient loads a recipient of the request's document
+func loadDispatchRecipient(c *gin.Context, document *models.OutgoingDocument) (*models.OutgoingDocumentRecipient, bool) {
+	recipientID, err := strconv.Atoi(c.Param("recipientId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID nơi nhận không hợp lệ"})
+		return nil, false
+	}
+	var recipient models.OutgoingDocumentRecipient
+	if err := database.DB.Preload("ReceivingUnit").Where("outgoing_document_id = ?", document.ID).First(&recipient, recipientID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy nơi nhận"})
+		return nil, false
+	}
+	return &recipient, true
+}
+
+// ConfirmRecipientReceipt records that a recipient confirmed receiving the document
+func ConfirmRecipientReceipt(c *gin.Context) {
+	var req ConfirmReceiptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ: " + err.Error()})
+		return
+	}
+	document, ok := loadDispatchDocument(c)
+	if !ok {
+		return
+	}
+	recipient, ok := loadDispatchRecipient(c, document)
+	if !ok {
+		return
+	}
+	if recipient.Status != models.RecipientStatusDispatched {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Chỉ xác nhận được nơi nhận đã gửi và chưa xác nhận"})
+		return
+	}
+
+	receivedAt, err := parseDispatchDate(req.ReceivedAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ngày nhận không hợp lệ"})
+		return
+	}
+	if recipient.DispatchedAt != nil && receivedAt.Format("2006-01-02") < recipient.DispatchedAt.Format("2006-01-02") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ngày nhận không thể trước ngày gửi"})
+		return
+	}
+
+	updates := map[string]interface{}{
+		"status":      models.RecipientStatusReceived,
+		"received_at": receivedAt,
+		"received_by": req.ReceivedBy,
+	}
+	if req.Notes != "" {
+		updates["notes"] = req.Notes
+	}
+	if err := database.DB.Model(recipient).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xác nhận đã nhận"})
+		return
+	}
+
+	services.NewAuditService().LogActivity(c, models.AuditActionDocumentReceipt, models.AuditEntityOutgoingDocument, document.ID,
+		fmt.Sprintf("%s xác nhận đã nhận văn bản đi %s", recipient.ReceivingUnit.Name, document.DocumentNumber),
+		nil, updates, nil)
+
+	respondRecipients(c, http.StatusOK, document.ID)
+}
+
+// ReturnRecipient records that the document did not reach a recipient, e.g. the post sent it
+// back or the email bounced. The recipient has to be dispatched again before the document counts
+// as sent.
+func ReturnRecipient(c *gin.Context) {
+	var req ReturnRecipientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vui lòng nhập lý do"})
+		return
+	}
+	document, ok := loadDispatchDocument(c)
+	if !ok {
+		return
+	}
+	recipient, ok := loadDispatchRecipient(c, document)
+	if !ok {
+		return
+	}
+	if !recipient.IsDispatched() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Văn bản chưa được gửi đến nơi nhận này"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	err := tx.Model(recipient).Updates(map[string]interface{}{
+		"status":      models.RecipientStatusReturned,
+		"notes":       req.Notes,
+		"received_at": nil,
+		"received_by": "",
+	}).Error
+	if err == nil {
+		err = syncDispatchStatusTx(tx, document)
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể ghi nhận văn bản bị trả lại"})
+		return
+	}
+
+	services.NewAuditService().LogActivity(c, models.AuditActionDocumentDispatch, models.AuditEntityOutgoingDocument, document.ID,
+		fmt.Sprintf("Văn bản đi %s gửi đến %s bị trả lại: %s", document.DocumentNumber, recipient.ReceivingUnit.Name, req.Notes),
+		nil, nil, nil)
+
+	respondRecipients(c, http.StatusOK, document.ID)
+}
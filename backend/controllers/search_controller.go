@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/services"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Page sizes of the unified search. Searching every type returns a short preview per group;
+// narrowing to one type pages through it.
+const (
+	defaultSearchPreviewLimit = 5
+	defaultSearchPageLimit    = 20
+	maxSearchLimit            = 50
+	maxSearchQueryLength      = 200
+)
+
+// Search runs a diacritic-insensitive full-text search over documents, tasks, comments and
+// file contents, returning ranked, highlighted results the user may see, grouped by type.
+// type narrows the search to a comma separated list of entity types.
+func Search(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vui lòng nhập từ khóa tìm kiếm"})
+		return
+	}
+	if utf8.RuneCountInString(query) > maxSearchQueryLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Từ khóa tìm kiếm quá dài"})
+		return
+	}
+
+	entityTypes := services.SearchEntityTypes
+	if types := c.Query("type"); types != "" {
+		entityTypes = nil
+		for _, entityType := range strings.Split(types, ",") {
+			entityType = strings.TrimSpace(entityType)
+			if !contains(services.SearchEntityTypes, entityType) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Loại tìm kiếm không hợp lệ: " + entityType})
+				return
+			}
+			entityTypes = append(entityTypes, entityType)
+		}
+	}
+
+	limit := defaultSearchPreviewLimit
+	if len(entityTypes) == 1 {
+		limit = defaultSearchPageLimit
+	}
+	if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 {
+		limit = value
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	groups, err := services.Search(query, entityTypes, userID.(uint), userRole.(string), (page-1)*limit, limit)
+	if err != nil {
+		log.Printf("Search failed: %v", err)
+		if strings.Contains(err.Error(), "vietnamese_unaccent") || strings.Contains(err.Error(), "search_vector") {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Cơ sở dữ liệu chưa được cài đặt tìm kiếm toàn văn"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tìm kiếm"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":  query,
+		"types":  entityTypes,
+		"page":   page,
+		"limit":  limit,
+		"groups": groups,
+	})
+}
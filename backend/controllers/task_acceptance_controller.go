@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultAcceptanceReminderHours is used when TASK_ACCEPTANCE_REMINDER_HOURS is not set
+const defaultAcceptanceReminderHours = 24
+
+type DeclineTaskRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// acceptanceReminderAfter returns how long an assignment may stay unaccepted before the
+// assigner is reminded on the dashboard
+func acceptanceReminderAfter() time.Duration {
+	hours := defaultAcceptanceReminderHours
+	if value := os.Getenv("TASK_ACCEPTANCE_REMINDER_HOURS"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+			hours = parsed
+		}
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// getUnacceptedTasks returns tasks assigned by the user that are still waiting for acceptance
+// longer than the reminder delay
+func getUnacceptedTasks(assignerID uint) []models.Task {
+	var tasks []models.Task
+	database.DB.Preload("AssignedTo").
+		Where("assigned_by_id = ? AND acceptance_status = ? AND assigned_at < ?",
+			assignerID, models.AcceptancePending, time.Now().Add(-acceptanceReminderAfter())).
+		Order("assigned_at asc").
+		Find(&tasks)
+	return tasks
+}
+
+// loadPendingAcceptanceTask loads the task from the route and checks that it is waiting for
+// the current user to accept it
+func loadPendingAcceptanceTask(c *gin.Context) (*models.Task, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return nil, false
+	}
+
+	userID, _ := c.Get("user_id")
+
+	var task models.Task
+	if err := database.DB.First(&task, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy công việc"})
+		return nil, false
+	}
+
+	if task.AssignedToID == nil || *task.AssignedToID != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Chỉ người được giao mới có thể xác nhận công việc"})
+		return nil, false
+	}
+
+	if task.AcceptanceStatus != models.AcceptancePending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Công việc không ở trạng thái chờ xác nhận"})
+		return nil, false
+	}
+
+	return &task, true
+}
+
+// AcceptTask confirms that the assignee has received the task and takes it on
+func AcceptTask(c *gin.Context) {
+	task, ok := loadPendingAcceptanceTask(c)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	now := time.Now()
+	task.AcceptanceStatus = models.AcceptanceAccepted
+	task.AcceptedAt = &now
+
+	if err := database.DB.Save(task).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xác nhận công việc"})
+		return
+	}
+
+	createTaskStatusHistory(task.ID, task.Status, task.Status, userID.(uint), "Xác nhận nhận công việc")
+
+	database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("AssignedBy").Preload("CreatedBy").Preload("StatusHistory.ChangedBy").First(task, task.ID)
+
+	c.JSON(http.StatusOK, task)
+}
+
+// DeclineTask refuses the assignment with a reason and hands the task back to the assigner
+func DeclineTask(c *gin.Context) {
+	task, ok := loadPendingAcceptanceTask(c)
+	if !ok {
+		return
+	}
+
+	var req DeclineTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vui lòng nhập lý do từ chối"})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+
+	userID, _ := c.Get("user_id")
+
+	// Return the task to whoever assigned it, falling back to its creator
+	returnToID := task.CreatedByID
+	if task.AssignedByID != nil {
+		returnToID = *task.AssignedByID
+	}
+
+	var decliner, assigner models.User
+	if err := database.DB.First(&decliner, userID.(uint)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể từ chối công việc"})
+		return
+	}
+	if err := database.DB.First(&assigner, returnToID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không tìm thấy người giao việc để trả lại công việc"})
+		return
+	}
+
+	task.AssignedToID = &returnToID
+	task.AcceptanceStatus = models.AcceptanceDeclined
+	task.AcceptedAt = nil
+	task.DeclineReason = reason
+
+	notes := fmt.Sprintf("%s từ chối công việc, trả lại cho %s. Lý do: %s", decliner.Name, assigner.Name, reason)
+	tx := database.DB.Begin()
+	err := tx.Save(task).Error
+	if err == nil {
+		err = createTaskStatusHistoryTx(tx, task.ID, task.Status, task.Status, userID.(uint), notes)
+	}
+	if err == nil {
+		message := fmt.Sprintf("%s từ chối công việc %s và trả lại cho bạn. Lý do: %s", decliner.Name, taskLabel(task), reason)
+		err = notifyUsersTx(tx, []uint{returnToID}, models.WatchEntityTask, task.ID, userID.(uint), models.NotificationEventDeclined, message)
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể từ chối công việc"})
+		return
+	}
+
+	database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("AssignedBy").Preload("CreatedBy").Preload("StatusHistory.ChangedBy").First(task, task.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"task":    task,
+		"message": fmt.Sprintf("Đã trả lại công việc cho %s", assigner.Name),
+	})
+}
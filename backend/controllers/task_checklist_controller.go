@@ -0,0 +1,357 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type CreateChecklistItemRequest struct {
+	Title      string `json:"title" binding:"required"`
+	IsRequired bool   `json:"is_required"`
+}
+
+type UpdateChecklistItemRequest struct {
+	Title      string `json:"title"`
+	IsRequired *bool  `json:"is_required"`
+}
+
+type ReorderChecklistRequest struct {
+	ItemIDs []uint `json:"item_ids" binding:"required"`
+}
+
+// checkRequiredChecklistItems rejects the operation while required checklist items are unchecked
+func checkRequiredChecklistItems(db *gorm.DB, taskID uint) error {
+	var pending []models.TaskChecklistItem
+	if err := db.Where("task_id = ? AND is_required = ? AND is_checked = ?", taskID, true, false).
+		Order("position asc").Find(&pending).Error; err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	titles := make([]string, len(pending))
+	for i, item := range pending {
+		titles[i] = item.Title
+	}
+	return &operationError{http.StatusBadRequest, fmt.Sprintf("Còn %d mục bắt buộc chưa hoàn thành: %s", len(pending), strings.Join(titles, ", "))}
+}
+
+// createTemplateChecklistTx copies the template checklist onto a newly created task
+func createTemplateChecklistTx(db *gorm.DB, taskID uint, template *models.TaskTemplate) error {
+	for _, templateItem := range template.ChecklistItems {
+		item := models.TaskChecklistItem{
+			TaskID:     taskID,
+			Title:      templateItem.Title,
+			Position:   templateItem.Position,
+			IsRequired: templateItem.IsRequired,
+		}
+		if err := db.Create(&item).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadChecklistTask loads the task from the route and checks the user may work on its checklist.
+// Leaders, secretaries and admins may change any checklist; others only on tasks they created or hold.
+func loadChecklistTask(c *gin.Context) (*models.Task, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return nil, false
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	var task models.Task
+	if !requireVisibleTask(c, &task, uint(id)) {
+		return nil, false
+	}
+
+	switch userRole.(string) {
+	case models.RoleAdmin, models.RoleSecretary, models.RoleTeamLeader, models.RoleDeputy:
+	default:
+		isAssignee := task.AssignedToID != nil && *task.AssignedToID == userID.(uint)
+		if !isAssignee && task.CreatedByID != userID.(uint) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền cập nhật danh sách kiểm tra của công việc này"})
+			return nil, false
+		}
+	}
+
+	return &task, true
+}
+
+// canChangeRequiredChecklist reports whether the user may decide which items are required: leaders,
+// admins and the task's creator. The assignee works the checklist but cannot drop what gates review.
+func canChangeRequiredChecklist(task *models.Task, userID uint, userRole string) bool {
+	switch userRole {
+	case models.RoleAdmin, models.RoleTeamLeader, models.RoleDeputy:
+		return true
+	}
+	return task.CreatedByID == userID
+}
+
+// loadChecklistItem loads the checklist item from the route, making sure it belongs to the task
+func loadChecklistItem(c *gin.Context, taskID uint) (*models.TaskChecklistItem, bool) {
+	itemID, err := strconv.Atoi(c.Param("itemId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return nil, false
+	}
+
+	var item models.TaskChecklistItem
+	if err := database.DB.Where("task_id = ?", taskID).First(&item, itemID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy mục kiểm tra"})
+		return nil, false
+	}
+
+	return &item, true
+}
+
+// getTaskChecklist returns the checklist of a task in display order
+func getTaskChecklist(taskID uint) ([]models.TaskChecklistItem, error) {
+	var items []models.TaskChecklistItem
+	err := database.DB.Preload("CheckedBy").Where("task_id = ?", taskID).Order("position asc, id asc").Find(&items).Error
+	return items, err
+}
+
+// GetTaskChecklist returns the checklist of a task with a progress summary
+func GetTaskChecklist(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	var task models.Task
+	if !requireVisibleTask(c, &task, uint(id)) {
+		return
+	}
+
+	items, err := getTaskChecklist(task.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách kiểm tra"})
+		return
+	}
+
+	checked, requiredPending := 0, 0
+	for _, item := range items {
+		if item.IsChecked {
+			checked++
+		} else if item.IsRequired {
+			requiredPending++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":            items,
+		"total":            len(items),
+		"checked":          checked,
+		"required_pending": requiredPending,
+	})
+}
+
+// CreateTaskChecklistItem appends an item to the end of a task's checklist
+func CreateTaskChecklistItem(c *gin.Context) {
+	task, ok := loadChecklistTask(c)
+	if !ok {
+		return
+	}
+
+	var req CreateChecklistItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	var last models.TaskChecklistItem
+	position := 1
+	if err := database.DB.Where("task_id = ?", task.ID).Order("position desc").First(&last).Error; err == nil {
+		position = last.Position + 1
+	}
+
+	item := models.TaskChecklistItem{
+		TaskID:     task.ID,
+		Title:      strings.TrimSpace(req.Title),
+		Position:   position,
+		IsRequired: req.IsRequired,
+	}
+	if err := database.DB.Create(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể thêm mục kiểm tra"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, item)
+}
+
+// UpdateTaskChecklistItem changes the title or the required flag of an item
+func UpdateTaskChecklistItem(c *gin.Context) {
+	task, ok := loadChecklistTask(c)
+	if !ok {
+		return
+	}
+	item, ok := loadChecklistItem(c, task.ID)
+	if !ok {
+		return
+	}
+
+	var req UpdateChecklistItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	if title := strings.TrimSpace(req.Title); title != "" {
+		item.Title = title
+	}
+	if req.IsRequired != nil && *req.IsRequired != item.IsRequired {
+		userID, _ := c.Get("user_id")
+		userRole, _ := c.Get("user_role")
+		if !canChangeRequiredChecklist(task, userID.(uint), userRole.(string)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền thay đổi mục bắt buộc của danh sách kiểm tra"})
+			return
+		}
+		item.IsRequired = *req.IsRequired
+	}
+
+	if err := database.DB.Save(item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật mục kiểm tra"})
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// DeleteTaskChecklistItem removes an item from a task's checklist
+func DeleteTaskChecklistItem(c *gin.Context) {
+	task, ok := loadChecklistTask(c)
+	if !ok {
+		return
+	}
+	item, ok := loadChecklistItem(c, task.ID)
+	if !ok {
+		return
+	}
+	if item.IsRequired {
+		userID, _ := c.Get("user_id")
+		userRole, _ := c.Get("user_role")
+		if !canChangeRequiredChecklist(task, userID.(uint), userRole.(string)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền xóa mục bắt buộc của danh sách kiểm tra"})
+			return
+		}
+	}
+
+	if err := database.DB.Delete(item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa mục kiểm tra"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Xóa mục kiểm tra thành công"})
+}
+
+// CheckTaskChecklistItem marks an item as done by the current user
+func CheckTaskChecklistItem(c *gin.Context) {
+	setChecklistItemChecked(c, true)
+}
+
+// UncheckTaskChecklistItem marks an item as not done
+func UncheckTaskChecklistItem(c *gin.Context) {
+	setChecklistItemChecked(c, false)
+}
+
+func setChecklistItemChecked(c *gin.Context, checked bool) {
+	task, ok := loadChecklistTask(c)
+	if !ok {
+		return
+	}
+	if task.Status == models.StatusCompleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không thể thay đổi danh sách kiểm tra của công việc đã hoàn thành"})
+		return
+	}
+	item, ok := loadChecklistItem(c, task.ID)
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	updates := map[string]interface{}{"is_checked": checked}
+	if checked {
+		updates["checked_by_id"] = userID.(uint)
+		updates["checked_at"] = time.Now()
+	} else {
+		updates["checked_by_id"] = nil
+		updates["checked_at"] = nil
+	}
+
+	if err := database.DB.Model(item).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật mục kiểm tra"})
+		return
+	}
+
+	database.DB.Preload("CheckedBy").First(item, item.ID)
+
+	c.JSON(http.StatusOK, item)
+}
+
+// ReorderTaskChecklist sets the order of the checklist; item_ids must list every item of the task
+func ReorderTaskChecklist(c *gin.Context) {
+	task, ok := loadChecklistTask(c)
+	if !ok {
+		return
+	}
+
+	var req ReorderChecklistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	var items []models.TaskChecklistItem
+	if err := database.DB.Where("task_id = ?", task.ID).Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách kiểm tra"})
+		return
+	}
+
+	ids := uniqueIDs(req.ItemIDs)
+	if len(ids) != len(items) || len(ids) != len(req.ItemIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Danh sách sắp xếp phải gồm đầy đủ các mục kiểm tra của công việc"})
+		return
+	}
+	belongs := make(map[uint]bool, len(items))
+	for _, item := range items {
+		belongs[item.ID] = true
+	}
+	for _, id := range ids {
+		if !belongs[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Danh sách sắp xếp phải gồm đầy đủ các mục kiểm tra của công việc"})
+			return
+		}
+	}
+
+	tx := database.DB.Begin()
+	for i, id := range ids {
+		if err := tx.Model(&models.TaskChecklistItem{}).Where("id = ?", id).Update("position", i+1).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể sắp xếp danh sách kiểm tra"})
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể sắp xếp danh sách kiểm tra"})
+		return
+	}
+
+	items, _ = getTaskChecklist(task.ID)
+	c.JSON(http.StatusOK, items)
+}
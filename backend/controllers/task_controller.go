@@ -13,10 +13,16 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 )
 
 // Helper function to create task status history
 func createTaskStatusHistory(taskID uint, oldStatus, newStatus string, changedByID uint, notes string) error {
+	return createTaskStatusHistoryTx(database.DB, taskID, oldStatus, newStatus, changedByID, notes)
+}
+
+// createTaskStatusHistoryTx records a status history entry using the given connection or transaction
+func createTaskStatusHistoryTx(db *gorm.DB, taskID uint, oldStatus, newStatus string, changedByID uint, notes string) error {
 	history := models.TaskStatusHistory{
 		TaskID:      taskID,
 		OldStatus:   oldStatus,
@@ -24,18 +30,53 @@ func createTaskStatusHistory(taskID uint, oldStatus, newStatus string, changedBy
 		ChangedByID: changedByID,
 		Notes:       notes,
 	}
-	return database.DB.Create(&history).Error
+	if err := db.Create(&history).Error; err != nil {
+		return err
+	}
+	if oldStatus == newStatus {
+		return nil
+	}
+	if err := syncTaskDocumentStatusTx(db, taskID, changedByID); err != nil {
+		return err
+	}
+	if oldStatus == "" {
+		return nil
+	}
+	return notifyTaskWatchersTx(db, taskID, changedByID, models.NotificationEventStatusChanged, func(task *models.Task) string {
+		return fmt.Sprintf("Công việc %s chuyển từ \"%s\" sang \"%s\"", taskLabel(task), oldStatus, newStatus)
+	})
+}
+
+// operationError is a rejected operation together with the HTTP status to report it with
+type operationError struct {
+	Status  int
+	Message string
+}
+
+func (e *operationError) Error() string {
+	return e.Message
+}
+
+// respondOperationError writes err to the response, hiding unexpected errors behind fallback
+func respondOperationError(c *gin.Context, err error, fallback string) {
+	if opErr, ok := err.(*operationError); ok {
+		c.JSON(opErr.Status, gin.H{"error": opErr.Message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
 }
 
 type CreateTaskRequest struct {
-	Description        string `json:"description" binding:"required"`
-	Deadline           string `json:"deadline"`
-	DeadlineType       string `json:"deadline_type"`
-	AssignedTo         uint   `json:"assigned_to" binding:"required"`
-	IncomingDocumentID *uint  `json:"incoming_document_id"`
-	TaskType           string `json:"task_type"`
-	ProcessingContent  string `json:"processing_content"`
-	ProcessingNotes    string `json:"processing_notes"`
+	Description        string            `json:"description"` // optional when created from a template
+	Deadline           string            `json:"deadline"`
+	DeadlineType       string            `json:"deadline_type"`
+	AssignedTo         uint              `json:"assigned_to"` // optional when the template has an assignee role
+	IncomingDocumentID *uint             `json:"incoming_document_id"`
+	TaskType           string            `json:"task_type"`
+	ProcessingContent  string            `json:"processing_content"`
+	ProcessingNotes    string            `json:"processing_notes"`
+	TemplateID         *uint             `json:"template_id"`
+	Placeholders       map[string]string `json:"placeholders"` // values for the template placeholders
 }
 
 type AssignTaskRequest struct {
@@ -51,6 +92,60 @@ func CreateTask(c *gin.Context) {
 
 	userID, _ := c.Get("user_id")
 
+	// Fill the request from the template; explicit values in the request take precedence
+	var template *models.TaskTemplate
+	var documentTypeID *uint
+	urgency := models.UrgencyNormal
+	if req.IncomingDocumentID != nil {
+		var document models.IncomingDocument
+		if err := database.DB.First(&document, *req.IncomingDocumentID).Error; err == nil {
+			if !requireIncomingDocumentAccess(c, &document) {
+				return
+			}
+			documentTypeID = &document.DocumentTypeID
+			urgency = document.Urgency
+		}
+	}
+	if req.TemplateID != nil {
+		var err error
+		template, err = loadTaskTemplate(database.DB, *req.TemplateID)
+		if err != nil || !template.IsActive {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Mẫu công việc không tồn tại hoặc đã ngừng sử dụng"})
+			return
+		}
+
+		description, notes, err := renderTaskTemplate(template, req.Placeholders)
+		if err != nil {
+			respondOperationError(c, err, "Không thể áp dụng mẫu công việc")
+			return
+		}
+		if req.Description == "" {
+			req.Description = description
+		}
+		if req.ProcessingNotes == "" {
+			req.ProcessingNotes = notes
+		}
+		if req.TaskType == "" {
+			req.TaskType = template.TaskType
+		}
+		if req.DeadlineType == "" && req.Deadline == "" {
+			req.DeadlineType = template.DeadlineType
+		}
+		if req.AssignedTo == 0 && template.AssigneeRole != "" {
+			assignee, err := defaultAssigneeForRole(template.AssigneeRole, documentTypeID)
+			if err != nil {
+				respondOperationError(c, err, "Không thể chọn người xử lý mặc định")
+				return
+			}
+			req.AssignedTo = assignee.ID
+		}
+	}
+
+	if req.Description == "" || req.AssignedTo == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+
 	// Set default values
 	taskType := req.TaskType
 	if taskType == "" {
@@ -76,7 +171,9 @@ func CreateTask(c *gin.Context) {
 		DeadlineType:       deadlineType,
 		ProcessingContent:  req.ProcessingContent,
 		ProcessingNotes:    req.ProcessingNotes,
+		TemplateID:         req.TemplateID,
 	}
+	task.MarkAssigned(userID.(uint))
 
 	// Parse deadline if provided
 	if req.Deadline != "" {
@@ -105,18 +202,62 @@ func CreateTask(c *gin.Context) {
 		}
 
 		task.Deadline = &deadline
+	} else if template != nil {
+		task.Deadline = template.DefaultDeadline(time.Now())
+	}
+	// Urgent documents come with a handling time of their own
+	if task.Deadline == nil {
+		task.Deadline = models.UrgencyDeadline(urgency, time.Now())
 	}
 
-	if err := database.DB.Create(&task).Error; err != nil {
+	tx := database.DB.Begin()
+	if err := tx.Create(&task).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo công việc"})
 		return
 	}
 
 	// Create initial status history
-	createTaskStatusHistory(task.ID, "", models.StatusNotStarted, userID.(uint), "Tạo công việc mới")
+	historyNotes := "Tạo công việc mới"
+	if template != nil {
+		historyNotes = "Tạo công việc mới từ mẫu " + template.Name
+	}
+	if err := createTaskStatusHistoryTx(tx, task.ID, "", models.StatusNotStarted, userID.(uint), historyNotes); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo công việc"})
+		return
+	}
+	if err := watchTaskChainTx(tx, &task); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo công việc"})
+		return
+	}
+	if err := clearTaskAssigneeTx(tx, &task, userID.(uint)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo công việc"})
+		return
+	}
+
+	if template != nil {
+		if err := createTemplateChecklistTx(tx, task.ID, template); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo danh sách kiểm tra từ mẫu"})
+			return
+		}
+		if err := createTemplateSubtasksTx(tx, &task, template, req.Placeholders, userID.(uint), documentTypeID); err != nil {
+			tx.Rollback()
+			respondOperationError(c, err, "Không thể tạo công việc con từ mẫu")
+			return
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo công việc"})
+		return
+	}
 
 	// Load relations
-	database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("IncomingFile.DocumentType").Preload("IncomingFile.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
+	preloadVisibleIncomingDocument(database.DB, userID.(uint)).Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("IncomingFile.DocumentType").Preload("IncomingFile.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
 
 	c.JSON(http.StatusCreated, task)
 }
@@ -129,19 +270,10 @@ func GetTasks(c *gin.Context) {
 	filterParams := services.ParseTaskFilterParams(c)
 
 	var tasks []models.Task
-	query := database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("IncomingFile.DocumentType").Preload("IncomingFile.IssuingUnit").Preload("Comments.User")
+	query := preloadVisibleIncomingDocument(database.DB, userID.(uint)).Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("IncomingFile.DocumentType").Preload("IncomingFile.IssuingUnit").Preload("Comments.User")
 
 	// Filter based on role
-	switch userRole.(string) {
-	case models.RoleSecretary, models.RoleAdmin:
-		// Can see all tasks
-	case models.RoleTeamLeader, models.RoleDeputy:
-		// Can see tasks assigned to them or created by them
-		query = query.Where("assigned_to_id = ? OR created_by_id = ?", userID, userID)
-	case models.RoleOfficer:
-		// Can only see tasks assigned to them
-		query = query.Where("assigned_to_id = ?", userID)
-	}
+	query = services.ScopeVisibleTasks(query, userID.(uint), userRole.(string))
 
 	// Apply advanced filters
 	query = services.ApplyTaskFilters(query, filterParams)
@@ -237,6 +369,11 @@ func ChooseReviewer(c *gin.Context) {
 		return
 	}
 
+	if err := checkRequiredChecklistItems(database.DB, task.ID); err != nil {
+		respondOperationError(c, err, "Không thể kiểm tra danh sách công việc")
+		return
+	}
+
 	// Verify the reviewer exists and has appropriate role
 	var reviewer models.User
 	if err := database.DB.First(&reviewer, req.ReviewerID).Error; err != nil {
@@ -264,6 +401,11 @@ func ChooseReviewer(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật trạng thái công việc"})
 		return
 	}
+	watchTaskChainTx(database.DB, &task)
+	if err := clearTaskAssigneeTx(database.DB, &task, userID.(uint)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cấp quyền truy cập văn bản cho người xem xét"})
+		return
+	}
 
 	// Create status history
 	notes := fmt.Sprintf("Cán bộ đã chọn %s để xem xét công việc", reviewer.Name)
@@ -281,7 +423,7 @@ func ChooseReviewer(c *gin.Context) {
 	createTaskStatusHistory(task.ID, oldStatus, task.Status, userID.(uint), notes)
 
 	// Load relations
-	database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
+	preloadVisibleIncomingDocument(database.DB, userID.(uint)).Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"task":     task,
@@ -359,7 +501,7 @@ func ReworkTask(c *gin.Context) {
 	createTaskStatusHistory(task.ID, oldStatus, task.Status, userID.(uint), notes)
 
 	// Load relations
-	database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
+	preloadVisibleIncomingDocument(database.DB, userID.(uint)).Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"task":    task,
@@ -424,6 +566,11 @@ func SubmitForReview(c *gin.Context) {
 		return
 	}
 
+	if err := checkRequiredChecklistItems(database.DB, task.ID); err != nil {
+		respondOperationError(c, err, "Không thể kiểm tra danh sách công việc")
+		return
+	}
+
 	// Find the Team Leader or Deputy who should review this task
 	// Look for the creator of the task or find a default reviewer
 	var reviewer models.User
@@ -467,6 +614,11 @@ func SubmitForReview(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật trạng thái công việc"})
 		return
 	}
+	watchTaskChainTx(database.DB, &task)
+	if err := clearTaskAssigneeTx(database.DB, &task, userID.(uint)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cấp quyền truy cập văn bản cho người xem xét"})
+		return
+	}
 
 	// Create status history
 	notes := fmt.Sprintf("Cán bộ %s đã nộp công việc để %s xem xét",
@@ -480,7 +632,7 @@ func SubmitForReview(c *gin.Context) {
 	createTaskStatusHistory(task.ID, oldStatus, task.Status, userID.(uint), notes)
 
 	// Load relations
-	database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
+	preloadVisibleIncomingDocument(database.DB, userID.(uint)).Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"task":     task,
@@ -497,7 +649,12 @@ func GetTask(c *gin.Context) {
 	}
 
 	var task models.Task
-	if err := database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("IncomingFile.DocumentType").Preload("IncomingFile.IssuingUnit").Preload("Comments.User").Preload("StatusHistory.ChangedBy").First(&task, id).Error; err != nil {
+	if !requireVisibleTask(c, &task, uint(id)) {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := preloadVisibleIncomingDocument(database.DB, userID.(uint)).Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("IncomingFile.DocumentType").Preload("IncomingFile.IssuingUnit").Preload("Comments.User").Preload("StatusHistory.ChangedBy").Preload("Template").Preload("Subtasks.AssignedTo").Preload("ChecklistItems", func(db *gorm.DB) *gorm.DB { return db.Order("position asc, id asc") }).Preload("ChecklistItems.CheckedBy").First(&task, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy công việc"})
 		return
 	}
@@ -526,6 +683,10 @@ func GetTask(c *gin.Context) {
 		taskWithTime.Creator = taskWithTime.CreatedBy
 	}
 
+	if !respondWithETag(c, task.Version) {
+		return
+	}
+
 	c.JSON(http.StatusOK, taskWithTime)
 }
 
@@ -550,28 +711,54 @@ func AssignTask(c *gin.Context) {
 		return
 	}
 
+	if err := assignTask(&task, req.AssignedTo, userID.(uint), ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể gán công việc"})
+		return
+	}
+
+	c.JSON(http.StatusOK, task)
+}
+
+// assignTask assigns the task to a user, starts it if it has not been started yet,
+// records the change in the status history and reloads the task with its relations
+func assignTask(task *models.Task, assigneeID, actorID uint, notes string) error {
+	if err := assignTaskTx(database.DB, task, assigneeID, actorID, notes); err != nil {
+		return err
+	}
+
+	// Load relations
+	return preloadVisibleIncomingDocument(database.DB, actorID).Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("IncomingFile.DocumentType").Preload("IncomingFile.IssuingUnit").Preload("StatusHistory.ChangedBy").First(task, task.ID).Error
+}
+
+// assignTaskTx performs the assignment of assignTask on db without reloading relations
+func assignTaskTx(db *gorm.DB, task *models.Task, assigneeID, actorID uint, notes string) error {
 	oldStatus := task.Status
 
 	// Update assignment and status
-	task.AssignedToID = &req.AssignedTo
+	task.AssignedToID = &assigneeID
+	task.MarkAssigned(actorID)
 	if task.Status == models.StatusNotStarted {
 		task.Status = models.StatusProcessing
 	}
 
-	if err := database.DB.Save(&task).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể gán công việc"})
-		return
+	if err := db.Save(task).Error; err != nil {
+		return err
 	}
-
-	// Create status history if status changed
-	if oldStatus != task.Status {
-		createTaskStatusHistory(task.ID, oldStatus, task.Status, userID.(uint), "Gán công việc và chuyển trạng thái")
+	if err := watchTaskChainTx(db, task); err != nil {
+		return err
+	}
+	if err := clearTaskAssigneeTx(db, task, actorID); err != nil {
+		return err
 	}
 
-	// Load relations
-	database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("IncomingFile.DocumentType").Preload("IncomingFile.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
-
-	c.JSON(http.StatusOK, task)
+	// Status history only records status changes; a reassignment alone is not one
+	if oldStatus == task.Status {
+		return nil
+	}
+	if notes == "" {
+		notes = "Gán công việc và chuyển trạng thái"
+	}
+	return createTaskStatusHistoryTx(db, task.ID, oldStatus, task.Status, actorID, notes)
 }
 
 // GetTaskWorkflow returns workflow information for a task
@@ -583,10 +770,10 @@ func GetTaskWorkflow(c *gin.Context) {
 	}
 
 	var task models.Task
-	if err := database.DB.Preload("AssignedTo").Preload("CreatedBy").First(&task, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy công việc"})
+	if !requireVisibleTask(c, &task, uint(id)) {
 		return
 	}
+	database.DB.Preload("AssignedTo").Preload("CreatedBy").First(&task, task.ID)
 
 	// Define workflow stages
 	stages := []map[string]interface{}{
@@ -698,13 +885,22 @@ func GetTaskWorkflow(c *gin.Context) {
 			}(),
 			"has_report":    task.ReportFile != "",
 			"total_stages":  len(stages),
-			"current_stage": getCurrentStageIndex(task.Status),
+			"current_stage": getCurrentStageIndex(workflowStatus(&task)),
 		},
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// workflowStatus is the status used to place the task in the workflow; a task on hold
+// stays at the stage it was paused in
+func workflowStatus(task *models.Task) string {
+	if task.Status == models.StatusOnHold && task.StatusBeforeHold != "" {
+		return task.StatusBeforeHold
+	}
+	return task.Status
+}
+
 func getCurrentStageIndex(status string) int {
 	switch status {
 	case models.StatusReceived:
@@ -741,36 +937,47 @@ func UpdateTaskStatus(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
 	var task models.Task
-	if err := database.DB.First(&task, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy công việc"})
+	if !requireVisibleTask(c, &task, uint(id)) {
 		return
 	}
 
+	if err := changeTaskStatusTx(database.DB, &task, req.Status, userID.(uint), req.Notes); err != nil {
+		respondOperationError(c, err, "Không thể cập nhật trạng thái")
+		return
+	}
+
+	// Load relations
+	preloadVisibleIncomingDocument(database.DB, userID.(uint)).Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
+
+	c.JSON(http.StatusOK, task)
+}
+
+// changeTaskStatusTx moves the task to a new status and records the change in the status history
+func changeTaskStatusTx(db *gorm.DB, task *models.Task, status string, actorID uint, notes string) error {
+	// Required checklist items gate both review and completion
+	if status != task.Status && (status == models.StatusReview || status == models.StatusCompleted) {
+		if err := checkRequiredChecklistItems(db, task.ID); err != nil {
+			return err
+		}
+	}
+
 	oldStatus := task.Status
-	task.Status = req.Status
+	task.Status = status
 
 	// Set completion date if task is completed
-	if req.Status == models.StatusCompleted && task.CompletionDate == nil {
+	if status == models.StatusCompleted && task.CompletionDate == nil {
 		now := time.Now()
 		task.CompletionDate = &now
 	}
 
-	if err := database.DB.Save(&task).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật trạng thái"})
-		return
+	if err := db.Save(task).Error; err != nil {
+		return err
 	}
 
-	// Create status history
-	notes := req.Notes
 	if notes == "" {
 		notes = "Cập nhật trạng thái công việc"
 	}
-	createTaskStatusHistory(task.ID, oldStatus, task.Status, userID.(uint), notes)
-
-	// Load relations
-	database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
-
-	c.JSON(http.StatusOK, task)
+	return createTaskStatusHistoryTx(db, task.ID, oldStatus, task.Status, actorID, notes)
 }
 
 type UpdateTaskRequest struct {
@@ -782,6 +989,7 @@ type UpdateTaskRequest struct {
 	TaskType           string `json:"task_type"`
 	ProcessingContent  string `json:"processing_content"`
 	ProcessingNotes    string `json:"processing_notes"`
+	Version            *uint  `json:"version"` // alternative to the If-Match header
 }
 
 func UpdateTask(c *gin.Context) {
@@ -797,6 +1005,12 @@ func UpdateTask(c *gin.Context) {
 		return
 	}
 
+	expected, err := expectedVersion(c, req.Version)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Phiên bản dữ liệu không hợp lệ"})
+		return
+	}
+
 	userID, _ := c.Get("user_id")
 	userRole, _ := c.Get("user_role")
 
@@ -855,8 +1069,16 @@ func UpdateTask(c *gin.Context) {
 	if req.DeadlineType != "" {
 		updates["deadline_type"] = req.DeadlineType
 	}
-	if req.AssignedTo > 0 {
+	if req.AssignedTo > 0 && (task.AssignedToID == nil || *task.AssignedToID != req.AssignedTo) {
+		reassigned := task
+		reassigned.AssignedToID = &req.AssignedTo
+		reassigned.MarkAssigned(userID.(uint))
 		updates["assigned_to_id"] = req.AssignedTo
+		updates["assigned_by_id"] = reassigned.AssignedByID
+		updates["assigned_at"] = reassigned.AssignedAt
+		updates["acceptance_status"] = reassigned.AcceptanceStatus
+		updates["accepted_at"] = reassigned.AcceptedAt
+		updates["decline_reason"] = reassigned.DeclineReason
 	}
 	if req.IncomingDocumentID != nil {
 		updates["incoming_document_id"] = req.IncomingDocumentID
@@ -871,17 +1093,43 @@ func UpdateTask(c *gin.Context) {
 		updates["processing_notes"] = req.ProcessingNotes
 	}
 
-	if err := database.DB.Model(&task).Updates(updates).Error; err != nil {
+	oldDeadline := task.Deadline
+	oldDocumentID := task.IncomingDocumentID
+	updated, err := updateIfVersion(database.DB, &task, expected, updates)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật công việc"})
 		return
 	}
 
 	// Create status history for update
-	createTaskStatusHistory(task.ID, task.Status, task.Status, userID.(uint), "Cập nhật thông tin công việc")
+	if updated {
+		createTaskStatusHistory(task.ID, task.Status, task.Status, userID.(uint), "Cập nhật thông tin công việc")
+		if _, reassigned := updates["assigned_to_id"]; reassigned {
+			watchTaskChainTx(database.DB, &task)
+		}
+		if err := clearTaskAssigneeTx(database.DB, &task, userID.(uint)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cấp quyền truy cập văn bản cho người được giao"})
+			return
+		}
+		if !sameDeadline(oldDeadline, task.Deadline) {
+			notifyTaskDeadlineChanged(database.DB, task.ID, userID.(uint), task.Deadline)
+		}
+		// Moving the task to another document changes what both documents wait on
+		if oldDocumentID != nil && (task.IncomingDocumentID == nil || *oldDocumentID != *task.IncomingDocumentID) {
+			syncIncomingDocumentStatusTx(database.DB, *oldDocumentID, userID.(uint))
+		}
+		syncTaskDocumentStatusTx(database.DB, task.ID, userID.(uint))
+	}
 
 	// Load relations
-	database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
+	preloadVisibleIncomingDocument(database.DB, userID.(uint)).Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
 
+	if !updated {
+		respondVersionConflict(c, task, task.Version)
+		return
+	}
+
+	c.Header("ETag", versionETag(task.Version))
 	c.JSON(http.StatusOK, task)
 }
 
@@ -901,39 +1149,64 @@ func DeleteTask(c *gin.Context) {
 		return
 	}
 
+	tx := database.DB.Begin()
+	if err := deleteTaskTx(tx, &task, userID.(uint), userRole.(string)); err != nil {
+		tx.Rollback()
+		respondOperationError(c, err, "Không thể xóa công việc")
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa công việc"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Xóa công việc thành công"})
+}
+
+// deleteTaskTx checks that the user may delete the task and deletes it with its comments
+func deleteTaskTx(db *gorm.DB, task *models.Task, userID uint, userRole string) error {
 	// Check permissions
-	if userRole.(string) == models.RoleSecretary {
+	if userRole == models.RoleSecretary {
 		// Secretary can delete any task
-	} else if userRole.(string) == models.RoleTeamLeader {
+	} else if userRole == models.RoleTeamLeader {
 		// Team leader can delete tasks they created
-		if task.CreatedByID != userID.(uint) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền xóa công việc này"})
-			return
+		if task.CreatedByID != userID {
+			return &operationError{http.StatusForbidden, "Không có quyền xóa công việc này"}
 		}
 	} else {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền xóa công việc"})
-		return
+		return &operationError{http.StatusForbidden, "Không có quyền xóa công việc"}
 	}
 
 	// Check if task can be deleted (only if not completed)
 	if task.Status == models.StatusCompleted {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Không thể xóa công việc đã hoàn thành"})
-		return
+		return &operationError{http.StatusBadRequest, "Không thể xóa công việc đã hoàn thành"}
 	}
 
-	// Delete related comments first
-	if err := database.DB.Where("task_id = ?", id).Delete(&models.Comment{}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa bình luận liên quan"})
-		return
+	// Delete related comments and checklist first
+	if err := db.Where("task_id = ?", task.ID).Delete(&models.Comment{}).Error; err != nil {
+		return &operationError{http.StatusInternalServerError, "Không thể xóa bình luận liên quan"}
+	}
+	if err := db.Where("task_id = ?", task.ID).Delete(&models.TaskChecklistItem{}).Error; err != nil {
+		return &operationError{http.StatusInternalServerError, "Không thể xóa danh sách kiểm tra liên quan"}
+	}
+	// The directive assignee stays, without the task made for them
+	if err := db.Model(&models.DirectiveAssignee{}).Where("task_id = ?", task.ID).Update("task_id", gorm.Expr("NULL")).Error; err != nil {
+		return err
+	}
+	if err := removeWatchersTx(db, models.WatchEntityTask, task.ID); err != nil {
+		return err
 	}
 
 	// Delete the task
-	if err := database.DB.Delete(&task).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa công việc"})
-		return
+	if err := db.Delete(task).Error; err != nil {
+		return err
 	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Xóa công việc thành công"})
+	if task.IncomingDocumentID != nil {
+		if _, err := syncIncomingDocumentStatusTx(db, *task.IncomingDocumentID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type ForwardTaskRequest struct {
@@ -949,6 +1222,7 @@ type DelegateTaskRequest struct {
 type UpdateProcessingContentRequest struct {
 	ProcessingContent string `json:"processing_content"`
 	ProcessingNotes   string `json:"processing_notes"`
+	Version           *uint  `json:"version"` // alternative to the If-Match header
 }
 
 type ChooseReviewerRequest struct {
@@ -981,44 +1255,64 @@ func ForwardTask(c *gin.Context) {
 		return
 	}
 
+	if err := forwardTaskTx(database.DB, &task, req.AssignedTo, userID.(uint), req.Comment); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể chuyển tiếp công việc"})
+		return
+	}
+
+	// Load relations
+	preloadVisibleIncomingDocument(database.DB, userID.(uint)).Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
+
+	c.JSON(http.StatusOK, task)
+}
+
+// forwardTaskTx hands the task over to another user, leaving a comment and a history entry
+func forwardTaskTx(db *gorm.DB, task *models.Task, assigneeID, actorID uint, comment string) error {
 	// Update assignment
 	oldAssignedTo := task.AssignedToID
-	task.AssignedToID = &req.AssignedTo
+	task.AssignedToID = &assigneeID
+	task.MarkAssigned(actorID)
 
-	if err := database.DB.Save(&task).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể chuyển tiếp công việc"})
-		return
+	if err := db.Save(task).Error; err != nil {
+		return err
+	}
+	if err := watchTaskChainTx(db, task); err != nil {
+		return err
+	}
+	if err := clearTaskAssigneeTx(db, task, actorID); err != nil {
+		return err
 	}
 
 	// Add comment about forwarding
 	var oldAssignedUser, newAssignedUser models.User
-	database.DB.First(&oldAssignedUser, oldAssignedTo)
-	database.DB.First(&newAssignedUser, req.AssignedTo)
+	if oldAssignedTo != nil {
+		db.First(&oldAssignedUser, *oldAssignedTo)
+	}
+	db.First(&newAssignedUser, assigneeID)
 
 	forwardComment := models.Comment{
-		TaskID:  uint(id),
-		UserID:  userID.(uint),
+		TaskID:  task.ID,
+		UserID:  actorID,
 		Content: "Đã chuyển tiếp công việc từ " + oldAssignedUser.Name + " đến " + newAssignedUser.Name,
+		Kind:    models.CommentKindSystem,
 	}
 
-	if req.Comment != "" {
-		forwardComment.Content += ". Ghi chú: " + req.Comment
+	if comment != "" {
+		forwardComment.Content += ". Ghi chú: " + comment
 	}
 
-	database.DB.Create(&forwardComment)
+	if err := db.Create(&forwardComment).Error; err != nil {
+		return err
+	}
 
 	// Create status history for forwarding
 	notes := fmt.Sprintf("Chuyển tiếp công việc từ %s đến %s", oldAssignedUser.Name, newAssignedUser.Name)
-	if req.Comment != "" {
-		notes += ". Ghi chú: " + req.Comment
+	if comment != "" {
+		notes += ". Ghi chú: " + comment
 	}
-	createTaskStatusHistory(task.ID, task.Status, task.Status, userID.(uint), notes)
-
-	// Load relations
-	database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
-
-	c.JSON(http.StatusOK, task)
+	return createTaskStatusHistoryTx(db, task.ID, task.Status, task.Status, actorID, notes)
 }
+
 func DelegateTask(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -1078,11 +1372,17 @@ func DelegateTask(c *gin.Context) {
 
 	oldAssignedToID := task.AssignedToID
 	task.AssignedToID = &req.AssignedTo
+	task.MarkAssigned(userID.(uint))
 
 	if err := database.DB.Save(&task).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể ủy quyền công việc"})
 		return
 	}
+	watchTaskChainTx(database.DB, &task)
+	if err := clearTaskAssigneeTx(database.DB, &task, userID.(uint)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cấp quyền truy cập văn bản cho người được ủy quyền"})
+		return
+	}
 
 	// Create status history for delegation
 	var oldAssignedUser models.User
@@ -1098,7 +1398,7 @@ func DelegateTask(c *gin.Context) {
 	createTaskStatusHistory(task.ID, task.Status, task.Status, userID.(uint), notes)
 
 	// Load relations
-	database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
+	preloadVisibleIncomingDocument(database.DB, userID.(uint)).Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
 
 	c.JSON(http.StatusOK, task)
 }
@@ -1116,6 +1416,12 @@ func UpdateProcessingContent(c *gin.Context) {
 		return
 	}
 
+	expected, err := expectedVersion(c, req.Version)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Phiên bản dữ liệu không hợp lệ"})
+		return
+	}
+
 	userID, _ := c.Get("user_id")
 
 	var task models.Task
@@ -1131,20 +1437,29 @@ func UpdateProcessingContent(c *gin.Context) {
 	}
 
 	// Update processing content
-	task.ProcessingContent = req.ProcessingContent
-	task.ProcessingNotes = req.ProcessingNotes
-
-	if err := database.DB.Save(&task).Error; err != nil {
+	updated, err := updateIfVersion(database.DB, &task, expected, map[string]interface{}{
+		"processing_content": req.ProcessingContent,
+		"processing_notes":   req.ProcessingNotes,
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật nội dung xử lý"})
 		return
 	}
 
 	// Create status history for content update
-	createTaskStatusHistory(task.ID, task.Status, task.Status, userID.(uint), "Cập nhật nội dung xử lý công việc")
+	if updated {
+		createTaskStatusHistory(task.ID, task.Status, task.Status, userID.(uint), "Cập nhật nội dung xử lý công việc")
+	}
 
 	// Load relations
-	database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("Creator").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
+	preloadVisibleIncomingDocument(database.DB, userID.(uint)).Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("Creator").Preload("IncomingDocument.DocumentType").Preload("IncomingDocument.IssuingUnit").Preload("StatusHistory.ChangedBy").First(&task, task.ID)
 
+	if !updated {
+		respondVersionConflict(c, task, task.Version)
+		return
+	}
+
+	c.Header("ETag", versionETag(task.Version))
 	c.JSON(http.StatusOK, task)
 }
 
@@ -1207,6 +1522,9 @@ func DownloadTaskIncomingDocument(c *gin.Context) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền truy cập văn bản này"})
 		return
 	}
+	if !requireIncomingDocumentAccess(c, task.IncomingDocument) {
+		return
+	}
 
 	// Look for file in the files table using a more reliable approach
 	var file struct {
@@ -1358,7 +1676,9 @@ func GetTaskDocuments(c *gin.Context) {
 	// Extract outgoing documents from relationships
 	var outgoingDocs []models.OutgoingDocument
 	for _, relationship := range taskOutgoingDocs {
-		outgoingDocs = append(outgoingDocs, relationship.OutgoingDocument)
+		if services.CanAccessOutgoingDocument(database.DB, &relationship.OutgoingDocument, userID.(uint)) {
+			outgoingDocs = append(outgoingDocs, relationship.OutgoingDocument)
+		}
 	}
 
 	// Prepare response
@@ -1368,7 +1688,7 @@ func GetTaskDocuments(c *gin.Context) {
 		"outgoing_documents": outgoingDocs,
 	}
 
-	if task.IncomingDocument != nil {
+	if task.IncomingDocument != nil && services.CanAccessIncomingDocument(database.DB, task.IncomingDocument, userID.(uint)) {
 		response["incoming_document"] = task.IncomingDocument
 	}
 
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HoldTaskRequest struct {
+	Reason           string `json:"reason" binding:"required"`
+	ExpectedResumeAt string `json:"expected_resume_at" binding:"required"` // YYYY-MM-DD
+}
+
+type ResumeTaskRequest struct {
+	Notes string `json:"notes"`
+}
+
+// loadHoldTask loads the task from the route and checks the user may pause or resume it:
+// its assignee, its creator, or a leader or admin
+func loadHoldTask(c *gin.Context) (*models.Task, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return nil, false
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	var task models.Task
+	if !requireVisibleTask(c, &task, uint(id)) {
+		return nil, false
+	}
+
+	switch userRole.(string) {
+	case models.RoleAdmin, models.RoleTeamLeader, models.RoleDeputy:
+	default:
+		isAssignee := task.AssignedToID != nil && *task.AssignedToID == userID.(uint)
+		if !isAssignee && task.CreatedByID != userID.(uint) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền tạm dừng hoặc tiếp tục công việc này"})
+			return nil, false
+		}
+	}
+
+	return &task, true
+}
+
+// HoldTask puts a task on hold while it waits on an external party, pausing its deadline clock
+func HoldTask(c *gin.Context) {
+	task, ok := loadHoldTask(c)
+	if !ok {
+		return
+	}
+
+	var req HoldTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vui lòng nhập lý do và ngày dự kiến tiếp tục"})
+		return
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Vui lòng nhập lý do tạm dừng"})
+		return
+	}
+
+	expectedResumeAt, err := time.ParseInLocation("2006-01-02", req.ExpectedResumeAt, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Định dạng ngày dự kiến tiếp tục không hợp lệ"})
+		return
+	}
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if expectedResumeAt.Before(today) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ngày dự kiến tiếp tục không được ở quá khứ"})
+		return
+	}
+
+	if !task.CanBePutOnHold() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không thể tạm dừng công việc ở trạng thái hiện tại"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	oldStatus := task.Status
+	task.StatusBeforeHold = task.Status
+	task.Status = models.StatusOnHold
+	task.HoldReason = reason
+	task.HoldStartedAt = &now
+	task.ExpectedResumeAt = &expectedResumeAt
+
+	if err := database.DB.Save(task).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạm dừng công việc"})
+		return
+	}
+
+	notes := fmt.Sprintf("Tạm dừng công việc: %s. Dự kiến tiếp tục ngày %s", reason, expectedResumeAt.Format("02/01/2006"))
+	createTaskStatusHistory(task.ID, oldStatus, task.Status, userID.(uint), notes)
+
+	database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("StatusHistory.ChangedBy").First(task, task.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"task":           task,
+		"remaining_time": task.GetRemainingTime(),
+	})
+}
+
+// ResumeTask takes a task off hold, restoring its previous status and pushing the
+// deadline back by the time it spent on hold
+func ResumeTask(c *gin.Context) {
+	task, ok := loadHoldTask(c)
+	if !ok {
+		return
+	}
+
+	var req ResumeTaskRequest
+	c.ShouldBindJSON(&req)
+
+	if task.Status != models.StatusOnHold || task.HoldStartedAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Công việc không ở trạng thái tạm dừng"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	heldFor := time.Since(*task.HoldStartedAt)
+	if task.Deadline != nil {
+		shifted := task.Deadline.Add(heldFor)
+		task.Deadline = &shifted
+	}
+
+	resumeStatus := task.StatusBeforeHold
+	if !models.IsValidTaskStatus(resumeStatus) || resumeStatus == models.StatusOnHold {
+		resumeStatus = models.StatusProcessing
+	}
+
+	task.Status = resumeStatus
+	task.HeldSeconds += int64(heldFor.Seconds())
+	task.HoldReason = ""
+	task.HoldStartedAt = nil
+	task.ExpectedResumeAt = nil
+	task.StatusBeforeHold = ""
+
+	if err := database.DB.Save(task).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tiếp tục công việc"})
+		return
+	}
+
+	notes := fmt.Sprintf("Tiếp tục công việc sau %s tạm dừng", formatHeldDuration(heldFor))
+	if task.Deadline != nil {
+		notes += ", hạn xử lý dời đến " + task.Deadline.Format("15:04 02/01/2006")
+	}
+	if req.Notes != "" {
+		notes += ". Ghi chú: " + req.Notes
+	}
+	createTaskStatusHistory(task.ID, models.StatusOnHold, task.Status, userID.(uint), notes)
+	if task.Deadline != nil {
+		notifyTaskDeadlineChanged(database.DB, task.ID, userID.(uint), task.Deadline)
+	}
+
+	database.DB.Preload("AssignedTo").Preload("AssignedUser").Preload("CreatedBy").Preload("StatusHistory.ChangedBy").First(task, task.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"task":           task,
+		"remaining_time": task.GetRemainingTime(),
+	})
+}
+
+// formatHeldDuration renders a hold duration in days and hours for history notes
+func formatHeldDuration(d time.Duration) string {
+	days := int(d.Hours() / 24)
+	hours := int(d.Hours()) % 24
+	if days > 0 {
+		return fmt.Sprintf("%d ngày %d giờ", days, hours)
+	}
+	if hours > 0 {
+		return fmt.Sprintf("%d giờ", hours)
+	}
+	return fmt.Sprintf("%d phút", int(d.Minutes()))
+}
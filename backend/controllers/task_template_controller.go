@@ -0,0 +1,404 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type TaskTemplateChecklistItemRequest struct {
+	Title      string `json:"title" binding:"required"`
+	IsRequired bool   `json:"is_required"`
+}
+
+type TaskTemplateSubtaskRequest struct {
+	Description        string `json:"description" binding:"required"`
+	DeadlineOffsetDays int    `json:"deadline_offset_days"`
+	AssigneeRole       string `json:"assignee_role"`
+}
+
+type TaskTemplateRequest struct {
+	Name               string                             `json:"name" binding:"required"`
+	Description        string                             `json:"description" binding:"required"`
+	ProcessingNotes    string                             `json:"processing_notes"`
+	TaskType           string                             `json:"task_type"`
+	DeadlineType       string                             `json:"deadline_type"`
+	DeadlineOffsetDays int                                `json:"deadline_offset_days"`
+	AssigneeRole       string                             `json:"assignee_role"`
+	IsActive           *bool                              `json:"is_active"`
+	ChecklistItems     []TaskTemplateChecklistItemRequest `json:"checklist_items"`
+	Subtasks           []TaskTemplateSubtaskRequest       `json:"subtasks"`
+}
+
+// validateTaskTemplateRequest checks the enumerated fields of a template request
+func validateTaskTemplateRequest(req *TaskTemplateRequest) string {
+	switch req.TaskType {
+	case "", models.TaskTypeDocumentLinked, models.TaskTypeIndependent:
+	default:
+		return "Loại công việc không hợp lệ"
+	}
+
+	switch req.DeadlineType {
+	case "", models.DeadlineTypeSpecific, models.DeadlineTypeMonthly, models.DeadlineTypeQuarterly, models.DeadlineTypeYearly:
+	default:
+		return "Loại thời hạn không hợp lệ"
+	}
+
+	if req.DeadlineOffsetDays < 0 {
+		return "Số ngày thời hạn không được âm"
+	}
+
+	if !isTemplateAssigneeRole(req.AssigneeRole) {
+		return "Vai trò người xử lý không hợp lệ"
+	}
+	for _, subtask := range req.Subtasks {
+		if subtask.DeadlineOffsetDays < 0 {
+			return "Số ngày thời hạn không được âm"
+		}
+		if !isTemplateAssigneeRole(subtask.AssigneeRole) {
+			return "Vai trò người xử lý không hợp lệ"
+		}
+	}
+
+	return ""
+}
+
+// isTemplateAssigneeRole reports whether tasks may be assigned by default to the role
+func isTemplateAssigneeRole(role string) bool {
+	switch role {
+	case "", models.RoleTeamLeader, models.RoleDeputy, models.RoleOfficer:
+		return true
+	}
+	return false
+}
+
+// applyTaskTemplateRequest copies the request onto the template, replacing its checklist and subtasks
+func applyTaskTemplateRequest(template *models.TaskTemplate, req *TaskTemplateRequest) {
+	template.Name = strings.TrimSpace(req.Name)
+	template.Description = req.Description
+	template.ProcessingNotes = req.ProcessingNotes
+	template.TaskType = req.TaskType
+	template.DeadlineType = req.DeadlineType
+	if template.DeadlineType == "" {
+		template.DeadlineType = models.DeadlineTypeSpecific
+	}
+	template.DeadlineOffsetDays = req.DeadlineOffsetDays
+	template.AssigneeRole = req.AssigneeRole
+	if req.IsActive != nil {
+		template.IsActive = *req.IsActive
+	}
+
+	template.ChecklistItems = make([]models.TaskTemplateChecklistItem, 0, len(req.ChecklistItems))
+	for i, item := range req.ChecklistItems {
+		template.ChecklistItems = append(template.ChecklistItems, models.TaskTemplateChecklistItem{
+			Title:      item.Title,
+			IsRequired: item.IsRequired,
+			Position:   i + 1,
+		})
+	}
+
+	template.Subtasks = make([]models.TaskTemplateSubtask, 0, len(req.Subtasks))
+	for i, subtask := range req.Subtasks {
+		template.Subtasks = append(template.Subtasks, models.TaskTemplateSubtask{
+			Description:        subtask.Description,
+			DeadlineOffsetDays: subtask.DeadlineOffsetDays,
+			AssigneeRole:       subtask.AssigneeRole,
+			Position:           i + 1,
+		})
+	}
+}
+
+// loadTaskTemplate loads a template with its checklist and subtasks in order
+func loadTaskTemplate(db *gorm.DB, id uint) (*models.TaskTemplate, error) {
+	var template models.TaskTemplate
+	err := db.Preload("CreatedBy").
+		Preload("ChecklistItems", func(db *gorm.DB) *gorm.DB { return db.Order("position asc") }).
+		Preload("Subtasks", func(db *gorm.DB) *gorm.DB { return db.Order("position asc") }).
+		First(&template, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// GetTaskTemplates lists task templates; inactive ones are included with include_inactive=true
+func GetTaskTemplates(c *gin.Context) {
+	query := database.DB.Preload("CreatedBy").
+		Preload("ChecklistItems", func(db *gorm.DB) *gorm.DB { return db.Order("position asc") }).
+		Preload("Subtasks", func(db *gorm.DB) *gorm.DB { return db.Order("position asc") })
+
+	if c.Query("include_inactive") != "true" {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var templates []models.TaskTemplate
+	if err := query.Order("name asc").Find(&templates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách mẫu công việc"})
+		return
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+// GetTaskTemplate returns a template together with the placeholders it expects
+func GetTaskTemplate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	template, err := loadTaskTemplate(database.DB, uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy mẫu công việc"})
+		return
+	}
+
+	texts := []string{template.Description, template.ProcessingNotes}
+	for _, subtask := range template.Subtasks {
+		texts = append(texts, subtask.Description)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"template":     template,
+		"placeholders": models.TemplatePlaceholders(texts...),
+	})
+}
+
+// CreateTaskTemplate creates a template with its checklist and subtask structure
+func CreateTaskTemplate(c *gin.Context) {
+	var req TaskTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+	if msg := validateTaskTemplateRequest(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	template := models.TaskTemplate{IsActive: true, CreatedByID: userID.(uint)}
+	applyTaskTemplateRequest(&template, &req)
+
+	if err := database.DB.Create(&template).Error; err != nil {
+		if database.IsUniqueConstraintError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Tên mẫu công việc đã tồn tại"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo mẫu công việc"})
+		return
+	}
+
+	created, _ := loadTaskTemplate(database.DB, template.ID)
+	c.JSON(http.StatusCreated, created)
+}
+
+// UpdateTaskTemplate replaces a template's fields, checklist and subtasks
+func UpdateTaskTemplate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	var req TaskTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+	if msg := validateTaskTemplateRequest(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var template models.TaskTemplate
+	if err := database.DB.First(&template, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy mẫu công việc"})
+		return
+	}
+
+	applyTaskTemplateRequest(&template, &req)
+
+	tx := database.DB.Begin()
+	// Checklist and subtasks are replaced as a whole; tasks already created keep their copies
+	if err := tx.Where("template_id = ?", template.ID).Delete(&models.TaskTemplateChecklistItem{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật mẫu công việc"})
+		return
+	}
+	if err := tx.Where("template_id = ?", template.ID).Delete(&models.TaskTemplateSubtask{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật mẫu công việc"})
+		return
+	}
+	if err := tx.Save(&template).Error; err != nil {
+		tx.Rollback()
+		if database.IsUniqueConstraintError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Tên mẫu công việc đã tồn tại"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật mẫu công việc"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật mẫu công việc"})
+		return
+	}
+
+	updated, _ := loadTaskTemplate(database.DB, template.ID)
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteTaskTemplate deletes a template; tasks created from it keep their reference for reporting
+func DeleteTaskTemplate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	var template models.TaskTemplate
+	if err := database.DB.First(&template, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy mẫu công việc"})
+		return
+	}
+
+	if err := database.DB.Delete(&template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa mẫu công việc"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Xóa mẫu công việc thành công"})
+}
+
+// GetTaskTemplateUsage reports how tasks created from each template are progressing
+func GetTaskTemplateUsage(c *gin.Context) {
+	type templateUsage struct {
+		TemplateID     uint   `json:"template_id"`
+		Name           string `json:"name"`
+		TotalTasks     int    `json:"total_tasks"`
+		CompletedTasks int    `json:"completed_tasks"`
+		OverdueTasks   int    `json:"overdue_tasks"`
+	}
+
+	overdueCondition, overdueArgs := models.OverdueTaskCondition(time.Now())
+	selectArgs := append([]interface{}{models.StatusCompleted}, overdueArgs...)
+
+	var usage []templateUsage
+	err := database.DB.Table("tasks").
+		Select("task_templates.id AS template_id, task_templates.name, COUNT(tasks.id) AS total_tasks, "+
+			"SUM(CASE WHEN tasks.status = ? THEN 1 ELSE 0 END) AS completed_tasks, "+
+			"SUM(CASE WHEN "+overdueCondition+" THEN 1 ELSE 0 END) AS overdue_tasks",
+			selectArgs...).
+		Joins("JOIN task_templates ON task_templates.id = tasks.template_id").
+		Where("tasks.deleted_at IS NULL AND tasks.parent_task_id IS NULL").
+		Group("task_templates.id, task_templates.name").
+		Order("total_tasks desc").
+		Scan(&usage).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể thống kê mẫu công việc"})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// defaultAssigneeForRole picks the least loaded active user of the role who is not absent
+func defaultAssigneeForRole(role string, documentTypeID *uint) (*models.User, error) {
+	var candidates []models.User
+	if err := database.DB.Where("role = ? AND is_active = ?", role, true).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	recommendations, err := rankAssignees(candidates, documentTypeID)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range recommendations {
+		if !rec.IsAbsent {
+			user := rec.User
+			return &user, nil
+		}
+	}
+
+	return nil, &operationError{http.StatusConflict, fmt.Sprintf("Không có %s nào sẵn sàng nhận công việc", role)}
+}
+
+// renderTaskTemplate fills in the template texts, reporting every placeholder without a value
+func renderTaskTemplate(template *models.TaskTemplate, values map[string]string) (description, notes string, err error) {
+	description, missingDescription := models.RenderTemplateText(template.Description, values)
+	notes, missingNotes := models.RenderTemplateText(template.ProcessingNotes, values)
+
+	missing := append(missingDescription, missingNotes...)
+	for _, subtask := range template.Subtasks {
+		_, missingSubtask := models.RenderTemplateText(subtask.Description, values)
+		missing = append(missing, missingSubtask...)
+	}
+	if len(missing) > 0 {
+		seen := make(map[string]bool)
+		var names []string
+		for _, name := range missing {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return "", "", &operationError{http.StatusBadRequest, "Thiếu giá trị cho: " + strings.Join(names, ", ")}
+	}
+
+	return description, notes, nil
+}
+
+// createTemplateSubtasksTx creates the subtasks of a template under the given parent task
+func createTemplateSubtasksTx(db *gorm.DB, parent *models.Task, template *models.TaskTemplate, values map[string]string, actorID uint, documentTypeID *uint) error {
+	for _, subtaskTemplate := range template.Subtasks {
+		description, _ := models.RenderTemplateText(subtaskTemplate.Description, values)
+
+		assigneeID := parent.AssignedToID
+		if subtaskTemplate.AssigneeRole != "" {
+			assignee, err := defaultAssigneeForRole(subtaskTemplate.AssigneeRole, documentTypeID)
+			if err != nil {
+				return err
+			}
+			assigneeID = &assignee.ID
+		}
+
+		subtask := models.Task{
+			Description:        description,
+			Status:             models.StatusNotStarted,
+			AssignedToID:       assigneeID,
+			CreatedByID:        actorID,
+			IncomingDocumentID: parent.IncomingDocumentID,
+			TaskType:           parent.TaskType,
+			DeadlineType:       models.DeadlineTypeSpecific,
+			Deadline:           subtaskTemplate.DefaultDeadline(time.Now(), parent.Deadline),
+			TemplateID:         parent.TemplateID,
+			ParentTaskID:       &parent.ID,
+		}
+		subtask.MarkAssigned(actorID)
+		if err := db.Create(&subtask).Error; err != nil {
+			return err
+		}
+		if err := createTaskStatusHistoryTx(db, subtask.ID, "", models.StatusNotStarted, actorID, "Tạo công việc con từ mẫu "+template.Name); err != nil {
+			return err
+		}
+		if err := watchTaskChainTx(db, &subtask); err != nil {
+			return err
+		}
+		if err := clearTaskAssigneeTx(db, &subtask, actorID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
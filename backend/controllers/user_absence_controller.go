@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateUserAbsenceRequest struct {
+	StartDate string `json:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" binding:"required"`
+	Reason    string `json:"reason"`
+}
+
+// GetUserAbsences returns the absence periods recorded for a user
+func GetUserAbsences(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	var absences []models.UserAbsence
+	if err := database.DB.Preload("CreatedBy").Where("user_id = ?", id).Order("start_date desc").Find(&absences).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách vắng mặt"})
+		return
+	}
+
+	c.JSON(http.StatusOK, absences)
+}
+
+// CreateUserAbsence records a new absence period for a user
+func CreateUserAbsence(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	var req CreateUserAbsenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	var user models.User
+	if err := database.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy người dùng"})
+		return
+	}
+
+	startDate, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Định dạng ngày bắt đầu không hợp lệ"})
+		return
+	}
+	endDate, err := time.Parse("2006-01-02", req.EndDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Định dạng ngày kết thúc không hợp lệ"})
+		return
+	}
+	if endDate.Before(startDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ngày kết thúc phải sau ngày bắt đầu"})
+		return
+	}
+
+	absence := models.UserAbsence{
+		UserID:    user.ID,
+		StartDate: startDate,
+		// The end date is inclusive: the user is away for the whole day
+		EndDate:     endDate.Add(24*time.Hour - time.Second),
+		Reason:      req.Reason,
+		CreatedByID: userID.(uint),
+	}
+
+	if err := database.DB.Create(&absence).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể ghi nhận vắng mặt"})
+		return
+	}
+
+	database.DB.Preload("User").Preload("CreatedBy").First(&absence, absence.ID)
+
+	c.JSON(http.StatusCreated, absence)
+}
+
+// DeleteUserAbsence removes a recorded absence period of the user in the route
+func DeleteUserAbsence(c *gin.Context) {
+	absenceID, err := strconv.Atoi(c.Param("absenceId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	var absence models.UserAbsence
+	if err := database.DB.Where("user_id = ?", c.Param("id")).First(&absence, absenceID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy thông tin vắng mặt"})
+		return
+	}
+
+	if err := database.DB.Delete(&absence).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa thông tin vắng mặt"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Xóa thông tin vắng mặt thành công"})
+}
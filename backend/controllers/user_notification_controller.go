@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserNotifications returns the current user's notifications, newest first.
+// Pass unread_only=true to leave out the ones already read.
+func GetUserNotifications(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := database.DB.Model(&models.UserNotification{}).Where("user_id = ?", userID)
+	if c.Query("unread_only") == "true" {
+		query = query.Where("is_read = ?", false)
+	}
+
+	var total int
+	query.Count(&total)
+
+	var notifications []models.UserNotification
+	if err := query.Preload("Actor").Order("created_at desc").
+		Offset((page - 1) * limit).Limit(limit).Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách thông báo"})
+		return
+	}
+
+	var unread int
+	database.DB.Model(&models.UserNotification{}).Where("user_id = ? AND is_read = ?", userID, false).Count(&unread)
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"unread_count":  unread,
+		"pagination": gin.H{
+			"current_page":   page,
+			"total_pages":    (total + limit - 1) / limit,
+			"total_items":    total,
+			"items_per_page": limit,
+		},
+	})
+}
+
+// MarkUserNotificationRead marks one of the current user's notifications as read
+func MarkUserNotificationRead(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	var notification models.UserNotification
+	if err := database.DB.Where("user_id = ?", userID).First(&notification, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy thông báo"})
+		return
+	}
+
+	if !notification.IsRead {
+		if err := database.DB.Model(&notification).Updates(map[string]interface{}{"is_read": true, "read_at": time.Now()}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật thông báo"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, notification)
+}
+
+// MarkAllUserNotificationsRead marks every unread notification of the current user as read
+func MarkAllUserNotificationsRead(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	result := database.DB.Model(&models.UserNotification{}).Where("user_id = ? AND is_read = ?", userID, false).
+		Updates(map[string]interface{}{"is_read": true, "read_at": time.Now()})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật thông báo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Đã đánh dấu tất cả thông báo là đã đọc", "updated": result.RowsAffected})
+}
@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"ai-code-agent-backend/services"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// addWatcherTx subscribes the user to the item, leaving an existing subscription untouched
+func addWatcherTx(db *gorm.DB, userID uint, entityType string, entityID uint, autoAdded bool) error {
+	return db.Exec(`INSERT INTO watchers (user_id, entity_type, entity_id, auto_added, created_at)
+		VALUES (?, ?, ?, ?, ?) ON CONFLICT (user_id, entity_type, entity_id) DO NOTHING`,
+		userID, entityType, entityID, autoAdded, time.Now()).Error
+}
+
+// watchTaskChainTx subscribes the creator, the assigner and the current assignee of the task.
+// It is called whenever the task changes hands, so everyone it passed through keeps following it.
+func watchTaskChainTx(db *gorm.DB, task *models.Task) error {
+	userIDs := []uint{task.CreatedByID}
+	if task.AssignedByID != nil {
+		userIDs = append(userIDs, *task.AssignedByID)
+	}
+	if task.AssignedToID != nil {
+		userIDs = append(userIDs, *task.AssignedToID)
+	}
+	for _, userID := range uniqueIDs(userIDs) {
+		if err := addWatcherTx(db, userID, models.WatchEntityTask, task.ID, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchIncomingDocumentTx subscribes the creator and the processor of the document
+func watchIncomingDocumentTx(db *gorm.DB, document *models.IncomingDocument) error {
+	userIDs := []uint{document.CreatedByID}
+	if document.ProcessorID != nil {
+		userIDs = append(userIDs, *document.ProcessorID)
+	}
+	for _, userID := range uniqueIDs(userIDs) {
+		if err := addWatcherTx(db, userID, models.WatchEntityIncomingDocument, document.ID, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeWatchersTx drops all subscriptions to an item that is being deleted
+func removeWatchersTx(db *gorm.DB, entityType string, entityID uint) error {
+	return db.Where("entity_type = ? AND entity_id = ?", entityType, entityID).Delete(&models.Watcher{}).Error
+}
+
+// notifyUsersTx stores a notification for each user except the one who made the change
+func notifyUsersTx(db *gorm.DB, userIDs []uint, entityType string, entityID, actorID uint, event, message string) error {
+	for _, userID := range uniqueIDs(userIDs) {
+		if userID == actorID {
+			continue
+		}
+		notification := models.UserNotification{
+			UserID:     userID,
+			EntityType: entityType,
+			EntityID:   entityID,
+			Event:      event,
+			Message:    message,
+			ActorID:    &actorID,
+		}
+		if err := db.Create(&notification).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watcherIDsTx returns the users watching the item
+func watcherIDsTx(db *gorm.DB, entityType string, entityID uint) ([]uint, error) {
+	var userIDs []uint
+	err := db.Model(&models.Watcher{}).Where("entity_type = ? AND entity_id = ?", entityType, entityID).Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// notifyTaskWatchersTx notifies the watchers of a task. Watchers of its incoming document are
+// notified as well, since following a document means following the work done on it.
+func notifyTaskWatchersTx(db *gorm.DB, taskID, actorID uint, event string, buildMessage func(task *models.Task) string) error {
+	var task models.Task
+	if err := db.Select("id, description, incoming_document_id").First(&task, taskID).Error; err != nil {
+		return err
+	}
+
+	userIDs, err := watcherIDsTx(db, models.WatchEntityTask, task.ID)
+	if err != nil {
+		return err
+	}
+	if task.IncomingDocumentID != nil {
+		documentWatchers, err := watcherIDsTx(db, models.WatchEntityIncomingDocument, *task.IncomingDocumentID)
+		if err != nil {
+			return err
+		}
+		userIDs = append(userIDs, documentWatchers...)
+	}
+
+	return notifyUsersTx(db, userIDs, models.WatchEntityTask, task.ID, actorID, event, buildMessage(&task))
+}
+
+// notifyIncomingDocumentWatchersTx notifies the watchers of an incoming document
+func notifyIncomingDocumentWatchersTx(db *gorm.DB, document *models.IncomingDocument, actorID uint, event, message string) error {
+	userIDs, err := watcherIDsTx(db, models.WatchEntityIncomingDocument, document.ID)
+	if err != nil {
+		return err
+	}
+	return notifyUsersTx(db, userIDs, models.WatchEntityIncomingDocument, document.ID, actorID, event, message)
+}
+
+// notifyIncomingDocumentStatusChangedTx tells the watchers of a document that its status changed
+func notifyIncomingDocumentStatusChangedTx(db *gorm.DB, document *models.IncomingDocument, oldStatus string, actorID uint) error {
+	if oldStatus == document.Status {
+		return nil
+	}
+	message := fmt.Sprintf("Văn bản đến số %d chuyển từ \"%s\" sang \"%s\"", document.ArrivalNumber, oldStatus, document.Status)
+	return notifyIncomingDocumentWatchersTx(db, document, actorID, models.NotificationEventStatusChanged, message)
+}
+
+// taskLabel names a task in notification messages
+func taskLabel(task *models.Task) string {
+	description := []rune(task.Description)
+	if len(description) > 80 {
+		return fmt.Sprintf("\"%s...\"", string(description[:80]))
+	}
+	return fmt.Sprintf("\"%s\"", string(description))
+}
+
+// notifyTaskDeadlineChanged tells the watchers of a task that its deadline moved
+func notifyTaskDeadlineChanged(db *gorm.DB, taskID, actorID uint, deadline *time.Time) error {
+	return notifyTaskWatchersTx(db, taskID, actorID, models.NotificationEventDeadlineChanged, func(task *models.Task) string {
+		if deadline == nil {
+			return fmt.Sprintf("Công việc %s đã bỏ hạn xử lý", taskLabel(task))
+		}
+		return fmt.Sprintf("Hạn xử lý công việc %s đổi thành %s", taskLabel(task), deadline.Format("15:04 02/01/2006"))
+	})
+}
+
+// sameDeadline reports whether two optional deadlines are equal
+func sameDeadline(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
+
+// canWatch checks that the user may follow the item. Watching a task adds it to the user's task
+// list, so a task may only be watched where requireVisibleTask would show it: within the user's view
+// of tasks, and with an incoming document they are cleared for. Officers only see documents they
+// have tasks on, so they may only watch those.
+func canWatch(userID uint, userRole, entityType string, entityID uint) (bool, error) {
+	switch entityType {
+	case models.WatchEntityTask:
+		var task models.Task
+		if err := database.DB.First(&task, entityID).Error; err != nil {
+			return false, err
+		}
+		var visible int
+		services.ScopeVisibleTasks(database.DB.Model(&models.Task{}), userID, userRole).Where("tasks.id = ?", task.ID).Count(&visible)
+		if visible == 0 {
+			return false, nil
+		}
+		if task.IncomingDocumentID == nil {
+			return true, nil
+		}
+		var document models.IncomingDocument
+		if err := database.DB.First(&document, *task.IncomingDocumentID).Error; err != nil {
+			return true, nil
+		}
+		return services.CanAccessIncomingDocument(database.DB, &document, userID), nil
+	case models.WatchEntityIncomingDocument:
+		var document models.IncomingDocument
+		if err := database.DB.First(&document, entityID).Error; err != nil {
+			return false, err
+		}
+		if !services.CanAccessIncomingDocument(database.DB, &document, userID) {
+			return false, nil
+		}
+		if userRole != models.RoleOfficer {
+			return true, nil
+		}
+		var count int
+		database.DB.Model(&models.Task{}).Where("incoming_document_id = ? AND assigned_to_id = ?", entityID, userID).Count(&count)
+		return count > 0, nil
+	}
+	return false, nil
+}
+
+func setWatching(c *gin.Context, entityType string, watching bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userRole, _ := c.Get("user_role")
+
+	notFound := "Không tìm thấy công việc"
+	if entityType == models.WatchEntityIncomingDocument {
+		notFound = "Không tìm thấy văn bản đến"
+	}
+
+	allowed, err := canWatch(userID.(uint), userRole.(string), entityType, uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return
+	}
+
+	if !watching {
+		if err := database.DB.Where("user_id = ? AND entity_type = ? AND entity_id = ?", userID, entityType, id).Delete(&models.Watcher{}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể bỏ theo dõi"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Đã bỏ theo dõi", "watching": false})
+		return
+	}
+
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Không có quyền theo dõi mục này"})
+		return
+	}
+
+	if err := addWatcherTx(database.DB, userID.(uint), entityType, uint(id), false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể theo dõi"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Đã theo dõi", "watching": true})
+}
+
+// WatchTask subscribes the current user to changes of a task
+func WatchTask(c *gin.Context) {
+	setWatching(c, models.WatchEntityTask, true)
+}
+
+// UnwatchTask stops notifications about a task for the current user
+func UnwatchTask(c *gin.Context) {
+	setWatching(c, models.WatchEntityTask, false)
+}
+
+// WatchIncomingDocument subscribes the current user to changes of an incoming document
+func WatchIncomingDocument(c *gin.Context) {
+	setWatching(c, models.WatchEntityIncomingDocument, true)
+}
+
+// UnwatchIncomingDocument stops notifications about an incoming document for the current user
+func UnwatchIncomingDocument(c *gin.Context) {
+	setWatching(c, models.WatchEntityIncomingDocument, false)
+}
+
+// GetTaskWatchers lists the users watching a task
+func GetTaskWatchers(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID không hợp lệ"})
+		return
+	}
+
+	var task models.Task
+	if !requireVisibleTask(c, &task, uint(id)) {
+		return
+	}
+
+	var watchers []models.Watcher
+	if err := database.DB.Preload("User").Where("entity_type = ? AND entity_id = ?", models.WatchEntityTask, id).
+		Order("created_at asc").Find(&watchers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách người theo dõi"})
+		return
+	}
+
+	c.JSON(http.StatusOK, watchers)
+}
+
+// GetWatching returns the tasks and incoming documents the current user watches
+func GetWatching(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var tasks []models.Task
+	if err := preloadVisibleIncomingDocument(database.DB, userID.(uint)).Preload("AssignedTo").Preload("CreatedBy").
+		Where("tasks.id IN (SELECT entity_id FROM watchers WHERE user_id = ? AND entity_type = ?)", userID, models.WatchEntityTask).
+		Order("updated_at desc").Find(&tasks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách đang theo dõi"})
+		return
+	}
+
+	var documents []models.IncomingDocument
+	if err := services.ScopeVisibleIncomingDocuments(database.DB, userID.(uint)).
+		Preload("DocumentType").Preload("IssuingUnit").Preload("Processor").
+		Where("incoming_documents.id IN (SELECT entity_id FROM watchers WHERE user_id = ? AND entity_type = ?)", userID, models.WatchEntityIncomingDocument).
+		Order("updated_at desc").Find(&documents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lấy danh sách đang theo dõi"})
+		return
+	}
+
+	type WatchedTask struct {
+		models.Task
+		RemainingTime models.RemainingTimeInfo `json:"remaining_time"`
+	}
+	watchedTasks := make([]WatchedTask, 0, len(tasks))
+	for _, task := range tasks {
+		watchedTasks = append(watchedTasks, WatchedTask{Task: task, RemainingTime: task.GetRemainingTime()})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tasks":              watchedTasks,
+		"incoming_documents": documents,
+	})
+}
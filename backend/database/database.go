@@ -90,6 +90,8 @@ func InitDatabase() {
 	DB.DB().SetMaxIdleConns(10)
 	DB.DB().SetMaxOpenConns(100)
 
+	models.RegisterVersioning(DB)
+
 	// Auto migrate tables
 	DB.AutoMigrate(&models.User{})
 	DB.AutoMigrate(&models.DocumentType{})
@@ -102,7 +104,27 @@ func InitDatabase() {
 	DB.AutoMigrate(&models.TaskStatusHistory{})
 	DB.AutoMigrate(&models.TaskOutgoingDocument{})
 	DB.AutoMigrate(&models.Comment{})
+	DB.AutoMigrate(&models.CommentRevision{})
+	DB.AutoMigrate(&models.CommentMention{})
 	DB.AutoMigrate(&models.AuditLog{})
+	DB.AutoMigrate(&models.UserAbsence{})
+	DB.AutoMigrate(&models.TaskTemplate{})
+	DB.AutoMigrate(&models.TaskTemplateChecklistItem{})
+	DB.AutoMigrate(&models.TaskTemplateSubtask{})
+	DB.AutoMigrate(&models.TaskChecklistItem{})
+	DB.AutoMigrate(&models.Watcher{})
+	DB.AutoMigrate(&models.UserNotification{})
+	DB.AutoMigrate(&models.DocumentDirective{})
+	DB.AutoMigrate(&models.DirectiveAssignee{})
+	DB.AutoMigrate(&models.DocumentDirectiveRevision{})
+	DB.AutoMigrate(&models.DocumentSequence{})
+	DB.AutoMigrate(&models.DocumentAccessGrant{})
+	DB.AutoMigrate(&models.FileText{})
+	DB.AutoMigrate(&models.FileSignature{})
+	DB.AutoMigrate(&models.DocumentRelation{})
+	DB.AutoMigrate(&models.OutgoingDocumentRecipient{})
+	DB.AutoMigrate(&models.OutgoingApprovalStep{})
+	DB.AutoMigrate(&models.OutgoingApprovalHistory{})
 	DB.AutoMigrate(&models.IncomingFile{}) // Temporary for backward compatibility
 
 	log.Println("Đã kết nối thành công đến PostgreSQL database")
@@ -144,6 +166,14 @@ func runMigrations() {
 	migrations := []string{
 		"001_enhance_schema.sql",
 		"002_create_task_outgoing_document_table.sql",
+		"003_mark_system_comments.sql",
+		"004_yearly_arrival_numbers.sql",
+		"005_outgoing_document_numbers.sql",
+		"006_incoming_document_drafts.sql",
+		"007_incoming_document_email_source.sql",
+		"008_full_text_search.sql",
+		"009_outgoing_approval_history.sql",
+		"010_task_template_names.sql",
 	}
 
 	for _, migrationFile := range migrations {
@@ -353,13 +383,13 @@ func seedConfigurationData() {
 
 	if docTypeCount == 0 {
 		defaultDocumentTypes := []models.DocumentType{
-			{Name: "Thông báo", Description: "Văn bản thông báo chính thức", IsActive: true},
-			{Name: "Công văn", Description: "Công văn hành chính", IsActive: true},
-			{Name: "Quyết định", Description: "Quyết định hành chính", IsActive: true},
-			{Name: "Chỉ thị", Description: "Chỉ thị từ cấp trên", IsActive: true},
-			{Name: "Báo cáo", Description: "Báo cáo công tác", IsActive: true},
-			{Name: "Tờ trình", Description: "Tờ trình đề xuất", IsActive: true},
-			{Name: "Biên bản", Description: "Biên bản họp, kiểm tra", IsActive: true},
+			{Name: "Thông báo", Description: "Văn bản thông báo chính thức", Code: "TB", NumberTemplate: "{seq}/{type_code}-{unit_code}", IsActive: true},
+			{Name: "Công văn", Description: "Công văn hành chính", NumberTemplate: "{seq}/{unit_code}", IsActive: true},
+			{Name: "Quyết định", Description: "Quyết định hành chính", Code: "QĐ", NumberTemplate: "{seq}/{type_code}-{unit_code}", IsActive: true},
+			{Name: "Chỉ thị", Description: "Chỉ thị từ cấp trên", Code: "CT", NumberTemplate: "{seq}/{type_code}-{unit_code}", IsActive: true},
+			{Name: "Báo cáo", Description: "Báo cáo công tác", Code: "BC", NumberTemplate: "{seq}/{type_code}-{unit_code}", IsActive: true},
+			{Name: "Tờ trình", Description: "Tờ trình đề xuất", Code: "TTr", NumberTemplate: "{seq}/{type_code}-{unit_code}", IsActive: true},
+			{Name: "Biên bản", Description: "Biên bản họp, kiểm tra", Code: "BB", NumberTemplate: "{seq}/{type_code}-{unit_code}", IsActive: true},
 		}
 
 		for _, docType := range defaultDocumentTypes {
@@ -374,14 +404,14 @@ func seedConfigurationData() {
 
 	if issuingUnitCount == 0 {
 		defaultIssuingUnits := []models.IssuingUnit{
-			{Name: "UBND Tỉnh", Description: "Ủy ban nhân dân tỉnh", IsActive: true},
-			{Name: "UBND Huyện", Description: "Ủy ban nhân dân huyện", IsActive: true},
-			{Name: "UBND Xã", Description: "Ủy ban nhân dân xã", IsActive: true},
-			{Name: "Công An Tỉnh", Description: "Công an tỉnh", IsActive: true},
-			{Name: "Công An Huyện", Description: "Công an huyện", IsActive: true},
-			{Name: "Công An Xã", Description: "Công an xã", IsActive: true},
-			{Name: "Sở Nội Vụ", Description: "Sở Nội vụ", IsActive: true},
-			{Name: "Văn phòng UBND", Description: "Văn phòng UBND các cấp", IsActive: true},
+			{Name: "UBND Tỉnh", Description: "Ủy ban nhân dân tỉnh", Code: "UBND", IsActive: true},
+			{Name: "UBND Huyện", Description: "Ủy ban nhân dân huyện", Code: "UBND", IsActive: true},
+			{Name: "UBND Xã", Description: "Ủy ban nhân dân xã", Code: "UBND", IsActive: true},
+			{Name: "Công An Tỉnh", Description: "Công an tỉnh", Code: "CAT", IsActive: true},
+			{Name: "Công An Huyện", Description: "Công an huyện", Code: "CAH", IsActive: true},
+			{Name: "Công An Xã", Description: "Công an xã", Code: "CAX", IsActive: true},
+			{Name: "Sở Nội Vụ", Description: "Sở Nội vụ", Code: "SNV", IsActive: true},
+			{Name: "Văn phòng UBND", Description: "Văn phòng UBND các cấp", Code: "VP", IsActive: true},
 		}
 
 		for _, unit := range defaultIssuingUnits {
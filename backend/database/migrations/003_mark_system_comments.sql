@@ -0,0 +1,4 @@
+-- Forwarding messages were stored as ordinary comments before comments had a kind.
+-- Mark them as system comments so they are no longer editable and can be filtered out.
+UPDATE comments SET kind = 'system'
+WHERE kind = 'user' AND content LIKE 'Đã chuyển tiếp công việc từ %';
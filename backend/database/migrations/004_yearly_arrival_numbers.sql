@@ -0,0 +1,11 @@
+-- Arrival numbers restart every year and can be kept in separate register books,
+-- so they are unique per year and book instead of globally.
+ALTER TABLE incoming_documents DROP CONSTRAINT IF EXISTS incoming_documents_arrival_number_key;
+
+UPDATE incoming_documents
+SET arrival_year = EXTRACT(YEAR FROM arrival_date)
+WHERE arrival_year IS NULL OR arrival_year = 0;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_incoming_documents_arrival_register
+ON incoming_documents (arrival_year, register_book, arrival_number)
+WHERE deleted_at IS NULL;
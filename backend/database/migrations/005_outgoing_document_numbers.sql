@@ -0,0 +1,37 @@
+-- Outgoing numbers are kept in one register per document type and year.
+UPDATE outgoing_documents
+SET number_year = EXTRACT(YEAR FROM issue_date)
+WHERE number_year IS NULL OR number_year = 0;
+
+UPDATE outgoing_documents SET sequence_number = 0 WHERE sequence_number IS NULL;
+
+-- Numbers typed by hand before the register existed may repeat within a year and type. The
+-- first document keeps the number; later ones get the document ID appended, with the original
+-- number kept in their internal notes, so the unique index below can be created.
+DO $$
+DECLARE
+    repeated RECORD;
+BEGIN
+    FOR repeated IN
+        SELECT id, document_number, first_id FROM (
+            SELECT id, document_number,
+                   MIN(id) OVER (PARTITION BY number_year, document_type_id, document_number) AS first_id
+            FROM outgoing_documents
+            WHERE document_number <> '' AND deleted_at IS NULL
+        ) numbered
+        WHERE id <> first_id
+    LOOP
+        RAISE WARNING 'Outgoing document % repeats number % of document %, renumbered',
+            repeated.id, repeated.document_number, repeated.first_id;
+        UPDATE outgoing_documents
+        SET document_number = document_number || ' (trùng #' || id || ')',
+            internal_notes = CONCAT_WS(E'\n\n', NULLIF(internal_notes, ''),
+                'Số văn bản ' || document_number || ' trùng với văn bản đi #' || repeated.first_id ||
+                ', đã đổi khi lập sổ số văn bản đi')
+        WHERE id = repeated.id;
+    END LOOP;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outgoing_documents_number_register
+ON outgoing_documents (number_year, document_type_id, document_number)
+WHERE document_number <> '' AND deleted_at IS NULL;
@@ -0,0 +1,14 @@
+-- Drafts from the scan inbox only get an arrival number when the secretary registers them,
+-- so documents without a number are left out of the register's uniqueness.
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_indexes
+        WHERE indexname = 'idx_incoming_documents_arrival_register' AND indexdef LIKE '%arrival_number > 0%'
+    ) THEN
+        DROP INDEX IF EXISTS idx_incoming_documents_arrival_register;
+        CREATE UNIQUE INDEX idx_incoming_documents_arrival_register
+        ON incoming_documents (arrival_year, register_book, arrival_number)
+        WHERE deleted_at IS NULL AND arrival_number > 0;
+    END IF;
+END $$;
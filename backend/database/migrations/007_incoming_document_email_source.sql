@@ -0,0 +1,4 @@
+-- An email is imported once: its Message-ID stays taken even after the draft is discarded.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_incoming_documents_source_email
+ON incoming_documents (source_email_id)
+WHERE source_email_id <> '';
@@ -0,0 +1,38 @@
+-- Full-text search that ignores Vietnamese diacritics: "cong van" finds "công văn".
+-- unaccent is a trusted extension, so the database owner may create it.
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'vietnamese_unaccent') THEN
+        CREATE TEXT SEARCH CONFIGURATION vietnamese_unaccent (COPY = simple);
+        ALTER TEXT SEARCH CONFIGURATION vietnamese_unaccent
+            ALTER MAPPING FOR asciiword, asciihword, hword_asciipart, word, hword, hword_part,
+                numword, numhword, hword_numpart, email, url, host, url_path, file
+            WITH unaccent, simple;
+    END IF;
+END $$;
+
+-- Weighted search vector of up to three fields, most important first. Queries must call it with
+-- the same arguments as the indexes below for the indexes to be used.
+CREATE OR REPLACE FUNCTION search_vector(a text, b text, c text) RETURNS tsvector
+LANGUAGE sql IMMUTABLE PARALLEL SAFE AS $$
+    SELECT setweight(to_tsvector('vietnamese_unaccent', coalesce(a, '')), 'A')
+        || setweight(to_tsvector('vietnamese_unaccent', coalesce(b, '')), 'B')
+        || setweight(to_tsvector('vietnamese_unaccent', coalesce(c, '')), 'C')
+$$;
+
+CREATE INDEX IF NOT EXISTS idx_incoming_documents_search ON incoming_documents
+USING GIN (search_vector(original_number, summary, internal_notes));
+
+CREATE INDEX IF NOT EXISTS idx_outgoing_documents_search ON outgoing_documents
+USING GIN (search_vector(document_number, summary, internal_notes));
+
+CREATE INDEX IF NOT EXISTS idx_tasks_search ON tasks
+USING GIN (search_vector(description, processing_content, processing_notes));
+
+CREATE INDEX IF NOT EXISTS idx_comments_search ON comments
+USING GIN (search_vector(content, '', ''));
+
+CREATE INDEX IF NOT EXISTS idx_file_texts_search ON file_texts
+USING GIN (search_vector(content, '', ''));
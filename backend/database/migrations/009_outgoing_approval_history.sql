@@ -0,0 +1,12 @@
+-- The approval history of outgoing documents is a record of who decided what; it is never
+-- edited or deleted, not even by the application.
+CREATE OR REPLACE FUNCTION refuse_approval_history_change() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+    RAISE EXCEPTION 'outgoing_approval_histories is append-only';
+END $$;
+
+DROP TRIGGER IF EXISTS outgoing_approval_histories_append_only ON outgoing_approval_histories;
+CREATE TRIGGER outgoing_approval_histories_append_only
+BEFORE UPDATE OR DELETE ON outgoing_approval_histories
+FOR EACH ROW EXECUTE FUNCTION refuse_approval_history_change();
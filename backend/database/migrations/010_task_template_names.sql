@@ -0,0 +1,7 @@
+-- Template names are unique among templates that are not deleted, so the name of a deleted
+-- template can be used again.
+ALTER TABLE task_templates DROP CONSTRAINT IF EXISTS task_templates_name_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_task_templates_name
+ON task_templates (name)
+WHERE deleted_at IS NULL;
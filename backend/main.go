@@ -5,6 +5,7 @@ import (
 	"ai-code-agent-backend/database"
 	"ai-code-agent-backend/middleware"
 	"ai-code-agent-backend/models"
+	"ai-code-agent-backend/services"
 	"log"
 
 	"github.com/gin-gonic/gin"
@@ -15,6 +16,18 @@ func main() {
 	database.InitDatabase()
 	defer database.DB.Close()
 
+	// Read the text of uploaded files for search
+	services.StartTextExtraction()
+
+	// Take in documents dropped by the scanner, when an inbox folder is configured
+	if inbox := services.ScanInboxFromEnv(); inbox != nil {
+		inbox.Start()
+	}
+	// and the mail sent to the office mailbox, when IMAP is configured
+	if mailbox := services.MailboxIntakeFromEnv(); mailbox != nil {
+		mailbox.Start()
+	}
+
 	// Create Gin router
 	r := gin.Default()
 
@@ -54,6 +67,9 @@ func main() {
 		api.DELETE("/users/:id", middleware.RequireRole(models.RoleAdmin), controllers.DeleteUser)
 		api.POST("/users/:id/toggle-status", middleware.RequireRole(models.RoleAdmin), controllers.ToggleUserStatus)
 		api.GET("/users/stats", middleware.RequireRole(models.RoleAdmin), controllers.GetUserStats)
+		api.GET("/users/:id/absences", middleware.RequireRole(models.RoleAdmin, models.RoleTeamLeader, models.RoleDeputy), controllers.GetUserAbsences)
+		api.POST("/users/:id/absences", middleware.RequireRole(models.RoleAdmin, models.RoleTeamLeader, models.RoleDeputy), controllers.CreateUserAbsence)
+		api.DELETE("/users/:id/absences/:absenceId", middleware.RequireRole(models.RoleAdmin, models.RoleTeamLeader, models.RoleDeputy), controllers.DeleteUserAbsence)
 
 		// Task routes
 		api.POST("/tasks", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader), controllers.CreateTask)
@@ -61,6 +77,8 @@ func main() {
 		api.GET("/tasks/:id", controllers.GetTask)
 		api.GET("/tasks/:id/workflow", controllers.GetTaskWorkflow)
 		api.PUT("/tasks/:id/assign", middleware.RequireRole(models.RoleTeamLeader, models.RoleDeputy), controllers.AssignTask)
+		api.GET("/tasks/:id/assignee-recommendations", middleware.RequireRole(models.RoleTeamLeader, models.RoleDeputy), controllers.GetAssigneeRecommendations)
+		api.POST("/tasks/:id/auto-assign", middleware.RequireRole(models.RoleTeamLeader, models.RoleDeputy), controllers.AutoAssignTask)
 		api.PUT("/tasks/:id/status", controllers.UpdateTaskStatus)
 		api.PUT("/tasks/:id", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader), controllers.UpdateTask)
 		api.DELETE("/tasks/:id", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader), controllers.DeleteTask)
@@ -70,10 +88,38 @@ func main() {
 		api.POST("/tasks/:id/choose-reviewer", controllers.ChooseReviewer)
 		api.POST("/tasks/:id/rework", controllers.ReworkTask)
 		api.GET("/tasks/reviewers/available", controllers.GetAvailableReviewers)
+		api.GET("/task-templates", controllers.GetTaskTemplates)
+		api.GET("/task-templates/usage", middleware.RequireRole(models.RoleAdmin, models.RoleTeamLeader, models.RoleDeputy), controllers.GetTaskTemplateUsage)
+		api.GET("/task-templates/:id", controllers.GetTaskTemplate)
+		api.POST("/task-templates", middleware.RequireRole(models.RoleAdmin, models.RoleTeamLeader, models.RoleDeputy), controllers.CreateTaskTemplate)
+		api.PUT("/task-templates/:id", middleware.RequireRole(models.RoleAdmin, models.RoleTeamLeader, models.RoleDeputy), controllers.UpdateTaskTemplate)
+		api.DELETE("/task-templates/:id", middleware.RequireRole(models.RoleAdmin, models.RoleTeamLeader, models.RoleDeputy), controllers.DeleteTaskTemplate)
+		api.POST("/tasks/bulk/assign", middleware.RequireRole(models.RoleTeamLeader, models.RoleDeputy), controllers.BulkAssignTasks)
+		api.POST("/tasks/bulk/forward", middleware.RequireRole(models.RoleTeamLeader, models.RoleDeputy), controllers.BulkForwardTasks)
+		api.POST("/tasks/bulk/status", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader, models.RoleDeputy, models.RoleAdmin), controllers.BulkUpdateTaskStatus)
+		api.POST("/tasks/bulk/delete", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader), controllers.BulkDeleteTasks)
 		api.PUT("/tasks/:id/processing", controllers.UpdateProcessingContent)
 		api.GET("/tasks/:id/history", controllers.GetTaskStatusHistory)
+		api.POST("/tasks/:id/hold", controllers.HoldTask)
+		api.POST("/tasks/:id/accept", controllers.AcceptTask)
+		api.POST("/tasks/:id/decline", controllers.DeclineTask)
+		api.POST("/tasks/:id/resume", controllers.ResumeTask)
+		api.POST("/tasks/:id/watch", controllers.WatchTask)
+		api.DELETE("/tasks/:id/watch", controllers.UnwatchTask)
+		api.GET("/tasks/:id/watchers", controllers.GetTaskWatchers)
+		api.GET("/tasks/:id/checklist", controllers.GetTaskChecklist)
+		api.POST("/tasks/:id/checklist", controllers.CreateTaskChecklistItem)
+		api.PUT("/tasks/:id/checklist/reorder", controllers.ReorderTaskChecklist)
+		api.PUT("/tasks/:id/checklist/:itemId", controllers.UpdateTaskChecklistItem)
+		api.DELETE("/tasks/:id/checklist/:itemId", controllers.DeleteTaskChecklistItem)
+		api.POST("/tasks/:id/checklist/:itemId/check", controllers.CheckTaskChecklistItem)
+		api.POST("/tasks/:id/checklist/:itemId/uncheck", controllers.UncheckTaskChecklistItem)
 		api.POST("/tasks/:id/comments", controllers.CreateComment)
 		api.GET("/tasks/:id/comments", controllers.GetTaskComments)
+		api.PUT("/comments/:id", controllers.UpdateComment)
+		api.DELETE("/comments/:id", controllers.DeleteComment)
+		api.GET("/comments/:id/revisions", controllers.GetCommentRevisions)
+		api.POST("/comments/:id/attachments", controllers.UploadCommentAttachment)
 		api.GET("/tasks/:id/documents", controllers.GetTaskDocuments)
 		api.GET("/tasks/:id/download/incoming", controllers.DownloadTaskIncomingDocument)
 		api.GET("/tasks/:id/download/outgoing", controllers.DownloadTaskOutgoingDocument)
@@ -97,6 +143,12 @@ func main() {
 		api.GET("/admin/files/stats", middleware.RequireRole(models.RoleAdmin), controllers.GetFileStats)
 		api.PUT("/admin/files/access", middleware.RequireRole(models.RoleAdmin), controllers.UpdateFileAccess)
 		api.DELETE("/admin/files/bulk-delete", middleware.RequireRole(models.RoleAdmin), controllers.BulkDeleteFiles)
+		api.POST("/admin/files/verify-signatures", middleware.RequireRole(models.RoleAdmin), controllers.ReverifyAllFileSignatures)
+		api.POST("/admin/files/:id/verify-signatures", middleware.RequireRole(models.RoleAdmin), controllers.VerifyFileSignatures)
+		api.GET("/admin/document-sequences", middleware.RequireRole(models.RoleAdmin), controllers.GetDocumentSequences)
+		api.PUT("/admin/document-sequences/:id", middleware.RequireRole(models.RoleAdmin), controllers.AdjustDocumentSequence)
+		api.PUT("/admin/incoming-documents/:id/arrival-number", middleware.RequireRole(models.RoleAdmin), controllers.CorrectArrivalNumber)
+		api.POST("/admin/incoming-documents/recompute-status", middleware.RequireRole(models.RoleAdmin), controllers.RecomputeIncomingDocumentStatuses)
 
 		// Legacy file routes (for backward compatibility)
 		api.POST("/files/incoming", middleware.RequireRole(models.RoleSecretary), controllers.UploadIncomingFile)
@@ -137,6 +189,12 @@ func main() {
 		api.DELETE("/receiving-units/:id", middleware.RequireRole(models.RoleAdmin), controllers.DeleteReceivingUnit)
 		api.POST("/receiving-units/:id/toggle-status", middleware.RequireRole(models.RoleAdmin), controllers.ToggleReceivingUnitStatus)
 
+		// Watch list and personal notification routes
+		api.GET("/watching", controllers.GetWatching)
+		api.GET("/user-notifications", controllers.GetUserNotifications)
+		api.PUT("/user-notifications/read-all", controllers.MarkAllUserNotificationsRead)
+		api.PUT("/user-notifications/:id/read", controllers.MarkUserNotificationRead)
+
 		// System Notification routes
 		notificationController := controllers.NewSystemNotificationController()
 		api.GET("/notifications", notificationController.GetNotifications)
@@ -151,11 +209,28 @@ func main() {
 		api.GET("/incoming-documents", controllers.GetIncomingDocuments)
 		api.GET("/incoming-documents/:id", controllers.GetIncomingDocument)
 		api.POST("/incoming-documents", middleware.RequireRole(models.RoleSecretary, models.RoleAdmin), controllers.CreateIncomingDocument)
+		api.POST("/incoming-documents/check-duplicates", middleware.RequireRole(models.RoleSecretary, models.RoleAdmin), controllers.CheckIncomingDocumentDuplicates)
 		api.PUT("/incoming-documents/:id", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader, models.RoleDeputy, models.RoleAdmin), controllers.UpdateIncomingDocument)
 		api.DELETE("/incoming-documents/:id", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader, models.RoleAdmin), controllers.DeleteIncomingDocument)
 		api.POST("/incoming-documents/:id/assign", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader, models.RoleDeputy, models.RoleAdmin), controllers.AssignProcessor)
 		api.POST("/incoming-documents/:id/upload", middleware.RequireRole(models.RoleSecretary, models.RoleAdmin), controllers.UploadIncomingDocumentFile)
+		api.GET("/incoming-documents/:id/directive", controllers.GetDocumentDirective)
+		api.PUT("/incoming-documents/:id/directive", middleware.RequireRole(models.RoleTeamLeader, models.RoleDeputy), controllers.SaveDocumentDirective)
+		api.GET("/incoming-documents/:id/directive/history", controllers.GetDocumentDirectiveHistory)
+		api.POST("/incoming-documents/:id/directive/tasks", middleware.RequireRole(models.RoleTeamLeader, models.RoleDeputy), controllers.CreateTasksFromDirective)
+		api.POST("/incoming-documents/:id/watch", controllers.WatchIncomingDocument)
+		api.DELETE("/incoming-documents/:id/watch", controllers.UnwatchIncomingDocument)
+		api.GET("/incoming-documents/:id/access", controllers.GetIncomingDocumentAccess)
+		api.POST("/incoming-documents/:id/access", controllers.GrantIncomingDocumentAccess)
+		api.DELETE("/incoming-documents/:id/access/:userId", controllers.RevokeIncomingDocumentAccess)
+		api.GET("/incoming-documents/:id/relations", controllers.GetIncomingDocumentRelations)
+		api.POST("/incoming-documents/:id/relations", controllers.CreateIncomingDocumentRelation)
+		api.GET("/incoming-documents/response-times", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader, models.RoleDeputy, models.RoleAdmin), controllers.GetResponseTimes)
 		api.GET("/incoming-documents/processors", controllers.GetProcessors)
+		api.POST("/incoming-documents/bulk/assign", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader, models.RoleDeputy, models.RoleAdmin), controllers.BulkAssignProcessor)
+		api.POST("/incoming-documents/import", middleware.RequireRole(models.RoleSecretary, models.RoleAdmin), controllers.ImportIncomingDocuments)
+		api.POST("/incoming-documents/import-email", middleware.RequireRole(models.RoleSecretary, models.RoleAdmin), controllers.ImportIncomingEmail)
+		api.POST("/incoming-documents/bulk/delete", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader, models.RoleAdmin), controllers.BulkDeleteIncomingDocuments)
 
 		// Outgoing Document routes
 		api.GET("/outgoing-documents", controllers.GetOutgoingDocuments)
@@ -163,10 +238,32 @@ func main() {
 		api.POST("/outgoing-documents", middleware.RequireRole(models.RoleSecretary, models.RoleAdmin), controllers.CreateOutgoingDocument)
 		api.PUT("/outgoing-documents/:id", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader, models.RoleDeputy, models.RoleOfficer, models.RoleAdmin), controllers.UpdateOutgoingDocument)
 		api.DELETE("/outgoing-documents/:id", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader, models.RoleAdmin), controllers.DeleteOutgoingDocument)
-		api.POST("/outgoing-documents/:id/approval", middleware.RequireRole(models.RoleTeamLeader, models.RoleDeputy, models.RoleSecretary, models.RoleAdmin), controllers.UpdateApprovalStatus)
+		api.POST("/outgoing-documents/:id/approval", controllers.UpdateApprovalStatus)
+		api.GET("/outgoing-documents/:id/approval", controllers.GetOutgoingApproval)
+		api.PUT("/outgoing-documents/:id/approval-chain", controllers.SetApprovalChain)
+		api.POST("/outgoing-documents/:id/submit", controllers.SubmitOutgoingDocument)
+		api.POST("/outgoing-documents/:id/withdraw", controllers.WithdrawOutgoingDocument)
+		api.POST("/outgoing-documents/:id/approve", middleware.RequireRole(models.RoleTeamLeader, models.RoleDeputy), controllers.ApproveOutgoingDocument)
+		api.POST("/outgoing-documents/:id/reject", middleware.RequireRole(models.RoleTeamLeader, models.RoleDeputy), controllers.RejectOutgoingDocument)
+		api.POST("/outgoing-documents/:id/issue", middleware.RequireRole(models.RoleSecretary, models.RoleAdmin), controllers.IssueOutgoingDocument)
 		api.POST("/outgoing-documents/:id/upload", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader, models.RoleDeputy, models.RoleOfficer, models.RoleAdmin), controllers.UploadOutgoingDocumentFile)
+		api.POST("/outgoing-documents/:id/cancel", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader, models.RoleDeputy, models.RoleAdmin), controllers.CancelOutgoingDocument)
+		api.GET("/outgoing-documents/:id/access", controllers.GetOutgoingDocumentAccess)
+		api.POST("/outgoing-documents/:id/access", controllers.GrantOutgoingDocumentAccess)
+		api.DELETE("/outgoing-documents/:id/access/:userId", controllers.RevokeOutgoingDocumentAccess)
+		api.GET("/outgoing-documents/:id/relations", controllers.GetOutgoingDocumentRelations)
+		api.POST("/outgoing-documents/:id/relations", controllers.CreateOutgoingDocumentRelation)
+		api.DELETE("/document-relations/:id", controllers.DeleteDocumentRelation)
+		api.GET("/outgoing-documents/:id/recipients", controllers.GetOutgoingDocumentRecipients)
+		api.PUT("/outgoing-documents/:id/recipients", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader, models.RoleDeputy, models.RoleOfficer, models.RoleAdmin), controllers.SetOutgoingDocumentRecipients)
+		api.POST("/outgoing-documents/:id/dispatch", middleware.RequireRole(models.RoleSecretary, models.RoleAdmin), controllers.DispatchOutgoingDocument)
+		api.POST("/outgoing-documents/:id/recipients/:recipientId/confirm", middleware.RequireRole(models.RoleSecretary, models.RoleAdmin), controllers.ConfirmRecipientReceipt)
+		api.POST("/outgoing-documents/:id/recipients/:recipientId/return", middleware.RequireRole(models.RoleSecretary, models.RoleAdmin), controllers.ReturnRecipient)
+		api.GET("/outgoing-documents/register", controllers.GetOutgoingRegister)
 		api.GET("/outgoing-documents/drafters", controllers.GetDrafters)
 		api.GET("/outgoing-documents/approvers", controllers.GetApprovers)
+		api.POST("/outgoing-documents/import", middleware.RequireRole(models.RoleSecretary, models.RoleAdmin), controllers.ImportOutgoingDocuments)
+		api.POST("/outgoing-documents/bulk/delete", middleware.RequireRole(models.RoleSecretary, models.RoleTeamLeader, models.RoleAdmin), controllers.BulkDeleteOutgoingDocuments)
 
 		// Filter and Search routes
 		api.GET("/filters/presets", controllers.GetFilterPresets)
@@ -174,6 +271,7 @@ func main() {
 		api.GET("/filters/saved", controllers.GetSavedFilters)
 		api.POST("/filters/saved", controllers.SaveFilter)
 		api.DELETE("/filters/saved/:id", controllers.DeleteSavedFilter)
+		api.GET("/search", controllers.Search)
 		api.GET("/search/suggestions", controllers.GetSearchSuggestions)
 
 		// Audit Trail routes
@@ -19,6 +19,17 @@ const (
 	AuditActionDocumentAssign   AuditAction = "document_assign"
 	AuditActionDocumentProcess  AuditAction = "document_process"
 	AuditActionDocumentComplete AuditAction = "document_complete"
+	AuditActionDocumentImport   AuditAction = "document_import"
+	AuditActionDocumentApproval AuditAction = "document_approval"
+	AuditActionDocumentDispatch AuditAction = "document_dispatch"
+	AuditActionDocumentReceipt  AuditAction = "document_receipt"
+	AuditActionNumberCorrect    AuditAction = "number_correct"
+	AuditActionNumberCancel     AuditAction = "number_cancel"
+	AuditActionClassifiedAccess AuditAction = "classified_access"
+	AuditActionAccessGrant      AuditAction = "access_grant"
+	AuditActionAccessRevoke     AuditAction = "access_revoke"
+	AuditActionRelationCreate   AuditAction = "relation_create"
+	AuditActionRelationDelete   AuditAction = "relation_delete"
 
 	// Task actions
 	AuditActionTaskCreate   AuditAction = "task_create"
@@ -46,6 +57,7 @@ const (
 	AuditActionFileDelete     AuditAction = "file_delete"
 	AuditActionReportGenerate AuditAction = "report_generate"
 	AuditActionReportExport   AuditAction = "report_export"
+	AuditActionSequenceAdjust AuditAction = "sequence_adjust"
 )
 
 // AuditEntityType represents the type of entity being audited
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Comment is a message on a task. Human comments can be replied to, edited and deleted;
+// system comments record events such as forwarding and are read-only.
+type Comment struct {
+	gorm.Model
+	TaskID      uint       `json:"task_id" gorm:"not null"`
+	UserID      uint       `json:"user_id" gorm:"not null"`
+	Content     string     `json:"content" gorm:"not null"`
+	ParentID    *uint      `json:"parent_id" gorm:"index"`              // Comment this one replies to
+	Kind        string     `json:"kind" gorm:"not null;default:'user'"` // "user", "system"
+	IsEdited    bool       `json:"is_edited" gorm:"default:false"`
+	EditedAt    *time.Time `json:"edited_at"`
+	DeletedByID *uint      `json:"deleted_by_id,omitempty"`
+	IsDeleted   bool       `json:"is_deleted" gorm:"-"` // Set when a deleted comment is kept as a placeholder for its replies
+
+	// Relations
+	User     User             `json:"user" gorm:"foreignkey:UserID"`
+	Mentions []CommentMention `json:"mentions,omitempty" gorm:"foreignkey:CommentID"`
+}
+
+// Comment kinds
+const (
+	CommentKindUser   = "user"
+	CommentKindSystem = "system"
+)
+
+// CommentRevision keeps the content a comment had before an edit
+type CommentRevision struct {
+	ID         uint      `json:"id" gorm:"primary_key"`
+	CommentID  uint      `json:"comment_id" gorm:"not null;index"`
+	Content    string    `json:"content" gorm:"not null"`
+	EditedByID uint      `json:"edited_by_id" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Relations
+	EditedBy User `json:"edited_by" gorm:"foreignkey:EditedByID"`
+}
+
+// CommentMention links a comment to a user mentioned in it with @username
+type CommentMention struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CommentID uint      `json:"comment_id" gorm:"not null;unique_index:idx_comment_mentions_comment_user"`
+	UserID    uint      `json:"user_id" gorm:"not null;unique_index:idx_comment_mentions_comment_user"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Relations
+	User User `json:"user" gorm:"foreignkey:UserID"`
+}
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([A-Za-z0-9_.]+)`)
+
+// ParseMentions returns the distinct usernames mentioned as @username in the content
+func ParseMentions(content string) []string {
+	seen := make(map[string]bool)
+	var usernames []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		username := strings.TrimRight(match[1], ".")
+		if username != "" && !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+	return usernames
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// DocumentDirective is the leader's directive (bút phê) on an incoming document: who handles it,
+// who supports, what is to be done and by when. Each document has at most one current directive;
+// earlier versions are kept as DocumentDirectiveRevision records.
+type DocumentDirective struct {
+	gorm.Model
+	IncomingDocumentID uint       `json:"incoming_document_id" gorm:"not null;unique_index"`
+	DirectorID         uint       `json:"director_id" gorm:"not null"`
+	Instruction        string     `json:"instruction" gorm:"type:text;not null"`
+	Deadline           *time.Time `json:"deadline"`                  // Response deadline, used for the tasks created from the directive
+	Revision           int        `json:"revision" gorm:"default:1"` // Incremented on every revision
+	TasksCreatedAt     *time.Time `json:"tasks_created_at"`          // Last time tasks were created from the directive
+
+	// Relations
+	Director  User                `json:"director" gorm:"foreignkey:DirectorID"`
+	Assignees []DirectiveAssignee `json:"assignees" gorm:"foreignkey:DirectiveID"`
+}
+
+// DirectiveAssignee is a person or unit named in a directive, either leading or supporting the work
+type DirectiveAssignee struct {
+	ID              uint   `json:"id" gorm:"primary_key"`
+	DirectiveID     uint   `json:"directive_id" gorm:"not null;index"`
+	Role            string `json:"role" gorm:"not null"` // "lead", "support"
+	UserID          *uint  `json:"user_id"`
+	UnitName        string `json:"unit_name"`        // For units outside the user list
+	TaskDescription string `json:"task_description"` // Work for this assignee, defaults to the instruction
+	TaskID          *uint  `json:"task_id"`          // Task created for this assignee
+	Position        int    `json:"position" gorm:"default:0"`
+
+	// Relations
+	User *User `json:"user,omitempty" gorm:"foreignkey:UserID"`
+	Task *Task `json:"task,omitempty" gorm:"foreignkey:TaskID"`
+}
+
+// DocumentDirectiveRevision is a snapshot of a directive taken before it was revised
+type DocumentDirectiveRevision struct {
+	ID          uint       `json:"id" gorm:"primary_key"`
+	DirectiveID uint       `json:"directive_id" gorm:"not null;index"`
+	Revision    int        `json:"revision" gorm:"not null"`
+	DirectorID  uint       `json:"director_id" gorm:"not null"`
+	Instruction string     `json:"instruction" gorm:"type:text;not null"`
+	Deadline    *time.Time `json:"deadline"`
+	Assignees   string     `json:"assignees" gorm:"type:text"` // JSON snapshot of the assignees
+	RevisedByID uint       `json:"revised_by_id" gorm:"not null"`
+	Note        string     `json:"note"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	// Relations
+	Director  User `json:"director" gorm:"foreignkey:DirectorID"`
+	RevisedBy User `json:"revised_by" gorm:"foreignkey:RevisedByID"`
+}
+
+// Directive assignee roles
+const (
+	DirectiveRoleLead    = "lead"
+	DirectiveRoleSupport = "support"
+)
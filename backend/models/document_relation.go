@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+)
+
+// DocumentRelation links two documents directly: the source replies to, supersedes, amends or
+// cites the target. An outgoing reply points at the incoming document it answers.
+type DocumentRelation struct {
+	ID           uint      `json:"id" gorm:"primary_key"`
+	SourceType   string    `json:"source_type" gorm:"not null;unique_index:idx_document_relations_pair;index:idx_document_relations_source"` // "incoming_document", "outgoing_document"
+	SourceID     uint      `json:"source_id" gorm:"not null;unique_index:idx_document_relations_pair;index:idx_document_relations_source"`
+	TargetType   string    `json:"target_type" gorm:"not null;unique_index:idx_document_relations_pair;index:idx_document_relations_target"`
+	TargetID     uint      `json:"target_id" gorm:"not null;unique_index:idx_document_relations_pair;index:idx_document_relations_target"`
+	RelationType string    `json:"relation_type" gorm:"not null;unique_index:idx_document_relations_pair"`
+	Notes        string    `json:"notes"`
+	CreatedByID  uint      `json:"created_by_id" gorm:"not null"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// Relations
+	CreatedBy User `json:"created_by" gorm:"foreignkey:CreatedByID"`
+}
+
+// Kinds of documents a relation connects
+const (
+	RelationDocumentIncoming = "incoming_document"
+	RelationDocumentOutgoing = "outgoing_document"
+)
+
+// Relation type constants, read as "source <type> target"
+const (
+	DocumentRelationRepliesTo  = "replies_to" // Answers a document of the other direction
+	DocumentRelationSupersedes = "supersedes" // Replaces a document of the same direction
+	DocumentRelationAmends     = "amends"     // Changes part of a document of the same direction
+	DocumentRelationCites      = "cites"      // Refers to any document
+	DocumentRelationTask       = "task"       // Derived: the outgoing document is a result of a task of the incoming one
+)
+
+func IsValidDocumentRelationType(relationType string) bool {
+	switch relationType {
+	case DocumentRelationRepliesTo, DocumentRelationSupersedes, DocumentRelationAmends, DocumentRelationCites:
+		return true
+	}
+	return false
+}
+
+// CorrespondenceDocument is one document of a correspondence thread
+type CorrespondenceDocument struct {
+	DocumentType string    `json:"document_type"`
+	ID           uint      `json:"id"`
+	Number       string    `json:"number"`
+	Summary      string    `json:"summary"`
+	Date         time.Time `json:"date"` // Arrival date of incoming documents, issue date of outgoing ones
+	Status       string    `json:"status"`
+	IssuingUnit  string    `json:"issuing_unit,omitempty"`
+}
+
+// CorrespondenceLink is an edge of a correspondence thread. Links derived from tasks have no ID.
+type CorrespondenceLink struct {
+	ID           uint   `json:"id,omitempty"`
+	SourceType   string `json:"source_type"`
+	SourceID     uint   `json:"source_id"`
+	TargetType   string `json:"target_type"`
+	TargetID     uint   `json:"target_id"`
+	RelationType string `json:"relation_type"`
+	TaskID       *uint  `json:"task_id,omitempty"`
+	Notes        string `json:"notes,omitempty"`
+}
+
+// CorrespondenceThread holds every document reachable from a document through relations, oldest first
+type CorrespondenceThread struct {
+	Documents []CorrespondenceDocument `json:"documents"`
+	Links     []CorrespondenceLink     `json:"links"`
+	Truncated bool                     `json:"truncated,omitempty"`
+}
+
+// ResponseTime measures how long an incoming document waited for its reply, from arrival to
+// the issue date of the first outgoing document replying to it
+type ResponseTime struct {
+	ReplyID        uint      `json:"reply_id"`
+	ReplyNumber    string    `json:"reply_number"`
+	ArrivalDate    time.Time `json:"arrival_date"`
+	ReplyIssueDate time.Time `json:"reply_issue_date"`
+	Days           int       `json:"days"`
+}
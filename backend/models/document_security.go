@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+)
+
+// Urgency levels (độ khẩn) of a document
+const (
+	UrgencyNormal     = "normal"      // Thường
+	UrgencyUrgent     = "urgent"      // Khẩn
+	UrgencyVeryUrgent = "very_urgent" // Thượng khẩn
+	UrgencyFlash      = "flash"       // Hỏa tốc
+)
+
+// Secrecy levels (độ mật) of a document. Anything above SecrecyNone is only visible to the
+// people working on the document and to users cleared for it explicitly.
+const (
+	SecrecyNone         = "none"
+	SecrecyConfidential = "confidential" // Mật
+	SecrecySecret       = "secret"       // Tối mật
+	SecrecyTopSecret    = "top_secret"   // Tuyệt mật
+)
+
+// UrgencyOrderSQL returns an ORDER BY expression that puts the most urgent documents of a table first
+func UrgencyOrderSQL(table string) string {
+	return "CASE " + table + ".urgency WHEN 'flash' THEN 3 WHEN 'very_urgent' THEN 2 WHEN 'urgent' THEN 1 ELSE 0 END DESC"
+}
+
+// Default time allowed to handle a document, by urgency. Normal documents have no default.
+var urgencyHandlingTime = map[string]time.Duration{
+	UrgencyUrgent:     3 * 24 * time.Hour,
+	UrgencyVeryUrgent: 24 * time.Hour,
+	UrgencyFlash:      4 * time.Hour,
+}
+
+func IsValidUrgency(urgency string) bool {
+	switch urgency {
+	case UrgencyNormal, UrgencyUrgent, UrgencyVeryUrgent, UrgencyFlash:
+		return true
+	}
+	return false
+}
+
+func IsValidSecrecy(level string) bool {
+	switch level {
+	case SecrecyNone, SecrecyConfidential, SecrecySecret, SecrecyTopSecret:
+		return true
+	}
+	return false
+}
+
+// IsClassified reports whether a secrecy level restricts who may see the document
+func IsClassified(level string) bool {
+	return level != "" && level != SecrecyNone
+}
+
+// UrgencyDeadline returns the default deadline for handling a document received at from,
+// or nil when its urgency sets none
+func UrgencyDeadline(urgency string, from time.Time) *time.Time {
+	handlingTime, ok := urgencyHandlingTime[urgency]
+	if !ok {
+		return nil
+	}
+	deadline := from.Add(handlingTime)
+	return &deadline
+}
+
+// Document kinds access can be granted to
+const (
+	AccessEntityIncomingDocument = "incoming_document"
+	AccessEntityOutgoingDocument = "outgoing_document"
+)
+
+// DocumentAccessGrant clears a user to see a classified document
+type DocumentAccessGrant struct {
+	ID          uint      `json:"id" gorm:"primary_key"`
+	EntityType  string    `json:"entity_type" gorm:"not null;unique_index:idx_document_access_grants_entity_user"`
+	EntityID    uint      `json:"entity_id" gorm:"not null;unique_index:idx_document_access_grants_entity_user"`
+	UserID      uint      `json:"user_id" gorm:"not null;unique_index:idx_document_access_grants_entity_user;index"`
+	GrantedByID uint      `json:"granted_by_id" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Relations
+	User      *User `json:"user,omitempty" gorm:"foreignkey:UserID"`
+	GrantedBy *User `json:"granted_by,omitempty" gorm:"foreignkey:GrantedByID"`
+}
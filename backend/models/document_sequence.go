@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// DocumentSequence is the counter of a numbering register, e.g. the arrival numbers of incoming
+// documents. Registers restart every year and may be split into separate books.
+type DocumentSequence struct {
+	ID           uint      `json:"id" gorm:"primary_key"`
+	Scope        string    `json:"scope" gorm:"not null;unique_index:idx_document_sequences_register"`
+	Year         int       `json:"year" gorm:"not null;unique_index:idx_document_sequences_register"`
+	RegisterBook string    `json:"register_book" gorm:"not null;default:'';unique_index:idx_document_sequences_register"`
+	LastValue    int       `json:"last_value" gorm:"not null;default:0"` // Last number handed out
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Sequence scopes
+const (
+	SequenceScopeIncoming = "incoming"
+	SequenceScopeOutgoing = "outgoing" // One register book per document type
+)
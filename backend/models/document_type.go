@@ -6,7 +6,9 @@ import (
 
 type DocumentType struct {
 	gorm.Model
-	Name        string `json:"name" gorm:"unique;not null"`
-	Description string `json:"description"`
-	IsActive    bool   `json:"is_active" gorm:"default:true"`
+	Name           string `json:"name" gorm:"unique;not null"`
+	Description    string `json:"description"`
+	Code           string `json:"code"`            // Short code used in document numbers, e.g. "BC"
+	NumberTemplate string `json:"number_template"` // e.g. "{seq}/{type_code}-{unit_code}"; empty means numbers are typed by hand
+	IsActive       bool   `json:"is_active" gorm:"default:true"`
 }
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// FileSignature is the verification result of one digital signature embedded in a stored PDF.
+// The rows of a file are replaced as a whole each time it is verified.
+type FileSignature struct {
+	ID                  uint       `json:"id" gorm:"primary_key"`
+	FileID              uint       `json:"file_id" gorm:"not null;index"`
+	Position            int        `json:"position"` // Signing order, the first signature is 1
+	Status              string     `json:"status" gorm:"not null;index"`
+	SignerName          string     `json:"signer_name"`
+	SignerOrganization  string     `json:"signer_organization,omitempty"`
+	Issuer              string     `json:"issuer"`
+	SerialNumber        string     `json:"serial_number,omitempty"`
+	SigningTime         *time.Time `json:"signing_time"`
+	TimeSource          string     `json:"time_source,omitempty"`
+	SubFilter           string     `json:"sub_filter"`
+	Reason              string     `json:"reason,omitempty"`
+	Location            string     `json:"location,omitempty"`
+	DigestAlgorithm     string     `json:"digest_algorithm,omitempty"`
+	CoversWholeDocument bool       `json:"covers_whole_document"` // False when the file was changed or signed again afterwards
+	IntegrityValid      bool       `json:"integrity_valid"`
+	ChainValid          bool       `json:"chain_valid"`
+	CertValidAtSigning  bool       `json:"cert_valid_at_signing"` // At the trusted time stamp's time, otherwise at verification
+	CertNotBefore       *time.Time `json:"cert_not_before"`
+	CertNotAfter        *time.Time `json:"cert_not_after"`
+	Error               string     `json:"error,omitempty"`
+	VerifiedAt          time.Time  `json:"verified_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// Signature statuses
+const (
+	FileSignatureValid     = "valid"     // Intact, and the certificate chains to a trusted CA and was valid when signing
+	FileSignatureUntrusted = "untrusted" // Intact, but the certificate is not trusted or was not valid when signing
+	FileSignatureModified  = "modified"  // The signed revision is intact, but the file was changed afterwards without being signed again
+	FileSignatureInvalid   = "invalid"   // The signed content was changed or the signature does not match
+	FileSignatureError     = "error"     // The signature could not be read or uses an unsupported format
+)
+
+// Where the signing time comes from
+const (
+	SignatureTimeTimestamp = "timestamp" // A time stamp token of a trusted time stamping authority
+	SignatureTimeClaimed   = "claimed"   // The signer's own clock
+)
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// FileText is the text extracted from a stored file, kept apart from the file record so file
+// listings do not carry it around. One row per file in the files table.
+type FileText struct {
+	ID          uint       `json:"id" gorm:"primary_key"`
+	FileID      uint       `json:"file_id" gorm:"not null;unique_index"`
+	Status      string     `json:"status" gorm:"not null;default:'pending';index"`
+	Content     string     `json:"content" gorm:"type:text"`
+	Error       string     `json:"error,omitempty"`
+	ExtractedAt *time.Time `json:"extracted_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Text extraction statuses
+const (
+	FileTextPending     = "pending"
+	FileTextExtracted   = "extracted"
+	FileTextEmpty       = "empty"       // Readable but without text, e.g. a scan without OCR
+	FileTextUnsupported = "unsupported" // Images and formats no extractor reads
+	FileTextFailed      = "failed"
+)
@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -9,29 +10,63 @@ import (
 
 type IncomingDocument struct {
 	gorm.Model
-	ArrivalDate    time.Time `json:"arrival_date" gorm:"not null"`
-	ArrivalNumber  int       `json:"arrival_number" gorm:"unique;not null"`
-	OriginalNumber string    `json:"original_number" gorm:"not null"`
-	DocumentDate   time.Time `json:"document_date" gorm:"not null"`
-	DocumentTypeID uint      `json:"document_type_id" gorm:"not null"`
-	IssuingUnitID  uint      `json:"issuing_unit_id" gorm:"not null"`
-	Summary        string    `json:"summary" gorm:"not null"`
-	InternalNotes  string    `json:"internal_notes"`
-	ProcessorID    *uint     `json:"processor_id"`
-	Status         string    `json:"status" gorm:"not null;default:'received'"`
-	FilePath       string    `json:"file_path"`
-	CreatedByID    uint      `json:"created_by_id" gorm:"not null"`
+	ArrivalDate    time.Time  `json:"arrival_date" gorm:"not null"`
+	ArrivalNumber  int        `json:"arrival_number" gorm:"not null"` // Unique within ArrivalYear and RegisterBook
+	ArrivalYear    int        `json:"arrival_year" gorm:"index"`
+	RegisterBook   string     `json:"register_book" gorm:"not null;default:''"` // Empty for the main register
+	OriginalNumber string     `json:"original_number" gorm:"not null"`
+	DocumentDate   time.Time  `json:"document_date" gorm:"not null"`
+	DocumentTypeID uint       `json:"document_type_id" gorm:"not null"`
+	IssuingUnitID  uint       `json:"issuing_unit_id" gorm:"not null"`
+	Summary        string     `json:"summary" gorm:"not null"`
+	Urgency        string     `json:"urgency" gorm:"not null;default:'normal';index"`
+	SecrecyLevel   string     `json:"secrecy_level" gorm:"not null;default:'none';index"`
+	InternalNotes  string     `json:"internal_notes"`
+	ProcessorID    *uint      `json:"processor_id"`
+	Status         string     `json:"status" gorm:"not null;default:'received'"` // Follows the linked tasks once there are any
+	CompletedAt    *time.Time `json:"completed_at"`
+	DuplicateOfID  *uint      `json:"duplicate_of_id" gorm:"index"` // First registered copy when the same document arrived twice
+	SourceEmailID  string     `json:"source_email_id,omitempty"`    // Message-ID of the email the document was imported from
+	FilePath       string     `json:"file_path"`
+	CreatedByID    uint       `json:"created_by_id" gorm:"not null"`
+	Version        uint       `json:"version" gorm:"not null;default:1"` // Incremented in SQL on every update (see versioning.go), exposed as ETag
 
 	// Relations
-	DocumentType DocumentType `json:"document_type" gorm:"foreignkey:DocumentTypeID"`
-	IssuingUnit  IssuingUnit  `json:"issuing_unit" gorm:"foreignkey:IssuingUnitID"`
-	Processor    *User        `json:"processor" gorm:"foreignkey:ProcessorID"`
-	CreatedBy    User         `json:"created_by" gorm:"foreignkey:CreatedByID"`
-	Tasks        []Task       `json:"tasks" gorm:"foreignkey:IncomingDocumentID"`
+	DocumentType DocumentType       `json:"document_type" gorm:"foreignkey:DocumentTypeID"`
+	IssuingUnit  IssuingUnit        `json:"issuing_unit" gorm:"foreignkey:IssuingUnitID"`
+	Processor    *User              `json:"processor" gorm:"foreignkey:ProcessorID"`
+	CreatedBy    User               `json:"created_by" gorm:"foreignkey:CreatedByID"`
+	Tasks        []Task             `json:"tasks" gorm:"foreignkey:IncomingDocumentID"`
+	Directive    *DocumentDirective `json:"directive,omitempty" gorm:"foreignkey:IncomingDocumentID"`
+	DuplicateOf  *IncomingDocument  `json:"duplicate_of,omitempty" gorm:"foreignkey:DuplicateOfID"`
+
+	// Filled in by the detail endpoint
+	Thread       *CorrespondenceThread `json:"thread,omitempty" gorm:"-"`
+	ResponseTime *ResponseTime         `json:"response_time,omitempty" gorm:"-"`
+}
+
+// ErrArrivalYearChanged is returned when a registered document would move to another year's
+// register through its arrival date; its number belongs to the register it was taken from
+var ErrArrivalYearChanged = errors.New("không thể đổi ngày đến sang năm khác với sổ đăng ký của văn bản")
+
+// BeforeSave files documents without an arrival year under the year they arrived, and refuses an
+// arrival date outside the year of the register the document is numbered in
+func (d *IncomingDocument) BeforeSave(scope *gorm.Scope) error {
+	if d.ArrivalDate.IsZero() {
+		return nil
+	}
+	if d.ArrivalYear == 0 {
+		return scope.SetColumn("ArrivalYear", d.ArrivalDate.Year())
+	}
+	if d.ArrivalDate.Year() != d.ArrivalYear {
+		return ErrArrivalYearChanged
+	}
+	return nil
 }
 
 // Status constants for incoming documents
 const (
+	IncomingStatusDraft      = "draft" // Scanned in, waiting for the secretary to enter its details and register it
 	IncomingStatusReceived   = "received"
 	IncomingStatusForwarded  = "forwarded"
 	IncomingStatusAssigned   = "assigned"
@@ -8,5 +8,7 @@ type IssuingUnit struct {
 	gorm.Model
 	Name        string `json:"name" gorm:"unique;not null"`
 	Description string `json:"description"`
+	Code        string `json:"code"`   // Short code used in document numbers, e.g. "CAX"
+	Emails      string `json:"emails"` // Comma separated addresses or domains ("@ubnd.gov.vn") the unit sends mail from
 	IsActive    bool   `json:"is_active" gorm:"default:true"`
 }
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+)
+
+// OutgoingApprovalStep is one approver of the chain an outgoing document goes through in
+// review. Steps are decided one after another in Position order; submitting the document again
+// starts a new round from the first step.
+type OutgoingApprovalStep struct {
+	ID                 uint       `json:"id" gorm:"primary_key"`
+	OutgoingDocumentID uint       `json:"outgoing_document_id" gorm:"not null;index"`
+	Position           int        `json:"position" gorm:"not null"`
+	ApproverID         uint       `json:"approver_id" gorm:"not null;index"`
+	Status             string     `json:"status" gorm:"not null;default:'waiting'"`
+	Comment            string     `json:"comment"`
+	DecidedAt          *time.Time `json:"decided_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+
+	// Relations
+	Approver User `json:"approver" gorm:"foreignkey:ApproverID"`
+}
+
+// Approval step status constants
+const (
+	ApprovalStepWaiting  = "waiting" // An earlier step has not been decided yet
+	ApprovalStepPending  = "pending" // Waiting for this approver
+	ApprovalStepApproved = "approved"
+	ApprovalStepRejected = "rejected"
+)
+
+// OutgoingApprovalHistory records one action of the approval workflow. Records are only ever
+// inserted; 009_outgoing_approval_history.sql makes the database refuse changes to them.
+type OutgoingApprovalHistory struct {
+	ID                 uint      `json:"id" gorm:"primary_key"`
+	OutgoingDocumentID uint      `json:"outgoing_document_id" gorm:"not null;index"`
+	Action             string    `json:"action" gorm:"not null"`
+	FromStatus         string    `json:"from_status" gorm:"not null"`
+	ToStatus           string    `json:"to_status" gorm:"not null"`
+	StepPosition       *int      `json:"step_position"` // Step decided by an approve or reject
+	ActorID            uint      `json:"actor_id" gorm:"not null"`
+	Comment            string    `json:"comment"`
+	CreatedAt          time.Time `json:"created_at"`
+
+	// Relations
+	Actor User `json:"actor" gorm:"foreignkey:ActorID"`
+}
+
+// Approval workflow actions
+const (
+	ApprovalActionSubmit   = "submit"
+	ApprovalActionWithdraw = "withdraw"
+	ApprovalActionApprove  = "approve"
+	ApprovalActionReject   = "reject"
+	ApprovalActionIssue    = "issue"
+	ApprovalActionSign     = "sign" // The approved file signed with the organisation's certificate
+)
@@ -8,31 +8,51 @@ import (
 
 type OutgoingDocument struct {
 	gorm.Model
-	DocumentNumber string    `json:"document_number" gorm:"not null"`
-	IssueDate      time.Time `json:"issue_date" gorm:"not null"`
-	DocumentTypeID uint      `json:"document_type_id" gorm:"not null"`
-	IssuingUnitID  uint      `json:"issuing_unit_id" gorm:"not null"`
-	Summary        string    `json:"summary" gorm:"not null"`
-	DrafterID      uint      `json:"drafter_id" gorm:"not null"`
-	ApproverID     uint      `json:"approver_id" gorm:"not null"`
-	InternalNotes  string    `json:"internal_notes"`
-	Status         string    `json:"status" gorm:"not null;default:'draft'"`
-	FilePath       string    `json:"file_path"`
-	CreatedByID    uint      `json:"created_by_id" gorm:"not null"`
+	DocumentNumber string     `json:"document_number" gorm:"not null"` // Unique within NumberYear and DocumentTypeID
+	NumberYear     int        `json:"number_year" gorm:"index"`
+	SequenceNumber int        `json:"sequence_number"` // Number reserved from the type's register, 0 for hand-typed numbers
+	CancelReason   string     `json:"cancel_reason"`
+	IssueDate      time.Time  `json:"issue_date" gorm:"not null"`
+	DocumentTypeID uint       `json:"document_type_id" gorm:"not null"`
+	IssuingUnitID  uint       `json:"issuing_unit_id" gorm:"not null"`
+	Summary        string     `json:"summary" gorm:"not null"`
+	Urgency        string     `json:"urgency" gorm:"not null;default:'normal';index"`
+	SecrecyLevel   string     `json:"secrecy_level" gorm:"not null;default:'none';index"`
+	DrafterID      uint       `json:"drafter_id" gorm:"not null"`
+	ApproverID     uint       `json:"approver_id" gorm:"not null"`
+	InternalNotes  string     `json:"internal_notes"`
+	Status         string     `json:"status" gorm:"not null;default:'draft'"`
+	FilePath       string     `json:"file_path"`
+	SentAt         *time.Time `json:"sent_at"` // When the last recipient was dispatched
+	CreatedByID    uint       `json:"created_by_id" gorm:"not null"`
+	Version        uint       `json:"version" gorm:"not null;default:1"` // Incremented in SQL on every update (see versioning.go), exposed as ETag
 
 	// Relations
-	DocumentType DocumentType `json:"document_type" gorm:"foreignkey:DocumentTypeID"`
-	IssuingUnit  IssuingUnit  `json:"issuing_unit" gorm:"foreignkey:IssuingUnitID"`
-	Drafter      User         `json:"drafter" gorm:"foreignkey:DrafterID"`
-	Approver     User         `json:"approver" gorm:"foreignkey:ApproverID"`
-	CreatedBy    User         `json:"created_by" gorm:"foreignkey:CreatedByID"`
+	DocumentType DocumentType                `json:"document_type" gorm:"foreignkey:DocumentTypeID"`
+	IssuingUnit  IssuingUnit                 `json:"issuing_unit" gorm:"foreignkey:IssuingUnitID"`
+	Drafter      User                        `json:"drafter" gorm:"foreignkey:DrafterID"`
+	Approver     User                        `json:"approver" gorm:"foreignkey:ApproverID"`
+	CreatedBy    User                        `json:"created_by" gorm:"foreignkey:CreatedByID"`
+	Recipients   []OutgoingDocumentRecipient `json:"recipients,omitempty" gorm:"foreignkey:OutgoingDocumentID"`
+
+	Thread *CorrespondenceThread `json:"thread,omitempty" gorm:"-"` // Filled in by the detail endpoint
+}
+
+// BeforeSave places documents without a number year in the register of the year they are issued
+func (d *OutgoingDocument) BeforeSave(scope *gorm.Scope) error {
+	if d.NumberYear == 0 && !d.IssueDate.IsZero() {
+		return scope.SetColumn("NumberYear", d.IssueDate.Year())
+	}
+	return nil
 }
 
 // Status constants for outgoing documents
 const (
-	OutgoingStatusDraft    = "draft"
-	OutgoingStatusReview   = "review"
-	OutgoingStatusApproved = "approved"
-	OutgoingStatusSent     = "sent"
-	OutgoingStatusRejected = "rejected"
+	OutgoingStatusDraft     = "draft"
+	OutgoingStatusReview    = "review"
+	OutgoingStatusApproved  = "approved"  // Every step of the approval chain approved
+	OutgoingStatusIssued    = "issued"    // Numbered and released by the secretary
+	OutgoingStatusSent      = "sent"      // Dispatched to every recipient
+	OutgoingStatusRejected  = "rejected"  // Before approval chains; rejected documents now go back to draft
+	OutgoingStatusCancelled = "cancelled" // The number stays in the register and is never reused
 )
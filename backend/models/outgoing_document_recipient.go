@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+)
+
+// OutgoingDocumentRecipient is a receiving unit on the distribution list (nơi nhận) of an
+// outgoing document, with how and when the document was sent to it
+type OutgoingDocumentRecipient struct {
+	ID                 uint       `json:"id" gorm:"primary_key"`
+	OutgoingDocumentID uint       `json:"outgoing_document_id" gorm:"not null;unique_index:idx_outgoing_recipients_unit"`
+	ReceivingUnitID    uint       `json:"receiving_unit_id" gorm:"not null;unique_index:idx_outgoing_recipients_unit"`
+	DeliveryMethod     string     `json:"delivery_method" gorm:"not null;default:'post'"`
+	Status             string     `json:"status" gorm:"not null;default:'pending';index"`
+	Position           int        `json:"position" gorm:"default:0"`
+	Notes              string     `json:"notes"`
+	DispatchedAt       *time.Time `json:"dispatched_at"`
+	DispatchedByID     *uint      `json:"dispatched_by_id"`
+	TrackingNumber     string     `json:"tracking_number"` // Postal tracking number, or the reference given by the e-exchange system
+	ReceivedAt         *time.Time `json:"received_at"`     // When the recipient confirmed receipt
+	ReceivedBy         string     `json:"received_by"`     // Who signed for it at the recipient
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+
+	// Relations
+	ReceivingUnit ReceivingUnit `json:"receiving_unit" gorm:"foreignkey:ReceivingUnitID"`
+	DispatchedBy  *User         `json:"dispatched_by,omitempty" gorm:"foreignkey:DispatchedByID"`
+}
+
+// Delivery methods
+const (
+	DeliveryMethodPost          = "post"
+	DeliveryMethodEmail         = "email"
+	DeliveryMethodHandDelivered = "hand_delivered"
+	DeliveryMethodEExchange     = "e_exchange" // Trục liên thông văn bản điện tử
+)
+
+func IsValidDeliveryMethod(method string) bool {
+	switch method {
+	case DeliveryMethodPost, DeliveryMethodEmail, DeliveryMethodHandDelivered, DeliveryMethodEExchange:
+		return true
+	}
+	return false
+}
+
+// Recipient status constants
+const (
+	RecipientStatusPending    = "pending"
+	RecipientStatusDispatched = "dispatched"
+	RecipientStatusReceived   = "received" // Receipt confirmed by the recipient
+	RecipientStatusReturned   = "returned" // Sent back or bounced; has to be dispatched again
+)
+
+// IsDispatched reports whether the document has left for this recipient
+func (r *OutgoingDocumentRecipient) IsDispatched() bool {
+	return r.Status == RecipientStatusDispatched || r.Status == RecipientStatusReceived
+}
@@ -21,16 +21,33 @@ type Task struct {
 	ProcessingNotes    string     `json:"processing_notes"`
 	CompletionDate     *time.Time `json:"completion_date"`
 	ReportFile         string     `json:"report_file"`
+	TemplateID         *uint      `json:"template_id" gorm:"index"`    // Template the task was created from
+	ParentTaskID       *uint      `json:"parent_task_id" gorm:"index"` // Set for subtasks created from a template
+	HoldReason         string     `json:"hold_reason"`
+	HoldStartedAt      *time.Time `json:"hold_started_at"`
+	ExpectedResumeAt   *time.Time `json:"expected_resume_at"`
+	StatusBeforeHold   string     `json:"status_before_hold"`            // Status restored when the task resumes
+	HeldSeconds        int64      `json:"held_seconds" gorm:"default:0"` // Total time spent on hold so far
+	AssignedByID       *uint      `json:"assigned_by_id"`
+	AssignedAt         *time.Time `json:"assigned_at"`
+	AcceptanceStatus   string     `json:"acceptance_status" gorm:"default:'accepted'"` // "pending", "accepted", "declined"
+	AcceptedAt         *time.Time `json:"accepted_at"`
+	DeclineReason      string     `json:"decline_reason"`
+	Version            uint       `json:"version" gorm:"not null;default:1"` // Incremented in SQL on every update (see versioning.go), exposed as ETag
 
 	// Relations
 	AssignedTo       *User               `json:"assigned_to" gorm:"foreignkey:AssignedToID"`
 	AssignedUser     *User               `json:"assigned_user" gorm:"foreignkey:AssignedToID"` // Compatibility field
 	CreatedBy        *User               `json:"created_by" gorm:"foreignkey:CreatedByID"`
+	AssignedBy       *User               `json:"assigned_by,omitempty" gorm:"foreignkey:AssignedByID"`
 	Creator          *User               `json:"creator" gorm:"-"` // Compatibility field - populated manually
 	IncomingDocument *IncomingDocument   `json:"incoming_document" gorm:"foreignkey:IncomingDocumentID"`
 	IncomingFile     *IncomingDocument   `json:"incoming_file" gorm:"foreignkey:IncomingDocumentID"` // Compatibility field
 	Comments         []Comment           `json:"comments" gorm:"foreignkey:TaskID"`
 	StatusHistory    []TaskStatusHistory `json:"status_history" gorm:"foreignkey:TaskID"`
+	Template         *TaskTemplate       `json:"template,omitempty" gorm:"foreignkey:TemplateID"`
+	Subtasks         []Task              `json:"subtasks,omitempty" gorm:"foreignkey:ParentTaskID"`
+	ChecklistItems   []TaskChecklistItem `json:"checklist_items,omitempty" gorm:"foreignkey:TaskID"`
 }
 
 // Status constants
@@ -40,8 +57,73 @@ const (
 	StatusReview     = "Xem xét"
 	StatusCompleted  = "Hoàn thành"
 	StatusNotStarted = "Chưa bắt đầu"
+	StatusOnHold     = "Tạm dừng" // Waiting on an external party; the deadline clock is paused
 )
 
+// taskStatusTransitions lists the statuses a task may move to from each status
+var taskStatusTransitions = map[string][]string{
+	StatusReceived:   {StatusNotStarted, StatusProcessing},
+	StatusNotStarted: {StatusReceived, StatusProcessing},
+	StatusProcessing: {StatusReview, StatusCompleted},
+	StatusReview:     {StatusProcessing, StatusCompleted},
+	StatusCompleted:  {StatusProcessing},
+	StatusOnHold:     {}, // Left only through resuming, which restores the previous status
+}
+
+// IsValidTaskStatus reports whether the status is one of the known task statuses
+func IsValidTaskStatus(status string) bool {
+	_, ok := taskStatusTransitions[status]
+	return ok
+}
+
+// CanTransitionTo reports whether the task may move from its current status to the given one
+func (t *Task) CanTransitionTo(status string) bool {
+	if t.Status == status {
+		return true
+	}
+	for _, next := range taskStatusTransitions[t.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// CanBePutOnHold reports whether the task is in a status that may be paused
+func (t *Task) CanBePutOnHold() bool {
+	return t.Status != StatusCompleted && t.Status != StatusOnHold
+}
+
+// OverdueTaskCondition returns a SQL condition matching tasks that are overdue at the given time.
+// Tasks on hold are judged at the moment they were put on hold, since their clock is paused.
+func OverdueTaskCondition(now time.Time) (string, []interface{}) {
+	return "(status <> ? AND deadline IS NOT NULL AND ((status = ? AND deadline < hold_started_at) OR (status <> ? AND deadline < ?)))",
+		[]interface{}{StatusCompleted, StatusOnHold, StatusOnHold, now}
+}
+
+// Acceptance status constants
+const (
+	AcceptancePending  = "pending"
+	AcceptanceAccepted = "accepted"
+	AcceptanceDeclined = "declined"
+)
+
+// MarkAssigned records a new assignment of the current assignee made by assignerID.
+// The assignee has to accept it, unless they assigned the task to themselves.
+func (t *Task) MarkAssigned(assignerID uint) {
+	now := time.Now()
+	t.AssignedByID = &assignerID
+	t.AssignedAt = &now
+	t.DeclineReason = ""
+	if t.AssignedToID != nil && *t.AssignedToID == assignerID {
+		t.AcceptanceStatus = AcceptanceAccepted
+		t.AcceptedAt = &now
+	} else {
+		t.AcceptanceStatus = AcceptancePending
+		t.AcceptedAt = nil
+	}
+}
+
 // Task type constants
 const (
 	TaskTypeDocumentLinked = "document_linked"
@@ -56,18 +138,11 @@ const (
 	DeadlineTypeYearly    = "yearly"
 )
 
-type Comment struct {
-	gorm.Model
-	TaskID  uint   `json:"task_id" gorm:"not null"`
-	UserID  uint   `json:"user_id" gorm:"not null"`
-	Content string `json:"content" gorm:"not null"`
-	User    User   `json:"user" gorm:"foreignkey:UserID"`
-}
-
 // RemainingTimeInfo represents remaining time information
 type RemainingTimeInfo struct {
 	Text      string `json:"text"`
 	IsOverdue bool   `json:"is_overdue"`
+	IsPaused  bool   `json:"is_paused"`
 	Urgency   string `json:"urgency"`
 	Days      int    `json:"days"`
 	Hours     int    `json:"hours"`
@@ -87,7 +162,23 @@ func (t *Task) GetRemainingTime() RemainingTimeInfo {
 		}
 	}
 
+	// The clock stops while the task is on hold
+	paused := t.Status == StatusOnHold && t.HoldStartedAt != nil
 	now := time.Now()
+	if paused {
+		now = *t.HoldStartedAt
+	}
+
+	info := t.remainingTimeAt(now)
+	if paused {
+		info.IsPaused = true
+		info.Text = "Tạm dừng - " + info.Text
+	}
+	return info
+}
+
+// remainingTimeAt calculates the remaining time as seen at the given moment
+func (t *Task) remainingTimeAt(now time.Time) RemainingTimeInfo {
 	diff := t.Deadline.Sub(now)
 
 	if diff < 0 {
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// TaskChecklistItem is one step of a task's processing checklist (verify identity, visit the site, ...)
+type TaskChecklistItem struct {
+	gorm.Model
+	TaskID      uint       `json:"task_id" gorm:"not null;index"`
+	Title       string     `json:"title" gorm:"not null"`
+	Position    int        `json:"position"`
+	IsRequired  bool       `json:"is_required"` // required items must be checked before review or completion
+	IsChecked   bool       `json:"is_checked"`
+	CheckedByID *uint      `json:"checked_by_id"`
+	CheckedAt   *time.Time `json:"checked_at"`
+
+	// Relations
+	CheckedBy *User `json:"checked_by" gorm:"foreignkey:CheckedByID"`
+}
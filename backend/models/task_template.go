@@ -0,0 +1,121 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// TaskTemplate describes a kind of work that is created repeatedly, e.g. household registration checks.
+// Description and ProcessingNotes may contain placeholders written as {name}.
+type TaskTemplate struct {
+	gorm.Model
+	Name               string `json:"name" gorm:"not null"` // unique among templates not deleted, see migration 010
+	Description        string `json:"description" gorm:"not null"`
+	ProcessingNotes    string `json:"processing_notes"`
+	TaskType           string `json:"task_type"`                               // empty means decided by the task (linked or independent)
+	DeadlineType       string `json:"deadline_type" gorm:"default:'specific'"` // "specific", "monthly", "quarterly", "yearly"
+	DeadlineOffsetDays int    `json:"deadline_offset_days"`                    // used by "specific" deadlines, 0 means no default deadline
+	AssigneeRole       string `json:"assignee_role"`                           // role of the default assignee, empty to require an explicit one
+	IsActive           bool   `json:"is_active"`
+	CreatedByID        uint   `json:"created_by_id" gorm:"not null"`
+
+	// Relations
+	CreatedBy      *User                       `json:"created_by" gorm:"foreignkey:CreatedByID"`
+	ChecklistItems []TaskTemplateChecklistItem `json:"checklist_items" gorm:"foreignkey:TemplateID"`
+	Subtasks       []TaskTemplateSubtask       `json:"subtasks" gorm:"foreignkey:TemplateID"`
+}
+
+// TaskTemplateChecklistItem is a checklist step copied to every task created from the template
+type TaskTemplateChecklistItem struct {
+	gorm.Model
+	TemplateID uint   `json:"template_id" gorm:"not null;index"`
+	Title      string `json:"title" gorm:"not null"`
+	IsRequired bool   `json:"is_required"`
+	Position   int    `json:"position"`
+}
+
+// TaskTemplateSubtask is a child task created together with a task from the template
+type TaskTemplateSubtask struct {
+	gorm.Model
+	TemplateID         uint   `json:"template_id" gorm:"not null;index"`
+	Description        string `json:"description" gorm:"not null"`
+	DeadlineOffsetDays int    `json:"deadline_offset_days"` // 0 inherits the parent deadline
+	AssigneeRole       string `json:"assignee_role"`        // empty assigns the subtask to the parent assignee
+	Position           int    `json:"position"`
+}
+
+var templatePlaceholderPattern = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// TemplatePlaceholders returns the distinct placeholder names used in the given texts
+func TemplatePlaceholders(texts ...string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, text := range texts {
+		for _, match := range templatePlaceholderPattern.FindAllStringSubmatch(text, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				names = append(names, match[1])
+			}
+		}
+	}
+	return names
+}
+
+// RenderTemplateText replaces {name} placeholders with the given values and returns
+// the names that had no value. Unknown placeholders are left untouched.
+func RenderTemplateText(text string, values map[string]string) (string, []string) {
+	var missing []string
+	rendered := templatePlaceholderPattern.ReplaceAllStringFunc(text, func(match string) string {
+		name := strings.Trim(match, "{}")
+		if value, ok := values[name]; ok {
+			return value
+		}
+		missing = append(missing, name)
+		return match
+	})
+	return rendered, missing
+}
+
+// DefaultDeadline computes the deadline of a task created from the template at the given time.
+// Periodic deadline types end with their period; specific deadlines use the day offset.
+func (t *TaskTemplate) DefaultDeadline(from time.Time) *time.Time {
+	year, month, _ := from.Date()
+	loc := from.Location()
+
+	var deadline time.Time
+	switch t.DeadlineType {
+	case DeadlineTypeMonthly:
+		deadline = time.Date(year, month+1, 1, 0, 0, 0, 0, loc)
+	case DeadlineTypeQuarterly:
+		quarterEnd := ((int(month)-1)/3 + 1) * 3
+		deadline = time.Date(year, time.Month(quarterEnd)+1, 1, 0, 0, 0, 0, loc)
+	case DeadlineTypeYearly:
+		deadline = time.Date(year+1, time.January, 1, 0, 0, 0, 0, loc)
+	default:
+		if t.DeadlineOffsetDays <= 0 {
+			return nil
+		}
+		deadline = from.AddDate(0, 0, t.DeadlineOffsetDays)
+		return &deadline
+	}
+
+	// End of the last day of the period
+	deadline = deadline.Add(-time.Second)
+	return &deadline
+}
+
+// DefaultDeadline computes the subtask deadline relative to the parent's creation time,
+// falling back to the parent deadline when no offset is set
+func (s *TaskTemplateSubtask) DefaultDeadline(from time.Time, parentDeadline *time.Time) *time.Time {
+	if s.DeadlineOffsetDays <= 0 {
+		return parentDeadline
+	}
+	deadline := from.AddDate(0, 0, s.DeadlineOffsetDays)
+	if parentDeadline != nil && deadline.After(*parentDeadline) {
+		return parentDeadline
+	}
+	return &deadline
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// UserAbsence records a period during which a user cannot take new work (leave, training, business trip)
+type UserAbsence struct {
+	gorm.Model
+	UserID      uint      `json:"user_id" gorm:"not null;index"`
+	StartDate   time.Time `json:"start_date" gorm:"not null"`
+	EndDate     time.Time `json:"end_date" gorm:"not null"`
+	Reason      string    `json:"reason"`
+	CreatedByID uint      `json:"created_by_id" gorm:"not null"`
+
+	// Relations
+	User      User `json:"user" gorm:"foreignkey:UserID"`
+	CreatedBy User `json:"created_by" gorm:"foreignkey:CreatedByID"`
+}
+
+// IsActiveAt reports whether the absence covers the given moment
+func (a *UserAbsence) IsActiveAt(t time.Time) bool {
+	return !t.Before(a.StartDate) && !t.After(a.EndDate)
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// UserNotification is a message for a single user about a change to something they watch
+type UserNotification struct {
+	ID         uint       `json:"id" gorm:"primary_key"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	EntityType string     `json:"entity_type" gorm:"not null"` // Same values as Watcher.EntityType
+	EntityID   uint       `json:"entity_id" gorm:"not null"`
+	Event      string     `json:"event" gorm:"not null"`
+	Message    string     `json:"message" gorm:"not null"`
+	ActorID    *uint      `json:"actor_id"`
+	IsRead     bool       `json:"is_read" gorm:"default:false"`
+	ReadAt     *time.Time `json:"read_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// Relations
+	Actor *User `json:"actor,omitempty" gorm:"foreignkey:ActorID"`
+}
+
+// User notification events
+const (
+	NotificationEventStatusChanged   = "status_changed"
+	NotificationEventComment         = "comment"
+	NotificationEventDeadlineChanged = "deadline_changed"
+	NotificationEventMention         = "mention"
+	NotificationEventDeclined        = "declined" // An assignee handed a task back
+)
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// versioned is implemented by models whose version is exposed as an ETag to detect concurrent edits
+type versioned interface {
+	versioned()
+}
+
+func (*IncomingDocument) versioned() {}
+func (*OutgoingDocument) versioned() {}
+func (*Task) versioned() {}
+
+// RegisterVersioning makes every update of a versioned model increment its version in SQL,
+// "version = version + 1", rather than writing the loaded version plus one: two writers that loaded
+// the same row would otherwise both store the same next version and one change would pass
+// unnoticed. Save and Updates both go through it; UpdateColumn, which skips hooks, does not.
+func RegisterVersioning(db *gorm.DB) {
+	db.Callback().Create().Before("gorm:create").Register("models:initial_version", initialVersionCallback)
+	db.Callback().Update().Before("gorm:update").Register("models:increment_version", incrementVersionCallback)
+	db.Callback().Update().After("gorm:update").Register("models:reload_version", reloadVersionCallback)
+}
+
+func isVersioned(scope *gorm.Scope) bool {
+	if _, ok := scope.Value.(versioned); !ok || scope.HasError() {
+		return false
+	}
+	_, updateColumn := scope.Get("gorm:update_column")
+	return !updateColumn
+}
+
+func initialVersionCallback(scope *gorm.Scope) {
+	if _, ok := scope.Value.(versioned); !ok || scope.HasError() {
+		return
+	}
+	if field, ok := scope.FieldByName("Version"); ok && field.IsBlank {
+		scope.Err(field.Set(1))
+	}
+}
+
+func incrementVersionCallback(scope *gorm.Scope) {
+	if !isVersioned(scope) {
+		return
+	}
+	var updates map[string]interface{}
+	if attrs, ok := scope.InstanceGet("gorm:update_attrs"); ok {
+		updates = attrs.(map[string]interface{})
+	} else {
+		// Save writes every field; list them the way gorm's update callback does, so the
+		// version can go in as an expression
+		updates = map[string]interface{}{}
+		for _, field := range scope.Fields() {
+			if field.IsPrimaryKey || !field.IsNormal || field.IsIgnored || (field.Name == "CreatedAt" && field.IsBlank) {
+				continue
+			}
+			if field.IsForeignKey && field.IsBlank && field.HasDefaultValue {
+				continue
+			}
+			updates[field.DBName] = field.Field.Interface()
+		}
+	}
+	updates["version"] = gorm.Expr("version + 1")
+	scope.InstanceSet("gorm:update_attrs", updates)
+}
+
+// reloadVersionCallback reads the new version back into the model, still inside the update's
+// transaction, so handlers answer with the ETag that was stored
+func reloadVersionCallback(scope *gorm.Scope) {
+	if !isVersioned(scope) || scope.PrimaryKeyZero() {
+		return
+	}
+	field, ok := scope.FieldByName("Version")
+	if !ok {
+		return
+	}
+	var current struct{ Version uint }
+	if err := scope.NewDB().Table(scope.TableName()).Select("version").
+		Where("id = ?", scope.PrimaryKeyValue()).Scan(&current).Error; err != nil {
+		scope.Err(err)
+		return
+	}
+	scope.Err(field.Set(current.Version))
+}
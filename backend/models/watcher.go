@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// Watcher subscribes a user to changes of a task or an incoming document
+type Watcher struct {
+	ID         uint      `json:"id" gorm:"primary_key"`
+	UserID     uint      `json:"user_id" gorm:"not null;unique_index:idx_watchers_user_entity"`
+	EntityType string    `json:"entity_type" gorm:"not null;unique_index:idx_watchers_user_entity;index:idx_watchers_entity"` // "task", "incoming_document"
+	EntityID   uint      `json:"entity_id" gorm:"not null;unique_index:idx_watchers_user_entity;index:idx_watchers_entity"`
+	AutoAdded  bool      `json:"auto_added" gorm:"default:false"` // Added as creator or assignee rather than by the user
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Relations
+	User User `json:"user" gorm:"foreignkey:UserID"`
+}
+
+// Watched entity types
+const (
+	WatchEntityTask             = "task"
+	WatchEntityIncomingDocument = "incoming_document"
+)
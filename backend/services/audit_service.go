@@ -63,6 +63,26 @@ func (s *AuditService) LogActivity(c *gin.Context, action models.AuditAction, en
 	return s.db.Create(auditLog).Error
 }
 
+// LogSystemActivity records an action a background job took on behalf of a user, outside any request
+func (s *AuditService) LogSystemActivity(userID uint, action models.AuditAction, entityType models.AuditEntityType, entityID uint, description string, metadata interface{}) error {
+	auditLog := &models.AuditLog{
+		Action:      action,
+		EntityType:  entityType,
+		EntityID:    entityID,
+		UserID:      userID,
+		UserAgent:   "system",
+		Description: description,
+		Success:     true,
+		Timestamp:   time.Now(),
+	}
+	if metadata != nil {
+		if err := auditLog.SetMetadata(metadata); err != nil {
+			return fmt.Errorf("failed to set metadata: %v", err)
+		}
+	}
+	return s.db.Create(auditLog).Error
+}
+
 // LogFailedActivity creates an audit log entry for failed operations
 func (s *AuditService) LogFailedActivity(c *gin.Context, action models.AuditAction, entityType models.AuditEntityType, entityID uint, description string, errorMessage string, metadata interface{}) error {
 	userID, exists := c.Get("user_id")
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"ai-code-agent-backend/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ScopeVisibleIncomingDocuments limits a query on incoming_documents to the documents the user may
+// see: unclassified ones, ones they created or process, and ones they were cleared for
+func ScopeVisibleIncomingDocuments(query *gorm.DB, userID uint) *gorm.DB {
+	return query.Where(`incoming_documents.secrecy_level = ? OR incoming_documents.created_by_id = ? OR incoming_documents.processor_id = ?
+		OR incoming_documents.id IN (SELECT entity_id FROM document_access_grants WHERE entity_type = ? AND user_id = ?)`,
+		models.SecrecyNone, userID, userID, models.AccessEntityIncomingDocument, userID)
+}
+
+// ScopeVisibleOutgoingDocuments is ScopeVisibleIncomingDocuments for outgoing documents, where the
+// drafter and the approvers of its chain work on the document
+func ScopeVisibleOutgoingDocuments(query *gorm.DB, userID uint) *gorm.DB {
+	return query.Where(`outgoing_documents.secrecy_level = ? OR outgoing_documents.created_by_id = ?
+		OR outgoing_documents.drafter_id = ? OR outgoing_documents.approver_id = ?
+		OR outgoing_documents.id IN (SELECT outgoing_document_id FROM outgoing_approval_steps WHERE approver_id = ?)
+		OR outgoing_documents.id IN (SELECT entity_id FROM document_access_grants WHERE entity_type = ? AND user_id = ?)`,
+		models.SecrecyNone, userID, userID, userID, userID, models.AccessEntityOutgoingDocument, userID)
+}
+
+// ScopeVisibleTasks limits a query on tasks to the ones the user's role lets them see. Secretaries
+// and admins see every task; leaders see the tasks assigned to, created by or watched by them;
+// officers see the tasks assigned to them and the ones they kept watching after handing them on.
+func ScopeVisibleTasks(query *gorm.DB, userID uint, role string) *gorm.DB {
+	switch role {
+	case models.RoleSecretary, models.RoleAdmin:
+		return query
+	case models.RoleTeamLeader, models.RoleDeputy:
+		return query.Where("tasks.assigned_to_id = ? OR tasks.created_by_id = ? OR tasks.id IN (SELECT entity_id FROM watchers WHERE user_id = ? AND entity_type = ?)",
+			userID, userID, userID, models.WatchEntityTask)
+	default:
+		return query.Where("tasks.assigned_to_id = ? OR tasks.id IN (SELECT entity_id FROM watchers WHERE user_id = ? AND entity_type = ?)",
+			userID, userID, models.WatchEntityTask)
+	}
+}
+
+// hasAccessGrant reports whether the user was cleared for the document
+func hasAccessGrant(db *gorm.DB, entityType string, entityID, userID uint) bool {
+	var count int
+	db.Model(&models.DocumentAccessGrant{}).
+		Where("entity_type = ? AND entity_id = ? AND user_id = ?", entityType, entityID, userID).
+		Count(&count)
+	return count > 0
+}
+
+// CanAccessIncomingDocument reports whether the user may see the document
+func CanAccessIncomingDocument(db *gorm.DB, document *models.IncomingDocument, userID uint) bool {
+	if !models.IsClassified(document.SecrecyLevel) || document.CreatedByID == userID ||
+		(document.ProcessorID != nil && *document.ProcessorID == userID) {
+		return true
+	}
+	return hasAccessGrant(db, models.AccessEntityIncomingDocument, document.ID, userID)
+}
+
+// CanAccessOutgoingDocument reports whether the user may see the document
+func CanAccessOutgoingDocument(db *gorm.DB, document *models.OutgoingDocument, userID uint) bool {
+	if !models.IsClassified(document.SecrecyLevel) || document.CreatedByID == userID ||
+		document.DrafterID == userID || document.ApproverID == userID {
+		return true
+	}
+	var steps int
+	db.Model(&models.OutgoingApprovalStep{}).Where("outgoing_document_id = ? AND approver_id = ?", document.ID, userID).Count(&steps)
+	return steps > 0 || hasAccessGrant(db, models.AccessEntityOutgoingDocument, document.ID, userID)
+}
+
+// ClassifiedDocument identifies the classified document a stored file belongs to
+type ClassifiedDocument struct {
+	EntityType   models.AuditEntityType
+	EntityID     uint
+	SecrecyLevel string
+	Allowed      bool // Whether the user asking may see it
+}
+
+// ClassifiedDocumentOf finds the classified document behind a file of the given document type,
+// following task reports and comment attachments to the incoming document of their task.
+// It returns nil when the file does not belong to a classified document.
+func ClassifiedDocumentOf(db *gorm.DB, documentType string, documentID, userID uint) *ClassifiedDocument {
+	switch documentType {
+	case "incoming":
+		var document models.IncomingDocument
+		if err := db.First(&document, documentID).Error; err != nil || !models.IsClassified(document.SecrecyLevel) {
+			return nil
+		}
+		return &ClassifiedDocument{models.AuditEntityIncomingDocument, document.ID, document.SecrecyLevel, CanAccessIncomingDocument(db, &document, userID)}
+	case "outgoing":
+		var document models.OutgoingDocument
+		if err := db.First(&document, documentID).Error; err != nil || !models.IsClassified(document.SecrecyLevel) {
+			return nil
+		}
+		return &ClassifiedDocument{models.AuditEntityOutgoingDocument, document.ID, document.SecrecyLevel, CanAccessOutgoingDocument(db, &document, userID)}
+	case "task_report":
+		var task models.Task
+		if err := db.First(&task, documentID).Error; err != nil || task.IncomingDocumentID == nil {
+			return nil
+		}
+		return ClassifiedDocumentOf(db, "incoming", *task.IncomingDocumentID, userID)
+	case "comment":
+		var comment models.Comment
+		if err := db.First(&comment, documentID).Error; err != nil {
+			return nil
+		}
+		return ClassifiedDocumentOf(db, "task_report", comment.TaskID, userID)
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"ai-code-agent-backend/models"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// A thread stops growing after this many documents; long chains of citations would otherwise
+// pull in half the register
+const maxThreadDocuments = 100
+
+// Outgoing documents count as replies once they are issued
+var issuedOutgoingStatuses = []string{models.OutgoingStatusIssued, models.OutgoingStatusSent}
+
+type threadNode struct {
+	Type string
+	ID   uint
+}
+
+// CorrespondenceThreadOf collects the documents connected to a document through relations in
+// either direction, and through tasks whose results are outgoing documents. Documents the user
+// may not see are left out and the thread does not continue through them.
+func CorrespondenceThreadOf(db *gorm.DB, documentType string, documentID, userID uint) (*models.CorrespondenceThread, error) {
+	thread := &models.CorrespondenceThread{Documents: []models.CorrespondenceDocument{}, Links: []models.CorrespondenceLink{}}
+	start := threadNode{documentType, documentID}
+	visited := map[threadNode]bool{start: true}
+	recorded := make(map[string]bool)
+
+	for frontier := []threadNode{start}; len(frontier) > 0; {
+		links, err := threadLinksOf(db, frontier)
+		if err != nil {
+			return nil, err
+		}
+
+		var candidates []threadNode
+		queued := make(map[threadNode]bool)
+		for _, link := range links {
+			for _, node := range []threadNode{{link.SourceType, link.SourceID}, {link.TargetType, link.TargetID}} {
+				if !visited[node] && !queued[node] {
+					queued[node] = true
+					candidates = append(candidates, node)
+				}
+			}
+		}
+		visible, err := visibleThreadNodes(db, candidates, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		frontier = nil
+		for _, node := range candidates {
+			if !visible[node] {
+				continue
+			}
+			if len(visited) >= maxThreadDocuments {
+				thread.Truncated = true
+				continue
+			}
+			visited[node] = true
+			frontier = append(frontier, node)
+		}
+		for _, link := range links {
+			key := correspondenceLinkKey(link)
+			if recorded[key] || !visited[threadNode{link.SourceType, link.SourceID}] || !visited[threadNode{link.TargetType, link.TargetID}] {
+				continue
+			}
+			recorded[key] = true
+			thread.Links = append(thread.Links, link)
+		}
+	}
+
+	nodes := make([]threadNode, 0, len(visited))
+	for node := range visited {
+		nodes = append(nodes, node)
+	}
+	incomingIDs, outgoingIDs := splitThreadNodes(nodes)
+	var incoming []models.IncomingDocument
+	if err := db.Preload("IssuingUnit").Where("id IN (?)", incomingIDs).Find(&incoming).Error; err != nil {
+		return nil, err
+	}
+	for _, document := range incoming {
+		thread.Documents = append(thread.Documents, models.CorrespondenceDocument{
+			DocumentType: models.RelationDocumentIncoming,
+			ID:           document.ID,
+			Number:       document.OriginalNumber,
+			Summary:      document.Summary,
+			Date:         document.ArrivalDate,
+			Status:       document.Status,
+			IssuingUnit:  document.IssuingUnit.Name,
+		})
+	}
+	var outgoing []models.OutgoingDocument
+	if err := db.Preload("IssuingUnit").Where("id IN (?)", outgoingIDs).Find(&outgoing).Error; err != nil {
+		return nil, err
+	}
+	for _, document := range outgoing {
+		thread.Documents = append(thread.Documents, models.CorrespondenceDocument{
+			DocumentType: models.RelationDocumentOutgoing,
+			ID:           document.ID,
+			Number:       document.DocumentNumber,
+			Summary:      document.Summary,
+			Date:         document.IssueDate,
+			Status:       document.Status,
+			IssuingUnit:  document.IssuingUnit.Name,
+		})
+	}
+
+	sort.Slice(thread.Documents, func(i, j int) bool {
+		a, b := thread.Documents[i], thread.Documents[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.DocumentType != b.DocumentType {
+			return a.DocumentType == models.RelationDocumentIncoming
+		}
+		return a.ID < b.ID
+	})
+	return thread, nil
+}
+
+// threadLinksOf returns the relations and task results touching any of the documents
+func threadLinksOf(db *gorm.DB, nodes []threadNode) ([]models.CorrespondenceLink, error) {
+	incomingIDs, outgoingIDs := splitThreadNodes(nodes)
+
+	var relations []models.DocumentRelation
+	if err := db.Where(`(source_type = ? AND source_id IN (?)) OR (source_type = ? AND source_id IN (?))
+		OR (target_type = ? AND target_id IN (?)) OR (target_type = ? AND target_id IN (?))`,
+		models.RelationDocumentIncoming, incomingIDs, models.RelationDocumentOutgoing, outgoingIDs,
+		models.RelationDocumentIncoming, incomingIDs, models.RelationDocumentOutgoing, outgoingIDs).
+		Order("id").Find(&relations).Error; err != nil {
+		return nil, err
+	}
+	links := make([]models.CorrespondenceLink, 0, len(relations))
+	for _, relation := range relations {
+		links = append(links, models.CorrespondenceLink{
+			ID:           relation.ID,
+			SourceType:   relation.SourceType,
+			SourceID:     relation.SourceID,
+			TargetType:   relation.TargetType,
+			TargetID:     relation.TargetID,
+			RelationType: relation.RelationType,
+			Notes:        relation.Notes,
+		})
+	}
+
+	var results []struct {
+		TaskID             uint
+		IncomingDocumentID uint
+		OutgoingDocumentID uint
+	}
+	if err := db.Table("task_outgoing_documents").
+		Select("task_outgoing_documents.task_id, tasks.incoming_document_id, task_outgoing_documents.outgoing_document_id").
+		Joins("JOIN tasks ON tasks.id = task_outgoing_documents.task_id AND tasks.deleted_at IS NULL").
+		Where("task_outgoing_documents.deleted_at IS NULL AND task_outgoing_documents.relationship_type = ? AND tasks.incoming_document_id IS NOT NULL", models.RelationshipTypeResult).
+		Where("tasks.incoming_document_id IN (?) OR task_outgoing_documents.outgoing_document_id IN (?)", incomingIDs, outgoingIDs).
+		Order("task_outgoing_documents.id").Scan(&results).Error; err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		taskID := result.TaskID
+		links = append(links, models.CorrespondenceLink{
+			SourceType:   models.RelationDocumentOutgoing,
+			SourceID:     result.OutgoingDocumentID,
+			TargetType:   models.RelationDocumentIncoming,
+			TargetID:     result.IncomingDocumentID,
+			RelationType: models.DocumentRelationTask,
+			TaskID:       &taskID,
+		})
+	}
+	return links, nil
+}
+
+// visibleThreadNodes keeps the documents that exist and the user may see
+func visibleThreadNodes(db *gorm.DB, nodes []threadNode, userID uint) (map[threadNode]bool, error) {
+	visible := make(map[threadNode]bool, len(nodes))
+	if len(nodes) == 0 {
+		return visible, nil
+	}
+	incomingIDs, outgoingIDs := splitThreadNodes(nodes)
+
+	var ids []uint
+	if err := ScopeVisibleIncomingDocuments(db.Model(&models.IncomingDocument{}), userID).
+		Where("incoming_documents.id IN (?)", incomingIDs).Pluck("incoming_documents.id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		visible[threadNode{models.RelationDocumentIncoming, id}] = true
+	}
+	ids = nil
+	if err := ScopeVisibleOutgoingDocuments(db.Model(&models.OutgoingDocument{}), userID).
+		Where("outgoing_documents.id IN (?)", outgoingIDs).Pluck("outgoing_documents.id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		visible[threadNode{models.RelationDocumentOutgoing, id}] = true
+	}
+	return visible, nil
+}
+
+// splitThreadNodes returns the incoming and outgoing document IDs among the nodes. Both lists
+// hold at least the ID 0, which matches nothing, so they can always be used with IN.
+func splitThreadNodes(nodes []threadNode) (incomingIDs, outgoingIDs []uint) {
+	incomingIDs, outgoingIDs = []uint{0}, []uint{0}
+	for _, node := range nodes {
+		if node.Type == models.RelationDocumentIncoming {
+			incomingIDs = append(incomingIDs, node.ID)
+		} else {
+			outgoingIDs = append(outgoingIDs, node.ID)
+		}
+	}
+	return incomingIDs, outgoingIDs
+}
+
+func correspondenceLinkKey(link models.CorrespondenceLink) string {
+	if link.TaskID != nil {
+		return fmt.Sprintf("task:%d:%d", *link.TaskID, link.SourceID)
+	}
+	return fmt.Sprintf("relation:%d", link.ID)
+}
+
+// ResponseTimeEntry is one incoming document of a response time report
+type ResponseTimeEntry struct {
+	DocumentID     uint                 `json:"document_id"`
+	ArrivalNumber  int                  `json:"arrival_number"`
+	OriginalNumber string               `json:"original_number"`
+	Summary        string               `json:"summary"`
+	ArrivalDate    time.Time            `json:"arrival_date"`
+	ResponseTime   *models.ResponseTime `json:"response_time"` // Nil while no reply was issued
+}
+
+// ResponseTimeSummary aggregates the answered documents of a report, in days
+type ResponseTimeSummary struct {
+	Total       int     `json:"total"`
+	Answered    int     `json:"answered"`
+	Unanswered  int     `json:"unanswered"`
+	AverageDays float64 `json:"average_days"`
+	MedianDays  float64 `json:"median_days"`
+	MaxDays     int     `json:"max_days"`
+}
+
+// ResponseTimes finds for each incoming document selected by query its first issued reply, the
+// issued or sent outgoing document replying to it with the earliest issue date
+func ResponseTimes(query *gorm.DB) ([]ResponseTimeEntry, error) {
+	var rows []struct {
+		ID             uint
+		ArrivalNumber  int
+		OriginalNumber string
+		Summary        string
+		ArrivalDate    time.Time
+		ReplyID        *uint
+		ReplyNumber    *string
+		ReplyIssueDate *time.Time
+	}
+	if err := query.Select(`incoming_documents.id, incoming_documents.arrival_number, incoming_documents.original_number,
+		incoming_documents.summary, incoming_documents.arrival_date,
+		reply.id AS reply_id, reply.document_number AS reply_number, reply.issue_date AS reply_issue_date`).
+		Joins(`LEFT JOIN LATERAL (SELECT outgoing_documents.id, outgoing_documents.document_number, outgoing_documents.issue_date
+			FROM document_relations JOIN outgoing_documents ON outgoing_documents.id = document_relations.source_id
+			WHERE document_relations.relation_type = ? AND document_relations.source_type = ?
+			AND document_relations.target_type = ? AND document_relations.target_id = incoming_documents.id
+			AND outgoing_documents.deleted_at IS NULL AND outgoing_documents.status IN (?)
+			ORDER BY outgoing_documents.issue_date, outgoing_documents.id LIMIT 1) reply ON true`,
+			models.DocumentRelationRepliesTo, models.RelationDocumentOutgoing, models.RelationDocumentIncoming, issuedOutgoingStatuses).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	entries := make([]ResponseTimeEntry, 0, len(rows))
+	for _, row := range rows {
+		entry := ResponseTimeEntry{
+			DocumentID:     row.ID,
+			ArrivalNumber:  row.ArrivalNumber,
+			OriginalNumber: row.OriginalNumber,
+			Summary:        row.Summary,
+			ArrivalDate:    row.ArrivalDate,
+		}
+		if row.ReplyID != nil && row.ReplyIssueDate != nil {
+			entry.ResponseTime = &models.ResponseTime{
+				ReplyID:        *row.ReplyID,
+				ArrivalDate:    row.ArrivalDate,
+				ReplyIssueDate: *row.ReplyIssueDate,
+				Days:           daysBetween(row.ArrivalDate, *row.ReplyIssueDate),
+			}
+			if row.ReplyNumber != nil {
+				entry.ResponseTime.ReplyNumber = *row.ReplyNumber
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ResponseTimeOf returns how long the incoming document waited for its reply, or nil if it has none yet
+func ResponseTimeOf(db *gorm.DB, documentID uint) (*models.ResponseTime, error) {
+	entries, err := ResponseTimes(db.Model(&models.IncomingDocument{}).Where("incoming_documents.id = ?", documentID))
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return entries[0].ResponseTime, nil
+}
+
+// SummarizeResponseTimes computes the figures shown above a response time report
+func SummarizeResponseTimes(entries []ResponseTimeEntry) ResponseTimeSummary {
+	summary := ResponseTimeSummary{Total: len(entries)}
+	var days []int
+	for _, entry := range entries {
+		if entry.ResponseTime == nil {
+			summary.Unanswered++
+			continue
+		}
+		days = append(days, entry.ResponseTime.Days)
+	}
+	summary.Answered = len(days)
+	if len(days) == 0 {
+		return summary
+	}
+
+	sort.Ints(days)
+	total := 0
+	for _, value := range days {
+		total += value
+	}
+	summary.AverageDays = float64(total) / float64(len(days))
+	if middle := len(days) / 2; len(days)%2 == 1 {
+		summary.MedianDays = float64(days[middle])
+	} else {
+		summary.MedianDays = float64(days[middle-1]+days[middle]) / 2
+	}
+	summary.MaxDays = days[len(days)-1]
+	return summary
+}
+
+// daysBetween counts calendar days from one date to another; documents dated the same day give 0
+func daysBetween(from, to time.Time) int {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(end.Sub(start).Hours() / 24)
+}
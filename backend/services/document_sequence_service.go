@@ -0,0 +1,101 @@
+package services
+
+import (
+	"ai-code-agent-backend/models"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// LockSequence loads the counter of a register and locks it until the transaction ends.
+// A missing counter is created first; lastUsed reports the highest number already in use
+// so a new counter continues from existing records.
+func LockSequence(tx *gorm.DB, scope string, year int, book string, lastUsed func() (int, error)) (*models.DocumentSequence, error) {
+	var sequence models.DocumentSequence
+	find := func() error {
+		return tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("scope = ? AND year = ? AND register_book = ?", scope, year, book).
+			First(&sequence).Error
+	}
+
+	err := find()
+	if gorm.IsRecordNotFoundError(err) {
+		start := 0
+		if lastUsed != nil {
+			if start, err = lastUsed(); err != nil {
+				return nil, err
+			}
+		}
+		now := time.Now()
+		if err = tx.Exec(`INSERT INTO document_sequences (scope, year, register_book, last_value, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (scope, year, register_book) DO NOTHING`,
+			scope, year, book, start, now, now).Error; err != nil {
+			return nil, err
+		}
+		err = find()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sequence, nil
+}
+
+// NextSequenceValue reserves the next number of a register. Concurrent callers wait on the
+// counter row, so each gets a different number.
+func NextSequenceValue(tx *gorm.DB, scope string, year int, book string, lastUsed func() (int, error)) (int, error) {
+	sequence, err := LockSequence(tx, scope, year, book, lastUsed)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Model(sequence).Update("last_value", sequence.LastValue+1).Error; err != nil {
+		return 0, err
+	}
+	return sequence.LastValue, nil
+}
+
+// Placeholders understood by FormatDocumentNumber
+var numberTemplatePlaceholder = regexp.MustCompile(`\{([a-z_]+)(?::(\d))?\}`)
+
+// ValidateNumberTemplate checks that a numbering template contains {seq} and only known placeholders
+func ValidateNumberTemplate(template string) error {
+	hasSeq := false
+	for _, match := range numberTemplatePlaceholder.FindAllStringSubmatch(template, -1) {
+		switch match[1] {
+		case "seq":
+			hasSeq = true
+		case "type_code", "unit_code", "year":
+		default:
+			return fmt.Errorf("ký hiệu không hợp lệ trong mẫu số: {%s}", match[1])
+		}
+	}
+	if !hasSeq {
+		return fmt.Errorf("mẫu số phải chứa {seq}")
+	}
+	return nil
+}
+
+// FormatDocumentNumber fills a numbering template such as "{seq}/{type_code}-{unit_code}".
+// {seq} is padded to two digits unless a width is given, e.g. {seq:3}.
+func FormatDocumentNumber(template string, seq int, year int, typeCode, unitCode string) string {
+	return numberTemplatePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		match := numberTemplatePlaceholder.FindStringSubmatch(placeholder)
+		switch match[1] {
+		case "seq":
+			width := 2
+			if match[2] != "" {
+				width, _ = strconv.Atoi(match[2])
+			}
+			return fmt.Sprintf("%0*d", width, seq)
+		case "type_code":
+			return typeCode
+		case "unit_code":
+			return unitCode
+		case "year":
+			return strconv.Itoa(year)
+		}
+		return placeholder
+	})
+}
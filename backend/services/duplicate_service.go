@@ -0,0 +1,79 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// SummarySimilarityThreshold is the similarity above which two summaries are reported as likely duplicates
+const SummarySimilarityThreshold = 0.8
+
+// FoldText lowercases s, strips Vietnamese diacritics and collapses punctuation into single spaces,
+// so "Công văn số 12/CV-UBND" and "cong van so 12 cv ubnd" compare equal.
+func FoldText(s string) string {
+	var b strings.Builder
+	space := true
+	for _, r := range norm.NFD.String(strings.ToLower(s)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case r == 'đ':
+			r = 'd'
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			if !space {
+				b.WriteByte(' ')
+				space = true
+			}
+			continue
+		}
+		b.WriteRune(r)
+		space = false
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// NormalizeDocumentNumber folds a document number for comparison, ignoring case, accents,
+// spacing and separators
+func NormalizeDocumentNumber(number string) string {
+	return strings.ReplaceAll(FoldText(number), " ", "")
+}
+
+// SummarySimilarity returns the Dice coefficient of the character trigrams of two folded texts,
+// from 0 for nothing in common to 1 for the same text
+func SummarySimilarity(a, b string) float64 {
+	ta, tb := trigrams(FoldText(a)), trigrams(FoldText(b))
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for gram, countA := range ta {
+		if countB, ok := tb[gram]; ok {
+			if countA < countB {
+				shared += countA
+			} else {
+				shared += countB
+			}
+		}
+	}
+	return 2 * float64(shared) / float64(total(ta)+total(tb))
+}
+
+func trigrams(s string) map[string]int {
+	runes := []rune(" " + s + " ")
+	grams := make(map[string]int)
+	for i := 0; i+3 <= len(runes); i++ {
+		grams[string(runes[i:i+3])]++
+	}
+	return grams
+}
+
+func total(counts map[string]int) int {
+	sum := 0
+	for _, n := range counts {
+		sum += n
+	}
+	return sum
+}
@@ -0,0 +1,355 @@
+package services
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// MaxEmailSize bounds a single message taken in, attachments included
+const MaxEmailSize = 60 * 1024 * 1024
+
+// ParsedEmail is what the intake keeps of an RFC 822 message
+type ParsedEmail struct {
+	MessageID   string
+	From        *mail.Address
+	Subject     string
+	Date        time.Time
+	Text        string // First text/plain part, decoded to UTF-8
+	Attachments []EmailAttachment
+}
+
+// EmailAttachment is a decoded attachment of a message
+type EmailAttachment struct {
+	Filename string
+	Data     []byte
+}
+
+// EmailAlreadyImportedError is returned when a message has been taken in before
+type EmailAlreadyImportedError struct {
+	DocumentID uint
+}
+
+func (e *EmailAlreadyImportedError) Error() string {
+	return fmt.Sprintf("email đã được tiếp nhận thành văn bản đến #%d", e.DocumentID)
+}
+
+// headerDecoder decodes RFC 2047 encoded words in any charset x/text knows about,
+// Vietnamese senders still use windows-1258 now and then
+var headerDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("bảng mã không được hỗ trợ: %s", charset)
+	}
+	return encoding.NewDecoder().Reader(input), nil
+}
+
+// ParseEmail reads a message and its MIME parts. A message without Message-ID gets one derived
+// from its content, so the same file uploaded twice is still recognised.
+func ParseEmail(raw []byte) (*ParsedEmail, error) {
+	if len(raw) > MaxEmailSize {
+		return nil, fmt.Errorf("email quá lớn, tối đa %d MB", MaxEmailSize/(1024*1024))
+	}
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("email không hợp lệ: %v", err)
+	}
+
+	parsed := &ParsedEmail{
+		MessageID: strings.TrimSpace(message.Header.Get("Message-Id")),
+		Subject:   decodeHeader(message.Header.Get("Subject")),
+	}
+	if parsed.MessageID == "" {
+		parsed.MessageID = fmt.Sprintf("<%x@no-message-id>", sha256.Sum256(raw))
+	}
+	if from := message.Header.Get("From"); from != "" {
+		parser := mail.AddressParser{WordDecoder: headerDecoder}
+		if addresses, err := parser.ParseList(from); err == nil && len(addresses) > 0 {
+			parsed.From = addresses[0]
+		}
+	}
+	if date, err := message.Header.Date(); err == nil {
+		parsed.Date = date
+	}
+
+	if err := parsed.readPart(message.Header.Get("Content-Type"), message.Header.Get("Content-Disposition"),
+		message.Header.Get("Content-Transfer-Encoding"), message.Body, 0); err != nil {
+		return nil, fmt.Errorf("email không hợp lệ: %v", err)
+	}
+	return parsed, nil
+}
+
+func decodeHeader(value string) string {
+	if decoded, err := headerDecoder.DecodeHeader(value); err == nil {
+		value = decoded
+	}
+	return strings.TrimSpace(value)
+}
+
+// readPart walks the MIME tree, keeping the first plain text body and every attachment
+func (p *ParsedEmail) readPart(contentType, disposition, transferEncoding string, body io.Reader, depth int) error {
+	if depth > 10 {
+		return fmt.Errorf("cấu trúc MIME lồng nhau quá sâu")
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			// NextPart already undoes quoted-printable and drops the header when it does
+			if err := p.readPart(part.Header.Get("Content-Type"), part.Header.Get("Content-Disposition"),
+				part.Header.Get("Content-Transfer-Encoding"), part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(transferEncoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+
+	filename := ""
+	dispositionType, dispositionParams, _ := mime.ParseMediaType(disposition)
+	if name := dispositionParams["filename"]; name != "" {
+		filename = decodeHeader(name)
+	} else if name := params["name"]; name != "" {
+		filename = decodeHeader(name)
+	}
+
+	if filename != "" || dispositionType == "attachment" {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		if filename == "" {
+			filename = fmt.Sprintf("attachment-%d", len(p.Attachments)+1)
+		}
+		p.Attachments = append(p.Attachments, EmailAttachment{Filename: filename, Data: data})
+		return nil
+	}
+
+	if mediaType == "text/plain" && p.Text == "" {
+		if charset := params["charset"]; charset != "" && !strings.EqualFold(charset, "utf-8") && !strings.EqualFold(charset, "us-ascii") {
+			if decoded, err := charsetReader(charset, body); err == nil {
+				body = decoded
+			}
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		p.Text = strings.TrimSpace(strings.ToValidUTF8(string(data), ""))
+		return nil
+	}
+
+	_, err = io.Copy(io.Discard, body)
+	return err
+}
+
+// memoryFile lets an attachment held in memory go through FileService like an uploaded file
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error { return nil }
+
+// FindEmailDocument returns the document a message was already taken in as, discarded drafts included
+func FindEmailDocument(messageID string) (uint, bool) {
+	var document models.IncomingDocument
+	if err := database.DB.Unscoped().Select("id").Where("source_email_id = ?", messageID).First(&document).Error; err != nil {
+		return 0, false
+	}
+	return document.ID, true
+}
+
+// MatchIssuingUnitByEmail finds the unit whose configured addresses cover the sender, an exact
+// address winning over a domain
+func MatchIssuingUnitByEmail(address string) *uint {
+	address = strings.ToLower(strings.TrimSpace(address))
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return nil
+	}
+	domain := address[at:]
+
+	var units []models.IssuingUnit
+	database.DB.Where("is_active = ? AND emails <> ''", true).Order("id asc").Find(&units)
+
+	var domainMatch *uint
+	for i := range units {
+		for _, entry := range strings.Split(units[i].Emails, ",") {
+			entry = strings.ToLower(strings.TrimSpace(entry))
+			switch {
+			case entry == "":
+			case entry == address:
+				return &units[i].ID
+			case domainMatch == nil && (entry == domain || "@"+entry == domain):
+				domainMatch = &units[i].ID
+			}
+		}
+	}
+	return domainMatch
+}
+
+// ImportEmail creates a draft incoming document for a parsed message and stores its attachments
+// through FileService. Attachments FileService refuses are listed in the internal notes rather
+// than failing the whole message.
+func ImportEmail(email *ParsedEmail, userID uint) (*models.IncomingDocument, error) {
+	if documentID, found := FindEmailDocument(email.MessageID); found {
+		return nil, &EmailAlreadyImportedError{DocumentID: documentID}
+	}
+
+	now := time.Now()
+	document := models.IncomingDocument{
+		ArrivalDate:   now,
+		DocumentDate:  now,
+		Summary:       email.Subject,
+		Status:        models.IncomingStatusDraft,
+		SourceEmailID: email.MessageID,
+		CreatedByID:   userID,
+	}
+	if !email.Date.IsZero() {
+		document.DocumentDate = email.Date
+	}
+	if document.Summary == "" {
+		document.Summary = "(Không có tiêu đề)"
+	}
+
+	var notes []string
+	if email.From != nil {
+		sender := email.From.Address
+		if email.From.Name != "" {
+			sender = fmt.Sprintf("%s <%s>", email.From.Name, email.From.Address)
+		}
+		notes = append(notes, "Email từ: "+sender)
+		if unitID := MatchIssuingUnitByEmail(email.From.Address); unitID != nil {
+			document.IssuingUnitID = *unitID
+		}
+	}
+	if email.Text != "" {
+		notes = append(notes, truncateText(email.Text, 2000))
+	}
+	document.InternalNotes = strings.Join(notes, "\n\n")
+
+	// The draft and its attachments are stored together, so a failure leaves neither rows nor
+	// files behind
+	fileService := NewFileService()
+	var stored []*FileInfo
+	rollback := func(tx *gorm.DB) {
+		tx.Rollback()
+		for _, fileInfo := range stored {
+			fileService.RemoveStoredFile(fileInfo)
+		}
+	}
+
+	tx := database.DB.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	if err := tx.Create(&document).Error; err != nil {
+		tx.Rollback()
+		if documentID, found := FindEmailDocument(email.MessageID); found {
+			return nil, &EmailAlreadyImportedError{DocumentID: documentID}
+		}
+		return nil, fmt.Errorf("không thể tạo văn bản nháp: %v", err)
+	}
+
+	var skipped []string
+	for _, attachment := range email.Attachments {
+		file := memoryFile{bytes.NewReader(attachment.Data)}
+		header := &multipart.FileHeader{Filename: attachment.Filename, Size: int64(len(attachment.Data))}
+		if err := fileService.ValidateFile(file, header, DocumentUploadConfig); err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s (%v)", attachment.Filename, err))
+			continue
+		}
+		fileHash, err := fileService.HashFile(file)
+		if err != nil {
+			rollback(tx)
+			return nil, err
+		}
+
+		// Content seen before, including an earlier attachment of this message, is not stored twice
+		var existing FileInfo
+		if err := tx.Table("files").Where("file_hash = ? AND document_type = ? AND deleted_at IS NULL", fileHash, "incoming").
+			First(&existing).Error; err == nil {
+			if existing.DocumentID != document.ID {
+				skipped = append(skipped, fmt.Sprintf("%s (trùng file của văn bản đến #%d)", attachment.Filename, existing.DocumentID))
+				if document.DuplicateOfID == nil {
+					duplicateOf := existing.DocumentID
+					document.DuplicateOfID = &duplicateOf
+				}
+			}
+			continue
+		}
+
+		fileInfo, err := fileService.storeFile(tx, file, header, DocumentUploadConfig, userID, fileHash, "incoming", document.ID)
+		if err != nil {
+			rollback(tx)
+			return nil, err
+		}
+		stored = append(stored, fileInfo)
+		if document.FilePath == "" || (!strings.HasSuffix(strings.ToLower(document.FilePath), ".pdf") &&
+			strings.HasSuffix(strings.ToLower(fileInfo.FilePath), ".pdf")) {
+			document.FilePath = fileInfo.FilePath
+		}
+	}
+	if len(skipped) > 0 {
+		document.InternalNotes = strings.TrimSpace(document.InternalNotes + "\n\nFile đính kèm không lưu: " + strings.Join(skipped, "; "))
+	}
+
+	if err := tx.Save(&document).Error; err != nil {
+		rollback(tx)
+		return nil, fmt.Errorf("không thể lưu văn bản nháp: %v", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		for _, fileInfo := range stored {
+			fileService.RemoveStoredFile(fileInfo)
+		}
+		return nil, fmt.Errorf("không thể lưu văn bản nháp: %v", err)
+	}
+	for _, fileInfo := range stored {
+		fileService.AfterFileSaved(fileInfo)
+	}
+	return &document, nil
+}
+
+// truncateText cuts text to at most limit bytes without splitting a character
+func truncateText(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	text = text[:limit]
+	for !utf8.ValidString(text) {
+		text = text[:len(text)-1]
+	}
+	return text + "…"
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// useTestDatabase points database.DB at an empty SQLite database holding the tables email intake
+// writes to, and runs the test in a temporary folder so stored files land under its uploads
+func useTestDatabase(t *testing.T) {
+	dir := t.TempDir()
+	db, err := gorm.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	db.AutoMigrate(&models.IncomingDocument{}, &models.IssuingUnit{}, &models.FileText{}, &models.FileSignature{})
+	if err := db.Exec(`CREATE TABLE files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, original_name TEXT, file_name TEXT, file_path TEXT UNIQUE,
+		thumbnail_path TEXT, file_size INTEGER, mime_type TEXT, file_hash TEXT, uploaded_by INTEGER,
+		uploaded_at DATETIME, document_type TEXT, document_id INTEGER, access_level TEXT, deleted_at DATETIME)`).Error; err != nil {
+		t.Fatalf("create files table: %v", err)
+	}
+
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		db.Close()
+		os.Chdir(wd)
+	})
+}
+
+// testEmail is a message from the given Message-Id carrying a PDF attachment
+func testEmail(messageID string, pdf []byte) []byte {
+	return []byte(fmt.Sprintf("Message-Id: %s\r\n"+
+		"From: Van thu <vanthu@example.gov.vn>\r\n"+
+		"Subject: Cong van so 12\r\n"+
+		"Date: Mon, 05 Oct 2026 09:00:00 +0700\r\n"+
+		"MIME-Version: 1.0\r\n"+
+		"Content-Type: multipart/mixed; boundary=\"b1\"\r\n\r\n"+
+		"--b1\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nKinh gui.\r\n"+
+		"--b1\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=\"cv12.pdf\"\r\n"+
+		"Content-Transfer-Encoding: base64\r\n\r\n%s\r\n--b1--\r\n",
+		messageID, base64.StdEncoding.EncodeToString(pdf)))
+}
+
+func importTestEmail(t *testing.T, raw []byte) *models.IncomingDocument {
+	email, err := ParseEmail(raw)
+	if err != nil {
+		t.Fatalf("ParseEmail: %v", err)
+	}
+	document, err := ImportEmail(email, 1)
+	if err != nil {
+		t.Fatalf("ImportEmail: %v", err)
+	}
+	return document
+}
+
+func TestImportEmailStoresAttachment(t *testing.T) {
+	useTestDatabase(t)
+	pdf := testPagePDF("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>", []byte("BT /F1 12 Tf 72 720 Td (Cong van) Tj ET"))
+
+	document := importTestEmail(t, testEmail("<first@example.gov.vn>", pdf))
+	if document.Status != models.IncomingStatusDraft || document.FilePath == "" {
+		t.Fatalf("got status %q and file %q, want a draft with its attachment as file", document.Status, document.FilePath)
+	}
+	if _, err := os.Stat(document.FilePath); err != nil {
+		t.Fatalf("stored attachment: %v", err)
+	}
+	var count int
+	database.DB.Table("files").Where("document_type = ? AND document_id = ?", "incoming", document.ID).Count(&count)
+	if count != 1 {
+		t.Fatalf("got %d file rows for the draft, want 1", count)
+	}
+}
+
+func TestImportEmailSameAttachmentMarksDuplicate(t *testing.T) {
+	useTestDatabase(t)
+	pdf := testPagePDF("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>", []byte("BT /F1 12 Tf 72 720 Td (Cong van) Tj ET"))
+
+	first := importTestEmail(t, testEmail("<first@example.gov.vn>", pdf))
+	second := importTestEmail(t, testEmail("<second@example.gov.vn>", pdf))
+	if second.DuplicateOfID == nil || *second.DuplicateOfID != first.ID {
+		t.Fatalf("got duplicate_of_id %v, want %d", second.DuplicateOfID, first.ID)
+	}
+	if second.FilePath != "" {
+		t.Errorf("got file %q on the duplicate, want the attachment stored once", second.FilePath)
+	}
+	var count int
+	database.DB.Table("files").Count(&count)
+	if count != 1 {
+		t.Errorf("got %d file rows, want 1", count)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/md5"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"os"
 	"path/filepath"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/disintegration/imaging"
 	"github.com/gabriel-vasile/mimetype"
+	"github.com/jinzhu/gorm"
 )
 
 // FileService handles file operations with enhanced security and organization
@@ -101,6 +103,17 @@ func (fs *FileService) ValidateFile(file multipart.File, header *multipart.FileH
 	return nil
 }
 
+// HashFile returns the hash stored with uploaded files, leaving file rewound to the start
+func (fs *FileService) HashFile(file multipart.File) (string, error) {
+	file.Seek(0, 0)
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to generate file hash: %v", err)
+	}
+	file.Seek(0, 0)
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
 // UploadFile handles file upload with enhanced security and organization
 func (fs *FileService) UploadFile(file multipart.File, header *multipart.FileHeader, config FileUploadConfig, userID uint, documentType string, documentID uint) (*FileInfo, error) {
 	// Validate file
@@ -109,13 +122,10 @@ func (fs *FileService) UploadFile(file multipart.File, header *multipart.FileHea
 	}
 
 	// Generate file hash for deduplication
-	file.Seek(0, 0)
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return nil, fmt.Errorf("failed to generate file hash: %v", err)
+	fileHash, err := fs.HashFile(file)
+	if err != nil {
+		return nil, err
 	}
-	fileHash := fmt.Sprintf("%x", hash.Sum(nil))
-	file.Seek(0, 0)
 
 	// Check for duplicate files
 	var existingFile FileInfo
@@ -124,6 +134,27 @@ func (fs *FileService) UploadFile(file multipart.File, header *multipart.FileHea
 		return &existingFile, nil
 	}
 
+	fileRecord, err := fs.storeFile(database.DB, file, header, config, userID, fileHash, documentType, documentID)
+	if err != nil {
+		return nil, err
+	}
+	fs.AfterFileSaved(fileRecord)
+
+	return fileRecord, nil
+}
+
+// RemoveStoredFile removes the files written for a record whose transaction did not commit
+func (fs *FileService) RemoveStoredFile(fileRecord *FileInfo) {
+	os.Remove(fileRecord.FilePath)
+	if fileRecord.ThumbnailPath != "" {
+		os.Remove(fileRecord.ThumbnailPath)
+	}
+}
+
+// storeFile writes a validated file under uploads and records it in db, without looking for an
+// earlier copy. When db is a transaction the caller removes the written file with RemoveStoredFile
+// if it does not commit, and runs AfterFileSaved once it does.
+func (fs *FileService) storeFile(db *gorm.DB, file multipart.File, header *multipart.FileHeader, config FileUploadConfig, userID uint, fileHash, documentType string, documentID uint) (*FileInfo, error) {
 	// Create organized directory structure
 	baseDir := "uploads"
 	subDir := fs.getSubDirectory(documentType, time.Now())
@@ -190,18 +221,64 @@ func (fs *FileService) UploadFile(file multipart.File, header *multipart.FileHea
 	}
 
 	// Save to database (you'll need to create a files table)
-	if err := database.DB.Table("files").Create(&fileRecord).Error; err != nil {
+	if err := db.Table("files").Create(&fileRecord).Error; err != nil {
 		// Clean up file if database save fails
-		os.Remove(filePath)
-		if fileRecord.ThumbnailPath != "" {
-			os.Remove(fileRecord.ThumbnailPath)
-		}
+		fs.RemoveStoredFile(&fileRecord)
 		return nil, fmt.Errorf("failed to save file record: %v", err)
 	}
 
 	return &fileRecord, nil
 }
 
+// SaveFileVersion stores generated contents as a new version of a file, in db so the row goes
+// with the caller's transaction. The caller removes the written file if the transaction fails and
+// runs AfterFileSaved once it commits.
+func (fs *FileService) SaveFileVersion(db *gorm.DB, previous *FileInfo, data []byte, userID uint) (*FileInfo, error) {
+	uploadsDir := filepath.Join("uploads", fs.getSubDirectory(previous.DocumentType, time.Now()))
+	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %v", err)
+	}
+
+	ext := filepath.Ext(previous.OriginalName)
+	baseFilename := fs.sanitizeFilename(strings.TrimSuffix(previous.OriginalName, ext))
+	filename := fmt.Sprintf("%s_%d_%d%s", baseFilename, previous.DocumentID, time.Now().UnixNano(), ext)
+	filePath := strings.ReplaceAll(filepath.Join(uploadsDir, filename), "\\", "/")
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save file: %v", err)
+	}
+
+	fileRecord := FileInfo{
+		OriginalName: previous.OriginalName,
+		FileName:     filename,
+		FilePath:     filePath,
+		FileSize:     int64(len(data)),
+		MimeType:     mimetype.Detect(data).String(),
+		FileHash:     fmt.Sprintf("%x", md5.Sum(data)),
+		UploadedBy:   userID,
+		UploadedAt:   time.Now(),
+		DocumentType: previous.DocumentType,
+		DocumentID:   previous.DocumentID,
+		AccessLevel:  previous.AccessLevel,
+	}
+	if err := db.Table("files").Create(&fileRecord).Error; err != nil {
+		os.Remove(filePath)
+		return nil, fmt.Errorf("failed to save file record: %v", err)
+	}
+	return &fileRecord, nil
+}
+
+// AfterFileSaved verifies the signatures of a new PDF before returning, so a signed file is never
+// shown unchecked, and queues the file for text extraction. A failed verification is only
+// logged; an admin can verify the file again.
+func (fs *FileService) AfterFileSaved(fileRecord *FileInfo) {
+	if isPDFFile(*fileRecord) {
+		if _, err := VerifyFileSignatures(fileRecord.ID); err != nil {
+			log.Printf("Warning: cannot verify signatures of file %d: %v", fileRecord.ID, err)
+		}
+	}
+	QueueTextExtraction(fileRecord.ID)
+}
+
 // CheckFileAccess checks if user has access to a file
 func (fs *FileService) CheckFileAccess(filePath string, userID uint, userRole string) error {
 	// Security check - ensure file is in uploads directory
@@ -215,6 +292,12 @@ func (fs *FileService) CheckFileAccess(filePath string, userID uint, userRole st
 		return fmt.Errorf("file not found in database")
 	}
 
+	// Files of classified documents are kept from anyone not cleared for the document,
+	// whatever the file's own access level
+	if classified := ClassifiedDocumentOf(database.DB, fileRecord.DocumentType, fileRecord.DocumentID, userID); classified != nil && !classified.Allowed {
+		return fmt.Errorf("access denied")
+	}
+
 	// Check access based on access level and user role
 	switch fileRecord.AccessLevel {
 	case "public":
@@ -263,6 +346,8 @@ func (fs *FileService) DeleteFile(filePath string, userID uint, userRole string)
 	if err := database.DB.Table("files").Delete(&fileRecord).Error; err != nil {
 		return fmt.Errorf("failed to remove file record: %v", err)
 	}
+	database.DB.Where("file_id = ?", fileRecord.ID).Delete(&models.FileText{})
+	database.DB.Where("file_id = ?", fileRecord.ID).Delete(&models.FileSignature{})
 
 	return nil
 }
@@ -346,6 +431,11 @@ func (fs *FileService) checkDocumentAccess(documentType string, documentID uint,
 		if doc.DrafterID == userID || doc.ApproverID == userID || doc.CreatedByID == userID {
 			return nil
 		}
+		var steps int
+		database.DB.Model(&models.OutgoingApprovalStep{}).Where("outgoing_document_id = ? AND approver_id = ?", doc.ID, userID).Count(&steps)
+		if steps > 0 {
+			return nil
+		}
 		if userRole == models.RoleAdmin || userRole == models.RoleSecretary {
 			return nil
 		}
@@ -364,6 +454,13 @@ func (fs *FileService) checkDocumentAccess(documentType string, documentID uint,
 		if userRole == models.RoleAdmin || userRole == models.RoleTeamLeader {
 			return nil
 		}
+	case "comment":
+		// Comment attachments follow the access rules of the task they were posted on
+		var comment models.Comment
+		if err := database.DB.First(&comment, documentID).Error; err != nil {
+			return fmt.Errorf("comment not found")
+		}
+		return fs.checkDocumentAccess("task_report", comment.TaskID, userID, userRole)
 	}
 	return fmt.Errorf("access denied")
 }
@@ -44,6 +44,8 @@ type TaskFilterParams struct {
 	IncomingDocumentID string
 	IsOverdue          string
 	UrgencyLevel       string
+	TemplateID         string
+	ParentTaskID       string
 }
 
 // ParseFilterParams extracts common filter parameters from gin context
@@ -86,6 +88,8 @@ func ParseTaskFilterParams(c *gin.Context) TaskFilterParams {
 		IncomingDocumentID: c.Query("incoming_document_id"),
 		IsOverdue:          c.Query("is_overdue"),
 		UrgencyLevel:       c.Query("urgency_level"),
+		TemplateID:         c.Query("template_id"),
+		ParentTaskID:       c.Query("parent_task_id"),
 	}
 }
 
@@ -204,16 +208,30 @@ func ApplyTaskFilters(query *gorm.DB, params TaskFilterParams) *gorm.DB {
 		query = query.Where("incoming_document_id = ?", params.IncomingDocumentID)
 	}
 
+	// Template filtering
+	if params.TemplateID != "" {
+		query = query.Where("template_id = ?", params.TemplateID)
+	}
+
+	// Subtask filtering
+	if params.ParentTaskID != "" {
+		query = query.Where("parent_task_id = ?", params.ParentTaskID)
+	}
+
 	// Overdue filtering
+	overdueCondition, overdueArgs := models.OverdueTaskCondition(time.Now())
 	if params.IsOverdue == "true" {
-		query = query.Where("deadline IS NOT NULL AND deadline < ?", time.Now())
+		query = query.Where(overdueCondition, overdueArgs...)
 	} else if params.IsOverdue == "false" {
-		query = query.Where("deadline IS NULL OR deadline >= ?", time.Now())
+		query = query.Where("NOT "+overdueCondition, overdueArgs...)
 	}
 
-	// Urgency level filtering
+	// Urgency level filtering; tasks on hold are not urgent while their clock is paused
 	if params.UrgencyLevel != "" {
 		now := time.Now()
+		if params.UrgencyLevel != "normal" {
+			query = query.Where("status <> ?", models.StatusOnHold)
+		}
 		switch params.UrgencyLevel {
 		case "critical":
 			// Tasks overdue or due within 1 hour
@@ -342,8 +360,9 @@ func GetFilterPresets() map[string]interface{} {
 	}
 }
 
-// SearchSuggestions provides autocomplete suggestions for search
-func GetSearchSuggestions(searchType, query string, limit int) ([]string, error) {
+// SearchSuggestions provides autocomplete suggestions for search, drawn only from the documents and
+// tasks the user may see
+func GetSearchSuggestions(searchType, query string, limit int, userID uint, userRole string) ([]string, error) {
 	if limit <= 0 {
 		limit = 10
 	}
@@ -357,7 +376,7 @@ func GetSearchSuggestions(searchType, query string, limit int) ([]string, error)
 			OriginalNumber string
 			Summary        string
 		}
-		err := database.DB.Model(&models.IncomingDocument{}).
+		err := ScopeVisibleIncomingDocuments(database.DB.Model(&models.IncomingDocument{}), userID).
 			Select("DISTINCT original_number, summary").
 			Where("LOWER(original_number) LIKE ? OR LOWER(summary) LIKE ?", searchPattern, searchPattern).
 			Limit(limit).
@@ -379,7 +398,7 @@ func GetSearchSuggestions(searchType, query string, limit int) ([]string, error)
 			DocumentNumber string
 			Summary        string
 		}
-		err := database.DB.Model(&models.OutgoingDocument{}).
+		err := ScopeVisibleOutgoingDocuments(database.DB.Model(&models.OutgoingDocument{}), userID).
 			Select("DISTINCT document_number, summary").
 			Where("LOWER(document_number) LIKE ? OR LOWER(summary) LIKE ?", searchPattern, searchPattern).
 			Limit(limit).
@@ -400,7 +419,7 @@ func GetSearchSuggestions(searchType, query string, limit int) ([]string, error)
 		var results []struct {
 			Description string
 		}
-		err := database.DB.Model(&models.Task{}).
+		err := ScopeVisibleTasks(database.DB.Model(&models.Task{}), userID, userRole).
 			Select("DISTINCT description").
 			Where("LOWER(description) LIKE ?", searchPattern).
 			Limit(limit).
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"ai-code-agent-backend/models"
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default for the mailbox poll, overridden by IMAP_INTERVAL_SECONDS
+const defaultMailboxInterval = 60 * time.Second
+
+// MailboxIntake takes in the unread messages of an IMAP mailbox as draft incoming documents.
+// Messages are flagged \Seen once taken in; a message that cannot be parsed is also flagged
+// \Flagged so someone looks at it, while database errors leave it unread for the next poll.
+type MailboxIntake struct {
+	Host     string
+	Port     int
+	TLS      bool
+	Username string
+	Password string
+	Mailbox  string
+	Interval time.Duration
+	User     string // Drafts are created in this user's name; empty means the first active secretary
+}
+
+// MailboxIntakeFromEnv reads the mailbox configuration. It returns nil when IMAP_HOST is not set.
+func MailboxIntakeFromEnv() *MailboxIntake {
+	host := os.Getenv("IMAP_HOST")
+	if host == "" {
+		return nil
+	}
+	intake := &MailboxIntake{
+		Host:     host,
+		TLS:      os.Getenv("IMAP_TLS") != "false",
+		Username: os.Getenv("IMAP_USERNAME"),
+		Password: os.Getenv("IMAP_PASSWORD"),
+		Mailbox:  os.Getenv("IMAP_MAILBOX"),
+		Interval: envSeconds("IMAP_INTERVAL_SECONDS", defaultMailboxInterval),
+		User:     os.Getenv("IMAP_INTAKE_USER"),
+	}
+	if intake.Mailbox == "" {
+		intake.Mailbox = "INBOX"
+	}
+	intake.Port, _ = strconv.Atoi(os.Getenv("IMAP_PORT"))
+	if intake.Port == 0 {
+		intake.Port = 143
+		if intake.TLS {
+			intake.Port = 993
+		}
+	}
+	return intake
+}
+
+// Start polls the mailbox in the background until the process exits
+func (m *MailboxIntake) Start() {
+	log.Printf("Mailbox intake polling %s@%s:%d/%s every %s", m.Username, m.Host, m.Port, m.Mailbox, m.Interval)
+	go func() {
+		for {
+			if err := m.Poll(); err != nil {
+				log.Printf("Warning: mailbox intake failed: %v", err)
+			}
+			time.Sleep(m.Interval)
+		}
+	}()
+}
+
+// Poll takes in the unread messages once
+func (m *MailboxIntake) Poll() error {
+	user, err := intakeUser(m.User)
+	if err != nil {
+		return err
+	}
+
+	client, err := dialIMAP(m.Host, m.Port, m.TLS)
+	if err != nil {
+		return err
+	}
+	defer client.logout()
+
+	if _, err := client.command("LOGIN %s %s", imapQuote(m.Username), imapQuote(m.Password)); err != nil {
+		return err
+	}
+	if _, err := client.command("SELECT %s", imapQuote(m.Mailbox)); err != nil {
+		return err
+	}
+	responses, err := client.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return err
+	}
+
+	var uids []string
+	for _, response := range responses {
+		if fields := strings.Fields(response.line); len(fields) > 2 && strings.EqualFold(fields[1], "SEARCH") {
+			uids = append(uids, fields[2:]...)
+		}
+	}
+
+	for _, uid := range uids {
+		responses, err := client.command("UID FETCH %s BODY.PEEK[]", uid)
+		if err != nil {
+			return err
+		}
+		var raw []byte
+		for _, response := range responses {
+			if len(response.literals) > 0 {
+				raw = response.literals[0]
+				break
+			}
+		}
+		if raw == nil {
+			continue
+		}
+
+		flags := `\Seen`
+		if documentID, err := m.intake(raw, user); err != nil {
+			if _, parseFailed := err.(emailParseError); !parseFailed {
+				log.Printf("Mailbox intake: message %s will be retried: %v", uid, err)
+				continue
+			}
+			log.Printf("Mailbox intake: message %s rejected: %v", uid, err)
+			flags = `\Seen \Flagged`
+		} else if documentID != 0 {
+			log.Printf("Mailbox intake: message %s registered as draft incoming document %d", uid, documentID)
+		}
+		if _, err := client.command("UID STORE %s +FLAGS (%s)", uid, flags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emailParseError marks a message that will never parse, as opposed to a failure worth retrying
+type emailParseError struct{ error }
+
+// intake takes in one message; an already imported message is not an error and returns 0
+func (m *MailboxIntake) intake(raw []byte, user *models.User) (uint, error) {
+	email, err := ParseEmail(raw)
+	if err != nil {
+		return 0, emailParseError{err}
+	}
+	document, err := ImportEmail(email, user.ID)
+	if err != nil {
+		if _, duplicate := err.(*EmailAlreadyImportedError); duplicate {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	NewAuditService().LogSystemActivity(user.ID, models.AuditActionDocumentCreate, models.AuditEntityIncomingDocument, document.ID,
+		fmt.Sprintf("Tạo văn bản đến nháp từ email: %s", document.Summary),
+		map[string]interface{}{"source": "imap", "mailbox": m.Mailbox, "message_id": email.MessageID})
+	return document.ID, nil
+}
+
+// imapClient speaks just enough IMAP4rev1 to read and flag messages
+type imapClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	tag    int
+}
+
+// imapResponse is an untagged response line, with the literals it carried
+type imapResponse struct {
+	line     string
+	literals [][]byte
+}
+
+func dialIMAP(host string, port int, useTLS bool) (*imapClient, error) {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("không thể kết nối máy chủ IMAP %s: %v", address, err)
+	}
+
+	client := &imapClient{conn: conn, reader: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(5 * time.Minute))
+	greeting, err := client.readResponse()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting.line, "* OK") && !strings.HasPrefix(greeting.line, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("máy chủ IMAP từ chối kết nối: %s", greeting.line)
+	}
+	return client, nil
+}
+
+// command sends a command and collects the untagged responses up to its tagged completion
+func (c *imapClient) command(format string, args ...interface{}) ([]imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("A%03d", c.tag)
+	command := fmt.Sprintf(format, args...)
+	c.conn.SetDeadline(time.Now().Add(5 * time.Minute))
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, command); err != nil {
+		return nil, err
+	}
+
+	verb := strings.Fields(command)[0]
+	var responses []imapResponse
+	for {
+		response, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(response.line, tag+" ") {
+			responses = append(responses, response)
+			continue
+		}
+		status := strings.TrimPrefix(response.line, tag+" ")
+		if !strings.HasPrefix(status, "OK") {
+			return nil, fmt.Errorf("lệnh IMAP %s thất bại: %s", verb, status)
+		}
+		return responses, nil
+	}
+}
+
+// readResponse reads one response, following the {n} literals that continue it over several lines
+func (c *imapClient) readResponse() (imapResponse, error) {
+	var response imapResponse
+	var line strings.Builder
+	for {
+		text, err := c.reader.ReadString('\n')
+		if err != nil {
+			return response, fmt.Errorf("mất kết nối IMAP: %v", err)
+		}
+		text = strings.TrimRight(text, "\r\n")
+		line.WriteString(text)
+
+		size, ok := imapLiteralSize(text)
+		if !ok {
+			response.line = line.String()
+			return response, nil
+		}
+		if size > MaxEmailSize {
+			return response, fmt.Errorf("email quá lớn, tối đa %d MB", MaxEmailSize/(1024*1024))
+		}
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(c.reader, literal); err != nil {
+			return response, fmt.Errorf("mất kết nối IMAP: %v", err)
+		}
+		response.literals = append(response.literals, literal)
+	}
+}
+
+// imapLiteralSize reports the size announced by a line ending in {n}
+func imapLiteralSize(line string) (int, bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+	open := strings.LastIndex(line, "{")
+	if open < 0 {
+		return 0, false
+	}
+	size, err := strconv.Atoi(strings.TrimSuffix(line[open+1:len(line)-1], "+"))
+	return size, err == nil && size >= 0
+}
+
+func (c *imapClient) logout() {
+	c.command("LOGOUT")
+	c.conn.Close()
+}
+
+// imapQuote writes a string as an IMAP quoted string
+func imapQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
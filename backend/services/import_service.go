@@ -0,0 +1,336 @@
+package services
+
+import (
+	"ai-code-agent-backend/models"
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits on what a single import may contain
+const (
+	MaxImportFileSize = 20 * 1024 * 1024
+	MaxImportRows     = 20000
+)
+
+// ImportRow is a data row of an import file. Line is the row number shown by the spreadsheet,
+// so errors can be reported in terms the user recognises.
+type ImportRow struct {
+	Line  int
+	Cells []string
+}
+
+// ReadImportRows reads the rows of a CSV or XLSX file, header row included; the format is
+// chosen by the file extension. Empty rows are skipped.
+func ReadImportRows(data []byte, filename string) ([]ImportRow, error) {
+	var rows []ImportRow
+	var err error
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		rows, err = readCSVRows(data)
+	case ".xlsx":
+		rows, err = readXLSXRows(data)
+	default:
+		return nil, fmt.Errorf("chỉ hỗ trợ file CSV hoặc XLSX")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nonEmpty := rows[:0]
+	for _, row := range rows {
+		for _, cell := range row.Cells {
+			if strings.TrimSpace(cell) != "" {
+				nonEmpty = append(nonEmpty, row)
+				break
+			}
+		}
+	}
+	if len(nonEmpty) > MaxImportRows+1 {
+		return nil, fmt.Errorf("file có quá nhiều dòng, tối đa %d dòng mỗi lần nhập", MaxImportRows)
+	}
+	return nonEmpty, nil
+}
+
+// readCSVRows reads a CSV file as saved by Excel: an optional UTF-8 BOM, and ';' instead of ','
+// as separator in locales that use the comma for decimals
+func readCSVRows(data []byte) ([]ImportRow, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var rows []ImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("file CSV không hợp lệ: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, ImportRow{Line: line, Cells: record})
+	}
+	return rows, nil
+}
+
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSXRows reads the first worksheet of an XLSX workbook. Only cell values are read;
+// dates come through as Excel serial numbers, which ParseImportDate understands.
+func readXLSXRows(data []byte) ([]ImportRow, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("file XLSX không hợp lệ")
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+	decode := func(name string, v interface{}) error {
+		file, ok := files[name]
+		if !ok {
+			return fmt.Errorf("thiếu %s", name)
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		return xml.NewDecoder(reader).Decode(v)
+	}
+
+	var sharedStrings struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decode("xl/sharedStrings.xml", &sharedStrings); err != nil {
+			return nil, fmt.Errorf("file XLSX không hợp lệ: %v", err)
+		}
+	}
+
+	var worksheet xlsxWorksheet
+	if err := decode(firstWorksheetPath(decode), &worksheet); err != nil {
+		return nil, fmt.Errorf("file XLSX không hợp lệ: %v", err)
+	}
+
+	rows := make([]ImportRow, 0, len(worksheet.Rows))
+	for i, row := range worksheet.Rows {
+		line := row.Number
+		if line == 0 {
+			line = i + 1
+		}
+		var cells []string
+		for j, cell := range row.Cells {
+			column := j
+			if cell.Ref != "" {
+				column = xlsxColumnIndex(cell.Ref)
+			}
+			for len(cells) <= column {
+				cells = append(cells, "")
+			}
+			switch cell.Type {
+			case "s":
+				if index, err := strconv.Atoi(cell.Value); err == nil && index >= 0 && index < len(sharedStrings.Items) {
+					cells[column] = sharedStrings.Items[index].String()
+				}
+			case "inlineStr":
+				cells[column] = cell.Inline.String()
+			default:
+				cells[column] = cell.Value
+			}
+		}
+		rows = append(rows, ImportRow{Line: line, Cells: cells})
+	}
+	return rows, nil
+}
+
+// firstWorksheetPath finds the first sheet of the workbook through its relationships, falling
+// back to the name Excel normally gives it
+func firstWorksheetPath(decode func(string, interface{}) error) string {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	var workbook struct {
+		Sheets []struct {
+			RelationID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var relationships struct {
+		Items []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if decode("xl/workbook.xml", &workbook) != nil || len(workbook.Sheets) == 0 ||
+		decode("xl/_rels/workbook.xml.rels", &relationships) != nil {
+		return fallback
+	}
+	for _, relationship := range relationships.Items {
+		if relationship.ID == workbook.Sheets[0].RelationID {
+			if strings.HasPrefix(relationship.Target, "/") {
+				return strings.TrimPrefix(relationship.Target, "/")
+			}
+			return path.Join("xl", relationship.Target)
+		}
+	}
+	return fallback
+}
+
+// xlsxColumnIndex turns a cell reference such as "AB12" into a zero-based column index
+func xlsxColumnIndex(ref string) int {
+	index := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A') + 1
+	}
+	return index - 1
+}
+
+// MapImportColumns matches the header row against the names each field is known by. overrides
+// maps a field to the exact header chosen by the user and wins over the known names. It returns
+// the column index of every field found and the headers that matched nothing.
+func MapImportColumns(header []string, aliases map[string][]string, overrides map[string]string) (map[string]int, []string) {
+	byHeader := make(map[string]int, len(header))
+	for i, name := range header {
+		if folded := FoldText(name); folded != "" {
+			if _, seen := byHeader[folded]; !seen {
+				byHeader[folded] = i
+			}
+		}
+	}
+
+	columns := make(map[string]int)
+	for field, names := range aliases {
+		if override, ok := overrides[field]; ok {
+			if i, found := byHeader[FoldText(override)]; found {
+				columns[field] = i
+			}
+			continue
+		}
+		for _, name := range append([]string{field}, names...) {
+			if i, found := byHeader[FoldText(name)]; found {
+				columns[field] = i
+				break
+			}
+		}
+	}
+
+	used := make(map[int]bool, len(columns))
+	for _, i := range columns {
+		used[i] = true
+	}
+	var unmapped []string
+	for i, name := range header {
+		if !used[i] && strings.TrimSpace(name) != "" {
+			unmapped = append(unmapped, name)
+		}
+	}
+	return columns, unmapped
+}
+
+// Date layouts accepted in import files, day first as written in Vietnamese registers
+var importDateLayouts = []string{"02/01/2006", "2/1/2006", "02-01-2006", "2-1-2006", "02.01.2006", "2006-01-02", "02/01/06", "2/1/06"}
+
+// ParseImportDate reads a date as typed in a register, or an Excel serial date
+func ParseImportDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if serial, err := strconv.ParseFloat(value, 64); err == nil {
+		// Serials count days from 1899-12-30; the range keeps small numbers from passing as dates
+		if serial >= 10000 && serial < 2958466 {
+			return time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(serial)), nil
+		}
+	}
+	if len(value) > 10 {
+		// Keep the date of a date-time such as "2024-03-05 00:00:00"
+		if i := strings.IndexAny(value, " T"); i > 0 {
+			value = value[:i]
+		}
+	}
+	for _, layout := range importDateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("ngày không hợp lệ: %s", value)
+}
+
+// Vietnamese names of the urgency and secrecy levels, folded
+var (
+	urgencyNames = map[string]string{
+		"thuong": models.UrgencyNormal, "khan": models.UrgencyUrgent,
+		"thuong khan": models.UrgencyVeryUrgent, "hoa toc": models.UrgencyFlash,
+	}
+	secrecyNames = map[string]string{
+		"": models.SecrecyNone, "khong": models.SecrecyNone, "mat": models.SecrecyConfidential,
+		"toi mat": models.SecrecySecret, "tuyet mat": models.SecrecyTopSecret,
+	}
+)
+
+// ParseImportUrgency accepts an urgency level by its code or its Vietnamese name; empty means normal
+func ParseImportUrgency(value string) (string, bool) {
+	if value = strings.TrimSpace(value); value == "" {
+		return models.UrgencyNormal, true
+	}
+	if models.IsValidUrgency(value) {
+		return value, true
+	}
+	urgency, ok := urgencyNames[FoldText(value)]
+	return urgency, ok
+}
+
+// ParseImportSecrecy accepts a secrecy level by its code or its Vietnamese name; empty means none
+func ParseImportSecrecy(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if models.IsValidSecrecy(value) {
+		return value, true
+	}
+	secrecy, ok := secrecyNames[FoldText(value)]
+	return secrecy, ok
+}
@@ -0,0 +1,677 @@
+package services
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// A small PDF reader: enough of ISO 32000 to resolve objects, walk the page tree and decode
+// content streams. The cross-reference table is not trusted; objects are found by scanning the
+// file, which also copes with the damaged files scanners and old converters produce.
+
+type (
+	pdfName    string
+	pdfString  []byte
+	pdfArray   []interface{}
+	pdfDict    map[pdfName]interface{}
+	pdfKeyword string
+	pdfRef     struct{ Num, Gen int }
+)
+
+// pdfStream is a stream object with its data still encoded
+type pdfStream struct {
+	Dict pdfDict
+	Data []byte
+}
+
+// Errors a PDF can be refused with
+var (
+	errNotPDF       = errors.New("không phải file PDF")
+	errPDFEncrypted = errors.New("file PDF được mã hoá")
+	errPDFSyntax    = errors.New("cú pháp PDF không hợp lệ")
+)
+
+// Decoded streams are capped so a small file cannot inflate without bound
+const maxPDFStreamSize = 64 * 1024 * 1024
+
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFWhitespace(b byte) bool {
+	switch b {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isPDFDelimiter(b byte) bool {
+	switch b {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isPDFRegular(b byte) bool {
+	return !isPDFWhitespace(b) && !isPDFDelimiter(b)
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		if b == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFWhitespace(b) {
+			return
+		}
+		l.pos++
+	}
+}
+
+func (l *pdfLexer) hasPrefix(prefix string) bool {
+	return bytes.HasPrefix(l.data[l.pos:], []byte(prefix))
+}
+
+// readObject reads the next object. Operators and stray closing delimiters, as found in
+// content streams, come back as pdfKeyword.
+func (l *pdfLexer) readObject() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+	b := l.data[l.pos]
+	switch {
+	case b == '/':
+		return l.readName(), nil
+	case b == '(':
+		return l.readLiteralString(), nil
+	case b == '<' && l.hasPrefix("<<"):
+		return l.readDict()
+	case b == '<':
+		return l.readHexString(), nil
+	case b == '[':
+		return l.readArray()
+	case b == '>' && l.hasPrefix(">>"):
+		l.pos += 2
+		return pdfKeyword(">>"), nil
+	case isPDFDelimiter(b):
+		l.pos++
+		return pdfKeyword(string(b)), nil
+	case b == '+' || b == '-' || b == '.' || (b >= '0' && b <= '9'):
+		return l.readNumberOrRef(), nil
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && isPDFRegular(l.data[l.pos]) {
+		l.pos++
+	}
+	switch word := string(l.data[start:l.pos]); word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	default:
+		return pdfKeyword(word), nil
+	}
+}
+
+func (l *pdfLexer) readName() pdfName {
+	l.pos++
+	var name []byte
+	for l.pos < len(l.data) && isPDFRegular(l.data[l.pos]) {
+		b := l.data[l.pos]
+		if b == '#' && l.pos+2 < len(l.data) {
+			if decoded, err := hex.DecodeString(string(l.data[l.pos+1 : l.pos+3])); err == nil {
+				name = append(name, decoded[0])
+				l.pos += 3
+				continue
+			}
+		}
+		name = append(name, b)
+		l.pos++
+	}
+	return pdfName(name)
+}
+
+func (l *pdfLexer) readLiteralString() pdfString {
+	l.pos++
+	var value []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		l.pos++
+		switch b {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return value
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return value
+			}
+			escaped := l.data[l.pos]
+			l.pos++
+			switch escaped {
+			case 'n':
+				b = '\n'
+			case 'r':
+				b = '\r'
+			case 't':
+				b = '\t'
+			case 'b':
+				b = '\b'
+			case 'f':
+				b = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					octal := int(escaped - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						octal = octal*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					b = byte(octal)
+				} else {
+					b = escaped
+				}
+			}
+		}
+		value = append(value, b)
+	}
+	return value
+}
+
+func (l *pdfLexer) readHexString() pdfString {
+	l.pos++
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if b := l.data[l.pos]; !isPDFWhitespace(b) {
+			digits = append(digits, b)
+		}
+		l.pos++
+	}
+	if l.pos < len(l.data) {
+		l.pos++ // The closing '>', missing when the file is cut short
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	value := make([]byte, len(digits)/2)
+	hex.Decode(value, digits)
+	return value
+}
+
+func (l *pdfLexer) readArray() (pdfArray, error) {
+	l.pos++
+	var array pdfArray
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return array, errPDFSyntax
+		}
+		if l.data[l.pos] == ']' {
+			l.pos++
+			return array, nil
+		}
+		value, err := l.readObject()
+		if err != nil {
+			return array, err
+		}
+		array = append(array, value)
+	}
+}
+
+func (l *pdfLexer) readDict() (pdfDict, error) {
+	l.pos += 2
+	dict := pdfDict{}
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return dict, errPDFSyntax
+		}
+		if l.hasPrefix(">>") {
+			l.pos += 2
+			return dict, nil
+		}
+		key, err := l.readObject()
+		if err != nil {
+			return dict, err
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			return dict, errPDFSyntax
+		}
+		value, err := l.readObject()
+		if err != nil {
+			return dict, err
+		}
+		dict[name] = value
+	}
+}
+
+// readNumberOrRef reads a number, or an indirect reference "12 0 R"
+func (l *pdfLexer) readNumberOrRef() interface{} {
+	start := l.pos
+	for l.pos < len(l.data) && isPDFRegular(l.data[l.pos]) {
+		l.pos++
+	}
+	token := string(l.data[start:l.pos])
+	number, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return 0.0
+	}
+	if generation, ok := l.peekRefTail(token); ok {
+		num, _ := strconv.Atoi(token)
+		return pdfRef{Num: num, Gen: generation}
+	}
+	return number
+}
+
+// peekRefTail checks whether an integer is followed by "<gen> R", consuming it if so
+func (l *pdfLexer) peekRefTail(token string) (int, bool) {
+	for _, b := range []byte(token) {
+		if b < '0' || b > '9' {
+			return 0, false
+		}
+	}
+	pos := l.pos
+	for pos < len(l.data) && isPDFWhitespace(l.data[pos]) {
+		pos++
+	}
+	genStart := pos
+	for pos < len(l.data) && l.data[pos] >= '0' && l.data[pos] <= '9' {
+		pos++
+	}
+	if pos == genStart || pos >= len(l.data) || !isPDFWhitespace(l.data[pos]) {
+		return 0, false
+	}
+	generation, _ := strconv.Atoi(string(l.data[genStart:pos]))
+	for pos < len(l.data) && isPDFWhitespace(l.data[pos]) {
+		pos++
+	}
+	if pos >= len(l.data) || l.data[pos] != 'R' || (pos+1 < len(l.data) && isPDFRegular(l.data[pos+1])) {
+		return 0, false
+	}
+	l.pos = pos + 1
+	return generation, true
+}
+
+// pdfDocument holds every object of a file by number; a later definition, as written by an
+// incremental update, replaces an earlier one
+type pdfDocument struct {
+	data    []byte
+	objects map[int]pdfObjectEntry
+	trailer pdfDict
+}
+
+type pdfObjectEntry struct {
+	offset int // Where the definition starts; objects of an object stream take the stream's offset
+	value  interface{}
+}
+
+var pdfObjectHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// parsePDF loads the objects of a file. Encrypted files are refused, their strings and streams
+// cannot be read without the key.
+func parsePDF(data []byte) (*pdfDocument, error) {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	if !bytes.Contains(head, []byte("%PDF-")) {
+		return nil, errNotPDF
+	}
+
+	doc := &pdfDocument{data: data, objects: map[int]pdfObjectEntry{}, trailer: pdfDict{}}
+	type trailerAt struct {
+		offset int
+		dict   pdfDict
+	}
+	var trailers []trailerAt
+
+	for pos := 0; pos < len(data); {
+		match := pdfObjectHeader.FindSubmatchIndex(data[pos:])
+		if match == nil {
+			break
+		}
+		start := pos + match[0]
+		num, _ := strconv.Atoi(string(data[pos+match[2] : pos+match[3]]))
+		lexer := &pdfLexer{data: data, pos: pos + match[1]}
+		value, err := lexer.readIndirect()
+		if err != nil {
+			pos += match[1]
+			continue
+		}
+		doc.objects[num] = pdfObjectEntry{offset: start, value: value}
+		if stream, ok := value.(*pdfStream); ok && stream.Dict["Type"] == pdfName("XRef") {
+			trailers = append(trailers, trailerAt{start, stream.Dict})
+		}
+		pos = lexer.pos
+	}
+	if len(doc.objects) == 0 {
+		return nil, errPDFSyntax
+	}
+
+	for pos := 0; ; {
+		i := bytes.Index(data[pos:], []byte("trailer"))
+		if i < 0 {
+			break
+		}
+		lexer := &pdfLexer{data: data, pos: pos + i + len("trailer")}
+		if dict, ok := mustReadObject(lexer).(pdfDict); ok {
+			trailers = append(trailers, trailerAt{pos + i, dict})
+		}
+		pos += i + len("trailer")
+	}
+	sort.Slice(trailers, func(i, j int) bool { return trailers[i].offset < trailers[j].offset })
+	for _, trailer := range trailers {
+		for key, value := range trailer.dict {
+			doc.trailer[key] = value
+		}
+	}
+	if doc.trailer["Encrypt"] != nil {
+		return nil, errPDFEncrypted
+	}
+
+	doc.expandObjectStreams()
+	return doc, nil
+}
+
+func mustReadObject(lexer *pdfLexer) interface{} {
+	value, _ := lexer.readObject()
+	return value
+}
+
+// readIndirect reads the body of "n g obj ... endobj", stream data included
+func (l *pdfLexer) readIndirect() (interface{}, error) {
+	value, err := l.readObject()
+	if err != nil {
+		return nil, err
+	}
+	dict, isDict := value.(pdfDict)
+	l.skipSpace()
+	if isDict && l.hasPrefix("stream") {
+		l.pos += len("stream")
+		if l.hasPrefix("\r\n") {
+			l.pos += 2
+		} else if l.pos < len(l.data) && (l.data[l.pos] == '\n' || l.data[l.pos] == '\r') {
+			l.pos++
+		}
+		start := l.pos
+
+		// Trust /Length only when it is direct and lands on endstream
+		end := -1
+		if length, ok := dict["Length"].(float64); ok && length >= 0 && start+int(length) <= len(l.data) {
+			check := &pdfLexer{data: l.data, pos: start + int(length)}
+			check.skipSpace()
+			if check.hasPrefix("endstream") {
+				end = start + int(length)
+			}
+		}
+		if end < 0 {
+			i := bytes.Index(l.data[start:], []byte("endstream"))
+			if i < 0 {
+				return nil, errPDFSyntax
+			}
+			end = start + i
+			for end > start && (l.data[end-1] == '\n' || l.data[end-1] == '\r') {
+				end--
+			}
+		}
+		l.pos = end
+		l.skipSpace()
+		l.pos += len("endstream")
+		value = &pdfStream{Dict: dict, Data: l.data[start:end]}
+		l.skipSpace()
+	}
+	if l.hasPrefix("endobj") {
+		l.pos += len("endobj")
+	}
+	return value, nil
+}
+
+// expandObjectStreams adds the objects packed into /ObjStm streams (PDF 1.5 and later)
+func (d *pdfDocument) expandObjectStreams() {
+	type container struct {
+		offset int
+		stream *pdfStream
+	}
+	var containers []container
+	for _, entry := range d.objects {
+		if stream, ok := entry.value.(*pdfStream); ok && stream.Dict["Type"] == pdfName("ObjStm") {
+			containers = append(containers, container{entry.offset, stream})
+		}
+	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i].offset < containers[j].offset })
+
+	for _, c := range containers {
+		data, err := d.streamData(c.stream)
+		if err != nil {
+			continue
+		}
+		count, _ := d.integer(c.stream.Dict["N"])
+		first, _ := d.integer(c.stream.Dict["First"])
+		header := &pdfLexer{data: data}
+		for i := 0; i < count; i++ {
+			num, ok1 := mustReadObject(header).(float64)
+			offset, ok2 := mustReadObject(header).(float64)
+			if !ok1 || !ok2 || first+int(offset) >= len(data) {
+				break
+			}
+			if existing, found := d.objects[int(num)]; found && existing.offset > c.offset {
+				continue
+			}
+			lexer := &pdfLexer{data: data, pos: first + int(offset)}
+			if value, err := lexer.readObject(); err == nil {
+				d.objects[int(num)] = pdfObjectEntry{offset: c.offset, value: value}
+			}
+		}
+	}
+}
+
+// resolve follows indirect references
+func (d *pdfDocument) resolve(value interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		value = d.objects[ref.Num].value
+	}
+	return nil
+}
+
+func (d *pdfDocument) dict(value interface{}) pdfDict {
+	switch v := d.resolve(value).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.Dict
+	}
+	return nil
+}
+
+func (d *pdfDocument) array(value interface{}) pdfArray {
+	array, _ := d.resolve(value).(pdfArray)
+	return array
+}
+
+func (d *pdfDocument) stream(value interface{}) *pdfStream {
+	stream, _ := d.resolve(value).(*pdfStream)
+	return stream
+}
+
+func (d *pdfDocument) number(value interface{}) (float64, bool) {
+	number, ok := d.resolve(value).(float64)
+	return number, ok
+}
+
+func (d *pdfDocument) integer(value interface{}) (int, bool) {
+	number, ok := d.number(value)
+	return int(number), ok
+}
+
+func (d *pdfDocument) name(value interface{}) pdfName {
+	name, _ := d.resolve(value).(pdfName)
+	return name
+}
+
+// streamData decodes a stream through its filters
+func (d *pdfDocument) streamData(stream *pdfStream) ([]byte, error) {
+	data := stream.Data
+	var filters pdfArray
+	switch filter := d.resolve(stream.Dict["Filter"]).(type) {
+	case pdfName:
+		filters = pdfArray{filter}
+	case pdfArray:
+		filters = filter
+	}
+
+	for _, filter := range filters {
+		var err error
+		switch d.name(filter) {
+		case "FlateDecode", "Fl":
+			data, err = inflatePDF(data)
+		case "ASCIIHexDecode", "AHx":
+			data = (&pdfLexer{data: append(append([]byte{'<'}, bytes.TrimSpace(data)...), '>')}).readHexString()
+		case "ASCII85Decode", "A85":
+			data, err = decodeASCII85(data)
+		default:
+			return nil, fmt.Errorf("bộ lọc PDF không được hỗ trợ: %s", d.name(filter))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// inflatePDF undoes FlateDecode, keeping what could be read from a truncated stream
+func inflatePDF(data []byte) ([]byte, error) {
+	var reader io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		reader = zr
+	} else {
+		reader = flate.NewReader(bytes.NewReader(data))
+	}
+	out, err := io.ReadAll(io.LimitReader(reader, maxPDFStreamSize))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	out := make([]byte, len(data))
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+// pdfPage is a page with the resources it inherits from the page tree
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages lists the pages in reading order
+func (d *pdfDocument) pages() []pdfPage {
+	var pages []pdfPage
+	visited := map[int]bool{}
+	var walk func(node interface{}, resources pdfDict, depth int)
+	walk = func(node interface{}, resources pdfDict, depth int) {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref.Num] {
+				return
+			}
+			visited[ref.Num] = true
+		}
+		dict := d.dict(node)
+		if dict == nil || depth > 64 {
+			return
+		}
+		if own := d.dict(dict["Resources"]); own != nil {
+			resources = own
+		}
+		if kids := d.array(dict["Kids"]); kids != nil || d.name(dict["Type"]) == "Pages" {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+			return
+		}
+		pages = append(pages, pdfPage{dict: dict, resources: resources})
+	}
+	if root := d.dict(d.trailer["Root"]); root != nil {
+		walk(root["Pages"], nil, 0)
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	// Without a usable page tree, take the page objects in object number order
+	var numbers []int
+	for num, entry := range d.objects {
+		if dict, ok := entry.value.(pdfDict); ok && dict["Type"] == pdfName("Page") {
+			numbers = append(numbers, num)
+		}
+	}
+	sort.Ints(numbers)
+	for _, num := range numbers {
+		dict := d.objects[num].value.(pdfDict)
+		pages = append(pages, pdfPage{dict: dict, resources: d.dict(dict["Resources"])})
+	}
+	return pages
+}
+
+// contents returns the decoded content streams of a page, joined
+func (d *pdfDocument) contents(page pdfPage) []byte {
+	var streams []*pdfStream
+	switch contents := d.resolve(page.dict["Contents"]).(type) {
+	case *pdfStream:
+		streams = append(streams, contents)
+	case pdfArray:
+		for _, item := range contents {
+			if stream := d.stream(item); stream != nil {
+				streams = append(streams, stream)
+			}
+		}
+	}
+
+	var content []byte
+	for _, stream := range streams {
+		if data, err := d.streamData(stream); err == nil {
+			content = append(append(content, data...), '\n')
+		}
+	}
+	return content
+}
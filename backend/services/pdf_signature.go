@@ -0,0 +1,581 @@
+package services
+
+import (
+	"ai-code-agent-backend/models"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signatures of PDFs (ISO 32000 12.8, PAdES): a signature dictionary names the byte ranges of the
+// file it covers and holds a CMS SignedData (RFC 5652) in the gap between them. The CMS is read
+// with encoding/asn1 and checked by hand; only what PDF signers produce is supported.
+
+// pdfSignature is a signature dictionary found in a file, not yet verified
+type pdfSignature struct {
+	ByteRange   [4]int
+	CMS         []byte // Zero padded up to the size reserved in the file
+	SubFilter   string
+	Name        string
+	Reason      string
+	Location    string
+	ClaimedTime *time.Time // /M, written by the signing software
+	err         error
+}
+
+// Reasons a signature is found invalid rather than unreadable
+var (
+	errSignedContentChanged = errors.New("nội dung file đã bị thay đổi sau khi ký")
+	errSignatureMismatch    = errors.New("giá trị chữ ký không khớp với chứng thư số")
+	errTimestampMismatch    = errors.New("dấu thời gian không khớp với chữ ký")
+	errSignatureByteRange   = errors.New("vùng dữ liệu được ký (ByteRange) không hợp lệ")
+)
+
+// findPDFSignatures returns the signatures of a file in signing order
+func findPDFSignatures(data []byte) ([]pdfSignature, error) {
+	doc, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var dicts []pdfDict
+	for _, entry := range doc.objects {
+		collectSignatureDicts(entry.value, &dicts, 0)
+	}
+
+	seen := map[[4]int]bool{}
+	var signatures []pdfSignature
+	for _, dict := range dicts {
+		signature := pdfSignature{
+			SubFilter:   string(doc.name(dict["SubFilter"])),
+			Name:        doc.textString(dict["Name"]),
+			Reason:      doc.textString(dict["Reason"]),
+			Location:    doc.textString(dict["Location"]),
+			ClaimedTime: parsePDFDate(doc.textString(dict["M"])),
+		}
+		byteRange := doc.array(dict["ByteRange"])
+		if len(byteRange) != 4 {
+			signature.err = errSignatureByteRange
+		} else {
+			for i, value := range byteRange {
+				signature.ByteRange[i], _ = doc.integer(value)
+			}
+			signature.CMS, signature.err = signatureContents(data, signature.ByteRange)
+		}
+		if seen[signature.ByteRange] {
+			continue
+		}
+		seen[signature.ByteRange] = true
+		signatures = append(signatures, signature)
+	}
+
+	sort.Slice(signatures, func(i, j int) bool {
+		a, b := signatures[i].ByteRange, signatures[j].ByteRange
+		return a[2]+a[3] < b[2]+b[3]
+	})
+	return signatures, nil
+}
+
+// collectSignatureDicts finds the signature dictionaries in an object, including those written
+// directly into a field's /V
+func collectSignatureDicts(value interface{}, dicts *[]pdfDict, depth int) {
+	if depth > 8 {
+		return
+	}
+	switch value := value.(type) {
+	case pdfDict:
+		if value["ByteRange"] != nil && value["Contents"] != nil {
+			*dicts = append(*dicts, value)
+			return
+		}
+		for _, item := range value {
+			collectSignatureDicts(item, dicts, depth+1)
+		}
+	case pdfArray:
+		for _, item := range value {
+			collectSignatureDicts(item, dicts, depth+1)
+		}
+	}
+}
+
+// signatureContents reads the CMS from the gap between the signed byte ranges. It is taken from
+// the file rather than the parsed dictionary, so a later object with the same number cannot stand in.
+func signatureContents(data []byte, byteRange [4]int) ([]byte, error) {
+	gapStart, gapEnd := byteRange[1], byteRange[2]
+	if byteRange[0] != 0 || gapStart <= 0 || gapEnd <= gapStart+1 || byteRange[3] < 0 || gapEnd+byteRange[3] > len(data) {
+		return nil, errSignatureByteRange
+	}
+	if data[gapStart] != '<' || data[gapEnd-1] != '>' {
+		return nil, errSignatureByteRange
+	}
+	lexer := &pdfLexer{data: data[:gapEnd], pos: gapStart}
+	contents := lexer.readHexString()
+	if lexer.pos != gapEnd || len(contents) == 0 {
+		return nil, errSignatureByteRange
+	}
+	return contents, nil
+}
+
+// textString decodes a PDF text string: UTF-16BE with a byte order mark, otherwise PDFDocEncoding,
+// which matches Latin-1 for the characters signers write
+func (d *pdfDocument) textString(value interface{}) string {
+	text, ok := d.resolve(value).(pdfString)
+	if !ok {
+		return ""
+	}
+	if bytes.HasPrefix(text, []byte{0xFE, 0xFF}) {
+		return strings.TrimSpace(decodeUTF16BE(text[2:]))
+	}
+	runes := make([]rune, len(text))
+	for i, b := range text {
+		runes[i] = rune(b)
+	}
+	return strings.TrimSpace(string(runes))
+}
+
+// parsePDFDate reads a PDF date, D:YYYYMMDDHHmmSSOHH'mm', where everything after the year is optional
+func parsePDFDate(value string) *time.Time {
+	value = strings.TrimPrefix(value, "D:")
+	digits := len(value) - len(strings.TrimLeft(value, "0123456789"))
+	if digits < 4 || digits%2 == 1 {
+		return nil
+	}
+	if digits > 14 {
+		digits = 14
+	}
+	stamp := value[:digits] + "0101000000"[digits-4:]
+
+	location := time.UTC
+	if zone := value[digits:]; len(zone) >= 3 && (zone[0] == '+' || zone[0] == '-') {
+		hours, _ := strconv.Atoi(zone[1:3])
+		minutes := 0
+		if rest := strings.Trim(zone[3:], "'"); len(rest) >= 2 {
+			minutes, _ = strconv.Atoi(rest[:2])
+		}
+		offset := hours*3600 + minutes*60
+		if zone[0] == '-' {
+			offset = -offset
+		}
+		location = time.FixedZone("", offset)
+	}
+	parsed, err := time.ParseInLocation("20060102150405", stamp, location)
+	if err != nil {
+		return nil
+	}
+	return &parsed
+}
+
+// verifyPDFSignature checks one signature: that the signed ranges are unchanged and the CMS
+// signature matches them, then whether the signer's certificate chains to roots. The certificate
+// is checked at the time of a trusted time stamp, otherwise now: the signing time a signer states
+// is only its own claim. roots may be nil when no trust store is configured.
+func verifyPDFSignature(data []byte, signature pdfSignature, roots *x509.CertPool) models.FileSignature {
+	result := models.FileSignature{
+		Status:     models.FileSignatureError,
+		SignerName: signature.Name,
+		SubFilter:  signature.SubFilter,
+		Reason:     signature.Reason,
+		Location:   signature.Location,
+	}
+	if signature.ClaimedTime != nil {
+		result.SigningTime = signature.ClaimedTime
+		result.TimeSource = models.SignatureTimeClaimed
+	}
+	if signature.err != nil {
+		result.Error = signature.err.Error()
+		return result
+	}
+	byteRange := signature.ByteRange
+	result.CoversWholeDocument = len(bytes.TrimRight(data[byteRange[2]+byteRange[3]:], "\x00\t\n\f\r ")) == 0
+	signedRanges := digestOf(data[:byteRange[1]], data[byteRange[2]:byteRange[2]+byteRange[3]])
+
+	if signature.SubFilter == "adbe.x509.rsa_sha1" {
+		result.Error = "định dạng chữ ký adbe.x509.rsa_sha1 không được hỗ trợ"
+		return result
+	}
+	signedData, err := parseCMSSignedData(signature.CMS)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	var signer *cmsSigner
+	var timestamp *cmsTimestamp
+	switch signature.SubFilter {
+	case "ETSI.RFC3161":
+		// A document time stamp: the token itself is the signature, its imprint the file's digest
+		timestamp, err = signedData.verifyTimestamp(signedRanges)
+		if timestamp != nil {
+			signer = timestamp.signer
+		}
+	case "adbe.pkcs7.sha1":
+		// The SHA-1 digest of the ranges is the encapsulated content, signed in turn
+		if !bytes.Equal(signedData.EncapContentInfo.Content, signedRanges(crypto.SHA1)) {
+			err = errSignedContentChanged
+		} else {
+			signer, err = signedData.verify(digestOf(signedData.EncapContentInfo.Content))
+		}
+	default:
+		signer, err = signedData.verify(signedRanges)
+	}
+	if err == nil && signer.timestampToken != nil {
+		timestamp, err = verifyTimestampToken(signer.timestampToken, digestOf(signer.info.Signature))
+	}
+	if err != nil {
+		if errors.Is(err, errSignedContentChanged) || errors.Is(err, errSignatureMismatch) || errors.Is(err, errTimestampMismatch) {
+			result.Status = models.FileSignatureInvalid
+		}
+		result.Error = err.Error()
+		return result
+	}
+
+	cert := signer.cert
+	result.IntegrityValid = true
+	result.DigestAlgorithm = signer.hash.String()
+	if cert.Subject.CommonName != "" {
+		result.SignerName = cert.Subject.CommonName
+	}
+	result.SignerOrganization = strings.Join(cert.Subject.Organization, ", ")
+	result.Issuer = cert.Issuer.CommonName
+	if result.Issuer == "" {
+		result.Issuer = cert.Issuer.String()
+	}
+	result.SerialNumber = strings.ToUpper(cert.SerialNumber.Text(16))
+	notBefore, notAfter := cert.NotBefore, cert.NotAfter
+	result.CertNotBefore, result.CertNotAfter = &notBefore, &notAfter
+	if signer.signingTime != nil {
+		result.SigningTime = signer.signingTime
+		result.TimeSource = models.SignatureTimeClaimed
+	}
+	// A time stamp only proves the time when its authority is trusted too
+	checkTime := time.Now()
+	if timestamp != nil && roots != nil && verifyCertificateChain(timestamp.signer, roots, timestamp.time) == nil {
+		result.SigningTime = &timestamp.time
+		result.TimeSource = models.SignatureTimeTimestamp
+		checkTime = timestamp.time
+	}
+	result.CertValidAtSigning = !checkTime.Before(cert.NotBefore) && !checkTime.After(cert.NotAfter)
+
+	switch {
+	case roots == nil:
+		result.Error = "chưa cấu hình kho chứng thư số tin cậy"
+	case !result.CertValidAtSigning && result.TimeSource == models.SignatureTimeTimestamp:
+		result.Error = "chứng thư số không còn hiệu lực tại thời điểm ký"
+	case !result.CertValidAtSigning:
+		result.Error = "chứng thư số đã hết hạn hoặc chưa có hiệu lực"
+	default:
+		if err := verifyCertificateChain(signer, roots, checkTime); err != nil {
+			result.Error = fmt.Sprintf("chứng thư số không được cấp bởi tổ chức chứng thực tin cậy: %v", err)
+		} else {
+			result.ChainValid = true
+		}
+	}
+	result.Status = models.FileSignatureUntrusted
+	if result.ChainValid && result.CertValidAtSigning {
+		result.Status = models.FileSignatureValid
+	}
+	return result
+}
+
+// verifyCertificateChain checks the signer's certificate against roots, using the certificates
+// carried in the CMS as intermediates. Revocation is not checked.
+func verifyCertificateChain(signer *cmsSigner, roots *x509.CertPool, at time.Time) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range signer.certificates {
+		intermediates.AddCert(cert)
+	}
+	_, err := signer.cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
+
+var (
+	oidSignedData         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidAttrMessageDigest  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningTime    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidAttrTimestampToken = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	oidRSASSAPSS          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+)
+
+// Digest algorithms by OID. Some signers put the signature algorithm where the digest belongs,
+// so the RSA-with-hash OIDs are accepted too.
+var cmsDigestAlgorithms = map[string]crypto.Hash{
+	"1.3.14.3.2.26":          crypto.SHA1,
+	"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+	"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+	"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+	"1.2.840.113549.1.1.5":   crypto.SHA1,
+	"1.2.840.113549.1.1.11":  crypto.SHA256,
+	"1.2.840.113549.1.1.12":  crypto.SHA384,
+	"1.2.840.113549.1.1.13":  crypto.SHA512,
+}
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     []byte `asn1:"optional,explicit,tag:0"`
+	}
+	Certificates asn1.RawValue   `asn1:"optional,tag:0"`
+	CRLs         asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos  []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// cmsSigner is a SignerInfo whose signature checked out
+type cmsSigner struct {
+	info           cmsSignerInfo
+	cert           *x509.Certificate
+	certificates   []*x509.Certificate // All certificates carried in the CMS
+	hash           crypto.Hash
+	signingTime    *time.Time // The signing-time attribute, as claimed by the signer
+	timestampToken []byte     // An unsigned signature time stamp, not yet verified
+}
+
+type cmsTimestamp struct {
+	time   time.Time
+	signer *cmsSigner
+}
+
+// signedContent returns the digest of the content a signature covers with the given hash, so
+// large files are hashed in place rather than copied
+type signedContent func(hash crypto.Hash) []byte
+
+func digestOf(parts ...[]byte) signedContent {
+	return func(hash crypto.Hash) []byte {
+		h := hash.New()
+		for _, part := range parts {
+			h.Write(part)
+		}
+		return h.Sum(nil)
+	}
+}
+
+// parseCMSSignedData reads a DER ContentInfo holding SignedData; trailing padding is ignored
+func parseCMSSignedData(data []byte) (*cmsSignedData, error) {
+	var info cmsContentInfo
+	if _, err := asn1.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("không đọc được dữ liệu chữ ký: %v", err)
+	}
+	if !info.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("dữ liệu chữ ký không phải SignedData")
+	}
+	var signedData cmsSignedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &signedData); err != nil {
+		return nil, fmt.Errorf("không đọc được dữ liệu chữ ký: %v", err)
+	}
+	if len(signedData.SignerInfos) != 1 {
+		return nil, fmt.Errorf("chữ ký có %d người ký, cần đúng một", len(signedData.SignerInfos))
+	}
+	return &signedData, nil
+}
+
+// verify checks the signer's signature over content, through the signed attributes when present
+func (sd *cmsSignedData) verify(content signedContent) (*cmsSigner, error) {
+	info := sd.SignerInfos[0]
+	hash, ok := cmsDigestAlgorithms[info.DigestAlgorithm.Algorithm.String()]
+	if !ok || !hash.Available() {
+		return nil, fmt.Errorf("thuật toán băm %s không được hỗ trợ", info.DigestAlgorithm.Algorithm)
+	}
+	certificates, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("không đọc được chứng thư số trong chữ ký: %v", err)
+	}
+	signer := &cmsSigner{info: info, certificates: certificates, hash: hash}
+	if signer.cert = info.signerCertificate(certificates); signer.cert == nil {
+		return nil, errors.New("chữ ký không kèm chứng thư số của người ký")
+	}
+
+	digest := content(hash)
+	if len(info.SignedAttrs.FullBytes) > 0 {
+		// The signature covers the DER of the attributes, tagged as the SET OF they are
+		signedAttrs := append([]byte{0x31}, info.SignedAttrs.FullBytes[1:]...)
+		attributes, err := parseCMSAttributes(signedAttrs)
+		if err != nil {
+			return nil, err
+		}
+		var messageDigest []byte
+		if value := attributes[oidAttrMessageDigest.String()]; value != nil {
+			asn1.Unmarshal(value, &messageDigest)
+		}
+		if !bytes.Equal(messageDigest, digest) {
+			return nil, errSignedContentChanged
+		}
+		if value := attributes[oidAttrSigningTime.String()]; value != nil {
+			var signingTime time.Time
+			if _, err := asn1.Unmarshal(value, &signingTime); err == nil {
+				signer.signingTime = &signingTime
+			}
+		}
+		digest = digestOf(signedAttrs)(hash)
+	}
+	if err := checkCMSSignature(signer.cert, info, hash, digest); err != nil {
+		return nil, err
+	}
+
+	if len(info.UnsignedAttrs.FullBytes) > 0 {
+		attributes, err := parseCMSAttributes(append([]byte{0x31}, info.UnsignedAttrs.FullBytes[1:]...))
+		if err == nil {
+			signer.timestampToken = attributes[oidAttrTimestampToken.String()]
+		}
+	}
+	return signer, nil
+}
+
+// signerCertificate finds the certificate a SignerInfo names, by issuer and serial number or by
+// subject key identifier
+func (info cmsSignerInfo) signerCertificate(certificates []*x509.Certificate) *x509.Certificate {
+	if info.SID.Class == asn1.ClassContextSpecific && info.SID.Tag == 0 {
+		for _, cert := range certificates {
+			if len(cert.SubjectKeyId) > 0 && bytes.Equal(cert.SubjectKeyId, info.SID.Bytes) {
+				return cert
+			}
+		}
+		return nil
+	}
+	var issuerAndSerial struct {
+		Issuer       asn1.RawValue
+		SerialNumber *big.Int
+	}
+	if _, err := asn1.Unmarshal(info.SID.FullBytes, &issuerAndSerial); err != nil {
+		return nil
+	}
+	for _, cert := range certificates {
+		if bytes.Equal(cert.RawIssuer, issuerAndSerial.Issuer.FullBytes) && cert.SerialNumber.Cmp(issuerAndSerial.SerialNumber) == 0 {
+			return cert
+		}
+	}
+	return nil
+}
+
+// parseCMSAttributes returns the first value of each attribute of a SET OF Attribute, as DER
+func parseCMSAttributes(data []byte) (map[string][]byte, error) {
+	var attributes []cmsAttribute
+	if _, err := asn1.UnmarshalWithParams(data, &attributes, "set"); err != nil {
+		return nil, fmt.Errorf("không đọc được thuộc tính chữ ký: %v", err)
+	}
+	values := make(map[string][]byte, len(attributes))
+	for _, attribute := range attributes {
+		var first asn1.RawValue
+		if _, err := asn1.Unmarshal(attribute.Values.Bytes, &first); err == nil {
+			values[attribute.Type.String()] = first.FullBytes
+		}
+	}
+	return values, nil
+}
+
+func checkCMSSignature(cert *x509.Certificate, info cmsSignerInfo, hash crypto.Hash, digest []byte) error {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		var err error
+		if info.SignatureAlgorithm.Algorithm.Equal(oidRSASSAPSS) {
+			err = rsa.VerifyPSS(key, hash, digest, info.Signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+		} else {
+			err = rsa.VerifyPKCS1v15(key, hash, digest, info.Signature)
+		}
+		if err != nil {
+			return errSignatureMismatch
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest, info.Signature) {
+			return errSignatureMismatch
+		}
+	default:
+		return errors.New("loại khóa của chứng thư số không được hỗ trợ")
+	}
+	return nil
+}
+
+// tstInfo is the content of an RFC 3161 time stamp token
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint struct {
+		HashAlgorithm pkix.AlgorithmIdentifier
+		HashedMessage []byte
+	}
+	SerialNumber *big.Int
+	GenTime      time.Time `asn1:"generalized"`
+	Accuracy     struct {
+		Seconds      int `asn1:"optional"`
+		Milliseconds int `asn1:"optional,tag:0"`
+		Microseconds int `asn1:"optional,tag:1"`
+	} `asn1:"optional"`
+	Ordering   bool          `asn1:"optional,default:false"`
+	Nonce      *big.Int      `asn1:"optional"`
+	TSA        asn1.RawValue `asn1:"optional,explicit,tag:0"`
+	Extensions asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+func verifyTimestampToken(token []byte, imprinted signedContent) (*cmsTimestamp, error) {
+	signedData, err := parseCMSSignedData(token)
+	if err != nil {
+		return nil, err
+	}
+	return signedData.verifyTimestamp(imprinted)
+}
+
+// verifyTimestamp checks a time stamp token and that it was issued for imprinted
+func (sd *cmsSignedData) verifyTimestamp(imprinted signedContent) (*cmsTimestamp, error) {
+	if !sd.EncapContentInfo.ContentType.Equal(oidTSTInfo) {
+		return nil, errors.New("dấu thời gian không hợp lệ")
+	}
+	signer, err := sd.verify(digestOf(sd.EncapContentInfo.Content))
+	if err != nil {
+		if errors.Is(err, errSignedContentChanged) || errors.Is(err, errSignatureMismatch) {
+			return nil, errTimestampMismatch
+		}
+		return nil, err
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.Content, &info); err != nil {
+		return nil, fmt.Errorf("không đọc được dấu thời gian: %v", err)
+	}
+	hash, ok := cmsDigestAlgorithms[info.MessageImprint.HashAlgorithm.Algorithm.String()]
+	if !ok || !hash.Available() {
+		return nil, fmt.Errorf("thuật toán băm %s không được hỗ trợ", info.MessageImprint.HashAlgorithm.Algorithm)
+	}
+	if !bytes.Equal(info.MessageImprint.HashedMessage, imprinted(hash)) {
+		return nil, errTimestampMismatch
+	}
+	return &cmsTimestamp{time: info.GenTime, signer: signer}, nil
+}
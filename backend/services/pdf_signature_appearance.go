@@ -0,0 +1,247 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/unicode/norm"
+)
+
+// The visible block of a signature: a framed box of text lines drawn as the widget's appearance.
+// Vietnamese needs a TrueType font with its glyphs, embedded whole; without one the standard
+// Helvetica is used and the text loses its diacritics.
+
+const (
+	signatureBlockWidth    = 250.0
+	signatureBlockMargin   = 36.0 // From the bottom right corner of the page
+	signatureBlockPadding  = 6.0
+	signatureBlockFontSize = 8.0
+	signatureBlockLeading  = 11.0
+)
+
+// signatureFont is the font of the block; font is nil for Helvetica
+type signatureFont struct {
+	data   []byte
+	font   *sfnt.Font
+	buffer sfnt.Buffer
+	used   map[sfnt.GlyphIndex]rune
+}
+
+// loadSignatureFont reads a TrueType font; an empty path means Helvetica
+func loadSignatureFont(path string) (*signatureFont, error) {
+	if path == "" {
+		return &signatureFont{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("không đọc được font chữ ký: %v", err)
+	}
+	if bytes.HasPrefix(data, []byte("OTTO")) {
+		return nil, fmt.Errorf("font chữ ký phải là TrueType (.ttf)")
+	}
+	parsed, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("font chữ ký không hợp lệ: %v", err)
+	}
+	return &signatureFont{data: data, font: parsed, used: map[sfnt.GlyphIndex]rune{}}, nil
+}
+
+// Widths of the printable ASCII characters in Helvetica, 1/1000 em
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// foldToASCII drops diacritics for Helvetica: "Nguyễn Văn Đức" becomes "Nguyen Van Duc"
+func foldToASCII(text string) string {
+	var folded strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case r == 'đ':
+			folded.WriteByte('d')
+		case r == 'Đ':
+			folded.WriteByte('D')
+		case r >= 0x20 && r <= 0x7E:
+			folded.WriteRune(r)
+		default:
+			folded.WriteByte('?')
+		}
+	}
+	return folded.String()
+}
+
+// glyph returns the glyph of r, or of '?' when the font lacks it
+func (f *signatureFont) glyph(r rune) (sfnt.GlyphIndex, rune) {
+	if glyph, err := f.font.GlyphIndex(&f.buffer, r); err == nil && glyph != 0 {
+		return glyph, r
+	}
+	glyph, _ := f.font.GlyphIndex(&f.buffer, '?')
+	return glyph, '?'
+}
+
+func (f *signatureFont) advance(glyph sfnt.GlyphIndex) float64 {
+	advance, err := f.font.GlyphAdvance(&f.buffer, glyph, fixed.I(1000), font.HintingNone)
+	if err != nil {
+		return 0
+	}
+	return float64(advance) / 64
+}
+
+// width returns the width of text in 1/1000 em
+func (f *signatureFont) width(text string) float64 {
+	width := 0.0
+	if f.font == nil {
+		for _, b := range []byte(foldToASCII(text)) {
+			width += float64(helveticaWidths[b-0x20])
+		}
+		return width
+	}
+	for _, r := range norm.NFC.String(text) {
+		glyph, _ := f.glyph(r)
+		width += f.advance(glyph)
+	}
+	return width
+}
+
+// encode returns the string operand showing text, noting the glyphs to embed
+func (f *signatureFont) encode(text string) []byte {
+	if f.font == nil {
+		return []byte(foldToASCII(text))
+	}
+	var shown []byte
+	for _, r := range norm.NFC.String(text) {
+		glyph, shownRune := f.glyph(r)
+		f.used[glyph] = shownRune
+		shown = append(shown, byte(glyph>>8), byte(glyph))
+	}
+	return shown
+}
+
+// fit encodes text, shortened with "..." when it is wider than width points at the block's font size
+func (f *signatureFont) fit(text string, width float64) []byte {
+	limit := width * 1000 / signatureBlockFontSize
+	if f.width(text) <= limit {
+		return f.encode(text)
+	}
+	runes := []rune(text)
+	for cut := len(runes) - 1; cut > 0; cut-- {
+		if candidate := strings.TrimSpace(string(runes[:cut])) + "..."; f.width(candidate) <= limit {
+			return f.encode(candidate)
+		}
+	}
+	return nil
+}
+
+// signatureAppearance draws the block and returns its content stream and size
+func signatureAppearance(f *signatureFont, lines []string) ([]byte, float64, float64) {
+	width := signatureBlockWidth
+	height := 2*signatureBlockPadding + float64(len(lines))*signatureBlockLeading
+
+	var content bytes.Buffer
+	content.WriteString("q\n0.75 0 0 RG 0.75 0 0 rg 1 w\n")
+	fmt.Fprintf(&content, "0.5 0.5 %.2f %.2f re S\n", width-1, height-1)
+	fmt.Fprintf(&content, "BT\n/F1 %.1f Tf %.1f TL\n", signatureBlockFontSize, signatureBlockLeading)
+	fmt.Fprintf(&content, "%.2f %.2f Td\n", signatureBlockPadding, height-signatureBlockPadding-signatureBlockFontSize)
+	for i, line := range lines {
+		if i > 0 {
+			content.WriteString("T*\n")
+		}
+		writePDFObject(&content, pdfString(f.fit(line, width-2*signatureBlockPadding)))
+		content.WriteString(" Tj\n")
+	}
+	content.WriteString("ET\nQ\n")
+	return content.Bytes(), width, height
+}
+
+// write adds the font objects to the update, after all text has been encoded
+func (f *signatureFont) write(update *pdfUpdate) pdfRef {
+	ref := update.newObject()
+	if f.font == nil {
+		update.writeObject(ref, pdfDict{
+			"Type": pdfName("Font"), "Subtype": pdfName("Type1"),
+			"BaseFont": pdfName("Helvetica"), "Encoding": pdfName("WinAnsiEncoding"),
+		})
+		return ref
+	}
+
+	baseFont := "SignatureFont"
+	if name, err := f.font.Name(&f.buffer, sfnt.NameIDPostScript); err == nil && name != "" {
+		baseFont = strings.Map(func(r rune) rune {
+			if r > 0x20 && r < 0x7F && !isPDFDelimiter(byte(r)) {
+				return r
+			}
+			return -1
+		}, name)
+	}
+
+	glyphs := make([]int, 0, len(f.used))
+	for glyph := range f.used {
+		glyphs = append(glyphs, int(glyph))
+	}
+	sort.Ints(glyphs)
+	var widths pdfArray
+	var toUnicode strings.Builder
+	toUnicode.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for i, glyph := range glyphs {
+		widths = append(widths, glyph, pdfArray{int(f.advance(sfnt.GlyphIndex(glyph)) + 0.5)})
+		if i%100 == 0 {
+			if i > 0 {
+				toUnicode.WriteString("endbfchar\n")
+			}
+			fmt.Fprintf(&toUnicode, "%d beginbfchar\n", min(100, len(glyphs)-i))
+		}
+		fmt.Fprintf(&toUnicode, "<%04X> <", glyph)
+		for _, unit := range utf16.Encode([]rune{f.used[sfnt.GlyphIndex(glyph)]}) {
+			fmt.Fprintf(&toUnicode, "%04X", unit)
+		}
+		toUnicode.WriteString(">\n")
+	}
+	if len(glyphs) > 0 {
+		toUnicode.WriteString("endbfchar\n")
+	}
+	toUnicode.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+
+	metrics, _ := f.font.Metrics(&f.buffer, fixed.I(1000), font.HintingNone)
+	bounds, _ := f.font.Bounds(&f.buffer, fixed.I(1000), font.HintingNone)
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write(f.data)
+	writer.Close()
+
+	fileRef, descriptorRef, cidRef, unicodeRef := update.newObject(), update.newObject(), update.newObject(), update.newObject()
+	update.writeStream(fileRef, pdfDict{"Filter": pdfName("FlateDecode"), "Length1": len(f.data)}, compressed.Bytes())
+	update.writeObject(descriptorRef, pdfDict{
+		"Type": pdfName("FontDescriptor"), "FontName": pdfName(baseFont), "Flags": 32,
+		"FontBBox":    pdfArray{bounds.Min.X.Round(), -bounds.Max.Y.Round(), bounds.Max.X.Round(), -bounds.Min.Y.Round()},
+		"ItalicAngle": 0, "Ascent": metrics.Ascent.Round(), "Descent": -metrics.Descent.Round(),
+		"CapHeight": metrics.CapHeight.Round(), "StemV": 80, "FontFile2": fileRef,
+	})
+	update.writeObject(cidRef, pdfDict{
+		"Type": pdfName("Font"), "Subtype": pdfName("CIDFontType2"), "BaseFont": pdfName(baseFont),
+		"CIDSystemInfo":  pdfDict{"Registry": pdfString("Adobe"), "Ordering": pdfString("Identity"), "Supplement": 0},
+		"FontDescriptor": descriptorRef, "CIDToGIDMap": pdfName("Identity"), "W": widths,
+	})
+	update.writeStream(unicodeRef, pdfDict{}, []byte(toUnicode.String()))
+	update.writeObject(ref, pdfDict{
+		"Type": pdfName("Font"), "Subtype": pdfName("Type0"), "BaseFont": pdfName(baseFont),
+		"Encoding": pdfName("Identity-H"), "DescendantFonts": pdfArray{cidRef}, "ToUnicode": unicodeRef,
+	})
+	return ref
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"ai-code-agent-backend/models"
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// The signed fixtures were made with "openssl cms -sign" over the byte ranges of a one page PDF,
+// by certificates issued by testdata/trusted_root.pem unless their name says otherwise
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func testTrustedRoots(t *testing.T) *x509.CertPool {
+	t.Helper()
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(readTestdata(t, "trusted_root.pem")) {
+		t.Fatal("no certificate in trusted_root.pem")
+	}
+	return roots
+}
+
+// verifyOne verifies a file expected to hold a single signature
+func verifyOne(t *testing.T, data []byte, roots *x509.CertPool) models.FileSignature {
+	t.Helper()
+	results := verifyPDFSignatures(data, roots)
+	if len(results) != 1 {
+		t.Fatalf("got %d signatures, want 1: %+v", len(results), results)
+	}
+	return results[0]
+}
+
+var testStartXref = regexp.MustCompile(`startxref\s+(\d+)`)
+
+// appendPDFUpdate appends an incremental update redefining the given objects, numbered in
+// ascending order
+func appendPDFUpdate(data []byte, size int, objects map[int]string) []byte {
+	numbers := make([]int, 0, len(objects))
+	for num := range objects {
+		numbers = append(numbers, num)
+	}
+	sort.Ints(numbers)
+
+	out := bytes.NewBuffer(append([]byte(nil), data...))
+	var xref bytes.Buffer
+	for _, num := range numbers {
+		fmt.Fprintf(&xref, "%d 1\n%010d 00000 n \n", num, out.Len())
+		fmt.Fprintf(out, "%d 0 obj\n%s\nendobj\n", num, objects[num])
+	}
+	prev := testStartXref.FindAllSubmatch(data, -1)
+	startXref := out.Len()
+	fmt.Fprintf(out, "xref\n%strailer\n<< /Size %d /Root 1 0 R /Prev %s >>\nstartxref\n%d\n%%%%EOF\n",
+		xref.String(), size, prev[len(prev)-1][1], startXref)
+	return out.Bytes()
+}
+
+func TestVerifyPDFSignatureValid(t *testing.T) {
+	result := verifyOne(t, readTestdata(t, "signed.pdf"), testTrustedRoots(t))
+
+	if result.Status != models.FileSignatureValid {
+		t.Fatalf("status = %s (%s), want valid", result.Status, result.Error)
+	}
+	if !result.IntegrityValid || !result.ChainValid || !result.CertValidAtSigning || !result.CoversWholeDocument {
+		t.Errorf("checks = %+v, want all passed", result)
+	}
+	if result.SignerName != "Nguyễn Văn A" || result.Reason != "Phê duyệt" || result.DigestAlgorithm != "SHA-256" {
+		t.Errorf("signer = %q, reason = %q, digest = %q", result.SignerName, result.Reason, result.DigestAlgorithm)
+	}
+	if result.TimeSource != models.SignatureTimeClaimed || result.SigningTime == nil {
+		t.Errorf("signing time = %v from %q, want the signer's claim", result.SigningTime, result.TimeSource)
+	}
+}
+
+func TestVerifyPDFSignatureTampered(t *testing.T) {
+	data := readTestdata(t, "signed.pdf")
+	at := bytes.Index(data, []byte("So 15/UBND-VP"))
+	if at < 0 {
+		t.Fatal("fixture text not found")
+	}
+	data[at+3] = '6'
+
+	result := verifyOne(t, data, testTrustedRoots(t))
+	if result.Status != models.FileSignatureInvalid || result.IntegrityValid {
+		t.Errorf("status = %s, integrity = %v, want invalid", result.Status, result.IntegrityValid)
+	}
+}
+
+func TestVerifyPDFSignatureUntrustedRoot(t *testing.T) {
+	data := readTestdata(t, "signed_untrusted_root.pdf")
+
+	result := verifyOne(t, data, testTrustedRoots(t))
+	if result.Status != models.FileSignatureUntrusted || !result.IntegrityValid || result.ChainValid {
+		t.Errorf("status = %s, integrity = %v, chain = %v, want untrusted with intact content",
+			result.Status, result.IntegrityValid, result.ChainValid)
+	}
+
+	// Without a trust store nothing can be trusted
+	result = verifyOne(t, data, nil)
+	if result.Status != models.FileSignatureUntrusted || result.Error == "" {
+		t.Errorf("without roots: status = %s, error = %q", result.Status, result.Error)
+	}
+}
+
+func TestVerifyPDFSignatureExpiredCertificate(t *testing.T) {
+	// The certificate ran from 2020 to 2021 and the file claims it was signed in June 2020.
+	// Without a time stamp the claim proves nothing, so the certificate is checked today.
+	result := verifyOne(t, readTestdata(t, "signed_expired_cert.pdf"), testTrustedRoots(t))
+
+	if result.Status != models.FileSignatureUntrusted || result.CertValidAtSigning {
+		t.Errorf("status = %s, cert valid = %v, want untrusted", result.Status, result.CertValidAtSigning)
+	}
+	if !result.IntegrityValid {
+		t.Errorf("integrity = false, want the content intact")
+	}
+	claimed := time.Date(2020, 6, 1, 2, 0, 0, 0, time.UTC)
+	if result.SigningTime == nil || !result.SigningTime.Equal(claimed) || result.TimeSource != models.SignatureTimeClaimed {
+		t.Errorf("signing time = %v from %q, want the claimed %v", result.SigningTime, result.TimeSource, claimed)
+	}
+}
+
+func TestVerifyPDFSignatureIncrementalUpdate(t *testing.T) {
+	data := readTestdata(t, "signed.pdf")
+	roots := testTrustedRoots(t)
+
+	// Trailing line breaks some tools add are not a change
+	if result := verifyOne(t, append(append([]byte(nil), data...), "\r\n"...), roots); result.Status != models.FileSignatureValid {
+		t.Errorf("with a trailing line break: status = %s (%s), want valid", result.Status, result.Error)
+	}
+
+	content := "BT /F1 12 Tf 72 770 Td (So 99/UBND-VP) Tj ET"
+	updated := appendPDFUpdate(data, 8, map[int]string{
+		7: "<< /Length " + strconv.Itoa(len(content)) + " >>\nstream\n" + content + "\nendstream",
+	})
+	if text, err := extractPDFText(updated); err != nil || text != "So 99/UBND-VP" {
+		t.Fatalf("updated text = %q, %v", text, err)
+	}
+
+	result := verifyOne(t, updated, roots)
+	if result.Status != models.FileSignatureModified {
+		t.Errorf("status = %s, want modified", result.Status)
+	}
+	if !result.IntegrityValid || !result.ChainValid || result.CoversWholeDocument {
+		t.Errorf("integrity = %v, chain = %v, covers = %v, want the signed revision intact and not covering the file",
+			result.IntegrityValid, result.ChainValid, result.CoversWholeDocument)
+	}
+}
@@ -0,0 +1,485 @@
+package services
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Signing PDFs on the server with the organisation's certificate: a PAdES baseline signature
+// (ETSI.CAdES.detached) with a visible block, appended as an incremental update, and an RFC 3161
+// time stamp when a time stamping authority is configured.
+
+const (
+	tsaRequestTimeout        = 15 * time.Second
+	signatureReserveBase     = 4096  // Signed attributes, signature value and CMS structure
+	signatureReserveTSAToken = 12288 // A time stamp token with the authority's certificates
+)
+
+// DocumentSigner signs PDFs with a certificate and key read from a PKCS#12 file
+type DocumentSigner struct {
+	key      crypto.Signer
+	cert     *x509.Certificate
+	chain    []*x509.Certificate
+	tsaURL   string
+	fontPath string
+	location string
+}
+
+// PDFSignOptions describes one signature
+type PDFSignOptions struct {
+	SignerName string // The person on whose decision the document is signed, shown in the block
+	Reason     string
+	Time       time.Time
+}
+
+// DocumentSignerFromEnv loads the signing certificate named by PDF_SIGNING_PKCS12_FILE. It returns
+// nil without error when signing is not configured. The file is read on every call so a renewed
+// certificate applies without a restart.
+func DocumentSignerFromEnv() (*DocumentSigner, error) {
+	path := os.Getenv("PDF_SIGNING_PKCS12_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("không đọc được file chứng thư số: %v", err)
+	}
+	key, cert, chain, err := decodePKCS12(data, os.Getenv("PDF_SIGNING_PKCS12_PASSWORD"))
+	if err != nil {
+		return nil, err
+	}
+	switch key.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, errors.New("loại khóa của chứng thư số không được hỗ trợ")
+	}
+	if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, fmt.Errorf("chứng thư số hết hiệu lực từ %s", cert.NotAfter.Format("02/01/2006"))
+	}
+	return &DocumentSigner{
+		key:      key,
+		cert:     cert,
+		chain:    chain,
+		tsaURL:   os.Getenv("PDF_SIGNING_TSA_URL"),
+		fontPath: os.Getenv("PDF_SIGNING_FONT_FILE"),
+		location: os.Getenv("PDF_SIGNING_LOCATION"),
+	}, nil
+}
+
+// Certificate returns the signing certificate
+func (s *DocumentSigner) Certificate() *x509.Certificate {
+	return s.cert
+}
+
+// SignPDF returns the file with a signature appended, shown as a block at the bottom right of
+// the last page. Signatures already in the file stay valid.
+func (s *DocumentSigner) SignPDF(data []byte, options PDFSignOptions) ([]byte, error) {
+	doc, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+	root := doc.dict(doc.trailer["Root"])
+	rootRef, ok := doc.trailer["Root"].(pdfRef)
+	if root == nil || !ok {
+		return nil, errors.New("file PDF không có danh mục gốc")
+	}
+	pageRef, page := lastPage(doc, root)
+	if page == nil {
+		return nil, errors.New("file PDF không có trang nào")
+	}
+	signatureFont, err := loadSignatureFont(s.fontPath)
+	if err != nil {
+		return nil, err
+	}
+	update, err := newPDFUpdate(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// The visible block
+	lines := []string{"Ký bởi: " + s.cert.Subject.CommonName}
+	if len(s.cert.Subject.Organization) > 0 {
+		lines = append(lines, "Cơ quan: "+strings.Join(s.cert.Subject.Organization, ", "))
+	}
+	if options.SignerName != "" {
+		lines = append(lines, "Người duyệt: "+options.SignerName)
+	}
+	lines = append(lines, "Thời gian: "+options.Time.Format("15:04:05 02/01/2006"))
+	if options.Reason != "" {
+		lines = append(lines, "Lý do: "+options.Reason)
+	}
+	content, width, height := signatureAppearance(signatureFont, lines)
+	box := pageBox(doc, page)
+	bottom := signatureBlockBottom(doc, page, box[1]+signatureBlockMargin)
+	rect := pdfArray{
+		box[2] - signatureBlockMargin - width, bottom,
+		box[2] - signatureBlockMargin, bottom + height,
+	}
+
+	signatureRef, fieldRef, appearanceRef := update.newObject(), update.newObject(), update.newObject()
+	fontRef := signatureFont.write(update)
+	update.writeStream(appearanceRef, pdfDict{
+		"Type": pdfName("XObject"), "Subtype": pdfName("Form"), "BBox": pdfArray{0, 0, width, height},
+		"Resources": pdfDict{"Font": pdfDict{"F1": fontRef}},
+	}, content)
+
+	// The field and its widget, merged into one dictionary, on the page and in the form
+	form, formRef := pdfDict{}, pdfRef{}
+	if ref, ok := root["AcroForm"].(pdfRef); ok {
+		formRef = ref
+	}
+	if existing := doc.dict(root["AcroForm"]); existing != nil {
+		form = copyPDFDict(existing)
+	}
+	fields := append(pdfArray{}, doc.array(form["Fields"])...)
+	update.writeObject(fieldRef, pdfDict{
+		"Type": pdfName("Annot"), "Subtype": pdfName("Widget"), "FT": pdfName("Sig"),
+		"T": pdfTextString(signatureFieldName(doc, fields)), "V": signatureRef, "F": 132, // Print, locked
+		"Rect": rect, "P": pageRef, "AP": pdfDict{"N": appearanceRef},
+	})
+	form["Fields"] = append(fields, fieldRef)
+	form["SigFlags"] = 3
+	if formRef.Num > 0 {
+		update.writeObject(formRef, form)
+	} else {
+		root = copyPDFDict(root)
+		root["AcroForm"] = form
+		update.writeObject(rootRef, root)
+	}
+	page = copyPDFDict(page)
+	page["Annots"] = append(append(pdfArray{}, doc.array(page["Annots"])...), fieldRef)
+	update.writeObject(pageRef, page)
+
+	// The signature value, with room for the CMS to be written in once the byte ranges are known
+	reserve := signatureReserveBase + len(s.cert.Raw)
+	for _, cert := range s.chain {
+		reserve += len(cert.Raw)
+	}
+	if s.tsaURL != "" {
+		reserve += signatureReserveTSAToken
+	}
+	update.beginObject(signatureRef)
+	update.buf.WriteString("<</Type /Sig /Filter /Adobe.PPKLite /SubFilter /ETSI.CAdES.detached /ByteRange ")
+	byteRangeAt := update.buf.Len()
+	update.buf.WriteString("[0 0000000000 0000000000 0000000000]")
+	update.buf.WriteString(" /Contents ")
+	contentsAt := update.buf.Len()
+	update.buf.WriteString("<" + strings.Repeat("0", 2*reserve) + ">")
+	details := pdfDict{"M": pdfString(options.Time.Format("D:20060102150405-07'00'")), "Name": pdfTextString(s.cert.Subject.CommonName)}
+	if options.Reason != "" {
+		details["Reason"] = pdfTextString(options.Reason)
+	}
+	if s.location != "" {
+		details["Location"] = pdfTextString(s.location)
+	}
+	for _, key := range []pdfName{"M", "Name", "Reason", "Location"} {
+		if value, ok := details[key]; ok {
+			update.buf.WriteByte(' ')
+			writePDFObject(&update.buf, key)
+			update.buf.WriteByte(' ')
+			writePDFObject(&update.buf, value)
+		}
+	}
+	update.buf.WriteString(">>\nendobj\n")
+
+	signed := update.finish()
+	contentsEnd := contentsAt + 2 + 2*reserve
+	copy(signed[byteRangeAt:], fmt.Sprintf("[0 %010d %010d %010d]", contentsAt, contentsEnd, len(signed)-contentsEnd))
+
+	digest := sha256.New()
+	digest.Write(signed[:contentsAt])
+	digest.Write(signed[contentsEnd:])
+	cms, err := s.signedData(digest.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	if len(cms) > reserve {
+		return nil, errors.New("chữ ký vượt quá dung lượng dành sẵn trong file")
+	}
+	hex.Encode(signed[contentsAt+1:], cms)
+	return signed, nil
+}
+
+// lastPage finds the last page of the page tree, which the block goes on
+func lastPage(doc *pdfDocument, root pdfDict) (pdfRef, pdfDict) {
+	node := root["Pages"]
+	for depth := 0; depth < 64; depth++ {
+		ref, ok := node.(pdfRef)
+		dict := doc.dict(node)
+		if !ok || dict == nil {
+			return pdfRef{}, nil
+		}
+		kids := doc.array(dict["Kids"])
+		if len(kids) == 0 {
+			if doc.name(dict["Type"]) == "Pages" {
+				return pdfRef{}, nil
+			}
+			return ref, dict
+		}
+		node = kids[len(kids)-1]
+	}
+	return pdfRef{}, nil
+}
+
+// pageBox returns the visible area of a page, [x1 y1 x2 y2], inherited through the page tree
+func pageBox(doc *pdfDocument, page pdfDict) [4]float64 {
+	box := [4]float64{0, 0, 595, 842} // A4
+	for _, key := range []pdfName{"CropBox", "MediaBox"} {
+		node := page
+		for depth := 0; node != nil && depth < 64; depth++ {
+			if array := doc.array(node[key]); len(array) == 4 {
+				var found [4]float64
+				for i, value := range array {
+					found[i], _ = doc.number(value)
+				}
+				if found[0] > found[2] {
+					found[0], found[2] = found[2], found[0]
+				}
+				if found[1] > found[3] {
+					found[1], found[3] = found[3], found[1]
+				}
+				return found
+			}
+			node = doc.dict(node["Parent"])
+		}
+	}
+	return box
+}
+
+// signatureBlockBottom stacks the block above the blocks of earlier signatures on the page
+func signatureBlockBottom(doc *pdfDocument, page pdfDict, bottom float64) float64 {
+	for _, annot := range doc.array(page["Annots"]) {
+		widget := doc.dict(annot)
+		if doc.name(widget["FT"]) != "Sig" && doc.name(doc.dict(widget["Parent"])["FT"]) != "Sig" {
+			continue
+		}
+		if rect := doc.array(widget["Rect"]); len(rect) == 4 {
+			y1, _ := doc.number(rect[1])
+			y2, _ := doc.number(rect[3])
+			if top := math.Max(y1, y2); y1 != y2 && top+signatureBlockPadding > bottom {
+				bottom = top + signatureBlockPadding
+			}
+		}
+	}
+	return bottom
+}
+
+// signatureFieldName returns a field name not used yet
+func signatureFieldName(doc *pdfDocument, fields pdfArray) string {
+	taken := map[string]bool{}
+	for _, field := range fields {
+		taken[doc.textString(doc.dict(field)["T"])] = true
+	}
+	for n := len(fields) + 1; ; n++ {
+		if name := fmt.Sprintf("Signature%d", n); !taken[name] {
+			return name
+		}
+	}
+}
+
+var (
+	oidAttrContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidDigestSHA256             = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256          = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+type cmsAttributeOut struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type cmsSignerInfoOut struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional"`
+}
+
+type cmsSignedDataOut struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo struct {
+		ContentType asn1.ObjectIdentifier
+	}
+	Certificates asn1.RawValue
+	SignerInfos  []cmsSignerInfoOut `asn1:"set"`
+}
+
+// signedData builds the detached CMS for a document digest: the signing certificate is bound by
+// the signingCertificateV2 attribute, and the signing time is left to /M as PAdES requires
+func (s *DocumentSigner) signedData(documentDigest []byte) ([]byte, error) {
+	certHash := sha256.Sum256(s.cert.Raw)
+	signingCertificate, err := asn1.Marshal(struct {
+		Certs []struct{ CertHash []byte }
+	}{Certs: []struct{ CertHash []byte }{{CertHash: certHash[:]}}})
+	if err != nil {
+		return nil, err
+	}
+	contentType, _ := asn1.Marshal(oidPKCS7Data)
+	messageDigest, _ := asn1.Marshal(documentDigest)
+	signedAttrs, err := derSetOf(
+		cmsAttributeOut{Type: oidAttrContentType, Values: []asn1.RawValue{{FullBytes: contentType}}},
+		cmsAttributeOut{Type: oidAttrMessageDigest, Values: []asn1.RawValue{{FullBytes: messageDigest}}},
+		cmsAttributeOut{Type: oidAttrSigningCertificateV2, Values: []asn1.RawValue{{FullBytes: signingCertificate}}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	attrsDigest := sha256.Sum256(signedAttrs)
+	signature, err := s.key.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("không ký được: %v", err)
+	}
+	signatureAlgorithm := pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	if _, ok := s.key.Public().(*rsa.PublicKey); ok {
+		signatureAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+	}
+
+	issuerAndSerial, err := asn1.Marshal(struct {
+		Issuer       asn1.RawValue
+		SerialNumber interface{}
+	}{asn1.RawValue{FullBytes: s.cert.RawIssuer}, s.cert.SerialNumber})
+	if err != nil {
+		return nil, err
+	}
+	signerInfo := cmsSignerInfoOut{
+		Version:            1,
+		SID:                asn1.RawValue{FullBytes: issuerAndSerial},
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidDigestSHA256},
+		SignedAttrs:        retagged(signedAttrs, 0xA0),
+		SignatureAlgorithm: signatureAlgorithm,
+		Signature:          signature,
+	}
+
+	if s.tsaURL != "" {
+		token, err := requestTimestamp(s.tsaURL, signature)
+		if err != nil {
+			return nil, err
+		}
+		unsignedAttrs, err := derSetOf(cmsAttributeOut{Type: oidAttrTimestampToken, Values: []asn1.RawValue{{FullBytes: token}}})
+		if err != nil {
+			return nil, err
+		}
+		signerInfo.UnsignedAttrs = retagged(unsignedAttrs, 0xA1)
+	}
+
+	var certificates []byte
+	for _, cert := range append([]*x509.Certificate{s.cert}, s.chain...) {
+		certificates = append(certificates, cert.Raw...)
+	}
+	signedData := cmsSignedDataOut{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidDigestSHA256}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificates},
+		SignerInfos:      []cmsSignerInfoOut{signerInfo},
+	}
+	signedData.EncapContentInfo.ContentType = oidPKCS7Data
+	encoded, err := asn1.Marshal(signedData)
+	if err != nil {
+		return nil, err
+	}
+	// FullBytes would skip the EXPLICIT [0] of the content, so the wrapper is written out
+	return asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{oidSignedData, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: encoded}})
+}
+
+// derSetOf encodes a SET OF with its elements in the order DER requires
+func derSetOf(elements ...interface{}) ([]byte, error) {
+	encoded := make([][]byte, len(elements))
+	for i, element := range elements {
+		var err error
+		if encoded[i], err = asn1.Marshal(element); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(encoded, nil)})
+}
+
+// retagged returns a copy of a DER element under another tag, for IMPLICIT context tags
+func retagged(element []byte, tag byte) asn1.RawValue {
+	copied := append([]byte{}, element...)
+	copied[0] = tag
+	return asn1.RawValue{FullBytes: copied}
+}
+
+// requestTimestamp asks the time stamping authority to stamp a signature value (RFC 3161) and
+// returns the token, checked against the signature
+func requestTimestamp(url string, signature []byte) ([]byte, error) {
+	imprint := sha256.Sum256(signature)
+	var request struct {
+		Version        int
+		MessageImprint struct {
+			HashAlgorithm pkix.AlgorithmIdentifier
+			HashedMessage []byte
+		}
+		CertReq bool `asn1:"optional"`
+	}
+	request.Version = 1
+	request.MessageImprint.HashAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidDigestSHA256}
+	request.MessageImprint.HashedMessage = imprint[:]
+	request.CertReq = true
+	body, err := asn1.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: tsaRequestTimeout}
+	resp, err := client.Post(url, "application/timestamp-query", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("không kết nối được máy chủ cấp dấu thời gian: %v", err)
+	}
+	defer resp.Body.Close()
+	reply, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("không nhận được dấu thời gian: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("máy chủ cấp dấu thời gian trả về lỗi %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Status struct {
+			Status       int
+			StatusString asn1.RawValue  `asn1:"optional"`
+			FailInfo     asn1.BitString `asn1:"optional"`
+		}
+		TimeStampToken asn1.RawValue `asn1:"optional"`
+	}
+	if _, err := asn1.Unmarshal(reply, &response); err != nil {
+		return nil, fmt.Errorf("không đọc được dấu thời gian: %v", err)
+	}
+	// 0 granted, 1 granted with modifications
+	if response.Status.Status > 1 || len(response.TimeStampToken.FullBytes) == 0 {
+		return nil, fmt.Errorf("máy chủ cấp dấu thời gian từ chối yêu cầu (trạng thái %d)", response.Status.Status)
+	}
+	if _, err := verifyTimestampToken(response.TimeStampToken.FullBytes, digestOf(signature)); err != nil {
+		return nil, err
+	}
+	return response.TimeStampToken.FullBytes, nil
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"ai-code-agent-backend/models"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Both PKCS#12 fixtures hold a certificate issued by testdata/trusted_root.pem with the root as
+// its chain, protected by the password "secret": signer_aes.p12 as OpenSSL 3 writes it by default
+// (PBES2, AES-256-CBC) with an RSA key, signer_legacy.p12 with "-legacy" (RC2 and 3DES) and an
+// EC key
+var testPKCS12Files = []string{"signer_aes.p12", "signer_legacy.p12"}
+
+func testDocumentSigner(t *testing.T, file, password string) (*DocumentSigner, error) {
+	t.Helper()
+	t.Setenv("PDF_SIGNING_PKCS12_FILE", filepath.Join("testdata", file))
+	t.Setenv("PDF_SIGNING_PKCS12_PASSWORD", password)
+	t.Setenv("PDF_SIGNING_TSA_URL", "")
+	t.Setenv("PDF_SIGNING_FONT_FILE", "")
+	t.Setenv("PDF_SIGNING_LOCATION", "Hà Nội")
+	return DocumentSignerFromEnv()
+}
+
+func signTestPDF(t *testing.T, signer *DocumentSigner, data []byte) []byte {
+	t.Helper()
+	signed, err := signer.SignPDF(data, PDFSignOptions{SignerName: "Lê Thị Duyệt", Reason: "Phê duyệt văn bản", Time: time.Now()})
+	if err != nil {
+		t.Fatalf("SignPDF: %v", err)
+	}
+	return signed
+}
+
+func TestSignPDFRoundTrip(t *testing.T) {
+	roots := testTrustedRoots(t)
+	unsigned := testPagePDF("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		[]byte("BT /F1 12 Tf 72 770 Td (So 15/UBND-VP) Tj ET"))
+
+	for _, file := range testPKCS12Files {
+		t.Run(file, func(t *testing.T) {
+			signer, err := testDocumentSigner(t, file, "secret")
+			if err != nil {
+				t.Fatalf("DocumentSignerFromEnv: %v", err)
+			}
+			signed := signTestPDF(t, signer, unsigned)
+
+			result := verifyOne(t, signed, roots)
+			if result.Status != models.FileSignatureValid || !result.CoversWholeDocument {
+				t.Fatalf("status = %s (%s), covers = %v, want valid", result.Status, result.Error, result.CoversWholeDocument)
+			}
+			if result.SignerName != signer.Certificate().Subject.CommonName || result.SubFilter != "ETSI.CAdES.detached" ||
+				result.Reason != "Phê duyệt văn bản" || result.Location != "Hà Nội" {
+				t.Errorf("signature = %+v", result)
+			}
+			if text, err := extractPDFText(signed); err != nil || text != "So 15/UBND-VP" {
+				t.Errorf("text after signing = %q, %v", text, err)
+			}
+		})
+	}
+}
+
+func TestDocumentSignerWrongPassword(t *testing.T) {
+	for _, file := range testPKCS12Files {
+		if _, err := testDocumentSigner(t, file, "wrong"); !errors.Is(err, errPKCS12Password) {
+			t.Errorf("%s: err = %v, want %v", file, err, errPKCS12Password)
+		}
+	}
+}
+
+func TestSignPDFSecondSignature(t *testing.T) {
+	roots := testTrustedRoots(t)
+	signer, err := testDocumentSigner(t, "signer_aes.p12", "secret")
+	if err != nil {
+		t.Fatalf("DocumentSignerFromEnv: %v", err)
+	}
+	secondSigner, err := testDocumentSigner(t, "signer_legacy.p12", "secret")
+	if err != nil {
+		t.Fatalf("DocumentSignerFromEnv: %v", err)
+	}
+
+	// A file signed elsewhere, then by the organisation twice
+	signed := signTestPDF(t, signer, readTestdata(t, "signed.pdf"))
+	signed = signTestPDF(t, secondSigner, signed)
+
+	results := verifyPDFSignatures(signed, roots)
+	if len(results) != 3 {
+		t.Fatalf("got %d signatures, want 3", len(results))
+	}
+	for i, result := range results {
+		if result.Status != models.FileSignatureValid || result.Position != i+1 {
+			t.Errorf("signature %d: status = %s (%s), want valid", i+1, result.Status, result.Error)
+		}
+		if covers := i == len(results)-1; result.CoversWholeDocument != covers {
+			t.Errorf("signature %d: covers whole document = %v, want %v", i+1, result.CoversWholeDocument, covers)
+		}
+	}
+
+	// A change nobody signed afterwards shows on every signature
+	doc, err := parsePDF(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, _ := doc.integer(doc.trailer["Size"])
+	changed := appendPDFUpdate(signed, size, map[int]string{2: "<< /Type /Pages /Kids [3 0 R] /Count 1 /Rotate 90 >>"})
+	for i, result := range verifyPDFSignatures(changed, roots) {
+		if result.Status != models.FileSignatureModified {
+			t.Errorf("after an unsigned change, signature %d: status = %s, want modified", i+1, result.Status)
+		}
+	}
+}
@@ -0,0 +1,609 @@
+package services
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// pdfFont turns the codes of shown strings into text and glyph widths
+type pdfFont struct {
+	codeLengths  []int             // Byte lengths codes come in, shortest first
+	toUnicode    map[string]string // From the ToUnicode CMap
+	encoding     *[256]string      // Simple fonts without ToUnicode
+	widths       map[int]float64   // Glyph widths in thousandths of the font size
+	defaultWidth float64
+}
+
+// extractPDFText returns the text layer of a PDF, pages separated by a blank line. Scanned files
+// have no text layer unless OCR added one, which is read like any other text. A file cut short
+// before any of its pages is refused rather than read as empty.
+func extractPDFText(data []byte) (string, error) {
+	doc, err := parsePDF(data)
+	if err != nil {
+		return "", err
+	}
+	docPages := doc.pages()
+	if len(docPages) == 0 {
+		return "", errPDFSyntax
+	}
+
+	fonts := map[pdfRef]*pdfFont{}
+	var pages []string
+	for _, page := range docPages {
+		writer := &pdfTextWriter{}
+		doc.runContent(doc.contents(page), page.resources, writer, fonts, 0)
+		pages = append(pages, writer.out.String())
+	}
+	return strings.Join(pages, "\n\n"), nil
+}
+
+// pdfTextWriter assembles shown strings into lines, guessing spaces and line breaks from where
+// each string starts relative to where the previous one ended
+type pdfTextWriter struct {
+	out          strings.Builder
+	lastX, lastY float64
+	lastSize     float64
+	started      bool
+}
+
+func (w *pdfTextWriter) show(text string, x, y, size float64) {
+	if w.started {
+		threshold := math.Max(1, 0.5*w.lastSize)
+		gap := x - w.lastX
+		switch {
+		case math.Abs(y-w.lastY) > threshold:
+			w.separate('\n')
+		case gap > 0.15*math.Max(w.lastSize, size) || gap < -2*math.Max(w.lastSize, size):
+			w.separate(' ')
+		}
+	}
+	w.out.WriteString(text)
+	w.started = true
+}
+
+func (w *pdfTextWriter) separate(separator byte) {
+	current := w.out.String()
+	if current == "" {
+		return
+	}
+	last := current[len(current)-1]
+	if last == '\n' || (last == ' ' && separator == ' ') {
+		return
+	}
+	w.out.WriteByte(separator)
+}
+
+// pdfTextState is the part of the graphics state that positions text
+type pdfTextState struct {
+	tm, tlm                               [6]float64
+	font                                  *pdfFont
+	fontSize                              float64
+	charSpace, wordSpace, hScale, leading float64
+}
+
+var pdfIdentity = [6]float64{1, 0, 0, 1, 0, 0}
+
+// translate moves the text line matrix by (tx, ty) in text space
+func (s *pdfTextState) translate(tx, ty float64) {
+	m := s.tlm
+	s.tlm[4] = m[0]*tx + m[2]*ty + m[4]
+	s.tlm[5] = m[1]*tx + m[3]*ty + m[5]
+	s.tm = s.tlm
+}
+
+// advance moves the text matrix along the baseline by tx in text space
+func (s *pdfTextState) advance(tx float64) {
+	s.tm[4] += tx * s.tm[0]
+	s.tm[5] += tx * s.tm[1]
+}
+
+// userSize is the font size after the text matrix's scaling
+func (s *pdfTextState) userSize() float64 {
+	return s.fontSize * math.Hypot(s.tm[2], s.tm[3])
+}
+
+// runContent interprets a content stream, writing the text it shows. Form XObjects are
+// followed so text placed through them is not lost.
+func (d *pdfDocument) runContent(content []byte, resources pdfDict, writer *pdfTextWriter, fonts map[pdfRef]*pdfFont, depth int) {
+	if depth > 8 {
+		return
+	}
+	state := &pdfTextState{tm: pdfIdentity, tlm: pdfIdentity, hScale: 1}
+	lexer := &pdfLexer{data: content}
+	var operands []interface{}
+
+	show := func(value interface{}) {
+		text, ok := value.(pdfString)
+		if !ok || state.font == nil {
+			return
+		}
+		var decoded strings.Builder
+		x, y, size := state.tm[4], state.tm[5], state.userSize()
+		for _, code := range state.font.split(text) {
+			decoded.WriteString(state.font.text(code))
+			tx := state.font.width(code)/1000*state.fontSize + state.charSpace
+			if len(code) == 1 && code[0] == ' ' {
+				tx += state.wordSpace
+			}
+			state.advance(tx * state.hScale)
+		}
+		if decoded.Len() > 0 {
+			writer.show(decoded.String(), x, y, size)
+			writer.lastX, writer.lastY, writer.lastSize = state.tm[4], state.tm[5], size
+		}
+	}
+	number := func(i int) float64 {
+		if i < 0 || i >= len(operands) {
+			return 0
+		}
+		value, _ := operands[i].(float64)
+		return value
+	}
+	last := func() interface{} {
+		if len(operands) == 0 {
+			return nil
+		}
+		return operands[len(operands)-1]
+	}
+
+	for {
+		value, err := lexer.readObject()
+		if err != nil {
+			return
+		}
+		op, isOperator := value.(pdfKeyword)
+		if !isOperator {
+			operands = append(operands, value)
+			continue
+		}
+
+		switch op {
+		case "BT":
+			state.tm, state.tlm = pdfIdentity, pdfIdentity
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					state.font = d.loadFont(d.dict(resources["Font"])[name], fonts)
+				}
+				state.fontSize = number(len(operands) - 1)
+			}
+		case "Tc":
+			state.charSpace = number(0)
+		case "Tw":
+			state.wordSpace = number(0)
+		case "Tz":
+			state.hScale = number(0) / 100
+		case "TL":
+			state.leading = number(0)
+		case "Td":
+			state.translate(number(0), number(1))
+		case "TD":
+			state.leading = -number(1)
+			state.translate(number(0), number(1))
+		case "Tm":
+			if len(operands) >= 6 {
+				for i := range state.tlm {
+					state.tlm[i] = number(i)
+				}
+				state.tm = state.tlm
+			}
+		case "T*":
+			state.translate(0, -state.leading)
+		case "Tj":
+			show(last())
+		case "'":
+			state.translate(0, -state.leading)
+			show(last())
+		case "\"":
+			state.wordSpace, state.charSpace = number(0), number(1)
+			state.translate(0, -state.leading)
+			show(last())
+		case "TJ":
+			array, _ := last().(pdfArray)
+			for _, item := range array {
+				if adjustment, ok := item.(float64); ok {
+					state.advance(-adjustment / 1000 * state.fontSize * state.hScale)
+					continue
+				}
+				show(item)
+			}
+		case "Do":
+			if name, ok := last().(pdfName); ok {
+				if form := d.stream(d.dict(resources["XObject"])[name]); form != nil && d.name(form.Dict["Subtype"]) == "Form" {
+					if data, err := d.streamData(form); err == nil {
+						formResources := d.dict(form.Dict["Resources"])
+						if formResources == nil {
+							formResources = resources
+						}
+						d.runContent(data, formResources, writer, fonts, depth+1)
+					}
+				}
+			}
+		case "ID":
+			lexer.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+// skipInlineImage steps over the binary data of an inline image, which ends at "EI"
+func (l *pdfLexer) skipInlineImage() {
+	l.pos++
+	for l.pos+2 <= len(l.data) {
+		if l.data[l.pos] == 'E' && l.data[l.pos+1] == 'I' && isPDFWhitespace(l.data[l.pos-1]) &&
+			(l.pos+2 == len(l.data) || !isPDFRegular(l.data[l.pos+2])) {
+			l.pos += 2
+			return
+		}
+		l.pos++
+	}
+	l.pos = len(l.data)
+}
+
+// loadFont reads a font dictionary once per document
+func (d *pdfDocument) loadFont(value interface{}, cache map[pdfRef]*pdfFont) *pdfFont {
+	ref, isRef := value.(pdfRef)
+	if font, ok := cache[ref]; isRef && ok {
+		return font
+	}
+	dict := d.dict(value)
+	if dict == nil {
+		return nil
+	}
+
+	subtype := d.name(dict["Subtype"])
+	font := &pdfFont{codeLengths: []int{1}, widths: map[int]float64{}, defaultWidth: 500}
+	if subtype == "Type0" {
+		font.codeLengths = []int{2}
+	}
+	if stream := d.stream(dict["ToUnicode"]); stream != nil {
+		if data, err := d.streamData(stream); err == nil {
+			font.parseCMap(data)
+		}
+	}
+	if font.toUnicode == nil && subtype != "Type0" {
+		font.encoding = d.simpleEncoding(dict["Encoding"])
+	}
+	d.loadWidths(font, dict, subtype)
+
+	if isRef {
+		cache[ref] = font
+	}
+	return font
+}
+
+// loadWidths reads /Widths of simple fonts and /W of the descendant of a composite font
+func (d *pdfDocument) loadWidths(font *pdfFont, dict pdfDict, subtype pdfName) {
+	if subtype == "Type0" {
+		descendants := d.array(dict["DescendantFonts"])
+		if len(descendants) == 0 {
+			return
+		}
+		cid := d.dict(descendants[0])
+		font.defaultWidth = 1000
+		if width, ok := d.number(cid["DW"]); ok {
+			font.defaultWidth = width
+		}
+		w := d.array(cid["W"])
+		for i := 0; i < len(w); {
+			first, _ := d.integer(w[i])
+			if i+1 < len(w) {
+				if list := d.array(w[i+1]); list != nil {
+					for j, width := range list {
+						font.widths[first+j], _ = d.number(width)
+					}
+					i += 2
+					continue
+				}
+			}
+			if i+2 >= len(w) {
+				break
+			}
+			lastCode, _ := d.integer(w[i+1])
+			width, _ := d.number(w[i+2])
+			for code := first; code <= lastCode && code-first < 65536; code++ {
+				font.widths[code] = width
+			}
+			i += 3
+		}
+		return
+	}
+
+	scale := 1.0
+	if subtype == "Type3" {
+		if matrix := d.array(dict["FontMatrix"]); len(matrix) > 0 {
+			value, _ := d.number(matrix[0])
+			scale = value * 1000
+		}
+	}
+	if descriptor := d.dict(dict["FontDescriptor"]); descriptor != nil {
+		if width, ok := d.number(descriptor["MissingWidth"]); ok && width > 0 {
+			font.defaultWidth = width
+		}
+	}
+	first, _ := d.integer(dict["FirstChar"])
+	for i, width := range d.array(dict["Widths"]) {
+		value, _ := d.number(width)
+		font.widths[first+i] = value * scale
+	}
+	font.defaultWidth *= scale
+}
+
+// split cuts a shown string into character codes
+func (f *pdfFont) split(text pdfString) [][]byte {
+	var codes [][]byte
+	for i := 0; i < len(text); {
+		length := f.codeLengths[0]
+		if f.toUnicode != nil {
+			for _, candidate := range f.codeLengths {
+				if i+candidate <= len(text) {
+					if _, ok := f.toUnicode[string(text[i:i+candidate])]; ok {
+						length = candidate
+						break
+					}
+				}
+			}
+		}
+		if i+length > len(text) {
+			length = len(text) - i
+		}
+		codes = append(codes, text[i:i+length])
+		i += length
+	}
+	return codes
+}
+
+func (f *pdfFont) text(code []byte) string {
+	if f.toUnicode != nil {
+		if text, ok := f.toUnicode[string(code)]; ok {
+			return text
+		}
+	}
+	if f.encoding != nil && len(code) == 1 {
+		return f.encoding[code[0]]
+	}
+	return ""
+}
+
+func (f *pdfFont) width(code []byte) float64 {
+	value := 0
+	for _, b := range code {
+		value = value<<8 | int(b)
+	}
+	if width, ok := f.widths[value]; ok && width > 0 {
+		return width
+	}
+	return f.defaultWidth
+}
+
+// parseCMap reads the codespace ranges and bfchar/bfrange mappings of a ToUnicode CMap
+func (f *pdfFont) parseCMap(data []byte) {
+	lexer := &pdfLexer{data: data}
+	var operands []interface{}
+	lengths := map[int]bool{}
+	mapping := map[string]string{}
+
+	for {
+		value, err := lexer.readObject()
+		if err != nil {
+			break
+		}
+		op, isOperator := value.(pdfKeyword)
+		if !isOperator {
+			operands = append(operands, value)
+			continue
+		}
+		switch op {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				if low, ok := operands[i].(pdfString); ok && len(low) > 0 {
+					lengths[len(low)] = true
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				source, ok1 := operands[i].(pdfString)
+				target, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					mapping[string(source)] = decodeUTF16BE(target)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				low, ok1 := operands[i].(pdfString)
+				high, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(low) != len(high) || len(low) == 0 || len(low) > 4 {
+					continue
+				}
+				first, last := bigEndian(low), bigEndian(high)
+				if last < first || last-first > 65535 {
+					continue
+				}
+				for code := first; code <= last; code++ {
+					key := string(bigEndianBytes(code, len(low)))
+					switch target := operands[i+2].(type) {
+					case pdfString:
+						mapping[key] = offsetUTF16BE(target, code-first)
+					case pdfArray:
+						if code-first < len(target) {
+							if item, ok := target[code-first].(pdfString); ok {
+								mapping[key] = decodeUTF16BE(item)
+							}
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+
+	if len(mapping) == 0 {
+		return
+	}
+	f.toUnicode = mapping
+	if len(lengths) > 0 {
+		f.codeLengths = f.codeLengths[:0]
+		for length := 1; length <= 4; length++ {
+			if lengths[length] {
+				f.codeLengths = append(f.codeLengths, length)
+			}
+		}
+	}
+}
+
+func bigEndian(value []byte) int {
+	result := 0
+	for _, b := range value {
+		result = result<<8 | int(b)
+	}
+	return result
+}
+
+func bigEndianBytes(value, length int) []byte {
+	out := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		out[i] = byte(value)
+		value >>= 8
+	}
+	return out
+}
+
+// decodeUTF16BE decodes a CMap destination, dropping the NULs some producers map glyphs to
+func decodeUTF16BE(value []byte) string {
+	if len(value)%2 == 1 {
+		return strings.Trim(string(value), "\x00")
+	}
+	units := make([]uint16, len(value)/2)
+	for i := range units {
+		units[i] = uint16(value[2*i])<<8 | uint16(value[2*i+1])
+	}
+	return strings.Trim(string(utf16.Decode(units)), "\x00")
+}
+
+// offsetUTF16BE decodes the destination of a bfrange entry for the code offset places after the first
+func offsetUTF16BE(value []byte, offset int) string {
+	if len(value) < 2 {
+		return ""
+	}
+	shifted := append([]byte(nil), value...)
+	last := (int(shifted[len(shifted)-2])<<8 | int(shifted[len(shifted)-1])) + offset
+	shifted[len(shifted)-2], shifted[len(shifted)-1] = byte(last>>8), byte(last)
+	return decodeUTF16BE(shifted)
+}
+
+// simpleEncoding builds the code to text table of a simple font from its /Encoding, defaulting
+// to WinAnsi
+func (d *pdfDocument) simpleEncoding(value interface{}) *[256]string {
+	base := pdfName("WinAnsiEncoding")
+	var differences pdfArray
+	switch encoding := d.resolve(value).(type) {
+	case pdfName:
+		base = encoding
+	case pdfDict:
+		if name := d.name(encoding["BaseEncoding"]); name != "" {
+			base = name
+		}
+		differences = d.array(encoding["Differences"])
+	}
+
+	table := new([256]string)
+	codepage := charmap.Windows1252
+	if base == "MacRomanEncoding" {
+		codepage = charmap.Macintosh
+	}
+	for code := 32; code < 256; code++ {
+		if r := codepage.DecodeByte(byte(code)); r != utf8.RuneError {
+			table[code] = string(r)
+		}
+	}
+
+	code := 0
+	for _, item := range differences {
+		switch value := d.resolve(item).(type) {
+		case float64:
+			code = int(value)
+		case pdfName:
+			if code >= 0 && code < 256 {
+				table[code] = glyphText(string(value))
+			}
+			code++
+		}
+	}
+	return table
+}
+
+// Accents as they appear in glyph names, for names such as "ecircumflexacute" (ế)
+var glyphAccents = []struct {
+	suffix string
+	mark   rune
+}{
+	{"circumflex", 0x0302}, {"hookabove", 0x0309}, {"dotbelow", 0x0323}, {"dieresis", 0x0308},
+	{"cedilla", 0x0327}, {"macron", 0x0304}, {"grave", 0x0300}, {"acute", 0x0301}, {"tilde", 0x0303},
+	{"breve", 0x0306}, {"horn", 0x031B}, {"caron", 0x030C}, {"ring", 0x030A},
+}
+
+var glyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$", "percent": "%",
+	"ampersand": "&", "quotesingle": "'", "parenleft": "(", "parenright": ")", "asterisk": "*",
+	"plus": "+", "comma": ",", "hyphen": "-", "period": ".", "slash": "/", "colon": ":",
+	"semicolon": ";", "less": "<", "equal": "=", "greater": ">", "question": "?", "at": "@",
+	"bracketleft": "[", "backslash": "\\", "bracketright": "]", "asciicircum": "^", "underscore": "_",
+	"grave": "`", "braceleft": "{", "bar": "|", "braceright": "}", "asciitilde": "~",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4", "five": "5", "six": "6",
+	"seven": "7", "eight": "8", "nine": "9", "quoteleft": "‘", "quoteright": "’",
+	"quotedblleft": "“", "quotedblright": "”", "endash": "–", "emdash": "—", "bullet": "•",
+	"ellipsis": "…", "degree": "°", "section": "§", "fi": "fi", "fl": "fl", "nbspace": " ",
+	"dcroat": "đ", "Dcroat": "Đ", "dmacron": "đ", "Dslash": "Đ", "dslash": "đ",
+}
+
+// glyphText maps a glyph name from /Differences to text, following the Adobe glyph list
+// conventions for the names Vietnamese fonts use
+func glyphText(name string) string {
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+	if text, ok := glyphNames[name]; ok {
+		return text
+	}
+	if len(name) == 1 {
+		return name
+	}
+	if strings.HasPrefix(name, "uni") && len(name) >= 7 {
+		if value, err := strconv.ParseUint(name[3:7], 16, 32); err == nil {
+			return string(rune(value))
+		}
+	}
+	if strings.HasPrefix(name, "u") && len(name) >= 5 && len(name) <= 7 {
+		if value, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return string(rune(value))
+		}
+	}
+
+	// A letter followed by accent names, composed later by NFC normalisation
+	letter := name[0]
+	if !(letter >= 'a' && letter <= 'z' || letter >= 'A' && letter <= 'Z') {
+		return ""
+	}
+	text := []rune{rune(letter)}
+	rest := name[1:]
+	for rest != "" {
+		matched := false
+		for _, accent := range glyphAccents {
+			if strings.HasPrefix(rest, accent.suffix) {
+				text = append(text, accent.mark)
+				rest = rest[len(accent.suffix):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return ""
+		}
+	}
+	return string(text)
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testPDF assembles a PDF from object bodies numbered from 1, the first being the catalog
+func testPDF(objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+// testStream writes a stream object, compressed with FlateDecode when flate is set
+func testStream(dict string, data []byte, flate bool) string {
+	if flate {
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		w.Write(data)
+		w.Close()
+		data = compressed.Bytes()
+		dict += " /Filter /FlateDecode"
+	}
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// testPagePDF is a one page PDF showing content with font F1
+func testPagePDF(font string, content []byte, extra ...string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+		font,
+		testStream("", content, true),
+	}
+	return testPDF(append(objects, extra...)...)
+}
+
+func TestExtractPDFTextFlateDecode(t *testing.T) {
+	data := testPagePDF("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		[]byte("BT /F1 12 Tf 72 720 Td (Hello world) Tj 0 -14 Td [(Second) -250 (line)] TJ ET"))
+
+	text, err := extractPDFText(data)
+	if err != nil {
+		t.Fatalf("extractPDFText: %v", err)
+	}
+	if want := "Hello world\nSecond line"; text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+}
+
+func TestExtractPDFTextToUnicodeVietnamese(t *testing.T) {
+	const want = "Cộng hoà xã hội chủ nghĩa Việt Nam - Số 15/2024"
+
+	// Digits map through a bfrange, every other character through bfchar, as subset fonts do
+	codes := map[rune]int{}
+	var shown, bfchar bytes.Buffer
+	for _, r := range want {
+		if r >= '0' && r <= '9' {
+			fmt.Fprintf(&shown, "%04X", 0x100+int(r-'0'))
+			continue
+		}
+		code, ok := codes[r]
+		if !ok {
+			code = len(codes) + 1
+			codes[r] = code
+			fmt.Fprintf(&bfchar, "<%04X> <%04X>\n", code, r)
+		}
+		fmt.Fprintf(&shown, "%04X", code)
+	}
+	cmap := fmt.Sprintf(`/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/CMapName /Adobe-Identity-UCS def
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+%d beginbfchar
+%sendbfchar
+1 beginbfrange
+<0100> <0109> <0030>
+endbfrange
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end`, len(codes), bfchar.String())
+
+	data := testPagePDF("<< /Type /Font /Subtype /Type0 /BaseFont /TimesNewRoman /Encoding /Identity-H /DescendantFonts [7 0 R] /ToUnicode 6 0 R >>",
+		[]byte("BT /F1 13 Tf 1 0 0 1 60 780 Tm <"+shown.String()+"> Tj ET"),
+		testStream("", []byte(cmap), true),
+		"<< /Type /Font /Subtype /CIDFontType2 /BaseFont /TimesNewRoman /DW 500 >>")
+
+	text, err := extractPDFText(data)
+	if err != nil {
+		t.Fatalf("extractPDFText: %v", err)
+	}
+	if text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+}
+
+func TestExtractPDFTextMalformed(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":         nil,
+		"not a PDF":     []byte("<html>Công văn</html>"),
+		"header only":   []byte("%PDF-1.7\n"),
+		"unterminated":  []byte("%PDF-1.7\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R"),
+		"no page":       testPDF("<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Kids [] /Count 0 >>"),
+		"broken stream": []byte("%PDF-1.7\n1 0 obj\n<< /Length 100 >>\nstream\nabc"),
+	} {
+		if text, err := extractPDFText(data); err == nil {
+			t.Errorf("%s: got %q and no error", name, text)
+		}
+	}
+}
+
+func TestExtractPDFTextTruncated(t *testing.T) {
+	data := testPagePDF("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		[]byte("BT /F1 12 Tf 72 720 Td (Truncated file) Tj ET"))
+	page := bytes.Index(data, []byte("3 0 obj"))
+	pageEnd := page + bytes.Index(data[page:], []byte(">>\nendobj")) + len(">>")
+
+	// Every cut must be survived; one made before the page dictionary is complete must be refused
+	for n := 0; n < len(data); n++ {
+		text, err := extractPDFText(data[:n])
+		if n < pageEnd && err == nil {
+			t.Fatalf("cut at %d of %d: got %q and no error", n, len(data), text)
+		}
+		if err == nil && text != "" && !strings.HasPrefix("Truncated file", text) {
+			t.Fatalf("cut at %d of %d: got %q", n, len(data), text)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Writing PDF objects back out and appending them to a file as an incremental update (ISO 32000
+// 7.5.6): the original bytes stay untouched, so signatures already in the file remain valid.
+
+// writePDFObject serialises a parsed value; strings are written as hex so no escaping is needed
+func writePDFObject(buf *bytes.Buffer, value interface{}) {
+	switch value := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(value))
+	case int:
+		buf.WriteString(strconv.Itoa(value))
+	case float64:
+		if value == math.Trunc(value) && math.Abs(value) < 1e15 {
+			buf.WriteString(strconv.FormatInt(int64(value), 10))
+		} else {
+			buf.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+		}
+	case pdfName:
+		buf.WriteByte('/')
+		for i := 0; i < len(value); i++ {
+			if b := value[i]; b > 0x20 && b < 0x7F && b != '#' && !isPDFDelimiter(b) {
+				buf.WriteByte(b)
+			} else {
+				fmt.Fprintf(buf, "#%02X", b)
+			}
+		}
+	case pdfString:
+		buf.WriteByte('<')
+		buf.WriteString(hex.EncodeToString(value))
+		buf.WriteByte('>')
+	case pdfKeyword:
+		buf.WriteString(string(value))
+	case pdfRef:
+		fmt.Fprintf(buf, "%d %d R", value.Num, value.Gen)
+	case pdfArray:
+		buf.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writePDFObject(buf, item)
+		}
+		buf.WriteByte(']')
+	case pdfDict:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, string(key))
+		}
+		sort.Strings(keys)
+		buf.WriteString("<<")
+		for _, key := range keys {
+			writePDFObject(buf, pdfName(key))
+			buf.WriteByte(' ')
+			writePDFObject(buf, value[pdfName(key)])
+		}
+		buf.WriteString(">>")
+	default:
+		buf.WriteString("null")
+	}
+}
+
+// pdfTextString encodes a text string, as UTF-16BE with a byte order mark unless it is ASCII
+func pdfTextString(text string) pdfString {
+	ascii := true
+	for _, r := range text {
+		if r > 0x7E {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return pdfString(text)
+	}
+	encoded := []byte{0xFE, 0xFF}
+	for _, unit := range utf16.Encode([]rune(text)) {
+		encoded = append(encoded, byte(unit>>8), byte(unit))
+	}
+	return encoded
+}
+
+// copyPDFDict returns a shallow copy of a dictionary, to be changed and written again
+func copyPDFDict(dict pdfDict) pdfDict {
+	copied := make(pdfDict, len(dict))
+	for key, value := range dict {
+		copied[key] = value
+	}
+	return copied
+}
+
+var startXRefPattern = regexp.MustCompile(`startxref\s+(\d+)`)
+
+// pdfUpdate collects the objects of an incremental update appended to a file
+type pdfUpdate struct {
+	doc      *pdfDocument
+	buf      bytes.Buffer
+	offsets  map[int]int
+	gens     map[int]int
+	nextNum  int
+	prevXRef int
+}
+
+func newPDFUpdate(doc *pdfDocument) (*pdfUpdate, error) {
+	matches := startXRefPattern.FindAllSubmatch(doc.data, -1)
+	if len(matches) == 0 {
+		return nil, errors.New("file PDF không có bảng tham chiếu chéo")
+	}
+	prevXRef, _ := strconv.Atoi(string(matches[len(matches)-1][1]))
+	if prevXRef <= 0 || prevXRef >= len(doc.data) {
+		return nil, errors.New("bảng tham chiếu chéo của file PDF không hợp lệ")
+	}
+
+	update := &pdfUpdate{doc: doc, offsets: map[int]int{}, gens: map[int]int{}, prevXRef: prevXRef}
+	for num := range doc.objects {
+		if num >= update.nextNum {
+			update.nextNum = num + 1
+		}
+	}
+	if size, ok := doc.integer(doc.trailer["Size"]); ok && size > update.nextNum {
+		update.nextNum = size
+	}
+
+	update.buf.Grow(len(doc.data) + 64*1024)
+	update.buf.Write(doc.data)
+	if !bytes.HasSuffix(doc.data, []byte("\n")) {
+		update.buf.WriteByte('\n')
+	}
+	return update, nil
+}
+
+// newObject reserves the number of a new object
+func (u *pdfUpdate) newObject() pdfRef {
+	ref := pdfRef{Num: u.nextNum}
+	u.nextNum++
+	return ref
+}
+
+// beginObject starts "n g obj" for a new object or a new version of an existing one
+func (u *pdfUpdate) beginObject(ref pdfRef) {
+	u.offsets[ref.Num] = u.buf.Len()
+	u.gens[ref.Num] = ref.Gen
+	fmt.Fprintf(&u.buf, "%d %d obj\n", ref.Num, ref.Gen)
+}
+
+func (u *pdfUpdate) writeObject(ref pdfRef, value interface{}) {
+	u.beginObject(ref)
+	writePDFObject(&u.buf, value)
+	u.buf.WriteString("\nendobj\n")
+}
+
+func (u *pdfUpdate) writeStream(ref pdfRef, dict pdfDict, data []byte) {
+	dict = copyPDFDict(dict)
+	dict["Length"] = len(data)
+	u.beginObject(ref)
+	writePDFObject(&u.buf, dict)
+	u.buf.WriteString("\nstream\n")
+	u.buf.Write(data)
+	u.buf.WriteString("\nendstream\nendobj\n")
+}
+
+// finish writes the cross-reference section and trailer of the update, as a table or as a stream
+// to match the file's last section, and returns the updated file
+func (u *pdfUpdate) finish() []byte {
+	trailer := pdfDict{"Root": u.doc.trailer["Root"], "Prev": u.prevXRef}
+	for _, key := range []pdfName{"Info", "ID"} {
+		if value, ok := u.doc.trailer[key]; ok {
+			trailer[key] = value
+		}
+	}
+
+	if bytes.HasPrefix(u.doc.data[u.prevXRef:], []byte("xref")) {
+		nums := u.sortedNums()
+		xref := u.buf.Len()
+		u.buf.WriteString("xref\n")
+		for _, section := range xrefSections(nums) {
+			fmt.Fprintf(&u.buf, "%d %d\n", section[0], len(section))
+			for _, num := range section {
+				fmt.Fprintf(&u.buf, "%010d %05d n\r\n", u.offsets[num], u.gens[num])
+			}
+		}
+		trailer["Size"] = u.nextNum
+		u.buf.WriteString("trailer\n")
+		writePDFObject(&u.buf, trailer)
+		fmt.Fprintf(&u.buf, "\nstartxref\n%d\n%%%%EOF\n", xref)
+		return u.buf.Bytes()
+	}
+
+	// A cross-reference stream lists itself too
+	ref := u.newObject()
+	xref := u.buf.Len()
+	u.offsets[ref.Num] = xref
+	nums := u.sortedNums()
+	var index pdfArray
+	var entries bytes.Buffer
+	for _, section := range xrefSections(nums) {
+		index = append(index, section[0], len(section))
+		for _, num := range section {
+			entries.WriteByte(1)
+			binary.Write(&entries, binary.BigEndian, uint32(u.offsets[num]))
+			binary.Write(&entries, binary.BigEndian, uint16(u.gens[num]))
+		}
+	}
+	trailer["Type"] = pdfName("XRef")
+	trailer["Size"] = u.nextNum
+	trailer["Index"] = index
+	trailer["W"] = pdfArray{1, 4, 2}
+	u.writeStream(ref, trailer, entries.Bytes())
+	fmt.Fprintf(&u.buf, "startxref\n%d\n%%%%EOF\n", xref)
+	return u.buf.Bytes()
+}
+
+func (u *pdfUpdate) sortedNums() []int {
+	nums := make([]int, 0, len(u.offsets))
+	for num := range u.offsets {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// xrefSections groups sorted object numbers into runs of consecutive numbers
+func xrefSections(nums []int) [][]int {
+	var sections [][]int
+	for i, num := range nums {
+		if i == 0 || num != nums[i-1]+1 {
+			sections = append(sections, nil)
+		}
+		sections[len(sections)-1] = append(sections[len(sections)-1], num)
+	}
+	return sections
+}
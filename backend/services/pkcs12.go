@@ -0,0 +1,268 @@
+package services
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// Reading the certificate and private key of a PKCS#12 (.p12/.pfx) file. golang.org/x/crypto/pkcs12
+// reads the legacy encryptions Windows and older OpenSSL write; files protected with PBES2 and AES,
+// the default since OpenSSL 3, are decoded here.
+
+var errPKCS12Password = errors.New("sai mật khẩu file chứng thư số")
+
+// decodePKCS12 returns the private key, the certificate matching it and the other certificates
+// of the file, normally the chain up to the CA
+func decodePKCS12(data []byte, password string) (crypto.Signer, *x509.Certificate, []*x509.Certificate, error) {
+	var keys []interface{}
+	var certificates []*x509.Certificate
+
+	blocks, err := pkcs12.ToPEM(data, password)
+	switch err.(type) {
+	case nil:
+		for _, block := range blocks {
+			switch block.Type {
+			case "CERTIFICATE":
+				if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+					certificates = append(certificates, cert)
+				}
+			case "PRIVATE KEY":
+				// ToPEM writes RSA keys as PKCS#1 and EC keys as SEC 1 under this type
+				if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+					keys = append(keys, key)
+				} else if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+					keys = append(keys, key)
+				}
+			}
+		}
+	case pkcs12.NotImplementedError:
+		if keys, certificates, err = decodePBES2PKCS12(data, password); err != nil {
+			return nil, nil, nil, err
+		}
+	default:
+		if err == pkcs12.ErrIncorrectPassword {
+			return nil, nil, nil, errPKCS12Password
+		}
+		return nil, nil, nil, fmt.Errorf("không đọc được file chứng thư số: %v", err)
+	}
+
+	for _, key := range keys {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			continue
+		}
+		public, err := x509.MarshalPKIXPublicKey(signer.Public())
+		if err != nil {
+			continue
+		}
+		for i, cert := range certificates {
+			if bytes.Equal(cert.RawSubjectPublicKeyInfo, public) {
+				chain := append(append([]*x509.Certificate{}, certificates[:i]...), certificates[i+1:]...)
+				return signer, cert, chain, nil
+			}
+		}
+	}
+	return nil, nil, nil, errors.New("file chứng thư số không có khóa bí mật khớp với chứng thư")
+}
+
+var (
+	oidPKCS7Data          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS7EncryptedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidKeyBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidShroudedKeyBag     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidPBES2              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+)
+
+// PBKDF2 pseudo-random functions and AES-CBC key sizes by OID
+var (
+	pbkdf2PRFs = map[string]func() hash.Hash{
+		"1.2.840.113549.2.7":  sha1.New,
+		"1.2.840.113549.2.9":  sha256.New,
+		"1.2.840.113549.2.10": sha512.New384,
+		"1.2.840.113549.2.11": sha512.New,
+	}
+	aesCBCKeySizes = map[string]int{
+		"2.16.840.1.101.3.4.1.2":  16,
+		"2.16.840.1.101.3.4.1.22": 24,
+		"2.16.840.1.101.3.4.1.42": 32,
+	}
+)
+
+type pkcs12PFX struct {
+	Version  int
+	AuthSafe cmsContentInfo
+	MacData  asn1.RawValue `asn1:"optional"`
+}
+
+type pkcs12SafeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue `asn1:"explicit,tag:0"`
+	Attributes asn1.RawValue `asn1:"optional"`
+}
+
+type pkcs12EncryptedData struct {
+	Version              int
+	EncryptedContentInfo struct {
+		ContentType                asn1.ObjectIdentifier
+		ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+		EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+	}
+}
+
+type pkcs12EncryptedKey struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// decodePBES2PKCS12 walks the safes of a PKCS#12 file encrypted with PBES2. The MAC is not checked;
+// a wrong password shows as bad padding or a key that does not parse.
+func decodePBES2PKCS12(data []byte, password string) ([]interface{}, []*x509.Certificate, error) {
+	var pfx pkcs12PFX
+	if _, err := asn1.Unmarshal(data, &pfx); err != nil {
+		return nil, nil, fmt.Errorf("không đọc được file chứng thư số: %v", err)
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidPKCS7Data) {
+		return nil, nil, errors.New("file chứng thư số không được hỗ trợ")
+	}
+	var authSafeData []byte
+	if _, err := asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafeData); err != nil {
+		return nil, nil, fmt.Errorf("không đọc được file chứng thư số: %v", err)
+	}
+	var safes []cmsContentInfo
+	if _, err := asn1.Unmarshal(authSafeData, &safes); err != nil {
+		return nil, nil, fmt.Errorf("không đọc được file chứng thư số: %v", err)
+	}
+
+	var keys []interface{}
+	var certificates []*x509.Certificate
+	for _, safe := range safes {
+		var contents []byte
+		switch {
+		case safe.ContentType.Equal(oidPKCS7Data):
+			if _, err := asn1.Unmarshal(safe.Content.Bytes, &contents); err != nil {
+				return nil, nil, fmt.Errorf("không đọc được file chứng thư số: %v", err)
+			}
+		case safe.ContentType.Equal(oidPKCS7EncryptedData):
+			var encrypted pkcs12EncryptedData
+			if _, err := asn1.Unmarshal(safe.Content.Bytes, &encrypted); err != nil {
+				return nil, nil, fmt.Errorf("không đọc được file chứng thư số: %v", err)
+			}
+			info := encrypted.EncryptedContentInfo
+			var err error
+			if contents, err = decryptPBES2(info.ContentEncryptionAlgorithm, info.EncryptedContent.Bytes, password); err != nil {
+				return nil, nil, err
+			}
+		default:
+			continue
+		}
+
+		var bags []pkcs12SafeBag
+		if _, err := asn1.Unmarshal(contents, &bags); err != nil {
+			return nil, nil, errPKCS12Password
+		}
+		for _, bag := range bags {
+			switch {
+			case bag.ID.Equal(oidCertBag):
+				var certBag struct {
+					ID    asn1.ObjectIdentifier
+					Value []byte `asn1:"explicit,tag:0"`
+				}
+				if _, err := asn1.Unmarshal(bag.Value.Bytes, &certBag); err == nil && certBag.ID.Equal(oidX509Certificate) {
+					if cert, err := x509.ParseCertificate(certBag.Value); err == nil {
+						certificates = append(certificates, cert)
+					}
+				}
+			case bag.ID.Equal(oidKeyBag):
+				if key, err := x509.ParsePKCS8PrivateKey(bag.Value.Bytes); err == nil {
+					keys = append(keys, key)
+				}
+			case bag.ID.Equal(oidShroudedKeyBag):
+				var encrypted pkcs12EncryptedKey
+				if _, err := asn1.Unmarshal(bag.Value.Bytes, &encrypted); err != nil {
+					continue
+				}
+				plain, err := decryptPBES2(encrypted.Algorithm, encrypted.EncryptedData, password)
+				if err != nil {
+					return nil, nil, err
+				}
+				key, err := x509.ParsePKCS8PrivateKey(plain)
+				if err != nil {
+					return nil, nil, errPKCS12Password
+				}
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, certificates, nil
+}
+
+// decryptPBES2 undoes PBES2 (RFC 8018) with PBKDF2 and AES-CBC
+func decryptPBES2(algorithm pkix.AlgorithmIdentifier, data []byte, password string) ([]byte, error) {
+	if !algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("thuật toán mã hoá %s của file chứng thư số không được hỗ trợ", algorithm.Algorithm)
+	}
+	var params struct {
+		KeyDerivation pkix.AlgorithmIdentifier
+		Encryption    pkix.AlgorithmIdentifier
+	}
+	if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil || !params.KeyDerivation.Algorithm.Equal(oidPBKDF2) {
+		return nil, errors.New("tham số mã hoá của file chứng thư số không được hỗ trợ")
+	}
+	var kdf struct {
+		Salt       []byte
+		Iterations int
+		KeyLength  int                      `asn1:"optional"`
+		PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+	}
+	if _, err := asn1.Unmarshal(params.KeyDerivation.Parameters.FullBytes, &kdf); err != nil {
+		return nil, errors.New("tham số mã hoá của file chứng thư số không được hỗ trợ")
+	}
+	prf := sha1.New
+	if len(kdf.PRF.Algorithm) > 0 {
+		var ok bool
+		if prf, ok = pbkdf2PRFs[kdf.PRF.Algorithm.String()]; !ok {
+			return nil, fmt.Errorf("hàm dẫn xuất khóa %s không được hỗ trợ", kdf.PRF.Algorithm)
+		}
+	}
+	keySize, ok := aesCBCKeySizes[params.Encryption.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("thuật toán mã hoá %s của file chứng thư số không được hỗ trợ", params.Encryption.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.Encryption.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("tham số mã hoá của file chứng thư số không hợp lệ")
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errPKCS12Password
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(password), kdf.Salt, kdf.Iterations, keySize, prf))
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errPKCS12Password
+	}
+	return plain[:len(plain)-padding], nil
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for the scan inbox, overridden by SCAN_INBOX_INTERVAL_SECONDS and SCAN_INBOX_SETTLE_SECONDS
+const (
+	defaultScanInboxInterval = 30 * time.Second
+	defaultScanInboxSettle   = 10 * time.Second
+)
+
+// ScanInbox turns the files a scanner drops into a folder into draft incoming documents.
+// Processed files are moved to ArchiveDir, rejected ones to ErrorDir next to a note giving the
+// reason. Files that failed for a passing reason, such as the database being down, stay in Dir
+// and are tried again on the next scan.
+type ScanInbox struct {
+	Dir        string
+	ArchiveDir string
+	ErrorDir   string
+	Interval   time.Duration // How often the folder is checked
+	Settle     time.Duration // Files modified more recently are left alone, the scanner may still be writing them
+	Username   string        // Drafts are created in this user's name; empty means the first active secretary
+}
+
+// ScanInboxFromEnv reads the inbox configuration. It returns nil when SCAN_INBOX_DIR is not set.
+func ScanInboxFromEnv() *ScanInbox {
+	dir := os.Getenv("SCAN_INBOX_DIR")
+	if dir == "" {
+		return nil
+	}
+	inbox := &ScanInbox{
+		Dir:        dir,
+		ArchiveDir: os.Getenv("SCAN_INBOX_ARCHIVE_DIR"),
+		ErrorDir:   os.Getenv("SCAN_INBOX_ERROR_DIR"),
+		Interval:   envSeconds("SCAN_INBOX_INTERVAL_SECONDS", defaultScanInboxInterval),
+		Settle:     envSeconds("SCAN_INBOX_SETTLE_SECONDS", defaultScanInboxSettle),
+		Username:   os.Getenv("SCAN_INBOX_USER"),
+	}
+	if inbox.ArchiveDir == "" {
+		inbox.ArchiveDir = filepath.Join(dir, "archive")
+	}
+	if inbox.ErrorDir == "" {
+		inbox.ErrorDir = filepath.Join(dir, "error")
+	}
+	return inbox
+}
+
+func envSeconds(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return fallback
+}
+
+// Start checks the folder in the background until the process exits
+func (s *ScanInbox) Start() {
+	for _, dir := range []string{s.Dir, s.ArchiveDir, s.ErrorDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Printf("Warning: scan inbox disabled, cannot create %s: %v", dir, err)
+			return
+		}
+	}
+	log.Printf("Scan inbox watching %s every %s", s.Dir, s.Interval)
+
+	go func() {
+		for {
+			s.Scan()
+			time.Sleep(s.Interval)
+		}
+	}()
+}
+
+// Scan processes the files waiting in the folder once
+func (s *ScanInbox) Scan() {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		log.Printf("Warning: cannot read scan inbox %s: %v", s.Dir, err)
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < s.Settle {
+			continue
+		}
+
+		path := filepath.Join(s.Dir, entry.Name())
+		documentID, err := s.intake(path, info)
+		if err != nil {
+			if _, rejected := err.(scanRejection); !rejected {
+				log.Printf("Scan inbox: %s will be retried: %v", entry.Name(), err)
+				continue
+			}
+			log.Printf("Scan inbox: %s rejected: %v", entry.Name(), err)
+			s.reject(path, err)
+			continue
+		}
+		if err := moveFile(path, datedPath(s.ArchiveDir, entry.Name())); err != nil {
+			log.Printf("Warning: scan inbox could not archive %s: %v", entry.Name(), err)
+		}
+		log.Printf("Scan inbox: %s registered as draft incoming document %d", entry.Name(), documentID)
+	}
+}
+
+// intakeUser returns the user automatically taken in documents are created by: the named user,
+// or the first active secretary when no name is configured
+func intakeUser(username string) (*models.User, error) {
+	var user models.User
+	query := database.DB.Where("is_active = ?", true)
+	if username != "" {
+		query = query.Where("username = ?", username)
+	} else {
+		query = query.Where("role = ?", models.RoleSecretary).Order("id asc")
+	}
+	if err := query.First(&user).Error; err != nil {
+		return nil, fmt.Errorf("không tìm thấy người dùng tiếp nhận văn bản")
+	}
+	return &user, nil
+}
+
+// scanRejection marks a file that will never be taken in, as opposed to a failure worth retrying
+type scanRejection struct{ error }
+
+// intake creates a draft incoming document for a scanned file and attaches the file to it
+func (s *ScanInbox) intake(path string, info os.FileInfo) (uint, error) {
+	user, err := intakeUser(s.Username)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	fileService := NewFileService()
+	header := &multipart.FileHeader{Filename: info.Name(), Size: info.Size()}
+	if err := fileService.ValidateFile(file, header, DocumentUploadConfig); err != nil {
+		return 0, scanRejection{err}
+	}
+
+	// UploadFile hands back the stored copy of a file it has seen before, which would leave the
+	// draft without a file of its own
+	fileHash, err := fileService.HashFile(file)
+	if err != nil {
+		return 0, err
+	}
+	var existing FileInfo
+	if err := database.DB.Table("files").Where("file_hash = ? AND document_type = ? AND deleted_at IS NULL", fileHash, "incoming").
+		First(&existing).Error; err == nil {
+		return 0, scanRejection{fmt.Errorf("file trùng với file đã đính kèm văn bản đến #%d", existing.DocumentID)}
+	}
+
+	now := time.Now()
+	document := models.IncomingDocument{
+		ArrivalDate:   now,
+		DocumentDate:  now,
+		Status:        models.IncomingStatusDraft,
+		InternalNotes: "Văn bản quét: " + info.Name(),
+		CreatedByID:   user.ID,
+	}
+	// The draft and its file are created together, so a failure leaves neither behind and the
+	// source file stays in the inbox to be tried again
+	tx := database.DB.Begin()
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+	if err := tx.Create(&document).Error; err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("không thể tạo văn bản nháp: %v", err)
+	}
+	fileInfo, err := fileService.storeFile(tx, file, header, DocumentUploadConfig, user.ID, fileHash, "incoming", document.ID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	document.FilePath = fileInfo.FilePath
+	if err := tx.Model(&document).UpdateColumn("file_path", fileInfo.FilePath).Error; err != nil {
+		tx.Rollback()
+		fileService.RemoveStoredFile(fileInfo)
+		return 0, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		fileService.RemoveStoredFile(fileInfo)
+		return 0, fmt.Errorf("không thể tạo văn bản nháp: %v", err)
+	}
+	fileService.AfterFileSaved(fileInfo)
+
+	NewAuditService().LogSystemActivity(user.ID, models.AuditActionDocumentCreate, models.AuditEntityIncomingDocument, document.ID,
+		fmt.Sprintf("Tạo văn bản đến nháp từ file quét %s", info.Name()),
+		map[string]interface{}{"source": "scan_inbox", "file": info.Name(), "file_path": fileInfo.FilePath})
+	return document.ID, nil
+}
+
+// reject moves a file that could not be taken in to the error folder, with the reason beside it
+func (s *ScanInbox) reject(path string, reason error) {
+	target := datedPath(s.ErrorDir, filepath.Base(path))
+	if err := moveFile(path, target); err != nil {
+		log.Printf("Warning: scan inbox could not move %s to the error folder: %v", path, err)
+		return
+	}
+	note := fmt.Sprintf("%s\n%s\n", time.Now().Format("2006-01-02 15:04:05"), reason.Error())
+	if err := os.WriteFile(target+".error.txt", []byte(note), 0644); err != nil {
+		log.Printf("Warning: scan inbox could not write the error note for %s: %v", path, err)
+	}
+}
+
+// datedPath places a file in a per-day subfolder, renaming it if the name is already taken
+func datedPath(dir, name string) string {
+	dayDir := filepath.Join(dir, time.Now().Format("2006-01-02"))
+	target := filepath.Join(dayDir, name)
+	if _, err := os.Stat(target); err == nil {
+		ext := filepath.Ext(name)
+		target = filepath.Join(dayDir, fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), time.Now().UnixNano(), ext))
+	}
+	return target
+}
+
+// moveFile renames a file, copying it when the target is on another file system
+func moveFile(source, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(source, target); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(target)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(source)
+}
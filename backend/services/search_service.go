@@ -0,0 +1,235 @@
+package services
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Entity types searched by Search, in the order results are grouped
+const (
+	SearchIncomingDocuments = "incoming_documents"
+	SearchOutgoingDocuments = "outgoing_documents"
+	SearchTasks             = "tasks"
+	SearchComments          = "comments"
+	SearchFiles             = "files"
+)
+
+var SearchEntityTypes = []string{SearchIncomingDocuments, SearchOutgoingDocuments, SearchTasks, SearchComments, SearchFiles}
+
+// ts_headline marks matches with control characters, so the highlight can be HTML escaped
+// before they become <mark> tags
+const searchHeadlineOptions = "StartSel=\x02, StopSel=\x03, MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=\" … \""
+
+// SearchResult is one hit. Comments and files also say where they belong.
+type SearchResult struct {
+	ID           uint       `json:"id"`
+	Title        string     `json:"title"`
+	Number       string     `json:"number,omitempty"`
+	Date         *time.Time `json:"date,omitempty"`
+	Highlight    string     `json:"highlight"` // HTML, matches wrapped in <mark>
+	Rank         float64    `json:"rank"`
+	TaskID       *uint      `json:"task_id,omitempty"`
+	DocumentType string     `json:"document_type,omitempty"`
+	DocumentID   *uint      `json:"document_id,omitempty"`
+	FilePath     string     `json:"file_path,omitempty"`
+}
+
+// SearchGroup holds a page of the hits of one entity type, best first
+type SearchGroup struct {
+	Total   int            `json:"total"`
+	Results []SearchResult `json:"results"`
+}
+
+// searchSource describes how one entity type is searched. vector must call search_vector with
+// the same arguments as the GIN index of 008_full_text_search.sql, or the index is not used.
+type searchSource struct {
+	table    string
+	vector   string
+	document string // Text the highlight is cut from
+	columns  string // Selected as the SearchResult fields
+	joins    string
+	scope    func(query *gorm.DB, userID uint, role string) *gorm.DB
+}
+
+var searchSources = map[string]searchSource{
+	SearchIncomingDocuments: {
+		table:    "incoming_documents",
+		vector:   "search_vector(incoming_documents.original_number, incoming_documents.summary, incoming_documents.internal_notes)",
+		document: "concat_ws(' ', incoming_documents.summary, incoming_documents.internal_notes)",
+		columns:  "incoming_documents.id, incoming_documents.summary AS title, incoming_documents.original_number AS number, incoming_documents.arrival_date AS date",
+		scope: func(query *gorm.DB, userID uint, role string) *gorm.DB {
+			return ScopeVisibleIncomingDocuments(query, userID).Where("incoming_documents.status <> ?", models.IncomingStatusDraft)
+		},
+	},
+	SearchOutgoingDocuments: {
+		table:    "outgoing_documents",
+		vector:   "search_vector(outgoing_documents.document_number, outgoing_documents.summary, outgoing_documents.internal_notes)",
+		document: "concat_ws(' ', outgoing_documents.summary, outgoing_documents.internal_notes)",
+		columns:  "outgoing_documents.id, outgoing_documents.summary AS title, outgoing_documents.document_number AS number, outgoing_documents.issue_date AS date",
+		scope: func(query *gorm.DB, userID uint, role string) *gorm.DB {
+			return ScopeVisibleOutgoingDocuments(query, userID)
+		},
+	},
+	SearchTasks: {
+		table:    "tasks",
+		vector:   "search_vector(tasks.description, tasks.processing_content, tasks.processing_notes)",
+		document: "concat_ws(' ', tasks.description, tasks.processing_content, tasks.processing_notes)",
+		columns:  "tasks.id, left(tasks.description, 200) AS title, tasks.created_at AS date",
+		scope: func(query *gorm.DB, userID uint, role string) *gorm.DB {
+			return scopeClearedTasks(ScopeVisibleTasks(query, userID, role), userID)
+		},
+	},
+	SearchComments: {
+		table:    "comments",
+		vector:   "search_vector(comments.content, '', '')",
+		document: "comments.content",
+		columns:  "comments.id, left(tasks.description, 200) AS title, comments.created_at AS date, comments.task_id",
+		joins:    "JOIN tasks ON tasks.id = comments.task_id AND tasks.deleted_at IS NULL",
+		scope: func(query *gorm.DB, userID uint, role string) *gorm.DB {
+			return scopeClearedTasks(ScopeVisibleTasks(query, userID, role), userID).Where("comments.kind = ?", models.CommentKindUser)
+		},
+	},
+	SearchFiles: {
+		table:    "file_texts",
+		vector:   "search_vector(file_texts.content, '', '')",
+		document: "file_texts.content",
+		columns:  "files.id, files.original_name AS title, files.uploaded_at AS date, files.document_type, files.document_id, files.file_path",
+		joins:    "JOIN files ON files.id = file_texts.file_id AND files.deleted_at IS NULL",
+		scope:    scopeVisibleFiles,
+	},
+}
+
+// Search runs a full-text query over the given entity types, returning for each the total
+// number of hits the user may see and the requested page of them. The query accepts web search
+// syntax: quoted phrases, OR, and -word to exclude. Diacritics are ignored on both sides.
+func Search(query string, entityTypes []string, userID uint, role string, offset, limit int) (map[string]*SearchGroup, error) {
+	groups := make(map[string]*SearchGroup, len(entityTypes))
+	for _, entityType := range entityTypes {
+		source, ok := searchSources[entityType]
+		if !ok {
+			return nil, fmt.Errorf("loại tìm kiếm không hợp lệ: %s", entityType)
+		}
+		group, err := source.search(query, userID, role, offset, limit)
+		if err != nil {
+			return nil, err
+		}
+		groups[entityType] = group
+	}
+	return groups, nil
+}
+
+func (s searchSource) search(query string, userID uint, role string, offset, limit int) (*SearchGroup, error) {
+	tsQuery := "websearch_to_tsquery('vietnamese_unaccent', ?)"
+	base := database.DB.Table(s.table).Where(s.vector+" @@ "+tsQuery, query)
+	if s.joins != "" {
+		base = base.Joins(s.joins)
+	}
+	if s.table != "file_texts" {
+		base = base.Where(s.table + ".deleted_at IS NULL")
+	}
+	base = s.scope(base, userID, role)
+
+	group := &SearchGroup{Results: []SearchResult{}}
+	if err := base.Count(&group.Total).Error; err != nil {
+		return nil, err
+	}
+	if group.Total == 0 || offset >= group.Total {
+		return group, nil
+	}
+
+	if err := base.Select(fmt.Sprintf("%s, ts_rank_cd(%s, %s) AS rank", s.columns, s.vector, tsQuery), query).
+		Order("rank DESC").Order(s.table + ".id DESC").Offset(offset).Limit(limit).Scan(&group.Results).Error; err != nil {
+		return nil, err
+	}
+
+	// Highlights are cut for the page only; ts_headline reads the whole text and is the slow part
+	ids := make([]uint, len(group.Results))
+	for i, result := range group.Results {
+		ids[i] = result.ID
+	}
+	idColumn := s.table + ".id"
+	if s.table == "file_texts" {
+		idColumn = "file_texts.file_id"
+	}
+	var highlights []struct {
+		ID        uint
+		Highlight string
+	}
+	if err := database.DB.Table(s.table).
+		Select(fmt.Sprintf("%s AS id, ts_headline('vietnamese_unaccent', %s, %s, ?) AS highlight", idColumn, s.document, tsQuery), query, searchHeadlineOptions).
+		Where(idColumn+" IN (?)", ids).Scan(&highlights).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]string, len(highlights))
+	for _, highlight := range highlights {
+		byID[highlight.ID] = markHighlight(highlight.Highlight)
+	}
+	for i := range group.Results {
+		group.Results[i].Highlight = byID[group.Results[i].ID]
+	}
+	return group, nil
+}
+
+// markHighlight escapes a headline and turns its match markers into <mark> tags
+func markHighlight(headline string) string {
+	return strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>").Replace(html.EscapeString(headline))
+}
+
+// scopeClearedTasks limits a query on tasks to the tasks without an incoming document or whose
+// document the user may see; ScopeVisibleTasks alone lets secretaries and admins see every task
+func scopeClearedTasks(query *gorm.DB, userID uint) *gorm.DB {
+	visibleIncoming := ScopeVisibleIncomingDocuments(database.DB.Table("incoming_documents").Select("incoming_documents.id"), userID).QueryExpr()
+	return query.Where("tasks.incoming_document_id IS NULL OR tasks.incoming_document_id IN (?)", visibleIncoming)
+}
+
+// scopeVisibleFiles limits a query joined with files to the files the user may open, following
+// FileService.CheckFileAccess: files of classified documents only for those cleared for the
+// document, then public files for everyone, private ones for their uploader and admins, and
+// restricted ones also for the people working on the document
+func scopeVisibleFiles(query *gorm.DB, userID uint, role string) *gorm.DB {
+	db := database.DB
+	visibleIncoming := ScopeVisibleIncomingDocuments(db.Table("incoming_documents").Select("incoming_documents.id"), userID).QueryExpr()
+	visibleOutgoing := ScopeVisibleOutgoingDocuments(db.Table("outgoing_documents").Select("outgoing_documents.id"), userID).QueryExpr()
+	clearedTasks := db.Table("tasks").Select("tasks.id").
+		Where("tasks.incoming_document_id IS NULL OR tasks.incoming_document_id IN (?)", visibleIncoming).QueryExpr()
+
+	query = query.Where(`(files.document_type = 'incoming' AND files.document_id IN (?))
+		OR (files.document_type = 'outgoing' AND files.document_id IN (?))
+		OR (files.document_type = 'task_report' AND files.document_id IN (?))
+		OR (files.document_type = 'comment' AND files.document_id IN (SELECT id FROM comments WHERE task_id IN (?)))
+		OR files.document_type NOT IN ('incoming', 'outgoing', 'task_report', 'comment')`,
+		visibleIncoming, visibleOutgoing, clearedTasks, clearedTasks)
+
+	if role == models.RoleAdmin {
+		return query
+	}
+
+	// Restricted files of tasks are open to the assignee, the creator and team leaders
+	workingTasks := db.Table("tasks").Select("tasks.id").Where("tasks.assigned_to_id = ? OR tasks.created_by_id = ?", userID, userID).QueryExpr()
+	if role == models.RoleTeamLeader {
+		workingTasks = db.Table("tasks").Select("tasks.id").QueryExpr()
+	}
+	restricted := []string{
+		"files.document_type = 'task_report' AND files.document_id IN (?)",
+		"files.document_type = 'comment' AND files.document_id IN (SELECT id FROM comments WHERE task_id IN (?))",
+	}
+	args := []interface{}{userID, workingTasks, workingTasks}
+	if role == models.RoleSecretary {
+		restricted = append(restricted, "files.document_type IN ('incoming', 'outgoing')")
+	} else {
+		restricted = append(restricted,
+			"files.document_type = 'incoming' AND files.document_id IN (SELECT id FROM incoming_documents WHERE processor_id = ? OR created_by_id = ?)",
+			"files.document_type = 'outgoing' AND files.document_id IN (SELECT id FROM outgoing_documents WHERE drafter_id = ? OR approver_id = ? OR created_by_id = ?)",
+			"files.document_type = 'outgoing' AND files.document_id IN (SELECT outgoing_document_id FROM outgoing_approval_steps WHERE approver_id = ?)")
+		args = append(args, userID, userID, userID, userID, userID, userID)
+	}
+
+	return query.Where(fmt.Sprintf(`files.access_level = 'public' OR files.uploaded_by = ?
+		OR (files.access_level = 'restricted' AND ((%s)))`, strings.Join(restricted, ") OR (")), args...)
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LoadSignatureTrustStore reads the CA certificates in PDF_TRUST_STORE_DIR, PEM or DER, one or
+// more per file. It is read again on every verification so new CAs apply without a restart. It
+// returns nil when the directory is not configured or holds no certificate.
+func LoadSignatureTrustStore() *x509.CertPool {
+	dir := os.Getenv("PDF_TRUST_STORE_DIR")
+	if dir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("Warning: cannot read PDF trust store %s: %v", dir, err)
+		return nil
+	}
+
+	roots := x509.NewCertPool()
+	count := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			log.Printf("Warning: cannot read trusted certificate %s: %v", entry.Name(), err)
+			continue
+		}
+		var certificates []*x509.Certificate
+		if bytes.Contains(data, []byte("-----BEGIN")) {
+			for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+				if block.Type != "CERTIFICATE" {
+					continue
+				}
+				if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+					certificates = append(certificates, cert)
+				}
+			}
+		} else if parsed, err := x509.ParseCertificates(data); err == nil {
+			certificates = parsed
+		}
+		if len(certificates) == 0 {
+			log.Printf("Warning: no certificate in trust store file %s", entry.Name())
+		}
+		for _, cert := range certificates {
+			roots.AddCert(cert)
+			count++
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	return roots
+}
+
+// isPDFFile tells whether a stored file is a PDF, by extension or detected type
+func isPDFFile(file FileInfo) bool {
+	return strings.ToLower(filepath.Ext(file.FilePath)) == ".pdf" || file.MimeType == "application/pdf"
+}
+
+// VerifyFileSignatures verifies the signatures of a stored PDF against the trust store and
+// replaces the file's signature rows with the results. Files other than PDFs have none.
+func VerifyFileSignatures(fileID uint) ([]models.FileSignature, error) {
+	return verifyFileSignatures(fileID, LoadSignatureTrustStore())
+}
+
+func verifyFileSignatures(fileID uint, roots *x509.CertPool) ([]models.FileSignature, error) {
+	var file FileInfo
+	if err := database.DB.Table("files").Where("id = ? AND deleted_at IS NULL", fileID).First(&file).Error; err != nil {
+		return nil, err
+	}
+	signatures := []models.FileSignature{}
+	if isPDFFile(file) {
+		data, err := os.ReadFile(file.FilePath)
+		if err != nil {
+			return nil, fmt.Errorf("không đọc được file: %v", err)
+		}
+		signatures = verifyPDFSignatures(data, roots)
+	}
+
+	now := time.Now()
+	tx := database.DB.Begin()
+	if err := tx.Where("file_id = ?", fileID).Delete(&models.FileSignature{}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for i := range signatures {
+		signatures[i].FileID = fileID
+		signatures[i].VerifiedAt = now
+		if err := tx.Create(&signatures[i]).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return signatures, nil
+}
+
+// verifyPDFSignatures verifies every signature of a PDF. A file that cannot be parsed but looks
+// signed gets a single error result rather than passing as unsigned.
+func verifyPDFSignatures(data []byte, roots *x509.CertPool) (results []models.FileSignature) {
+	defer func() {
+		// A malformed file must not take the upload down with it
+		if r := recover(); r != nil {
+			results = []models.FileSignature{{Position: 1, Status: models.FileSignatureError, Error: fmt.Sprintf("file hỏng, không đọc được chữ ký: %v", r)}}
+		}
+	}()
+
+	signatures, err := findPDFSignatures(data)
+	if err != nil {
+		if bytes.Contains(data, []byte("/ByteRange")) {
+			return []models.FileSignature{{Position: 1, Status: models.FileSignatureError, Error: fmt.Sprintf("không đọc được chữ ký: %v", err)}}
+		}
+		return []models.FileSignature{}
+	}
+	results = make([]models.FileSignature, len(signatures))
+	for i, signature := range signatures {
+		results[i] = verifyPDFSignature(data, signature, roots)
+		results[i].Position = i + 1
+	}
+
+	// A signature that stops short of the end of the file was followed by incremental updates.
+	// Updates an intact later signature covers, such as a second signer's, are vouched for by that
+	// signer; otherwise the file was changed after it was signed.
+	signedToEnd := false
+	for i := len(results) - 1; i >= 0; i-- {
+		result := &results[i]
+		if result.CoversWholeDocument {
+			signedToEnd = signedToEnd || result.IntegrityValid
+			continue
+		}
+		if signedToEnd || !result.IntegrityValid {
+			continue
+		}
+		result.Status = models.FileSignatureModified
+		if result.Error == "" {
+			result.Error = "văn bản đã bị sửa đổi sau khi ký"
+		} else {
+			result.Error = "văn bản đã bị sửa đổi sau khi ký; " + result.Error
+		}
+	}
+	return results
+}
+
+// ReverifyAllFileSignatures verifies every stored PDF again in the background, e.g. after a CA
+// was added to the trust store, and returns how many files were queued
+func ReverifyAllFileSignatures() (int, error) {
+	var fileIDs []uint
+	if err := database.DB.Table("files").Where("deleted_at IS NULL AND (mime_type = ? OR lower(file_path) LIKE ?)", "application/pdf", "%.pdf").
+		Order("id").Pluck("id", &fileIDs).Error; err != nil {
+		return 0, err
+	}
+
+	go func() {
+		roots := LoadSignatureTrustStore()
+		failed := 0
+		for _, fileID := range fileIDs {
+			if _, err := verifyFileSignatures(fileID, roots); err != nil {
+				failed++
+				log.Printf("Signature verification: file %d failed: %v", fileID, err)
+			}
+		}
+		log.Printf("Signature verification: %d files verified again, %d failed", len(fileIDs)-failed, failed)
+	}()
+	return len(fileIDs), nil
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"ai-code-agent-backend/database"
+	"ai-code-agent-backend/models"
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	textunicode "golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Extracted text beyond this many bytes is dropped; it is plenty for search and keeps rows small
+const maxExtractedTextSize = 2 * 1024 * 1024
+
+// errTextUnsupported marks files no extractor reads
+var errTextUnsupported = errors.New("định dạng không hỗ trợ trích xuất văn bản")
+
+// Files waiting for extraction. The queue only speeds things up: rows left pending when it is
+// full or the process stops are picked up again by StartTextExtraction.
+var textExtractionQueue chan uint
+
+// StartTextExtraction runs the extraction worker and queues the files that have no text yet,
+// including those uploaded before extraction existed
+func StartTextExtraction() {
+	textExtractionQueue = make(chan uint, 1000)
+	go func() {
+		for fileID := range textExtractionQueue {
+			extractFileText(fileID)
+		}
+	}()
+
+	go func() {
+		var fileIDs []uint
+		if err := database.DB.Raw(`SELECT f.id FROM files f
+			LEFT JOIN file_texts t ON t.file_id = f.id
+			WHERE f.deleted_at IS NULL AND (t.id IS NULL OR t.status = ?)
+			ORDER BY f.id`, models.FileTextPending).Pluck("id", &fileIDs).Error; err != nil {
+			log.Printf("Warning: cannot list files waiting for text extraction: %v", err)
+			return
+		}
+		if len(fileIDs) > 0 {
+			log.Printf("Text extraction: %d files queued", len(fileIDs))
+		}
+		for _, fileID := range fileIDs {
+			textExtractionQueue <- fileID
+		}
+	}()
+}
+
+// QueueTextExtraction marks a file's text as pending and hands it to the worker
+func QueueTextExtraction(fileID uint) {
+	var fileText models.FileText
+	if err := database.DB.Where(models.FileText{FileID: fileID}).
+		Assign(map[string]interface{}{"status": models.FileTextPending, "error": ""}).
+		FirstOrCreate(&fileText).Error; err != nil {
+		log.Printf("Warning: cannot queue text extraction for file %d: %v", fileID, err)
+		return
+	}
+	select {
+	case textExtractionQueue <- fileID:
+	default:
+	}
+}
+
+// extractFileText reads the text of a stored file and records the outcome
+func extractFileText(fileID uint) {
+	var file FileInfo
+	if err := database.DB.Table("files").Where("id = ? AND deleted_at IS NULL", fileID).First(&file).Error; err != nil {
+		database.DB.Where("file_id = ?", fileID).Delete(&models.FileText{})
+		return
+	}
+
+	text, err := ExtractText(file.FilePath, file.MimeType)
+	now := time.Now()
+	updates := map[string]interface{}{"content": text, "error": "", "extracted_at": &now}
+	switch {
+	case err == errTextUnsupported:
+		updates["status"] = models.FileTextUnsupported
+	case err != nil:
+		updates["status"] = models.FileTextFailed
+		updates["error"] = err.Error()
+		log.Printf("Text extraction: file %d (%s) failed: %v", fileID, file.OriginalName, err)
+	case text == "":
+		updates["status"] = models.FileTextEmpty
+	default:
+		updates["status"] = models.FileTextExtracted
+	}
+	if err := database.DB.Model(&models.FileText{}).Where("file_id = ?", fileID).Updates(updates).Error; err != nil {
+		log.Printf("Warning: cannot save extracted text of file %d: %v", fileID, err)
+	}
+}
+
+// ExtractText returns the text of a PDF (its text layer), DOCX or plain text file, normalised
+// to NFC so Vietnamese written with combining marks compares equal to precomposed text
+func ExtractText(path, mimeType string) (text string, err error) {
+	defer func() {
+		// A malformed file must not take the worker down with it
+		if r := recover(); r != nil {
+			text, err = "", fmt.Errorf("file hỏng, không đọc được nội dung: %v", r)
+		}
+	}()
+
+	ext := strings.ToLower(filepath.Ext(path))
+	var extract func([]byte) (string, error)
+	switch {
+	case ext == ".pdf" || mimeType == "application/pdf":
+		extract = extractPDFText
+	case ext == ".docx" || strings.HasPrefix(mimeType, "application/vnd.openxmlformats-officedocument.wordprocessingml"):
+		extract = extractDOCXText
+	case ext == ".txt" || strings.HasPrefix(mimeType, "text/plain"):
+		extract = extractPlainText
+	default:
+		return "", errTextUnsupported
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	text, err = extract(data)
+	if err != nil {
+		return "", err
+	}
+	return cleanExtractedText(text), nil
+}
+
+var (
+	repeatedSpaces   = regexp.MustCompile(`[ \t]+`)
+	repeatedNewlines = regexp.MustCompile(`\n{3,}`)
+)
+
+// cleanExtractedText normalises to NFC, drops control characters and collapses blank runs
+func cleanExtractedText(text string) string {
+	text = norm.NFC.String(text)
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return r
+		case r == '\r' || r == '\f' || r == '\u00a0':
+			return ' '
+		case unicode.IsControl(r) || r == utf8.RuneError:
+			return -1
+		}
+		return r
+	}, text)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(repeatedSpaces.ReplaceAllString(line, " "))
+	}
+	text = strings.TrimSpace(repeatedNewlines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+
+	if len(text) > maxExtractedTextSize {
+		text = truncateText(text, maxExtractedTextSize)
+	}
+	return text
+}
+
+// extractDOCXText reads the body text of a Word document, one line per paragraph
+func extractDOCXText(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("file DOCX không hợp lệ")
+	}
+	var document *zip.File
+	for _, file := range archive.File {
+		if file.Name == "word/document.xml" {
+			document = file
+			break
+		}
+	}
+	if document == nil {
+		return "", fmt.Errorf("file DOCX không có nội dung")
+	}
+	reader, err := document.Open()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	var text strings.Builder
+	decoder := xml.NewDecoder(io.LimitReader(reader, maxPDFStreamSize))
+	inText := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("file DOCX không hợp lệ: %v", err)
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteByte('\t')
+			case "br", "cr":
+				text.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(element)
+			}
+		}
+	}
+	return text.String(), nil
+}
+
+// extractPlainText decodes a text file: UTF-8 or UTF-16 with a byte order mark, otherwise
+// Windows-1258 as saved by older Vietnamese Windows editors
+func extractPlainText(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:]), nil
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		decoded, err := textunicode.UTF16(textunicode.BigEndian, textunicode.UseBOM).NewDecoder().Bytes(data)
+		return string(decoded), err
+	case utf8.Valid(data):
+		return string(data), nil
+	}
+	decoded, err := charmap.Windows1258.NewDecoder().Bytes(data)
+	return string(decoded), err
+}
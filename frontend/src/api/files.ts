@@ -17,6 +17,15 @@ export interface FileInfo {
   uploaded_by?: number;
   order_number?: number;
   summary?: string;
+  text_extraction?: FileTextExtraction;
+}
+
+// Text read from the file for search; only returned by getFileInfo
+export interface FileTextExtraction {
+  status: 'pending' | 'extracted' | 'empty' | 'unsupported' | 'failed';
+  content: string;
+  error?: string;
+  extracted_at?: string;
 }
 
 export interface FileUploadResponse {